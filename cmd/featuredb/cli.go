@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api/proxy"
+	"github.com/abeja-inc/feature-search-db/pkg/client"
+	"github.com/abeja-inc/feature-search-db/pkg/vecio"
+)
+
+// Client subcommands. Running featuredb without a subcommand starts a node.
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"search", "search [flags] [file...]   search vectors and register the new ones", runSearch},
+	{"insert", "insert [flags] [file...]   register vectors without searching", runInsert},
+	{"import", "import [flags] [file]      load a file of vectors into a calc node", runImport},
+	{"export", "export [flags]             write the data points of feature groups as JSON lines or npy", runExport},
+	{"bricks", "bricks [flags]             list bricks", runBricks},
+	{"stat", "stat [flags]               report the health of the cluster", runStat},
+	{"node", "node drain [flags]         move the bricks of a calc node away and stop it", runNode},
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "usage: featuredb [flags]            start a node\n")
+	fmt.Fprintf(os.Stderr, "       featuredb <command> [flags]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %s\n", cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nVectors are read from the files, or stdin when none is given. .npy, .fvecs and .bvecs\n"+
+		"files are read as such, and others as one vector per line as a JSON array,\n"+
+		"{\"id\": ..., \"vals\": [...], \"meta\": {...}} or numbers separated by commas or spaces.\n")
+}
+
+// runCommand runs a subcommand and returns the exit code.
+func runCommand(args []string) int {
+	if args[0] == "help" {
+		printUsage()
+		return 0
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		err := cmd.run(args[1:])
+		if err == flag.ErrHelp {
+			return 2
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "featuredb %s: %v\n", cmd.name, err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "featuredb: unknown command %q\n\n", args[0])
+	printUsage()
+	return 2
+}
+
+type commonFlags struct {
+	addr      *string
+	output    *string
+	timeout   *time.Duration
+	binary    *bool
+	namespace *string
+}
+
+func newFlagSet(name string, defaultAddr string) (*flag.FlagSet, *commonFlags) {
+	fs := flag.NewFlagSet("featuredb "+name, flag.ContinueOnError)
+	cf := &commonFlags{
+		addr:      fs.String("addr", defaultAddr, "base URL of the proxy or calc node"),
+		output:    fs.String("o", "table", "output format (table or json)"),
+		timeout:   fs.Duration("timeout", 30*time.Second, "timeout of each request"),
+		binary:    fs.Bool("binary", true, "send vectors in the binary format"),
+		namespace: fs.String("namespace", "", "namespace of the feature groups (the default namespace when empty)"),
+	}
+	return fs, cf
+}
+
+func (cf *commonFlags) validate() error {
+	if *cf.output != "table" && *cf.output != "json" {
+		return fmt.Errorf("unknown output format %q", *cf.output)
+	}
+	return nil
+}
+
+func (cf *commonFlags) clientOf(addr string) *client.Client {
+	opts := []client.Option{client.WithHTTPClient(&http.Client{Timeout: *cf.timeout})}
+	if *cf.binary {
+		opts = append(opts, client.WithBinaryVectors())
+	}
+	if *cf.namespace != "" {
+		opts = append(opts, client.WithNamespace(*cf.namespace))
+	}
+	return client.New(addr, opts...)
+}
+
+func (cf *commonFlags) client() *client.Client {
+	return cf.clientOf(*cf.addr)
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+}
+
+// eachInput calls fn with a reader of every file, or of stdin when files is empty.
+func eachInput(files []string, fn func(r vecio.Reader) error) error {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, name := range files {
+		err := func() error {
+			if name == "-" {
+				return fn(vecio.NewTextReader(os.Stdin))
+			}
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r, err := vecio.NewReader(vecio.FormatOf(name), f)
+			if err != nil {
+				return err
+			}
+			return fn(r)
+		}()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// eachBatch reads the records of files and calls fn with up to size of them at once.
+// offset is the index of the first record of the batch.
+func eachBatch(files []string, size int, fn func(offset int, recs []vecio.Record) error) error {
+	offset := 0
+	recs := make([]vecio.Record, 0, size)
+	flush := func() error {
+		if len(recs) == 0 {
+			return nil
+		}
+		err := fn(offset, recs)
+		offset += len(recs)
+		recs = recs[:0]
+		return err
+	}
+	err := eachInput(files, func(r vecio.Reader) error {
+		for {
+			rec, err := r.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			recs = append(recs, rec)
+			if len(recs) == size {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+func vectorsOf(recs []vecio.Record) [][512]float64 {
+	vecs := make([][512]float64, len(recs))
+	for i := range recs {
+		vecs[i] = recs[i].Vals
+	}
+	return vecs
+}
+
+// queryResult is a line of the output of search, insert and import.
+type queryResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	proxy.ProxyQueryResult
+	Partial bool `json:"partial"`
+}
+
+// resultPrinter prints the results of every batch in one table or JSON array.
+type resultPrinter struct {
+	json bool
+	tw   *tabwriter.Writer
+	all  []queryResult
+}
+
+func newResultPrinter(cf *commonFlags) *resultPrinter {
+	p := &resultPrinter{json: *cf.output == "json", all: []queryResult{}}
+	if !p.json {
+		p.tw = newTable()
+		fmt.Fprintln(p.tw, "INDEX\tID\tDATA_ID\tDISTANCE\tNEW\tREGISTERED\tPARTIAL")
+	}
+	return p
+}
+
+func (p *resultPrinter) add(offset int, recs []vecio.Record, resp *proxy.ProxyBatchQueryResponse) {
+	for i, res := range resp.Results {
+		r := queryResult{Index: offset + i, ID: recs[i].ID, ProxyQueryResult: res, Partial: resp.Partial}
+		if p.json {
+			p.all = append(p.all, r)
+			continue
+		}
+		fmt.Fprintf(p.tw, "%d\t%s\t%s\t%g\t%v\t%v\t%v\n", r.Index, r.ID, r.DataID, r.Distance, r.IsNew, r.Registered, r.Partial)
+	}
+}
+
+func (p *resultPrinter) close() error {
+	if p.json {
+		return printJSON(p.all)
+	}
+	return p.tw.Flush()
+}
+
+type queryFlags struct {
+	featureGroupID   *int
+	calcMode         *string
+	noveltyThreshold *float64
+	zone             *string
+	batchSize        *int
+}
+
+func newQueryFlags(fs *flag.FlagSet, batchSize int) *queryFlags {
+	return &queryFlags{
+		featureGroupID:   fs.Int("group", 0, "feature group ID"),
+		calcMode:         fs.String("calc_mode", "", "calcMode of the search"),
+		noveltyThreshold: fs.Float64("novelty_threshold", -1, "novelty threshold (the proxy default when negative)"),
+		zone:             fs.String("zone", "", "zone of the nodes to register new data points into"),
+		batchSize:        fs.Int("batch_size", batchSize, "number of vectors per request"),
+	}
+}
+
+func (qf *queryFlags) options() client.SearchOptions {
+	o := client.SearchOptions{CalcMode: *qf.calcMode, Zone: *qf.zone}
+	if *qf.noveltyThreshold >= 0 {
+		o.NoveltyThreshold = qf.noveltyThreshold
+	}
+	return o
+}
+
+func runSearch(args []string) error {
+	fs, cf := newFlagSet("search", "http://127.0.0.1:8084")
+	qf := newQueryFlags(fs, 1000)
+	searchOnly := fs.Bool("search_only", false, "do not register new vectors")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cf.validate(); err != nil {
+		return err
+	}
+	c := cf.client()
+	opts := qf.options()
+	opts.SearchOnly = *searchOnly
+	p := newResultPrinter(cf)
+	err := eachBatch(fs.Args(), *qf.batchSize, func(offset int, recs []vecio.Record) error {
+		resp, err := c.BatchSearch(context.Background(), client.BatchSearchRequest{
+			FeatureGroupID: *qf.featureGroupID,
+			Vectors:        vectorsOf(recs),
+			SearchOptions:  opts,
+		})
+		if err != nil {
+			return err
+		}
+		p.add(offset, recs, resp)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return p.close()
+}
+
+func runInsert(args []string) error {
+	fs, cf := newFlagSet("insert", "http://127.0.0.1:8084")
+	qf := newQueryFlags(fs, 1000)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cf.validate(); err != nil {
+		return err
+	}
+	c := cf.client()
+	p := newResultPrinter(cf)
+	err := eachBatch(fs.Args(), *qf.batchSize, func(offset int, recs []vecio.Record) error {
+		resp, err := c.Register(context.Background(), client.BatchSearchRequest{
+			FeatureGroupID: *qf.featureGroupID,
+			Vectors:        vectorsOf(recs),
+			SearchOptions:  qf.options(),
+		})
+		if err != nil {
+			return fmt.Errorf("vectors %d-%d: %v", offset, offset+len(recs)-1, err)
+		}
+		for i, res := range resp.Results {
+			if !res.Registered {
+				return fmt.Errorf("vector %d was not registered, no brick may have room for it", offset+i)
+			}
+		}
+		p.add(offset, recs, resp)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return p.close()
+}
+
+// nodeAddr returns the base URL of the calc node which has the brick,
+// or "" when the brick was listed by the calc node itself.
+func nodeAddr(b proxy.BrickInfoWithNodeInfo) string {
+	if b.NodeName == "" {
+		return ""
+	}
+	return "http://" + net.JoinHostPort(b.NodeIpAddress, strconv.Itoa(b.NodeApiPort))
+}
+
+func runBricks(args []string) error {
+	fs, cf := newFlagSet("bricks", "http://127.0.0.1:8084")
+	featureGroupID := fs.Int("group", -1, "feature group ID (every group when negative)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cf.validate(); err != nil {
+		return err
+	}
+	bricks, err := cf.client().Bricks(context.Background())
+	if err != nil {
+		return err
+	}
+	filtered := []proxy.BrickInfoWithNodeInfo{}
+	for _, b := range bricks {
+		if *featureGroupID < 0 || b.FeatureGroupID == *featureGroupID {
+			filtered = append(filtered, b)
+		}
+	}
+	if *cf.output == "json" {
+		return printJSON(filtered)
+	}
+	tw := newTable()
+	fmt.Fprintln(tw, "UNIQUE_ID\tBRICK_ID\tGROUP\tNODE\tPOINTS\tCAPACITY")
+	for _, b := range filtered {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\t%d\n", b.UniqueID, b.BrickID, b.FeatureGroupID, b.NodeName, b.NumOfAvailablePoints, b.NumOfBrickTotalCap)
+	}
+	return tw.Flush()
+}
+
+func runStat(args []string) error {
+	fs, cf := newFlagSet("stat", "http://127.0.0.1:8084")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cf.validate(); err != nil {
+		return err
+	}
+	st, err := cf.client().Stat(context.Background())
+	if err != nil {
+		return err
+	}
+	if *cf.output == "json" {
+		return printJSON(st)
+	}
+	nodeNames := make([]string, 0, len(st.Response))
+	for nodeName := range st.Response {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+	tw := newTable()
+	fmt.Fprintf(tw, "%d/%d nodes healthy\n", st.NumOfHealthyNodes, st.NumOfNodes)
+	if st.Usage != nil && st.Quota != nil {
+		fmt.Fprintf(tw, "namespace %s: %d vectors (max %d), %d bytes (max %d)\n", st.Namespace,
+			st.Usage.Vectors, st.Quota.MaxVectors, st.Usage.MemoryBytes, st.Quota.MaxMemoryBytes)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "NODE\tHEALTHY\tZONE\tDRAINING\tBRICKS\tPOINTS\tCAPACITY\tFILL\tLATENCY\tERROR")
+	for _, nodeName := range nodeNames {
+		n := st.Response[nodeName]
+		fmt.Fprintf(tw, "%s\t%v\t%s\t%v\t%d\t%d\t%d\t%.3f\t%s\t%s\n", n.NodeName, n.Success, n.Meta.Zone, n.Meta.Draining,
+			len(n.Bricks), n.NumOfAvailablePoints, n.NumOfBrickTotalCap, n.FillRatio, time.Duration(n.ResponseTime).Round(time.Microsecond), n.Error)
+	}
+	fmt.Fprintln(tw, "\nGROUP\tBRICKS\tNODES\tPOINTS\tCAPACITY\tFILL")
+	for _, g := range st.FeatureGroups {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%.3f\n", g.FeatureGroupID, g.NumOfBricks, g.NumOfNodes, g.NumOfAvailablePoints, g.NumOfBrickTotalCap, g.FillRatio)
+	}
+	return tw.Flush()
+}
+
+func runNode(args []string) error {
+	if len(args) == 0 || args[0] != "drain" {
+		return errors.New("usage: featuredb node drain [flags]")
+	}
+	fs, cf := newFlagSet("node drain", "http://127.0.0.1:8001")
+	fs.Lookup("addr").Usage = "base URL of the state API of the calc node"
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := cf.validate(); err != nil {
+		return err
+	}
+	resp, err := cf.client().Drain(context.Background())
+	if err != nil {
+		return err
+	}
+	if *cf.output == "json" {
+		return printJSON(resp)
+	}
+	tw := newTable()
+	fmt.Fprintln(tw, "UNIQUE_ID\tNODE\tADDRESS")
+	for _, b := range resp.Bricks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", b.UniqueID, b.NodeName, b.Address)
+	}
+	return tw.Flush()
+}
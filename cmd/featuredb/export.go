@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/client"
+	"github.com/abeja-inc/feature-search-db/pkg/vecio"
+)
+
+// idsFileOf is the sidecar of an npy export, with one line per row of the array.
+func idsFileOf(name string) string {
+	return strings.TrimSuffix(name, ".npy") + ".ids.jsonl"
+}
+
+// exportWriter writes exported data points in a format.
+type exportWriter interface {
+	write(dp api.ExportedDataPoint) error
+	close() error
+}
+
+type jsonlExportWriter struct {
+	enc *json.Encoder
+}
+
+func (ew *jsonlExportWriter) write(dp api.ExportedDataPoint) error {
+	return ew.enc.Encode(dp)
+}
+
+func (ew *jsonlExportWriter) close() error {
+	return nil
+}
+
+// npyExportWriter writes vectors to the npy file and everything else to its sidecar.
+type npyExportWriter struct {
+	nw  *vecio.NpyWriter
+	ids *json.Encoder
+}
+
+func (ew *npyExportWriter) write(dp api.ExportedDataPoint) error {
+	if err := ew.nw.Write(dp.Vals); err != nil {
+		return err
+	}
+	dp.Vals = nil
+	return ew.ids.Encode(dp)
+}
+
+func (ew *npyExportWriter) close() error {
+	return ew.nw.Close()
+}
+
+func runExport(args []string) error {
+	fs, cf := newFlagSet("export", "http://127.0.0.1:8084")
+	featureGroupID := fs.Int("group", -1, "feature group ID (every group when negative)")
+	uniqueID := fs.String("brick", "", "uniqueID of a brick to export alone")
+	format := fs.String("format", "", "jsonl or npy (guessed from the extension of -out when empty)")
+	out := fs.String("out", "-", "output file. An npy export also writes <name>.ids.jsonl")
+	useFloat32 := fs.Bool("float32", false, "write npy as float32")
+	withVectors := fs.Bool("vectors", true, "include the vectors in a jsonl export")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cf.validate(); err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = vecio.FormatOf(*out)
+	}
+	if *format != vecio.FormatJSONL && *format != vecio.FormatNpy {
+		return fmt.Errorf("cannot export as %s", *format)
+	}
+	if *format == vecio.FormatNpy && *out == "-" {
+		return errors.New("an npy export needs -out")
+	}
+
+	// The proxy stitches the bricks of the cluster together; a single brick is read from its node.
+	c := cf.client()
+	req := client.ExportRequest{WithoutVectors: *format == vecio.FormatJSONL && !*withVectors}
+	if *featureGroupID >= 0 {
+		req.FeatureGroupID = featureGroupID
+	}
+	if *uniqueID != "" {
+		bricks, err := c.Bricks(context.Background())
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, b := range bricks {
+			if b.UniqueID == *uniqueID {
+				found = true
+				if addr := nodeAddr(b); addr != "" {
+					c = cf.clientOf(addr)
+				}
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("brick %s is not found", *uniqueID)
+		}
+		req.FeatureGroupID = nil
+		req.UniqueIDs = []string{*uniqueID}
+	}
+
+	var ew exportWriter
+	switch {
+	case *format == vecio.FormatNpy:
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		nw, err := vecio.NewNpyFileWriter(f, *useFloat32)
+		if err != nil {
+			return err
+		}
+		ids, err := os.Create(idsFileOf(*out))
+		if err != nil {
+			return err
+		}
+		defer ids.Close()
+		ew = &npyExportWriter{nw: nw, ids: json.NewEncoder(ids)}
+	case *out == "-":
+		ew = &jsonlExportWriter{enc: json.NewEncoder(os.Stdout)}
+	default:
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		ew = &jsonlExportWriter{enc: json.NewEncoder(f)}
+	}
+
+	er, err := c.Export(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	defer er.Close()
+	count := 0
+	for {
+		dp, err := er.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			ew.close()
+			return fmt.Errorf("after %d data points: %v", count, err)
+		}
+		if err := ew.write(dp); err != nil {
+			return err
+		}
+		count += 1
+	}
+	if err := ew.close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d data points exported\n", count)
+	return nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/bulk"
+	"github.com/abeja-inc/feature-search-db/pkg/client"
+	"github.com/abeja-inc/feature-search-db/pkg/vecio"
+)
+
+// encodeRecords encodes records for the import API of calc nodes.
+// JSON lines are used only when IDs or metadata have to be carried.
+func encodeRecords(recs []vecio.Record) ([]byte, string, error) {
+	labeled := false
+	for _, rec := range recs {
+		if rec.ID != "" || rec.Meta != nil {
+			labeled = true
+			break
+		}
+	}
+	buf := bytes.NewBuffer(nil)
+	if labeled {
+		enc := json.NewEncoder(buf)
+		for _, rec := range recs {
+			if err := enc.Encode(rec); err != nil {
+				return nil, "", err
+			}
+		}
+		return buf.Bytes(), vecio.FormatJSONL, nil
+	}
+	nw, err := vecio.NewNpyWriter(buf, len(recs), false)
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range recs {
+		if err := nw.Write(recs[i].Vals[:]); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := nw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), vecio.FormatNpy, nil
+}
+
+func printImportJob(cf *commonFlags, job *api.ImportJobResponse) error {
+	if *cf.output == "json" {
+		return printJSON(job)
+	}
+	tw := newTable()
+	fmt.Fprintln(tw, "SOURCE\tGROUP\tSTATE\tOFFSET\tINSERTED\tBRICKS")
+	fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%d\t%d\n", job.Source, job.FeatureGroupID, job.State, job.Offset, job.Inserted, len(job.Bricks))
+	return tw.Flush()
+}
+
+func reportProgress(job *api.ImportJobResponse) {
+	elapsed := job.UpdatedAt.Sub(job.StartedAt)
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(job.Inserted) / elapsed.Seconds()
+	}
+	fmt.Fprintf(os.Stderr, "%d records done, %d inserted (%s, %.0f records/s)\n", job.Offset, job.Inserted, elapsed.Round(time.Millisecond), rate)
+}
+
+func runImport(args []string) error {
+	fs, cf := newFlagSet("import", "http://127.0.0.1:8081")
+	fs.Lookup("addr").Usage = "base URL of the calc node"
+	featureGroupID := fs.Int("group", 0, "feature group ID")
+	format := fs.String("format", "", "npy, fvecs, bvecs or jsonl (guessed from the extension when empty)")
+	batchSize := fs.Int("batch_size", 5000, "number of records per request, or per insert of a remote import")
+	checkpoint := fs.String("checkpoint", "", "checkpoint file to resume from (<file>.checkpoint by default)")
+	remote := fs.Bool("remote", false, "the file is on the calc node, which imports it in the background")
+	poll := fs.Duration("poll", time.Second, "interval of progress reports of a remote import")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cf.validate(); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("only one file can be imported at a time")
+	}
+	name := "-"
+	if fs.NArg() == 1 {
+		name = fs.Arg(0)
+	}
+	if *format == "" {
+		*format = vecio.FormatOf(name)
+	}
+	if *checkpoint == "" && name != "-" {
+		*checkpoint = name + ".checkpoint"
+	}
+
+	c := cf.client()
+	if *remote {
+		if name == "-" {
+			return errors.New("a remote import needs the path of the file on the calc node")
+		}
+		return importRemote(cf, c, client.ImportRequest{
+			FeatureGroupID: *featureGroupID,
+			Format:         *format,
+			Path:           name,
+			Checkpoint:     *checkpoint,
+			BatchSize:      *batchSize,
+		}, *poll)
+	}
+	return importLocal(cf, c, name, *format, *featureGroupID, *batchSize, *checkpoint)
+}
+
+// importRemote starts a job on the calc node and reports its progress until it ends.
+func importRemote(cf *commonFlags, c *client.Client, req client.ImportRequest, poll time.Duration) error {
+	job, err := c.Import(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	for job.State == api.JobStateRunning {
+		time.Sleep(poll)
+		job, err = c.ImportJob(context.Background(), job.JobID)
+		if err != nil {
+			return err
+		}
+		reportProgress(job)
+	}
+	if err := printImportJob(cf, job); err != nil {
+		return err
+	}
+	if job.State != api.JobStateDone {
+		return fmt.Errorf("import job %s %s: %s", job.JobID, job.State, job.Msg)
+	}
+	return nil
+}
+
+// importLocal reads the file and sends it to the calc node in batches.
+// The checkpoint is saved after every batch, so a failed import is resumed by running it again.
+func importLocal(cf *commonFlags, c *client.Client, name string, format string, featureGroupID int, batchSize int, checkpoint string) error {
+	source := name
+	in := io.Reader(os.Stdin)
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+		if source, err = filepath.Abs(name); err != nil {
+			return err
+		}
+	}
+	r, err := vecio.NewReader(format, in)
+	if err != nil {
+		return err
+	}
+
+	var cp bulk.Checkpoint
+	if checkpoint != "" {
+		if cp, err = bulk.LoadCheckpoint(checkpoint); err != nil {
+			return err
+		}
+		if cp.Source != "" && (cp.Source != source || cp.FeatureGroupID != featureGroupID) {
+			return fmt.Errorf("%s is a checkpoint of another import", checkpoint)
+		}
+		if cp.Offset > 0 {
+			fmt.Fprintf(os.Stderr, "resuming from record %d of %s\n", cp.Offset, checkpoint)
+		}
+	}
+	if err := vecio.Skip(r, cp.Offset); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	job := &api.ImportJobResponse{
+		FeatureGroupID: featureGroupID,
+		Source:         source,
+		Format:         format,
+		Checkpoint:     checkpoint,
+		State:          api.JobStateRunning,
+		Offset:         cp.Offset,
+		Bricks:         []string{},
+		StartedAt:      now,
+		UpdatedAt:      now,
+	}
+	bricks := map[string]bool{}
+	recs := make([]vecio.Record, 0, batchSize)
+	for job.State == api.JobStateRunning {
+		recs = recs[:0]
+		var readErr error
+		for len(recs) < batchSize {
+			rec, err := r.Next()
+			if err != nil {
+				readErr = err
+				break
+			}
+			recs = append(recs, rec)
+		}
+		if readErr != nil && readErr != io.EOF {
+			return fmt.Errorf("record %d: %v", job.Offset+len(recs), readErr)
+		}
+		if readErr == io.EOF {
+			job.State = api.JobStateDone
+		}
+		if len(recs) == 0 {
+			break
+		}
+
+		body, bodyFormat, err := encodeRecords(recs)
+		if err != nil {
+			return err
+		}
+		resp, err := c.Import(context.Background(), client.ImportRequest{
+			FeatureGroupID: featureGroupID,
+			Format:         bodyFormat,
+			Body:           body,
+			BatchSize:      batchSize,
+		})
+		if resp != nil {
+			job.Offset += resp.Offset
+			job.Inserted += resp.Inserted
+			for _, uniqueID := range resp.Bricks {
+				if !bricks[uniqueID] {
+					bricks[uniqueID] = true
+					job.Bricks = append(job.Bricks, uniqueID)
+				}
+			}
+			job.UpdatedAt = time.Now()
+			if checkpoint != "" {
+				if err := bulk.SaveCheckpoint(checkpoint, bulk.Checkpoint{
+					Source:         source,
+					FeatureGroupID: featureGroupID,
+					Offset:         job.Offset,
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("records from %d: %v", job.Offset, err)
+		}
+		reportProgress(job)
+	}
+	return printImportJob(cf, job)
+}
@@ -1,13 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"net"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -15,119 +17,277 @@ import (
 	"github.com/abeja-inc/feature-search-db/pkg/api/proxy"
 	"github.com/abeja-inc/feature-search-db/pkg/api/query"
 	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
 	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/config"
+	"github.com/abeja-inc/feature-search-db/pkg/health"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+	"github.com/abeja-inc/feature-search-db/pkg/reload"
+	"github.com/abeja-inc/feature-search-db/pkg/tracing"
 	"github.com/abeja-inc/feature-search-db/pkg/util"
 
-	"github.com/weaveworks/mesh"
-	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
 )
 
+// Time allowed for in-flight requests to finish on shutdown.
+const shutdownTimeout = 30 * time.Second
+
+// signalError is sent to errs when a signal asks the process to stop.
+type signalError struct {
+	sig os.Signal
+}
+
+func (e signalError) Error() string {
+	return e.sig.String()
+}
+
 func processSignal(errs chan error) {
 	go func(errs chan error) {
-		c := make(chan os.Signal)
-		signal.Notify(c, syscall.SIGINT)
-		errs <- fmt.Errorf("%s", <-c)
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+		errs <- signalError{<-c}
 	}(errs)
 }
 
-func main() {
-	ipAddress, err := util.GetExternalIP()
-	if err != nil {
-		fmt.Printf("Failed to get IPAddress")
+// stopped logs why the node stops and returns the exit code of the process:
+// 0 when a signal or a drain stops it, and 1 when a server has failed, as when its port is in use.
+func stopped(logger *zap.Logger, err error) int {
+	var se signalError
+	if errors.As(err, &se) || errors.Is(err, cluster.ErrDrained) {
+		logger.Info("stopping", zap.Error(err))
+		return 0
+	}
+	logger.Error("stopping on failure", zap.Error(err))
+	return 1
+}
+
+// shutdownCalcNode stops accepting writes, waits for in-flight searches,
+// and then leaves the cluster.
+func shutdownCalcNode(bp *brick.BrickPool, srv *http.Server, grpcSrv *grpc.Server, cl *cluster.Cluster, logger *zap.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	cl.StopWrites(bp)
+	logger.Info("feature api stopping")
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("feature api shutdown", zap.Error(err))
+	}
+	stopGrpcServer(ctx, grpcSrv)
+	// Bricks are kept only in memory, so there is no WAL or snapshot to flush.
+	if err := cl.Shutdown(ctx); err != nil {
+		logger.Error("cluster shutdown", zap.Error(err))
+	}
+}
+
+func shutdownReverseProxy(srv *http.Server, grpcSrv *grpc.Server, cl *cluster.Cluster, logger *zap.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	logger.Info("reverse proxy stopping")
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("reverse proxy shutdown", zap.Error(err))
+	}
+	stopGrpcServer(ctx, grpcSrv)
+	proxy.CloseNodeConns()
+	if err := cl.Shutdown(ctx); err != nil {
+		logger.Error("cluster shutdown", zap.Error(err))
+	}
+}
+
+// stopGrpcServer waits for in-flight RPCs until ctx is done, then closes the rest.
+func stopGrpcServer(ctx context.Context, srv *grpc.Server) {
+	if srv == nil {
 		return
 	}
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		srv.Stop()
+	}
+}
+
+// detectNode fills the identity of the node which the configuration leaves empty from the host.
+func detectNode(cfg *config.Config) error {
+	if cfg.Node.IPAddress == "" {
+		ipAddress, err := util.GetExternalIP()
+		if err != nil {
+			return errors.New("Failed to get IPAddress")
+		}
+		cfg.Node.IPAddress = ipAddress
+	}
+	if cfg.Node.HWAddr == "" {
+		cfg.Node.HWAddr = cluster.MustHardwareAddr()
+	}
+	if cfg.Node.Nickname == "" {
+		cfg.Node.Nickname = cluster.MustHostname()
+	}
+	return nil
+}
+
+// loadConfig reads the configuration again for a reload, with the arguments and the environment of the process.
+func loadConfig(args []string) func() (*config.Config, error) {
+	return func() (*config.Config, error) {
+		fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		cfg, err := config.Load(fs, args, os.Getenv)
+		if err != nil {
+			return nil, err
+		}
+		return cfg, detectNode(cfg)
+	}
+}
+
+func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1:]))
+	}
 
 	// Input
-	clusterConfigInfo := cluster.NewConfig(
-		flag.Int("size_of_init_brick", 100000, "Size of Initial brick"),
-		flag.String("ipaddress", ipAddress, "Local IP"),
-		flag.String("feature_api", ":8081", "HTTP listen address (API)"),
-		flag.String("node_role", "calc", "RoleName in cluster"),
-		flag.String("state_api", ":8001", "HTTP listen address (ClusterManage)"),
-		flag.String("mesh", net.JoinHostPort("0.0.0.0", strconv.Itoa(mesh.Port)), "mesh listen address"),
-		flag.String("hwaddr", cluster.MustHardwareAddr(), "MAC address, i.e. mesh peer ID"),
-		flag.String("nickname", cluster.MustHostname(), "peer nickname"),
-		flag.String("password", "", "password (optional)"),
-		flag.String("channel", "default", "gossip channel name"),
-		flag.String("strategy", "naive", "search strategy"),
-		cluster.ClusterPeers{},
-	)
-	flag.Var(clusterConfigInfo.Peers, "peer", "initial peer (may be repeated)")
-	flag.Parse()
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:], os.Getenv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "featuredb: %v\n", err)
+		os.Exit(2)
+	}
+	if err := detectNode(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "featuredb: %v\n", err)
+		os.Exit(1)
+	}
+	clusterConfigInfo := cluster.NewConfig(cfg)
+
+	logger, err := logging.New(logging.Config{Level: cfg.Logging.Level, Format: cfg.Logging.Format})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "featuredb: %v\n", err)
+		os.Exit(1)
+	}
+	logger.Info("effective config", zap.Any("config", cfg.Redacted()))
+	rl := reload.New(cfg, loadConfig(os.Args[1:]), logger)
 
 	errs := make(chan error)
 	processSignal(errs)
 
 	// 計算ノードとして動くモード
-	if *clusterConfigInfo.NodeRole == "calc" {
-		tracer.Start(
-			tracer.WithServiceName("feature-db-calcNode"),
-			tracer.WithAnalytics(true),
-		)
-		defer tracer.Stop()
+	if *clusterConfigInfo.NodeRole == config.RoleCalc {
+		if err := tracing.Start(tracing.Config{
+			Backend:      cfg.Tracing.Backend,
+			ServiceName:  "feature-db-calcNode",
+			OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		}); err != nil {
+			logger.Error("tracing", zap.Error(err))
+			os.Exit(1)
+		}
 		cpus := runtime.NumCPU()
 		runtime.GOMAXPROCS(cpus)
-		fmt.Printf("CPU=%d\n", cpus)
+		logger.Info("calc node starting", zap.Int("cpus", cpus))
 
 		// TODO: Discuss about deciding strategy's timing
-		var strategy brick.SearchStrategy
-		switch p := *clusterConfigInfo.SearchStrategy; {
-		case p == "naive":
-			strategy = brick.NewLinerFindStrategy()
-			fmt.Println("search strategy: LinerFindStrategy")
-		case strings.HasPrefix(p, "goroutine_"):
-			strs := strings.Split(p, "_")
-			div, err := strconv.Atoi(strs[1])
-			if err != nil {
-				fmt.Println("failed parse goroutine num")
-				return
-			}
-			strategy = brick.NewLinerDividingFindStrategy(div)
-			fmt.Println("search strategy: LinerDividingFindStrategy")
-		default:
-			strategy = brick.NewLinerFindStrategy()
-			fmt.Println("search strategy: LinerFindStrategy")
+		strategy, err := brick.NewSearchStrategy(clusterConfigInfo.Runtime().GetSearchStrategy(0))
+		if err != nil {
+			logger.Error("search strategy", zap.Error(err))
+			os.Exit(1)
 		}
+		logger.Info("search strategy", zap.String("strategy", brick.StrategyName(strategy)))
+
+		bp := brick.BrickPool{}
+		bp.InitBrickPool()
+
+		// The catalog is gossiped, so the cluster is joined before the servers check requests against it.
+		cl := cluster.StartClusteringFunc(clusterConfigInfo, &bp, logger, errs)
+		cl.SetGroup(catalog.DefaultGroup())
+
+		// The servers start before the brick is filled, so that /readyz tells the node is loading.
+		// Bricks are kept only in memory, so there is no WAL to replay before the node is ready.
+		ready := health.NewChecker()
+		srv := query.StartFeatureDbServer(&bp, &clusterConfigInfo, cl.Peer, ready, rl, logger, errs)
+		var grpcSrv *grpc.Server
+		if *clusterConfigInfo.GrpcListen != "" {
+			grpcSrv = query.StartFeatureDbGrpcServer(&bp, &clusterConfigInfo, cl.Peer, logger, errs)
+		}
+		ready.Add("bricks", func() error {
+			if !bp.IsLoaded() {
+				return errors.New("bricks are loading")
+			}
+			return nil
+		})
+		ready.Add("mesh", cl.CheckMesh)
+		ready.Add("draining", cl.CheckDraining)
+		cl.SetLabels(nil, cfg.Node.Labels)
+		rl.OnReload(func(old, new *config.Config) {
+			rt := cluster.NewRuntime(new)
+			clusterConfigInfo.SetRuntime(rt)
+			query.SetSlowQueryThreshold(rt.SlowQueryThreshold)
+			// Strategies have been validated, so this fails only on a bug.
+			if err := query.ApplySearchStrategies(&bp, rt, cl.Peer); err != nil {
+				logger.Error("search strategy", zap.Error(err))
+			}
+			cl.SetLabels(old.Node.Labels, new.Node.Labels)
+		})
+		rl.NotifySignal(syscall.SIGHUP)
 
 		fp := brick.NewBrick(*clusterConfigInfo.SizeOfInitBrick,
 			0,
 			strategy,
 		)
-		brick.InsertRandomValuesIntoPool(&fp, *clusterConfigInfo.SizeOfInitBrick)
-
-		bp := brick.BrickPool{}
-		bp.InitBrickPool()
+		brick.InsertRandomValuesIntoPool(&fp, *clusterConfigInfo.SizeOfInitBrick, logger.Named("brick"))
 		bp.RegisterIntoPool(&fp)
+		bp.SetLoaded()
+		logger.Info("bricks loaded")
 
-		query.StartFeatureDbServer(&bp, &clusterConfigInfo, errs)
-		peer := cluster.StartClusteringFunc(clusterConfigInfo, errs)
 		stateConf := clusterConfigInfo.StateConfig()
 		go func(peer cluster.PeerController) {
 			for true {
 				peer.SetNodeInfo(stateConf, &bp)
-				time.Sleep(10 * time.Second)
+				time.Sleep(*clusterConfigInfo.HeartbeatInterval)
 			}
-		}(peer)
-		fmt.Println(<-errs)
-		os.Exit(0)
+		}(cl)
+		code := stopped(logger, <-errs)
+		shutdownCalcNode(&bp, srv, grpcSrv, cl, logger)
+		tracing.Stop()
+		os.Exit(code)
 	}
 
 	// ReverseProxyとして動くモード
-	if *clusterConfigInfo.NodeRole == "reverseProxy" {
-		tracer.Start(
-			tracer.WithServiceName("feature-db-proxy"),
-			tracer.WithAnalytics(true),
-		)
-		peer := cluster.StartClusteringFunc(clusterConfigInfo, errs)
-		proxy.StartReverseProxy(peer, *clusterConfigInfo.FeatureApiHttpListen, errs)
+	if *clusterConfigInfo.NodeRole == config.RoleReverseProxy {
+		if err := tracing.Start(tracing.Config{
+			Backend:      cfg.Tracing.Backend,
+			ServiceName:  "feature-db-proxy",
+			OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		}); err != nil {
+			logger.Error("tracing", zap.Error(err))
+			os.Exit(1)
+		}
+		cl := cluster.StartClusteringFunc(clusterConfigInfo, nil, logger, errs)
+		ready := health.NewChecker()
+		ready.Add("mesh", cl.CheckMesh)
+		ready.Add("groups", proxy.CoverageCheck(cl.Peer, &clusterConfigInfo))
+		cl.SetLabels(nil, cfg.Node.Labels)
+		rl.OnReload(func(old, new *config.Config) {
+			rt := cluster.NewRuntime(new)
+			clusterConfigInfo.SetRuntime(rt)
+			proxy.SetSlowQueryThreshold(rt.SlowQueryThreshold)
+			cl.SetLabels(old.Node.Labels, new.Node.Labels)
+		})
+		rl.NotifySignal(syscall.SIGHUP)
+		srv := proxy.StartReverseProxy(cl.Peer, &clusterConfigInfo, ready, rl, logger, errs)
+		var grpcSrv *grpc.Server
+		if *clusterConfigInfo.GrpcListen != "" {
+			grpcSrv = proxy.StartReverseProxyGrpcServer(cl.Peer, &clusterConfigInfo, logger, errs)
+		}
 		go func(peer cluster.PeerController) {
 			for true {
-				fmt.Print(peer.GetAllState())
-				time.Sleep(10 * time.Second)
+				logger.Debug("cluster state", zap.Int("nodes", len(peer.GetAllState().NodeInfos)))
+				time.Sleep(*clusterConfigInfo.HeartbeatInterval)
 			}
-		}(peer)
-		fmt.Println(<-errs)
-		os.Exit(0)
+		}(cl)
+		code := stopped(logger, <-errs)
+		shutdownReverseProxy(srv, grpcSrv, cl, logger)
+		tracing.Stop()
+		os.Exit(code)
 	}
 
 }
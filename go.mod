@@ -3,13 +3,20 @@ module github.com/abeja-inc/feature-search-db
 go 1.13
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/DataDog/datadog-go v3.3.0+incompatible // indirect
+	github.com/golang/protobuf v1.3.4
 	github.com/gorilla/mux v1.7.3
-	github.com/opentracing/opentracing-go v1.1.0 // indirect
+	github.com/gorilla/websocket v1.4.1
 	github.com/philhofer/fwd v1.0.0 // indirect
+	github.com/prometheus/client_golang v1.2.1
 	github.com/rs/xid v1.2.1
 	github.com/tinylib/msgp v1.1.1 // indirect
 	github.com/weaveworks/mesh v0.0.0-20191105120815-58dbcc3e8e63
-	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543 // indirect
+	go.opentelemetry.io/otel v0.6.0
+	go.opentelemetry.io/otel/exporters/otlp v0.6.0
+	go.uber.org/zap v1.15.0
+	google.golang.org/grpc v1.28.1
 	gopkg.in/DataDog/dd-trace-go.v1 v1.19.0
+	gopkg.in/yaml.v2 v2.2.7
 )
@@ -0,0 +1,57 @@
+package api
+
+import "time"
+
+// SearchExplain tells how a calc node ran a search. It is returned with explain=true.
+// DistanceEvaluations is PointsVisited times the number of queries.
+type SearchExplain struct {
+	Strategy            string         `json:"strategy"`
+	BricksScanned       int            `json:"bricksScanned"`
+	PointsVisited       int            `json:"pointsVisited"`
+	DistanceEvaluations int            `json:"distanceEvaluations"`
+	Bricks              []BrickExplain `json:"bricks"`
+	Phases              []ExplainPhase `json:"phases"`
+}
+
+// BrickExplain is the part of a search spent on one brick.
+// Goroutines has the number of data points each goroutine visited.
+type BrickExplain struct {
+	UniqueID      string `json:"uniqueID"`
+	Strategy      string `json:"strategy"`
+	PointsVisited int    `json:"pointsVisited"`
+	Goroutines    []int  `json:"goroutines"`
+	ElapsedTime   int64  `json:"elapsedTime"`
+}
+
+// ExplainPhase is the time spent on a phase of a request, in nanoseconds.
+type ExplainPhase struct {
+	Name        string `json:"name"`
+	ElapsedTime int64  `json:"elapsedTime"`
+}
+
+// PhaseTimer measures the consecutive phases of a request.
+type PhaseTimer struct {
+	last   time.Time
+	Phases []ExplainPhase
+}
+
+// NewPhaseTimer starts measuring the first phase.
+func NewPhaseTimer() *PhaseTimer {
+	return &PhaseTimer{last: time.Now(), Phases: []ExplainPhase{}}
+}
+
+// Done ends the current phase under name and starts the next one.
+func (pt *PhaseTimer) Done(name string) {
+	now := time.Now()
+	pt.Phases = append(pt.Phases, ExplainPhase{Name: name, ElapsedTime: now.Sub(pt.last).Nanoseconds()})
+	pt.last = now
+}
+
+// Total is the time spent on all the phases done.
+func (pt *PhaseTimer) Total() int64 {
+	var total int64
+	for _, p := range pt.Phases {
+		total += p.ElapsedTime
+	}
+	return total
+}
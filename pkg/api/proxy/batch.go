@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+	"github.com/abeja-inc/feature-search-db/pkg/tracing"
+)
+
+type ProxyBatchQueryResponse struct {
+	Bricks             []BrickInfoWithNodeInfo `json:"bricks"`
+	NodeResponses      []NodeQueryResponse     `json:"nodeResponses"`
+	Results            []ProxyQueryResult      `json:"results"`
+	Partial            bool                    `json:"partial"`
+	UnansweredBricks   []string                `json:"unansweredBricks"`
+	RequestProcessTime int64                   `json:"requestProcessTime"`
+}
+
+// handlerOfProxyBatchQuery searches N queries with one request per calc node.
+// New queries are registered together in one brick. Queries of the same batch
+// are not compared with each other, so near duplicates within a batch are all registered.
+func handlerOfProxyBatchQuery(peer *state.Peer, c *cluster.ClusterConfigInfo) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		span, ctx := tracing.StartSpan(r.Context(), "handlerOfProxyBatchQuery")
+		defer span.Finish()
+		span.SetTag("http.url", r.URL.Path)
+		t_start := time.Now().UnixNano()
+
+		// Allow only POST Method
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		defer r.Body.Close()
+
+		params, err := parseProxyQueryParams(catalog.NamespaceOf(r), r.URL.Query(), c, peer)
+		if err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{err.Error()})
+			w.WriteHeader(statusOfParamsError(err))
+			w.Write(jsonBytes)
+			return
+		}
+
+		// Parse Payload that Client has sent
+		query, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{"Failed to read payload."})
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write(jsonBytes)
+			return
+		}
+		payload, err := ParseQueryPayload(r.Header.Get("Content-Type"), query, true)
+		if err == ErrInvalidContentType {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid Content-Type"))
+			return
+		}
+		if err == nil {
+			err = payload.CheckGroup(params.group)
+		}
+		if err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{err.Error()})
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write(jsonBytes)
+			return
+		}
+
+		resp := runBatchQuery(ctx, peer, c, params, payload)
+		resp.RequestProcessTime = time.Now().UnixNano() - t_start
+		if !params.onlyRegister {
+			recordSlowQuery(ctx, r.URL.Path, params.namespace.Name, params.featureGroupID, payload.NumOfQueries, resp.RequestProcessTime, explainNodes(resp.NodeResponses, nil))
+		}
+		jsonBytes, _ := json.Marshal(resp)
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonBytes)
+	}
+}
+
+// runBatchQuery searches the queries of payload in the cluster and registers the new ones together.
+func runBatchQuery(ctx context.Context, peer *state.Peer, c *cluster.ClusterConfigInfo, params proxyQueryParams, payload QueryPayload) ProxyBatchQueryResponse {
+	status := peer.GetAllState()
+	bricks := bricksOfGroup(status, params.namespace.Name, params.featureGroupID)
+	fo := &fanOut{
+		namespace:      params.namespace.Name,
+		featureGroupID: params.featureGroupID,
+		calcMode:       params.calcMode,
+		payload:        payload,
+		timeout:        params.nodeTimeout,
+		retries:        params.retries,
+		batch:          true,
+	}
+	resp := ProxyBatchQueryResponse{
+		Bricks:           bricks,
+		NodeResponses:    []NodeQueryResponse{},
+		Results:          make([]ProxyQueryResult, payload.NumOfQueries),
+		UnansweredBricks: []string{},
+	}
+	for i := range resp.Results {
+		resp.Results[i].NoveltyThreshold = params.noveltyThreshold
+	}
+
+	// Queries to register, by their index in the batch.
+	newQueries := []int{}
+	if params.onlyRegister {
+		for i := 0; i < payload.NumOfQueries; i++ {
+			newQueries = append(newQueries, i)
+		}
+	} else {
+		res := fo.search(ctx, groupReplicas(bricks))
+		resp.NodeResponses = res.nodeResponses
+		resp.UnansweredBricks = res.unanswered
+		resp.Partial = len(res.unanswered) > 0
+
+		// Merge per query
+		// Failed responses carry no distance, so they are left out of the comparison.
+		for i := range resp.Results {
+			result := &resp.Results[i]
+			found := false
+			for _, brs := range res.brickResults {
+				br := brs[i]
+				if !br.Success || br.DataID == "" {
+					continue
+				}
+				if !found || result.Distance > br.Distance {
+					result.DataID = br.DataID
+					result.Distance = br.Distance
+					found = true
+				}
+			}
+			// The nearest point may be in an unanswered brick, so a partial result is never registered.
+			result.IsNew = found && result.Distance > params.noveltyThreshold
+			if result.IsNew && !params.searchOnly && !resp.Partial {
+				newQueries = append(newQueries, i)
+			}
+		}
+	}
+
+	if len(newQueries) > 0 {
+		minBrick, hasRegisterTarget := selectBrickForRegistration(bricks, params.selector, len(newQueries))
+		if hasRegisterTarget && params.allowsRegistration(status, bricks, len(newQueries)) {
+			registerFo := *fo
+			registerFo.payload = payload.Subset(newQueries)
+			node, resps := registerFo.register(ctx, minBrick)
+			resp.NodeResponses = append(resp.NodeResponses, node)
+			if node.Success {
+				for j, i := range newQueries {
+					resp.Results[i].DataID = resps[j].DataID
+					resp.Results[i].Distance = resps[j].Distance
+					resp.Results[i].Registered = resps[j].Registered
+				}
+			}
+		}
+	}
+	return resp
+}
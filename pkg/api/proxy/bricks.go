@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+)
+
+// clusterBricks lists the bricks of the namespace on every node from the gossiped state,
+// or the bricks of every namespace when it is empty.
+func clusterBricks(status state.StateContent, namespace string) []BrickInfoWithNodeInfo {
+	bricks := []BrickInfoWithNodeInfo{}
+	for nodeName, v := range status.NodeInfos {
+		for _, b := range brickInfosOfNode(nodeName, v) {
+			if namespace == "" || b.GetNamespace() == namespace {
+				bricks = append(bricks, b)
+			}
+		}
+	}
+	sort.Slice(bricks, func(i, j int) bool {
+		return bricks[i].UniqueID < bricks[j].UniqueID
+	})
+	return bricks
+}
+
+// handlerOfProxyBricks lists the bricks of the namespace in the cluster in the same form as /api/v1/bricks
+// of a calc node, with the node of each brick.
+func handlerOfProxyBricks(peer *state.Peer) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		bricks := clusterBricks(peer.GetAllState(), catalog.NamespaceOf(r))
+		if s := r.URL.Query().Get("featureGroupID"); s != "" {
+			featureGroupID, err := strconv.Atoi(s)
+			if err != nil {
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{"Invalid GroupID"})
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write(jsonBytes)
+				return
+			}
+			filtered := []BrickInfoWithNodeInfo{}
+			for _, b := range bricks {
+				if b.FeatureGroupID == featureGroupID {
+					filtered = append(filtered, b)
+				}
+			}
+			bricks = filtered
+		}
+		jsonBytes, _ := json.Marshal(bricks)
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonBytes)
+	}
+}
@@ -0,0 +1,240 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+)
+
+const (
+	ContentTypeJSON    = "application/json"
+	ContentTypeVectors = "application/x-featuredb-vectors"
+	// ContentTypeNDJSON is the type of exports, which are streams of JSON lines.
+	ContentTypeNDJSON = "application/x-ndjson"
+)
+
+// Binary vectors are little endian with a 16 byte header:
+//
+//	offset 0  magic "FDBV"
+//	offset 4  version (uint8, 1)
+//	offset 5  bytes per value (uint8, 4 for float32 or 8 for float64)
+//	offset 6  reserved (uint16, 0)
+//	offset 8  number of vectors (uint32)
+//	offset 12 dimension (uint32)
+//	offset 16 values, vector after vector
+const (
+	vectorsMagic      = "FDBV"
+	vectorsVersion    = 1
+	vectorsHeaderSize = 16
+)
+
+var ErrInvalidContentType = errors.New("Invalid Content-Type")
+
+type vectorsHeader struct {
+	valueSize int
+	count     int
+	dim       int
+}
+
+// EncodeVectors packs vecs in the binary format, as float32 when useFloat32 is set.
+func EncodeVectors(vecs [][512]float64, useFloat32 bool) []byte {
+	valueSize := 8
+	if useFloat32 {
+		valueSize = 4
+	}
+	dim := len(QueryInputForm{}.Vals)
+	b := make([]byte, vectorsHeaderSize+len(vecs)*dim*valueSize)
+	copy(b, vectorsMagic)
+	b[4] = vectorsVersion
+	b[5] = byte(valueSize)
+	binary.LittleEndian.PutUint32(b[8:], uint32(len(vecs)))
+	binary.LittleEndian.PutUint32(b[12:], uint32(dim))
+	off := vectorsHeaderSize
+	for _, vec := range vecs {
+		for _, val := range vec {
+			if useFloat32 {
+				binary.LittleEndian.PutUint32(b[off:], math.Float32bits(float32(val)))
+			} else {
+				binary.LittleEndian.PutUint64(b[off:], math.Float64bits(val))
+			}
+			off += valueSize
+		}
+	}
+	return b
+}
+
+// parseVectorsHeader checks the header and that the body has every value it announces.
+func parseVectorsHeader(b []byte) (vectorsHeader, error) {
+	var h vectorsHeader
+	if len(b) < vectorsHeaderSize || string(b[:4]) != vectorsMagic {
+		return h, errors.New("Invalid vectors header")
+	}
+	if b[4] != vectorsVersion {
+		return h, fmt.Errorf("Unsupported vectors version (%d)", b[4])
+	}
+	h.valueSize = int(b[5])
+	if h.valueSize != 4 && h.valueSize != 8 {
+		return h, fmt.Errorf("Unsupported value size (%d)", h.valueSize)
+	}
+	h.count = int(binary.LittleEndian.Uint32(b[8:]))
+	h.dim = int(binary.LittleEndian.Uint32(b[12:]))
+	if h.dim != len(QueryInputForm{}.Vals) {
+		return h, fmt.Errorf("Invalid dimension (%d)", h.dim)
+	}
+	if len(b) != vectorsHeaderSize+h.count*h.dim*h.valueSize {
+		return h, errors.New("Invalid vectors length")
+	}
+	return h, nil
+}
+
+func (h vectorsHeader) rowSize() int {
+	return h.dim * h.valueSize
+}
+
+// DecodeVectors unpacks vectors in the binary format.
+func DecodeVectors(b []byte) ([]QueryInputForm, error) {
+	h, err := parseVectorsHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	forms := make([]QueryInputForm, h.count)
+	off := vectorsHeaderSize
+	for i := range forms {
+		for j := range forms[i].Vals {
+			if h.valueSize == 4 {
+				forms[i].Vals[j] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[off:])))
+			} else {
+				forms[i].Vals[j] = math.Float64frombits(binary.LittleEndian.Uint64(b[off:]))
+			}
+			off += h.valueSize
+		}
+	}
+	return forms, nil
+}
+
+// QueryPayload is the body of a search query as the client has sent it.
+// The proxy forwards Body to calc nodes as is instead of encoding it again.
+type QueryPayload struct {
+	ContentType  string
+	Body         []byte
+	NumOfQueries int
+	forms        []QueryInputForm
+	// dim is the dimension of the vectors as sent, or of the first one which differs from QueryInputForm.
+	dim int
+	// valueSize is the size of a value of binary vectors, and 0 for JSON.
+	valueSize int
+}
+
+// jsonQueryInputForm keeps every value as sent, which QueryInputForm pads or cuts to its dimension.
+type jsonQueryInputForm struct {
+	Vals []float64 `json:"vals"`
+}
+
+// formsOfJSON converts vals into QueryInputForm, and returns the dimension of the vectors as sent.
+func formsOfJSON(vals []jsonQueryInputForm) ([]QueryInputForm, int) {
+	forms := make([]QueryInputForm, len(vals))
+	dim := len(QueryInputForm{}.Vals)
+	for i, v := range vals {
+		copy(forms[i].Vals[:], v.Vals)
+		if len(v.Vals) != len(forms[i].Vals) && dim == len(forms[i].Vals) {
+			dim = len(v.Vals)
+		}
+	}
+	return forms, dim
+}
+
+// ParseQueryPayload checks a query body of contentType. A batch body holds any number
+// of queries, otherwise it must hold exactly one.
+// JSON is decoded, while only the header of binary vectors is checked.
+func ParseQueryPayload(contentType string, body []byte, batch bool) (QueryPayload, error) {
+	p := QueryPayload{Body: body}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return p, ErrInvalidContentType
+	}
+	switch mediaType {
+	case ContentTypeJSON:
+		p.ContentType = ContentTypeJSON
+		if batch {
+			var batchInputForm struct {
+				Queries []jsonQueryInputForm `json:"queries"`
+			}
+			if err := json.Unmarshal(body, &batchInputForm); err != nil {
+				return p, errors.New("Failed to parse json.")
+			}
+			p.forms, p.dim = formsOfJSON(batchInputForm.Queries)
+		} else {
+			var queryInputForm jsonQueryInputForm
+			if err := json.Unmarshal(body, &queryInputForm); err != nil {
+				return p, errors.New("Failed to parse json.")
+			}
+			p.forms, p.dim = formsOfJSON([]jsonQueryInputForm{queryInputForm})
+		}
+		p.NumOfQueries = len(p.forms)
+	case ContentTypeVectors:
+		p.ContentType = ContentTypeVectors
+		h, err := parseVectorsHeader(body)
+		if err != nil {
+			return p, err
+		}
+		if !batch && h.count != 1 {
+			return p, errors.New("Exactly one vector must be sent")
+		}
+		p.NumOfQueries = h.count
+		p.dim = h.dim
+		p.valueSize = h.valueSize
+	default:
+		return p, ErrInvalidContentType
+	}
+	if p.NumOfQueries == 0 {
+		return p, errors.New("No query is given")
+	}
+	return p, nil
+}
+
+// CheckGroup checks the vectors against the definition of their feature group.
+func (p QueryPayload) CheckGroup(g catalog.Group) error {
+	return g.CheckVectors(p.dim, p.valueSize)
+}
+
+// Forms returns the queries of the payload.
+func (p QueryPayload) Forms() ([]QueryInputForm, error) {
+	if p.ContentType == ContentTypeVectors {
+		return DecodeVectors(p.Body)
+	}
+	return p.forms, nil
+}
+
+// Subset returns a batch payload with the queries at indexes, in the same encoding.
+func (p QueryPayload) Subset(indexes []int) QueryPayload {
+	sub := QueryPayload{
+		ContentType:  p.ContentType,
+		NumOfQueries: len(indexes),
+		dim:          p.dim,
+		valueSize:    p.valueSize,
+	}
+	if p.ContentType == ContentTypeVectors {
+		h, _ := parseVectorsHeader(p.Body)
+		rowSize := h.rowSize()
+		body := make([]byte, vectorsHeaderSize, vectorsHeaderSize+len(indexes)*rowSize)
+		copy(body, p.Body[:vectorsHeaderSize])
+		binary.LittleEndian.PutUint32(body[8:], uint32(len(indexes)))
+		for _, i := range indexes {
+			off := vectorsHeaderSize + i*rowSize
+			body = append(body, p.Body[off:off+rowSize]...)
+		}
+		sub.Body = body
+		return sub
+	}
+	sub.forms = make([]QueryInputForm, 0, len(indexes))
+	for _, i := range indexes {
+		sub.forms = append(sub.forms, p.forms[i])
+	}
+	sub.Body, _ = json.Marshal(BatchQueryInputForm{Queries: sub.forms})
+	return sub
+}
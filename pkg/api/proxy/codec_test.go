@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+)
+
+func TestQueryPayload(t *testing.T) {
+	t.Run("it decodes binary vectors successfully", testQueryPayload_vectors)
+	t.Run("it takes a subset of the queries successfully", testQueryPayload_subset)
+	t.Run("it rejects invalid payloads", testQueryPayload_invalid)
+	t.Run("it checks vectors against their feature group", testQueryPayload_checkGroup)
+}
+
+func testVectors(n int) [][512]float64 {
+	vecs := make([][512]float64, n)
+	for i := range vecs {
+		for j := range vecs[i] {
+			vecs[i][j] = float64(i) + float64(j)/4
+		}
+	}
+	return vecs
+}
+
+func testQueryPayload_vectors(t *testing.T) {
+	vecs := testVectors(3)
+	for _, useFloat32 := range []bool{false, true} {
+		// exec
+		payload, err := ParseQueryPayload(ContentTypeVectors, EncodeVectors(vecs, useFloat32), true)
+		if err != nil {
+			t.Fatalf("fail. %v", err)
+		}
+		forms, err := payload.Forms()
+
+		// assert
+		if err != nil || payload.NumOfQueries != 3 || len(forms) != 3 {
+			t.Fatalf("fail. number of queries not match. %d %v", payload.NumOfQueries, err)
+		}
+		for i := range forms {
+			if forms[i].Vals != vecs[i] {
+				t.Fatalf("fail. vector %d not match (float32=%v)", i, useFloat32)
+			}
+		}
+	}
+}
+
+func testQueryPayload_subset(t *testing.T) {
+	vecs := testVectors(3)
+	jsonBody, _ := json.Marshal(BatchQueryInputForm{Queries: []QueryInputForm{{vecs[0]}, {vecs[1]}, {vecs[2]}}})
+	for _, c := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{ContentTypeJSON, jsonBody},
+		{ContentTypeVectors, EncodeVectors(vecs, false)},
+	} {
+		payload, err := ParseQueryPayload(c.contentType, c.body, true)
+		if err != nil {
+			t.Fatalf("fail. %v", err)
+		}
+
+		// exec
+		sub := payload.Subset([]int{2, 0})
+
+		// assert
+		sub, err = ParseQueryPayload(sub.ContentType, sub.Body, true)
+		if err != nil {
+			t.Fatalf("fail. %v", err)
+		}
+		forms, _ := sub.Forms()
+		if len(forms) != 2 || forms[0].Vals != vecs[2] || forms[1].Vals != vecs[0] {
+			t.Fatalf("fail. subset not match (%s)", c.contentType)
+		}
+	}
+}
+
+func testQueryPayload_invalid(t *testing.T) {
+	body := EncodeVectors(testVectors(2), true)
+	if _, err := ParseQueryPayload("text/plain", body, true); err != ErrInvalidContentType {
+		t.Fatalf("fail. content type must be rejected. %v", err)
+	}
+	if _, err := ParseQueryPayload(ContentTypeVectors, body[:len(body)-1], true); err == nil {
+		t.Fatalf("fail. truncated vectors must be rejected")
+	}
+	if _, err := ParseQueryPayload(ContentTypeVectors, body, false); err == nil {
+		t.Fatalf("fail. single query must have one vector")
+	}
+	if _, err := ParseQueryPayload("application/json; charset=utf-8", []byte(`{"vals": [1.0]}`), false); err != nil {
+		t.Fatalf("fail. json with charset must be accepted. %v", err)
+	}
+}
+
+func testQueryPayload_checkGroup(t *testing.T) {
+	vecs := testVectors(2)
+	g := catalog.Group{ID: 1, Name: "a", DType: catalog.DTypeFloat32}
+	g.SetDefaults()
+	for _, c := range []struct {
+		contentType string
+		body        []byte
+		ok          bool
+	}{
+		{ContentTypeJSON, []byte(`{"queries": [{"vals": [1, 2, 3]}]}`), false},
+		{ContentTypeVectors, EncodeVectors(vecs, true), true},
+		{ContentTypeVectors, EncodeVectors(vecs, false), false},
+	} {
+		// exec
+		payload, err := ParseQueryPayload(c.contentType, c.body, true)
+		if err != nil {
+			t.Fatalf("fail. %v", err)
+		}
+		err = payload.CheckGroup(g)
+
+		// assert
+		if (err == nil) != c.ok {
+			t.Fatalf("fail. %s: ok=%v expected, got %v", c.contentType, c.ok, err)
+		}
+		if err == nil && payload.Subset([]int{1}).CheckGroup(g) != nil {
+			t.Fatalf("fail. subset of %s rejected.", c.contentType)
+		}
+	}
+	jsonBody, _ := json.Marshal(BatchQueryInputForm{Queries: []QueryInputForm{{vecs[0]}}})
+	payload, _ := ParseQueryPayload(ContentTypeJSON, jsonBody, true)
+	if err := payload.CheckGroup(g); err != nil {
+		t.Fatalf("fail. JSON vectors rejected. %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api/rpc"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+	"github.com/abeja-inc/feature-search-db/pkg/tracing"
+	"google.golang.org/grpc"
+)
+
+// nodeConns keeps one gRPC connection per calc node, which every request to the node shares.
+var nodeConns = &connPool{conns: map[string]*grpc.ClientConn{}}
+
+type connPool struct {
+	mtx   sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+// client returns the client of the node at address, connecting on first use.
+// Dial does not block, so a node which is down fails the request instead.
+func (cp *connPool) client(address string) (rpc.FeatureDBClient, error) {
+	cp.mtx.Lock()
+	defer cp.mtx.Unlock()
+	if conn, ok := cp.conns[address]; ok {
+		return rpc.NewFeatureDBClient(conn), nil
+	}
+	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithChainUnaryInterceptor(logging.UnaryClientInterceptor, tracing.UnaryClientInterceptor))
+	if err != nil {
+		return nil, err
+	}
+	cp.conns[address] = conn
+	return rpc.NewFeatureDBClient(conn), nil
+}
+
+// keep closes the connections to the nodes which are not in addresses any more.
+func (cp *connPool) keep(addresses map[string]bool) {
+	cp.mtx.Lock()
+	defer cp.mtx.Unlock()
+	for address, conn := range cp.conns {
+		if !addresses[address] {
+			conn.Close()
+			delete(cp.conns, address)
+		}
+	}
+}
+
+// pruneNodeConns closes the connections to nodes which have left the cluster, once a minute.
+func pruneNodeConns(peer *state.Peer) {
+	for range time.Tick(time.Minute) {
+		addresses := map[string]bool{}
+		for _, v := range peer.GetAllState().NodeInfos {
+			addresses[v.GrpcAddress()] = true
+		}
+		nodeConns.keep(addresses)
+	}
+}
+
+// CloseNodeConns closes the gRPC connections to calc nodes.
+func CloseNodeConns() {
+	nodeConns.keep(nil)
+}
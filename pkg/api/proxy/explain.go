@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+	"github.com/abeja-inc/feature-search-db/pkg/slowlog"
+
+	"go.uber.org/zap"
+)
+
+// slowQueries keeps the slow searches of this proxy for /admin/slowqueries.
+// Its threshold is set when the servers start, and again when the config is reloaded.
+var slowQueries = slowlog.New(slowlog.DefaultSize, 0)
+
+// SetSlowQueryThreshold changes the time from which a search is kept on /admin/slowqueries.
+func SetSlowQueryThreshold(threshold time.Duration) {
+	slowQueries.SetThreshold(threshold)
+}
+
+// ProxyExplain sums up how the calc nodes ran a search. It is returned with explain=true.
+// The explanation of each node is in its NodeQueryResponse.
+type ProxyExplain struct {
+	NodesQueried        int                `json:"nodesQueried"`
+	BricksScanned       int                `json:"bricksScanned"`
+	PointsVisited       int                `json:"pointsVisited"`
+	DistanceEvaluations int                `json:"distanceEvaluations"`
+	Nodes               []NodeExplain      `json:"nodes"`
+	Phases              []api.ExplainPhase `json:"phases"`
+}
+
+// NodeExplain is the part of a search spent on one node.
+// NodeTime is the time the node spent on the request, and NetworkTime is the rest of ResponseTime.
+type NodeExplain struct {
+	NodeName            string `json:"nodeName"`
+	Success             bool   `json:"success"`
+	Strategy            string `json:"strategy,omitempty"`
+	BricksScanned       int    `json:"bricksScanned"`
+	PointsVisited       int    `json:"pointsVisited"`
+	DistanceEvaluations int    `json:"distanceEvaluations"`
+	ResponseTime        int64  `json:"responseTime"`
+	NodeTime            int64  `json:"nodeTime"`
+	NetworkTime         int64  `json:"networkTime"`
+}
+
+// explainNodes aggregates the explanations of nodeResponses per node.
+// Nodes which sent no explanation are listed with their response time only.
+func explainNodes(nodeResponses []NodeQueryResponse, pt *api.PhaseTimer) *ProxyExplain {
+	explain := &ProxyExplain{
+		NodesQueried: len(nodeResponses),
+		Nodes:        make([]NodeExplain, 0, len(nodeResponses)),
+		Phases:       []api.ExplainPhase{},
+	}
+	if pt != nil {
+		explain.Phases = pt.Phases
+	}
+	for _, nr := range nodeResponses {
+		node := NodeExplain{
+			NodeName:     nr.NodeName,
+			Success:      nr.Success,
+			ResponseTime: nr.ResponseTime,
+		}
+		if nr.Explain != nil {
+			node.Strategy = nr.Explain.Strategy
+			node.BricksScanned = nr.Explain.BricksScanned
+			node.PointsVisited = nr.Explain.PointsVisited
+			node.DistanceEvaluations = nr.Explain.DistanceEvaluations
+			for _, p := range nr.Explain.Phases {
+				node.NodeTime += p.ElapsedTime
+			}
+			node.NetworkTime = nr.ResponseTime - node.NodeTime
+		}
+		explain.BricksScanned += node.BricksScanned
+		explain.PointsVisited += node.PointsVisited
+		explain.DistanceEvaluations += node.DistanceEvaluations
+		explain.Nodes = append(explain.Nodes, node)
+	}
+	return explain
+}
+
+// recordSlowQuery keeps a search which took the threshold or longer in slowQueries.
+func recordSlowQuery(ctx context.Context, endpoint string, namespace string, featureGroupID int, queries int, elapsedTime int64, explain *ProxyExplain) {
+	kept := slowQueries.Record(slowlog.Entry{
+		RequestID:      logging.RequestID(ctx),
+		Endpoint:       endpoint,
+		Namespace:      namespace,
+		FeatureGroupID: featureGroupID,
+		Queries:        queries,
+		ElapsedTime:    elapsedTime,
+		Explain:        explain,
+	})
+	if kept {
+		logging.FromContext(ctx).Warn("slow query",
+			zap.String("endpoint", endpoint),
+			zap.String("namespace", namespace),
+			zap.Int("featureGroupID", featureGroupID),
+			zap.Int("queries", queries),
+			zap.Duration("elapsed", time.Duration(elapsedTime)),
+		)
+	}
+}
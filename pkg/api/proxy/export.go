@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+	"github.com/abeja-inc/feature-search-db/pkg/tracing"
+
+	"go.uber.org/zap"
+)
+
+// countingWriter counts the bytes written, to know whether a failed export can still move on to another replica,
+// and keeps the last one, to know whether a node which failed left a line unfinished.
+type countingWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	n       int64
+	last    byte
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	if n > 0 {
+		cw.last = b[n-1]
+	}
+	if cw.flusher != nil {
+		cw.flusher.Flush()
+	}
+	return n, err
+}
+
+// exportBrick copies the export of one brick from its node.
+func exportBrick(r *http.Request, b BrickInfoWithNodeInfo, withVectors bool, cw *countingWriter) error {
+	values := url.Values{}
+	values.Add("uniqueID", b.UniqueID)
+	if !withVectors {
+		values.Add("vectors", "false")
+	}
+	path := catalog.NamespacePath(b.GetNamespace(), "/api/v1/export")
+	address := fmt.Sprintf("http://%s:%d%s?%s", b.NodeIpAddress, b.NodeApiPort, path, values.Encode())
+	req, _ := http.NewRequest(http.MethodGet, address, nil)
+	tracing.Inject(r.Context(), req.Header)
+	logging.InjectRequestID(r.Context(), req.Header)
+	httpResp, err := nodeClient.Do(req.WithContext(r.Context()))
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", b.NodeName, httpResp.StatusCode)
+	}
+	_, err = io.Copy(cw, httpResp.Body)
+	return err
+}
+
+// handlerOfProxyExport streams the data points of a feature group, or of every group of the namespace, as JSON lines
+// by stitching the exports of the calc nodes together brick by brick.
+// A brick is read from the next replica when its node fails before sending anything;
+// a failure in the middle of a brick ends the stream with a line holding the error.
+func handlerOfProxyExport(peer *state.Peer) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		v := r.URL.Query()
+		bricks := clusterBricks(peer.GetAllState(), catalog.NamespaceOf(r))
+		if s := v.Get("featureGroupID"); s != "" {
+			featureGroupID, err := strconv.Atoi(s)
+			if err != nil {
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{"Invalid GroupID"})
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write(jsonBytes)
+				return
+			}
+			filtered := []BrickInfoWithNodeInfo{}
+			for _, b := range bricks {
+				if b.FeatureGroupID == featureGroupID {
+					filtered = append(filtered, b)
+				}
+			}
+			bricks = filtered
+		}
+		withVectors := v.Get("vectors") != "false"
+
+		w.Header().Set("Content-Type", ContentTypeNDJSON)
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		cw := &countingWriter{w: w, flusher: flusher}
+		for _, replicas := range groupReplicas(bricks) {
+			err := errors.New("no replica")
+			for _, b := range replicas {
+				written := cw.n
+				if err = exportBrick(r, b, withVectors, cw); err == nil || cw.n != written || r.Context().Err() != nil {
+					break
+				}
+				logging.FromContext(r.Context()).Warn("error exporting brick",
+					zap.String("uniqueID", b.UniqueID), zap.String("node", b.NodeName), zap.Error(err))
+			}
+			if err != nil {
+				jsonBytes, _ := json.Marshal(api.ExportedDataPoint{
+					UniqueID:       replicas[0].UniqueID,
+					FeatureGroupID: replicas[0].FeatureGroupID,
+					Error:          err.Error(),
+				})
+				if cw.n > 0 && cw.last != '\n' {
+					jsonBytes = append([]byte{'\n'}, jsonBytes...)
+				}
+				w.Write(append(jsonBytes, '\n'))
+				return
+			}
+		}
+	}
+}
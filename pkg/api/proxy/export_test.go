@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+)
+
+func TestProxyExport(t *testing.T) {
+	t.Run("it ends a brick which fails midway with a line of the error", testProxyExport_partialLine)
+}
+
+func testProxyExport_partialLine(t *testing.T) {
+	// prepare
+	// The node breaks the connection in the middle of its second line.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeNDJSON)
+		w.Write([]byte(`{"dataID":"d1","uniqueID":"u1","groupID":0}` + "\n" + `{"dataID":"d2","uni`))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer srv.Close()
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	portInt, _ := strconv.Atoi(port)
+	peer := newTestPeer(t, []BrickInfoWithNodeInfo{{
+		BrickInfo:     state.BrickInfo{UniqueID: "u1", BrickID: "b1", NumOfBrickTotalCap: 100},
+		NodeName:      "a",
+		NodeIpAddress: host,
+		NodeApiPort:   portInt,
+	}})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/export?featureGroupID=0", nil)
+	rec := httptest.NewRecorder()
+
+	// exec
+	handlerOfProxyExport(peer)(rec, req)
+
+	// assert
+	lines := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(rec.Body.String()))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 3 {
+		t.Fatalf("fail. number of lines not match. %q", rec.Body.String())
+	}
+	var last api.ExportedDataPoint
+	if err := json.Unmarshal([]byte(lines[2]), &last); err != nil || last.Error == "" || last.UniqueID != "u1" {
+		t.Fatalf("fail. error line not match. %q %v", lines[2], err)
+	}
+}
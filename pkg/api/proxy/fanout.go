@@ -0,0 +1,405 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/api/rpc"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+	"github.com/abeja-inc/feature-search-db/pkg/metrics"
+	"github.com/abeja-inc/feature-search-db/pkg/tracing"
+
+	"go.uber.org/zap"
+)
+
+// nodeClient is shared by all requests to calc nodes so that connections are reused.
+// Streams send many requests to the same nodes at once, so more idle connections are kept per node.
+var nodeClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        256,
+		MaxIdleConnsPerHost: 32,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// fanOut sends a query to the calc nodes which hold the bricks of a feature group.
+// Each node gets one request naming the bricks to search by uniqueID.
+// The payload is forwarded as the client has sent it, to the batch endpoint when batch is set.
+type fanOut struct {
+	namespace      string
+	featureGroupID int
+	calcMode       string
+	payload        QueryPayload
+	timeout        time.Duration
+	retries        int
+	batch          bool
+	explain        bool
+}
+
+// fanOutResult is the outcome of fanOut.search.
+// brickResponses has the result of the first query for each brick keyed by uniqueID,
+// brickResults has the results of all queries in their order, and unanswered the uniqueIDs of the bricks nobody answered.
+type fanOutResult struct {
+	nodeResponses  []NodeQueryResponse
+	brickResponses map[string]BrickQueryResponse
+	brickResults   map[string][]api.BrickSearchResult
+	unanswered     []string
+}
+
+// pendingBrick is a brick which has not been answered yet, with the replicas left to try.
+type pendingBrick struct {
+	replicas []BrickInfoWithNodeInfo
+	next     int
+	attempts int
+	lastErr  string
+	// tried is the replica which was requested last, or nil before any request.
+	tried *BrickInfoWithNodeInfo
+}
+
+func (pb *pendingBrick) current() BrickInfoWithNodeInfo {
+	return pb.replicas[pb.next]
+}
+
+// reported is the replica which a brick nobody answered is reported as:
+// the one which was requested last, or else the one which would have been next.
+func (pb *pendingBrick) reported() BrickInfoWithNodeInfo {
+	if pb.tried != nil {
+		return *pb.tried
+	}
+	if pb.next < len(pb.replicas) {
+		return pb.current()
+	}
+	return pb.replicas[len(pb.replicas)-1]
+}
+
+type nodeResult struct {
+	node    NodeQueryResponse
+	resps   []api.SearchQueryResponse
+	pending []*pendingBrick
+}
+
+// requestNode sends one request for the bricks to their node, over gRPC when the node serves it.
+// It returns one SearchQueryResponse per query.
+func (fo *fanOut) requestNode(ctx context.Context, bricks []BrickInfoWithNodeInfo, onlyRegister bool) (NodeQueryResponse, []api.SearchQueryResponse) {
+	var result NodeQueryResponse
+	var resps []api.SearchQueryResponse
+	protocol := "http"
+	span, ctx := tracing.StartSpan(ctx, "requestNode")
+	defer span.Finish()
+	// The gRPC API has no explanations, so explained searches go over HTTP.
+	if bricks[0].NodeGrpcAddress != "" && !(fo.explain && !onlyRegister) {
+		protocol = "grpc"
+		result, resps = fo.requestNodeGrpc(ctx, bricks, onlyRegister)
+	} else {
+		result, resps = fo.requestNodeHTTP(ctx, bricks, onlyRegister)
+	}
+	span.SetTag("node", result.NodeName)
+	span.SetTag("protocol", protocol)
+	if !result.Success {
+		span.SetError(errors.New(result.Error))
+		logging.FromContext(ctx).Warn("error communicating query api",
+			zap.String("node", result.NodeName), zap.String("protocol", protocol), zap.String("error", result.Error))
+	}
+	metrics.NodeRequestDuration.WithLabelValues(result.NodeName, protocol).Observe(time.Duration(result.ResponseTime).Seconds())
+	if !result.Success {
+		metrics.NodeRequestErrors.WithLabelValues(result.NodeName, protocol).Inc()
+	}
+	return result, resps
+}
+
+func (fo *fanOut) requestNodeGrpc(ctx context.Context, bricks []BrickInfoWithNodeInfo, onlyRegister bool) (NodeQueryResponse, []api.SearchQueryResponse) {
+	ta := time.Now().UnixNano()
+	node := bricks[0]
+	uniqueIDs := make([]string, 0, len(bricks))
+	for _, b := range bricks {
+		uniqueIDs = append(uniqueIDs, b.UniqueID)
+	}
+	result := NodeQueryResponse{
+		NodeName: node.NodeName,
+		Address:  "grpc://" + node.NodeGrpcAddress,
+		Bricks:   uniqueIDs,
+	}
+	client, err := nodeConns.client(node.NodeGrpcAddress)
+	if err != nil {
+		result.ResponseTime = time.Now().UnixNano() - ta
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	req := &rpc.SearchRequest{
+		FeatureGroupId: int32(fo.featureGroupID),
+		CalcMode:       fo.calcMode,
+		UniqueIds:      uniqueIDs,
+		Payload:        fo.payload.Body,
+		ContentType:    fo.payload.ContentType,
+	}
+	ctx, cancel := context.WithTimeout(rpc.WithNamespace(ctx, fo.namespace), fo.timeout)
+	defer cancel()
+	var resp *rpc.SearchResponse
+	switch {
+	case onlyRegister:
+		// Register takes a batch.
+		if !fo.batch {
+			payload := fo.payload.Subset([]int{0})
+			req.Payload, req.ContentType = payload.Body, payload.ContentType
+		}
+		resp, err = client.Register(ctx, req)
+	case fo.batch:
+		resp, err = client.BatchSearch(ctx, req)
+	default:
+		resp, err = client.Search(ctx, req)
+	}
+	result.ResponseTime = time.Now().UnixNano() - ta
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	resps := rpc.ToSearchQueryResponses(resp)
+	if len(resps) != fo.queries() {
+		result.Error = "Number of results does not match"
+		return result, nil
+	}
+	result.Success = true
+	return result, resps
+}
+
+func (fo *fanOut) requestNodeHTTP(ctx context.Context, bricks []BrickInfoWithNodeInfo, onlyRegister bool) (NodeQueryResponse, []api.SearchQueryResponse) {
+	ta := time.Now().UnixNano()
+	node := bricks[0]
+	values := url.Values{}
+	values.Add("featureGroupID", fmt.Sprintf("%d", fo.featureGroupID))
+	if onlyRegister {
+		values.Add("onlyRegister", "true")
+	} else {
+		values.Add("onlyRegister", "false")
+		values.Add("calcMode", fo.calcMode)
+		if fo.explain {
+			values.Add("explain", "true")
+		}
+	}
+	uniqueIDs := make([]string, 0, len(bricks))
+	for _, b := range bricks {
+		values.Add("uniqueID", b.UniqueID)
+		uniqueIDs = append(uniqueIDs, b.UniqueID)
+	}
+	path := "/api/v1/searchQuery"
+	if fo.batch {
+		path = "/api/v1/batchSearchQuery"
+	}
+	address := fmt.Sprintf(
+		"http://%s:%d%s?%s",
+		node.NodeIpAddress,
+		node.NodeApiPort,
+		catalog.NamespacePath(fo.namespace, path),
+		values.Encode(),
+	)
+	result := NodeQueryResponse{
+		NodeName: node.NodeName,
+		Address:  address,
+		Bricks:   uniqueIDs,
+	}
+	var resps []api.SearchQueryResponse
+
+	ctx, cancel := context.WithTimeout(ctx, fo.timeout)
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodPost, address, bytes.NewReader(fo.payload.Body))
+	req.Header.Set("Content-Type", fo.payload.ContentType)
+	tracing.Inject(ctx, req.Header)
+	logging.InjectRequestID(ctx, req.Header)
+	httpResp, err := nodeClient.Do(req.WithContext(ctx))
+	if err != nil {
+		result.ResponseTime = time.Now().UnixNano() - ta
+		result.Error = err.Error()
+		return result, resps
+	}
+	defer httpResp.Body.Close()
+	result.StatusCode = httpResp.StatusCode
+	b, err := ioutil.ReadAll(httpResp.Body)
+	result.ResponseTime = time.Now().UnixNano() - ta
+	if err != nil {
+		result.Error = err.Error()
+		return result, resps
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		result.Error = string(b)
+		return result, resps
+	}
+	if fo.batch {
+		var batchResp api.BatchSearchQueryResponse
+		err = json.Unmarshal(b, &batchResp)
+		resps = batchResp.Results
+	} else {
+		var resp api.SearchQueryResponse
+		err = json.Unmarshal(b, &resp)
+		resps = []api.SearchQueryResponse{resp}
+		result.Explain = resp.Explain
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	if len(resps) != fo.queries() {
+		result.Error = "Number of results does not match"
+		return result, nil
+	}
+	result.Success = true
+	return result, resps
+}
+
+func (fo *fanOut) queries() int {
+	if fo.batch {
+		return fo.payload.NumOfQueries
+	}
+	return 1
+}
+
+// search queries every brick once. A brick whose node fails or does not have it
+// is retried on its next replica, at most fo.retries times.
+// It returns the responses per node, the responses per brick keyed by uniqueID,
+// and the uniqueIDs of the bricks which nobody answered.
+func (fo *fanOut) search(ctx context.Context, replicaSets [][]BrickInfoWithNodeInfo) fanOutResult {
+	ta := time.Now()
+	group := metrics.Group(fo.featureGroupID)
+	defer func() {
+		metrics.ProxyQueries.WithLabelValues(fo.namespace, group).Add(float64(fo.queries()))
+		metrics.ProxySearchDuration.WithLabelValues(fo.namespace, group).Observe(time.Since(ta).Seconds())
+	}()
+	nodeResponses := []NodeQueryResponse{}
+	brickResponses := map[string]BrickQueryResponse{}
+	brickResults := map[string][]api.BrickSearchResult{}
+	unanswered := []string{}
+
+	pending := make([]*pendingBrick, 0, len(replicaSets))
+	for _, replicas := range replicaSets {
+		pending = append(pending, &pendingBrick{replicas: replicas})
+	}
+	failedNodes := map[string]bool{}
+	giveUp := func(pb *pendingBrick) {
+		b := pb.reported()
+		unanswered = append(unanswered, b.UniqueID)
+		brickResponses[b.UniqueID] = BrickQueryResponse{
+			UniqueID: b.UniqueID,
+			BrickID:  b.BrickID,
+			NodeName: b.NodeName,
+			Success:  false,
+			Attempts: pb.attempts,
+			Error:    pb.lastErr,
+		}
+	}
+
+	for round := 0; len(pending) > 0; round++ {
+		if round > fo.retries || ctx.Err() != nil {
+			for _, pb := range pending {
+				giveUp(pb)
+			}
+			break
+		}
+
+		// Plan one request per node.
+		plan := map[string][]*pendingBrick{}
+		nodeNames := []string{}
+		for _, pb := range pending {
+			for pb.next < len(pb.replicas) && failedNodes[pb.current().NodeName] {
+				pb.next += 1
+			}
+			if pb.next >= len(pb.replicas) {
+				giveUp(pb)
+				continue
+			}
+			nodeName := pb.current().NodeName
+			if _, ok := plan[nodeName]; !ok {
+				nodeNames = append(nodeNames, nodeName)
+			}
+			plan[nodeName] = append(plan[nodeName], pb)
+		}
+		sort.Strings(nodeNames)
+
+		ch := make(chan nodeResult)
+		for _, nodeName := range nodeNames {
+			go func(pbs []*pendingBrick) {
+				bricks := make([]BrickInfoWithNodeInfo, 0, len(pbs))
+				for _, pb := range pbs {
+					bricks = append(bricks, pb.current())
+				}
+				node, resps := fo.requestNode(ctx, bricks, false)
+				ch <- nodeResult{node: node, resps: resps, pending: pbs}
+			}(plan[nodeName])
+		}
+
+		retry := []*pendingBrick{}
+		for _ = range nodeNames {
+			res := <-ch
+			nodeResponses = append(nodeResponses, res.node)
+			if !res.node.Success {
+				failedNodes[res.node.NodeName] = true
+			}
+			results := map[string][]api.BrickSearchResult{}
+			for _, resp := range res.resps {
+				for _, br := range resp.Bricks {
+					results[br.UniqueID] = append(results[br.UniqueID], br)
+				}
+			}
+			for _, pb := range res.pending {
+				pb.attempts += 1
+				b := pb.current()
+				pb.tried = &b
+				brs := results[b.UniqueID]
+				switch {
+				case !res.node.Success:
+					pb.lastErr = res.node.Error
+				case len(brs) != fo.queries():
+					pb.lastErr = "No response for brick"
+				case !brs[0].Success:
+					pb.lastErr = brs[0].Error
+				default:
+					br := brs[0]
+					brickResults[b.UniqueID] = brs
+					brickResponses[b.UniqueID] = BrickQueryResponse{
+						UniqueID:    b.UniqueID,
+						BrickID:     b.BrickID,
+						NodeName:    b.NodeName,
+						Success:     true,
+						DataID:      br.DataID,
+						Distance:    br.Distance,
+						ElapsedTime: br.ElapsedTime,
+						Attempts:    pb.attempts,
+					}
+					continue
+				}
+				pb.next += 1
+				if pb.next >= len(pb.replicas) {
+					giveUp(pb)
+					continue
+				}
+				retry = append(retry, pb)
+			}
+		}
+		pending = retry
+	}
+	return fanOutResult{
+		nodeResponses:  nodeResponses,
+		brickResponses: brickResponses,
+		brickResults:   brickResults,
+		unanswered:     unanswered,
+	}
+}
+
+// register adds the queries as new data points into the brick.
+func (fo *fanOut) register(ctx context.Context, brick BrickInfoWithNodeInfo) (NodeQueryResponse, []api.SearchQueryResponse) {
+	result, resps := fo.requestNode(ctx, []BrickInfoWithNodeInfo{brick}, true)
+	if result.Success {
+		metrics.ProxyInserts.WithLabelValues(fo.namespace, metrics.Group(fo.featureGroupID)).Add(float64(len(resps)))
+	}
+	return result, resps
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+)
+
+func TestFanOut(t *testing.T) {
+	t.Run("it groups bricks per node successfully", testFanOut_search)
+	t.Run("it retries on another replica successfully", testFanOut_searchRetry)
+}
+
+// newTestNode starts a calc node stub which answers every named brick with distance.
+func newTestNode(t *testing.T, nodeName string, distance float64, requests *int) (*httptest.Server, func(uniqueID, brickID string) BrickInfoWithNodeInfo) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests += 1
+		resp := api.SearchQueryResponse{}
+		for _, uniqueID := range r.URL.Query()["uniqueID"] {
+			resp.Bricks = append(resp.Bricks, api.BrickSearchResult{
+				UniqueID: uniqueID,
+				Success:  true,
+				DataID:   "data-" + uniqueID,
+				Distance: distance,
+			})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	portInt, _ := strconv.Atoi(port)
+	return srv, func(uniqueID, brickID string) BrickInfoWithNodeInfo {
+		return BrickInfoWithNodeInfo{
+			BrickInfo:     state.BrickInfo{UniqueID: uniqueID, BrickID: brickID},
+			NodeName:      nodeName,
+			NodeIpAddress: host,
+			NodeApiPort:   portInt,
+		}
+	}
+}
+
+func testFanOut_search(t *testing.T) {
+	// prepare
+	requests := 0
+	srv, brickOf := newTestNode(t, "a", 1.0, &requests)
+	defer srv.Close()
+	fo := &fanOut{timeout: time.Second, retries: 1}
+	bricks := []BrickInfoWithNodeInfo{brickOf("u1", "b1"), brickOf("u2", "b2")}
+
+	// exec
+	res := fo.search(context.Background(), groupReplicas(bricks))
+	nodeResponses, brickResponses, unanswered := res.nodeResponses, res.brickResponses, res.unanswered
+
+	// assert
+	if requests != 1 || len(nodeResponses) != 1 {
+		t.Fatalf("fail. bricks on a node must be sent in one request. requests=%d", requests)
+	}
+	if len(unanswered) != 0 || len(brickResponses) != 2 {
+		t.Fatalf("fail. brick responses not match. %v", brickResponses)
+	}
+	if brickResponses["u2"].DataID != "data-u2" {
+		t.Fatalf("fail. dataID not match. %v", brickResponses["u2"])
+	}
+}
+
+func testFanOut_searchRetry(t *testing.T) {
+	// prepare
+	requests := 0
+	srv, brickOf := newTestNode(t, "b", 2.0, &requests)
+	defer srv.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	host, port, _ := net.SplitHostPort(down.Listener.Addr().String())
+	portInt, _ := strconv.Atoi(port)
+	down.Close()
+	fo := &fanOut{timeout: time.Second, retries: 1}
+	bricks := []BrickInfoWithNodeInfo{
+		{BrickInfo: state.BrickInfo{UniqueID: "u1", BrickID: "b1"}, NodeName: "a", NodeIpAddress: host, NodeApiPort: portInt},
+		brickOf("u1-replica", "b1"),
+		{BrickInfo: state.BrickInfo{UniqueID: "u2", BrickID: "b2"}, NodeName: "a", NodeIpAddress: host, NodeApiPort: portInt},
+	}
+
+	// exec
+	res := fo.search(context.Background(), groupReplicas(bricks))
+	nodeResponses, brickResponses, unanswered := res.nodeResponses, res.brickResponses, res.unanswered
+
+	// assert
+	if len(nodeResponses) != 2 {
+		t.Fatalf("fail. number of node requests not match. %v", nodeResponses)
+	}
+	if !brickResponses["u1-replica"].Success || brickResponses["u1-replica"].Attempts != 2 {
+		t.Fatalf("fail. replica not used. %v", brickResponses)
+	}
+	if len(unanswered) != 1 || unanswered[0] != "u2" || brickResponses["u2"].Success {
+		t.Fatalf("fail. unanswered bricks not match. %v", unanswered)
+	}
+}
@@ -0,0 +1,296 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/api/rpc"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+	"github.com/abeja-inc/feature-search-db/pkg/tracing"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// proxyServer is the gRPC API of the reverse proxy. It works the same as the HTTP API.
+type proxyServer struct {
+	peer *state.Peer
+	c    *cluster.ClusterConfigInfo
+}
+
+var _ rpc.FeatureDBServer = &proxyServer{}
+
+// StartReverseProxyGrpcServer serves the gRPC API on c.GrpcListen.
+func StartReverseProxyGrpcServer(peer *state.Peer, c *cluster.ClusterConfigInfo, logger *zap.Logger, errs chan error) *grpc.Server {
+	logger = logger.Named("proxy")
+	SetSlowQueryThreshold(c.Runtime().SlowQueryThreshold)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(logging.UnaryServerInterceptor(logger), tracing.UnaryServerInterceptor),
+		grpc.ChainStreamInterceptor(logging.StreamServerInterceptor(logger), tracing.StreamServerInterceptor),
+	)
+	rpc.RegisterFeatureDBServer(srv, &proxyServer{peer: peer, c: c})
+	go func(errs chan error) {
+		lis, err := net.Listen("tcp", *c.GrpcListen)
+		if err != nil {
+			errs <- err
+			return
+		}
+		logger.Info("gRPC server starting", zap.String("address", *c.GrpcListen))
+		if err := srv.Serve(lis); err != nil && err != grpc.ErrServerStopped {
+			errs <- err
+		}
+	}(errs)
+	return srv
+}
+
+// paramsOfRequest reads the same parameters as parseProxyQueryParams from req of the namespace.
+func paramsOfRequest(namespace string, req *rpc.SearchRequest, c *cluster.ClusterConfigInfo, groups catalog.Store) (proxyQueryParams, error) {
+	rt := c.Runtime()
+	params := proxyQueryParams{
+		featureGroupID: int(req.FeatureGroupId),
+		calcMode:       req.CalcMode,
+		nodeTimeout:    rt.NodeTimeout,
+		retries:        rt.NodeRetries,
+		searchOnly:     req.SearchOnly,
+		selector: RegisterSelector{
+			Zone:   req.Zone,
+			Labels: req.NodeSelector,
+		},
+	}
+	if params.calcMode == "" {
+		params.calcMode = string(api.CalcModeNaive)
+	}
+	ns, err := catalog.LookupNamespace(groups, namespace)
+	if err != nil {
+		return params, status.Error(codes.NotFound, err.Error())
+	}
+	params.namespace = ns
+	group, err := catalog.Lookup(groups, namespace, params.featureGroupID)
+	if err != nil {
+		return params, status.Error(codes.NotFound, err.Error())
+	}
+	params.group = group
+	params.noveltyThreshold = noveltyThresholdOf(rt, group)
+	if req.NoveltyThreshold != nil {
+		if req.NoveltyThreshold.Value < 0 {
+			return params, status.Error(codes.InvalidArgument, "Invalid noveltyThreshold")
+		}
+		params.noveltyThreshold = req.NoveltyThreshold.Value
+	}
+	if req.TimeoutMs < 0 {
+		return params, status.Error(codes.InvalidArgument, "Invalid timeout")
+	}
+	if req.TimeoutMs > 0 {
+		params.nodeTimeout = time.Duration(req.TimeoutMs) * time.Millisecond
+	}
+	return params, nil
+}
+
+// payloadOfRequest returns the queries of req as a batch payload.
+// Vectors are packed as binary vectors of the dtype of g, and a payload is forwarded as is.
+func payloadOfRequest(req *rpc.SearchRequest, batch bool, g catalog.Group) (QueryPayload, error) {
+	var payload QueryPayload
+	var err error
+	if len(req.Payload) > 0 {
+		payload, err = ParseQueryPayload(req.ContentType, req.Payload, batch)
+	} else {
+		if !batch && len(req.Vectors) != 1 {
+			return payload, status.Error(codes.InvalidArgument, "Exactly one vector must be sent")
+		}
+		vecs := make([][512]float64, len(req.Vectors))
+		for i, v := range req.Vectors {
+			if len(v.Vals) != len(vecs[i]) {
+				return payload, status.Errorf(codes.InvalidArgument, "Invalid dimension (%d)", len(v.Vals))
+			}
+			copy(vecs[i][:], v.Vals)
+		}
+		payload, err = ParseQueryPayload(ContentTypeVectors, EncodeVectors(vecs, g.DType == catalog.DTypeFloat32), true)
+	}
+	if err == nil {
+		err = payload.CheckGroup(g)
+	}
+	if err != nil {
+		return payload, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !batch {
+		// The batch endpoints of calc nodes take the JSON of a batch.
+		payload = payload.Subset([]int{0})
+	}
+	return payload, nil
+}
+
+func toSearchResponse(resp ProxyBatchQueryResponse) *rpc.SearchResponse {
+	result := &rpc.SearchResponse{
+		Results:          make([]*rpc.SearchResult, 0, len(resp.Results)),
+		Partial:          resp.Partial,
+		UnansweredBricks: resp.UnansweredBricks,
+		ElapsedTime:      resp.RequestProcessTime,
+	}
+	for _, r := range resp.Results {
+		result.Results = append(result.Results, &rpc.SearchResult{
+			DataId:           r.DataID,
+			Distance:         r.Distance,
+			IsNew:            r.IsNew,
+			Registered:       r.Registered,
+			NoveltyThreshold: r.NoveltyThreshold,
+		})
+	}
+	return result
+}
+
+func (s *proxyServer) search(ctx context.Context, req *rpc.SearchRequest, batch bool, onlyRegister bool) (ProxyBatchQueryResponse, error) {
+	ta := time.Now().UnixNano()
+	params, err := paramsOfRequest(rpc.NamespaceOf(ctx), req, s.c, s.peer)
+	if err != nil {
+		return ProxyBatchQueryResponse{}, err
+	}
+	params.onlyRegister = onlyRegister
+	payload, err := payloadOfRequest(req, batch, params.group)
+	if err != nil {
+		return ProxyBatchQueryResponse{}, err
+	}
+	resp := runBatchQuery(ctx, s.peer, s.c, params, payload)
+	resp.RequestProcessTime = time.Now().UnixNano() - ta
+	if !onlyRegister {
+		method, _ := grpc.Method(ctx)
+		recordSlowQuery(ctx, method, params.namespace.Name, params.featureGroupID, payload.NumOfQueries, resp.RequestProcessTime, explainNodes(resp.NodeResponses, nil))
+	}
+	return resp, nil
+}
+
+func (s *proxyServer) Search(ctx context.Context, req *rpc.SearchRequest) (*rpc.SearchResponse, error) {
+	resp, err := s.search(ctx, req, false, false)
+	if err != nil {
+		return nil, err
+	}
+	return toSearchResponse(resp), nil
+}
+
+func (s *proxyServer) BatchSearch(ctx context.Context, req *rpc.SearchRequest) (*rpc.SearchResponse, error) {
+	resp, err := s.search(ctx, req, true, false)
+	if err != nil {
+		return nil, err
+	}
+	return toSearchResponse(resp), nil
+}
+
+func (s *proxyServer) StreamSearch(stream rpc.FeatureDB_StreamSearchServer) error {
+	return rpc.ServeStream(stream, func(ctx context.Context, req *rpc.SearchRequest) (*rpc.SearchResponse, error) {
+		return s.Search(ctx, req)
+	})
+}
+
+// Register adds the vectors together into the brick chosen as the HTTP API does.
+func (s *proxyServer) Register(ctx context.Context, req *rpc.SearchRequest) (*rpc.SearchResponse, error) {
+	resp, err := s.search(ctx, req, true, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.NodeResponses) == 0 {
+		return nil, status.Error(codes.ResourceExhausted, "No brick to register")
+	}
+	if node := resp.NodeResponses[0]; !node.Success {
+		return nil, status.Error(codes.Unavailable, node.Error)
+	}
+	return toSearchResponse(resp), nil
+}
+
+// Delete asks every node with a brick of the feature group to delete the data points.
+func (s *proxyServer) Delete(ctx context.Context, req *rpc.DeleteRequest) (*rpc.DeleteResponse, error) {
+	ns := rpc.NamespaceOf(ctx)
+	nodes := map[string]string{}
+	for _, b := range bricksOfGroup(s.peer.GetAllState(), ns, int(req.FeatureGroupId)) {
+		if req.UniqueId == "" || req.UniqueId == b.UniqueID {
+			nodes[b.NodeName] = b.NodeGrpcAddress
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, status.Error(codes.NotFound, "Not found Brick")
+	}
+
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	deleted := map[string]bool{}
+	failed := []string{}
+	for nodeName, address := range nodes {
+		wg.Add(1)
+		go func(nodeName string, address string) {
+			defer wg.Done()
+			var resp *rpc.DeleteResponse
+			err := fmt.Errorf("gRPC is not served")
+			if address != "" {
+				var client rpc.FeatureDBClient
+				client, err = nodeConns.client(address)
+				if err == nil {
+					ctx, cancel := context.WithTimeout(rpc.WithNamespace(ctx, ns), s.c.Runtime().NodeTimeout)
+					defer cancel()
+					resp, err = client.Delete(ctx, req)
+				}
+			}
+			mtx.Lock()
+			defer mtx.Unlock()
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", nodeName, err))
+				return
+			}
+			for _, dataID := range resp.Deleted {
+				deleted[dataID] = true
+			}
+		}(nodeName, address)
+	}
+	wg.Wait()
+
+	resp := &rpc.DeleteResponse{}
+	for _, dataID := range req.DataIds {
+		if deleted[dataID] {
+			resp.Deleted = append(resp.Deleted, dataID)
+		} else {
+			resp.NotFound = append(resp.NotFound, dataID)
+		}
+	}
+	// A data point which was not found may be on a node which has failed.
+	if len(resp.NotFound) > 0 && len(failed) > 0 {
+		sort.Strings(failed)
+		return nil, status.Errorf(codes.Unavailable, "Failed to delete on nodes (%s)", strings.Join(failed, ", "))
+	}
+	return resp, nil
+}
+
+func (s *proxyServer) ListBricks(ctx context.Context, req *rpc.ListBricksRequest) (*rpc.ListBricksResponse, error) {
+	ns := rpc.NamespaceOf(ctx)
+	resp := &rpc.ListBricksResponse{}
+	for nodeName, v := range s.peer.GetAllState().NodeInfos {
+		for _, b := range brickInfosOfNode(nodeName, v) {
+			if b.GetNamespace() != ns {
+				continue
+			}
+			if req.FeatureGroupId != nil && int32(b.FeatureGroupID) != req.FeatureGroupId.Value {
+				continue
+			}
+			resp.Bricks = append(resp.Bricks, &rpc.Brick{
+				UniqueId:             b.UniqueID,
+				BrickId:              b.BrickID,
+				FeatureGroupId:       int32(b.FeatureGroupID),
+				NumOfBrickTotalCap:   int64(b.NumOfBrickTotalCap),
+				NumOfAvailablePoints: int64(b.NumOfAvailablePoints),
+				NodeName:             nodeName,
+				NodeAddress:          v.APIAddress(),
+			})
+		}
+	}
+	sort.Slice(resp.Bricks, func(i, j int) bool {
+		return resp.Bricks[i].UniqueId < resp.Bricks[j].UniqueId
+	})
+	return resp, nil
+}
@@ -2,4 +2,7 @@ package proxy
 
 type QueryInputForm struct {
 	Vals [512]float64 `json:"vals"`
-}
\ No newline at end of file
+}
+type BatchQueryInputForm struct {
+	Queries []QueryInputForm `json:"queries"`
+}
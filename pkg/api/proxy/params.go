@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+)
+
+// proxyQueryParams are the query parameters shared by the search endpoints of the proxy.
+type proxyQueryParams struct {
+	namespace        catalog.Namespace
+	featureGroupID   int
+	group            catalog.Group
+	calcMode         string
+	noveltyThreshold float64
+	nodeTimeout      time.Duration
+	retries          int
+	// searchOnly never registers the query even if it is new.
+	searchOnly bool
+	// onlyRegister registers the queries without searching (batch only).
+	onlyRegister bool
+	// explain asks the calc nodes how they ran the search.
+	explain  bool
+	selector RegisterSelector
+}
+
+func parseProxyQueryParams(namespace string, v url.Values, c *cluster.ClusterConfigInfo, groups catalog.Store) (proxyQueryParams, error) {
+	var err error
+	rt := c.Runtime()
+	params := proxyQueryParams{
+		calcMode:    string(api.CalcModeNaive),
+		nodeTimeout: rt.NodeTimeout,
+		retries:     rt.NodeRetries,
+		selector:    newRegisterSelector(v),
+	}
+	params.namespace, err = catalog.LookupNamespace(groups, namespace)
+	if err != nil {
+		return params, err
+	}
+
+	// An alias is resolved once here, and the nodes are sent the ID of its group.
+	if _, ok := v["alias"]; ok {
+		params.featureGroupID, err = catalog.ResolveAlias(groups, namespace, v["alias"][0])
+		if err != nil {
+			return params, err
+		}
+	} else {
+		if _, ok := v["featureGroupID"]; !ok {
+			return params, errors.New("FeatureGroupID or alias must be specified")
+		}
+		params.featureGroupID, err = strconv.Atoi(v["featureGroupID"][0])
+		if err != nil {
+			return params, errors.New("Invalid FeatureGroupID")
+		}
+	}
+	params.group, err = catalog.Lookup(groups, namespace, params.featureGroupID)
+	if err != nil {
+		return params, err
+	}
+
+	if _, ok := v["calcMode"]; ok {
+		params.calcMode = v["calcMode"][0]
+	}
+
+	params.noveltyThreshold = noveltyThresholdOf(rt, params.group)
+	if _, ok := v["noveltyThreshold"]; ok {
+		params.noveltyThreshold, err = strconv.ParseFloat(v["noveltyThreshold"][0], 64)
+		if err != nil || params.noveltyThreshold < 0 {
+			return params, errors.New("Invalid noveltyThreshold")
+		}
+	}
+
+	if _, ok := v["timeout"]; ok {
+		params.nodeTimeout, err = time.ParseDuration(v["timeout"][0])
+		if err != nil || params.nodeTimeout <= 0 {
+			return params, errors.New("Invalid timeout")
+		}
+	}
+
+	if _, ok := v["searchOnly"]; ok {
+		params.searchOnly, err = strconv.ParseBool(v["searchOnly"][0])
+		if err != nil {
+			return params, errors.New("Invalid Flag (searchOnly)")
+		}
+	}
+
+	if _, ok := v["onlyRegister"]; ok {
+		params.onlyRegister, err = strconv.ParseBool(v["onlyRegister"][0])
+		if err != nil {
+			return params, errors.New("Invalid Flag (onlyRegister)")
+		}
+	}
+
+	if _, ok := v["explain"]; ok {
+		params.explain, err = strconv.ParseBool(v["explain"][0])
+		if err != nil {
+			return params, errors.New("Invalid Flag (explain)")
+		}
+	}
+	return params, nil
+}
+
+// bricksOfGroup lists the bricks of the feature group of the namespace in the cluster.
+func bricksOfGroup(status state.StateContent, namespace string, featureGroupID int) []BrickInfoWithNodeInfo {
+	bricks := []BrickInfoWithNodeInfo{}
+	for nodeName, v := range status.NodeInfos {
+		for _, b := range brickInfosOfNode(nodeName, v) {
+			if b.FeatureGroupID == featureGroupID && b.GetNamespace() == namespace {
+				bricks = append(bricks, b)
+			}
+		}
+	}
+	return bricks
+}
+
+// allowsRegistration tells whether n more data points fit in the capacity of the group
+// and the quota of its namespace.
+func (params proxyQueryParams) allowsRegistration(status state.StateContent, bricks []BrickInfoWithNodeInfo, n int) bool {
+	if !params.group.Capacity.Allows(pointsOfGroup(bricks), n) {
+		return false
+	}
+	return params.namespace.Quota.Check(status.Usage(params.namespace.Name), n, 0) == nil
+}
+
+// noveltyThresholdOf returns the threshold of the catalog, or else the one the proxy is configured with.
+func noveltyThresholdOf(rt *cluster.Runtime, g catalog.Group) float64 {
+	if g.NoveltyThreshold != nil {
+		return *g.NoveltyThreshold
+	}
+	return rt.GetNoveltyThreshold(g.ID)
+}
+
+// statusOfParamsError tells the HTTP status of an error of parseProxyQueryParams.
+func statusOfParamsError(err error) int {
+	if errors.Is(err, catalog.ErrUnknownGroup) || errors.Is(err, catalog.ErrUnknownAlias) || errors.Is(err, catalog.ErrUnknownNamespace) {
+		return http.StatusNotFound
+	}
+	return http.StatusUnprocessableEntity
+}
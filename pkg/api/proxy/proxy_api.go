@@ -1,23 +1,23 @@
 package proxy
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"net/url"
-	"os"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/health"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+	"github.com/abeja-inc/feature-search-db/pkg/metrics"
+	"github.com/abeja-inc/feature-search-db/pkg/reload"
 	"github.com/abeja-inc/feature-search-db/pkg/state"
-	httptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gorilla/mux"
+	"github.com/abeja-inc/feature-search-db/pkg/tracing"
 
-	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
 )
 
 // ---------------------- API for ReverseProxy -----------------------------
@@ -26,120 +26,67 @@ type BrickInfoWithNodeInfo struct {
 	state.BrickInfo
 	NodeName      string `json:"nodeName"`
 	NodeIpAddress string `json:"nodeIpAddress"`
-	NodeApiPort   int    `json:nodeApiPort`
+	NodeApiPort   int    `json:"nodeApiPort"`
+	// NodeGrpcAddress is empty when the node does not serve gRPC.
+	NodeGrpcAddress string         `json:"nodeGrpcAddress,omitempty"`
+	NodeMeta        state.NodeMeta `json:"nodeMeta"`
 }
 
-type NodeStatResponse struct {
-	Success      bool   `json:"success"`
-	Address      string `json:"address"`
-	ResponseTime int64  `json:"responseTime"`
-	Contents     string `json:"contents"`
-	StatusCode   int    `json:"statusCode"`
+// NodeQueryResponse is the outcome of one request to a calc node.
+type NodeQueryResponse struct {
+	NodeName     string   `json:"nodeName"`
+	Success      bool     `json:"success"`
+	Address      string   `json:"address"`
+	Bricks       []string `json:"bricks"`
+	ResponseTime int64    `json:"responseTime"`
+	StatusCode   int      `json:"statusCode"`
+	Error        string   `json:"error,omitempty"`
+	// Explain is how the node ran the search, with explain=true.
+	Explain *api.SearchExplain `json:"explain,omitempty"`
 }
 
-type ProxyStatResponse struct {
-	Bricks             []BrickInfoWithNodeInfo     `json:"bricks"`
-	Response           map[string]NodeStatResponse `json:"responses"`
-	RequestProcessTime int64                       `json:"requestProcessTime"`
-}
-
-type NodeQueryResponse struct {
-	Success      bool    `json:"success"`
-	Address      string  `json:"address"`
-	ResponseTime int64   `json:"responseTime"`
-	DataID       string  `json:"dataID"`
-	Distance     float64 `json:"distance"`
-	StatusCode   int     `json:"statusCode"`
+// BrickQueryResponse is the nearest data point found in a brick.
+type BrickQueryResponse struct {
+	UniqueID    string  `json:"uniqueID"`
+	BrickID     string  `json:"brickID"`
+	NodeName    string  `json:"nodeName"`
+	Success     bool    `json:"success"`
+	DataID      string  `json:"dataID"`
+	Distance    float64 `json:"distance"`
+	ElapsedTime int64   `json:"elapsedTime"`
+	Attempts    int     `json:"attempts"`
+	Error       string  `json:"error,omitempty"`
 }
 
 type ProxyQueryResult struct {
-	DataID   string  `json:"dataID"`
-	Distance float64 `json:"distance"`
-	IsNew    bool    `json:"isNew"`
+	DataID           string  `json:"dataID"`
+	Distance         float64 `json:"distance"`
+	IsNew            bool    `json:"isNew"`
+	Registered       bool    `json:"registered"`
+	NoveltyThreshold float64 `json:"noveltyThreshold"`
 }
 
 type ProxyQueryResponse struct {
-	Bricks             []BrickInfoWithNodeInfo      `json:"bricks"`
-	NodeResponse       map[string]NodeQueryResponse `json:"nodeResponses"`
-	Result             ProxyQueryResult             `json:"result"`
-	RequestProcessTime int64                        `json:"requestProcessTime"`
+	Bricks             []BrickInfoWithNodeInfo       `json:"bricks"`
+	NodeResponses      []NodeQueryResponse           `json:"nodeResponses"`
+	BrickResponses     map[string]BrickQueryResponse `json:"brickResponses"`
+	Result             ProxyQueryResult              `json:"result"`
+	Partial            bool                          `json:"partial"`
+	UnansweredBricks   []string                      `json:"unansweredBricks"`
+	RequestProcessTime int64                         `json:"requestProcessTime"`
+	Explain            *ProxyExplain                 `json:"explain,omitempty"`
 }
 
-func handlerOfProxyStat(peer *state.Peer) func(w http.ResponseWriter, r *http.Request) {
+func handlerOfProxyQuery(peer *state.Peer, c *cluster.ClusterConfigInfo) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		t_start := time.Now().UnixNano()
-		// Allow only POST Method
-		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			w.Write([]byte("Invalid method"))
-			return
-		}
-		// Create NodeLists
-		status := peer.GetAllState()
-		bricks := []BrickInfoWithNodeInfo{}
-		for nodeName, v := range status.NodeInfos {
-			for _, v2 := range *v.Bricks {
-				nodeAPIPorts := strings.Split(v.ApiPort, ":")
-				nodeAPIPortInt, _ := strconv.Atoi(nodeAPIPorts[1])
-				bricks = append(bricks, BrickInfoWithNodeInfo{
-					v2,
-					nodeName,
-					v.IpAddress,
-					nodeAPIPortInt,
-				})
-			}
-		}
-
-		// Access Each Node
-		responses := map[string]NodeStatResponse{}
-		for _, brick := range bricks {
-			ta := time.Now().UnixNano()
-			address := fmt.Sprintf("http://%s:%d/", brick.NodeIpAddress, brick.NodeApiPort)
-			resp, err := http.Get(address)
-			if err != nil {
-				responses[brick.NodeName] = NodeStatResponse{
-					Success: false,
-				}
-				return
-			}
-			defer resp.Body.Close()
-			b, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				responses[brick.NodeName] = NodeStatResponse{
-					Success: false,
-				}
-				return
-			}
-			tb := time.Now().UnixNano()
-			responses[brick.NodeName] = NodeStatResponse{
-				Address:      address,
-				Success:      true,
-				ResponseTime: tb - ta,
-				Contents:     string(b),
-			}
-		}
-
-		t_end := time.Now().UnixNano()
-
-		jsonBytes, _ := json.Marshal(ProxyStatResponse{
-			Bricks:             bricks,
-			Response:           responses,
-			RequestProcessTime: (t_end - t_start),
-		})
-		w.WriteHeader(http.StatusOK)
-		w.Write(jsonBytes)
-	}
-}
-
-func handlerOfProxyQuery(peer *state.Peer) func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		span := tracer.StartSpan("handlerOfProxyQuery")
+		span, ctx := tracing.StartSpan(r.Context(), "handlerOfProxyQuery")
 		defer span.Finish()
-		var childSpan tracer.Span
+		var childSpan tracing.Span
 		span.SetTag("http.url", r.URL.Path)
 
-		childSpan = tracer.StartSpan("validationRequest", tracer.ChildOf(span.Context()))
+		childSpan, _ = tracing.StartSpan(ctx, "validationRequest")
 		t_start := time.Now().UnixNano()
+		pt := api.NewPhaseTimer()
 
 		// Allow only POST Method
 		if r.Method != http.MethodPost {
@@ -149,40 +96,18 @@ func handlerOfProxyQuery(peer *state.Peer) func(w http.ResponseWriter, r *http.R
 		}
 		defer r.Body.Close()
 
-		// Check Content-Type
-		contentType := r.Header.Get("Content-Type")
-		if strings.ToLower(contentType) != "application/json" {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			w.Write([]byte("Invalid Content-Type"))
-			return
-		}
-
 		// Check GET Query
 		v := r.URL.Query()
-
-		if _, ok := v["featureGroupID"]; !ok {
-			jsonBytes, _ := json.Marshal(struct {
-				Msg string `json:"msg"`
-			}{"FeatureGroupID must be specified"})
-			w.WriteHeader(http.StatusUnprocessableEntity)
-			w.Write(jsonBytes)
-			return
-		}
-		featureGroupIDint, err := strconv.Atoi(v["featureGroupID"][0])
+		params, err := parseProxyQueryParams(catalog.NamespaceOf(r), v, c, peer)
 		if err != nil {
 			jsonBytes, _ := json.Marshal(struct {
 				Msg string `json:"msg"`
-			}{"Invalid FeatureGroupID"})
-			w.WriteHeader(http.StatusUnprocessableEntity)
+			}{err.Error()})
+			w.WriteHeader(statusOfParamsError(err))
 			w.Write(jsonBytes)
 			return
 		}
 
-		calcMode := string(api.CalcModeNaive)
-		if _, ok := v["calcMode"]; ok {
-			calcMode = v["calcMode"][0]
-		}
-
 		// Parse Payload that Client has sent
 		query, err := ioutil.ReadAll(r.Body)
 		if err != nil {
@@ -195,167 +120,108 @@ func handlerOfProxyQuery(peer *state.Peer) func(w http.ResponseWriter, r *http.R
 		}
 		childSpan.Finish()
 
-		childSpan = tracer.StartSpan("requestBinding", tracer.ChildOf(span.Context()))
-		var queryInputForm QueryInputForm
-		err = json.Unmarshal(query, &queryInputForm)
+		// The payload is checked here and forwarded to calc nodes without encoding it again.
+		childSpan, _ = tracing.StartSpan(ctx, "requestBinding")
+		payload, err := ParseQueryPayload(r.Header.Get("Content-Type"), query, false)
+		if err == ErrInvalidContentType {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid Content-Type"))
+			return
+		}
+		if err == nil {
+			err = payload.CheckGroup(params.group)
+		}
 		if err != nil {
 			jsonBytes, _ := json.Marshal(struct {
 				Msg string `json:"msg"`
-			}{"Failed to parse json."})
+			}{err.Error()})
 			w.WriteHeader(http.StatusUnprocessableEntity)
 			w.Write(jsonBytes)
 			return
 		}
 		childSpan.Finish()
+		pt.Done("parse")
 
 		// Create NodeLists
-		childSpan = tracer.StartSpan("createNodeLists", tracer.ChildOf(span.Context()))
+		childSpan, _ = tracing.StartSpan(ctx, "createNodeLists")
 		status := peer.GetAllState()
-		bricks := []BrickInfoWithNodeInfo{}
-
-		var minBrick BrickInfoWithNodeInfo
-		minUsageVal := float64(100.0)
-
-		for nodeName, v := range status.NodeInfos {
-			for _, v2 := range *v.Bricks {
-				if v2.FeatureGroupID == featureGroupIDint {
-					// Add BrickList
-					nodeAPIPorts := strings.Split(v.ApiPort, ":")
-					nodeAPIPortInt, _ := strconv.Atoi(nodeAPIPorts[1])
-					tmp := BrickInfoWithNodeInfo{
-						v2,
-						nodeName,
-						v.IpAddress,
-						nodeAPIPortInt,
-					}
-					usage := float64(v2.NumOfAvailablePoints * 100.0 / v2.NumOfBrickTotalCap)
-					if usage < minUsageVal {
-						minBrick = tmp
-						minUsageVal = usage
-					}
-					bricks = append(bricks, tmp)
-				}
-			}
-		}
-		childSpan.Finish()
-
-		childSpan = tracer.StartSpan("marshalQueryInputForm", tracer.ChildOf(span.Context()))
-		querbyBytes, err := json.Marshal(queryInputForm)
+		bricks := bricksOfGroup(status, params.namespace.Name, params.featureGroupID)
+		minBrick, hasRegisterTarget := selectBrickForRegistration(bricks, params.selector, 1)
+		hasRegisterTarget = hasRegisterTarget && params.allowsRegistration(status, bricks, 1)
 		childSpan.Finish()
+		pt.Done("route")
 
 		// Access Each Node
-		processEachNode := func(ch chan map[string]NodeQueryResponse, brick BrickInfoWithNodeInfo, onlyRegister bool) {
-			ta := time.Now().UnixNano()
-			values := url.Values{}
-			values.Add("featureGroupID", fmt.Sprintf("%d", featureGroupIDint))
-			if onlyRegister {
-				values.Add("onlyRegister", "true")
-			} else {
-				values.Add("onlyRegister", "false")
-				values.Add("calcMode", calcMode)
-			}
-			address := fmt.Sprintf(
-				"http://%s:%d/api/v1/searchQuery?%s",
-				brick.NodeIpAddress,
-				brick.NodeApiPort,
-				values.Encode(),
-			)
-			resp, err := http.Post(
-				address,
-				"application/json",
-				bytes.NewBuffer(querbyBytes),
-			)
-			if err != nil {
-				fmt.Printf("error communicating query api\n")
-				ch <- map[string]NodeQueryResponse{
-					brick.NodeName: NodeQueryResponse{
-						Success: false,
-					},
-				}
-				return
-			}
-			defer resp.Body.Close()
-			b, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				ch <- map[string]NodeQueryResponse{
-					brick.NodeName: NodeQueryResponse{
-						Success: false,
-					},
-				}
-				return
-			}
-
-			var tmp struct {
-				DataID      string  `json:"dataID"`
-				Distance    float64 `json:"distance"`
-				ElapsedTime int64   `json:"elapsedTime"`
-			}
-			json.Unmarshal(b, &tmp)
-
-			tb := time.Now().UnixNano()
-			ch <- map[string]NodeQueryResponse{
-				brick.NodeName: NodeQueryResponse{
-					Address:      address,
-					Success:      true,
-					ResponseTime: tb - ta,
-					DataID:       tmp.DataID,
-					Distance:     tmp.Distance,
-					StatusCode:   resp.StatusCode,
-				},
-			}
-		}
-
-		childSpan = tracer.StartSpan("processEachNode", tracer.ChildOf(span.Context()))
-		ch := make(chan map[string]NodeQueryResponse)
-		for _, brick := range bricks {
-			go processEachNode(ch, brick, false)
+		fo := &fanOut{
+			namespace:      params.namespace.Name,
+			featureGroupID: params.featureGroupID,
+			calcMode:       params.calcMode,
+			payload:        payload,
+			timeout:        params.nodeTimeout,
+			retries:        params.retries,
+			explain:        params.explain,
 		}
+		childSpan, nodeCtx := tracing.StartSpan(ctx, "processEachNode")
+		res := fo.search(nodeCtx, groupReplicas(bricks))
+		nodeResponses, brickResponses, unansweredBricks := res.nodeResponses, res.brickResponses, res.unanswered
+		pt.Done("fanOut")
 
 		// Merge
-		responses := map[string]NodeQueryResponse{}
+		// Failed responses carry no distance, so they are left out of the comparison.
 		recvCnt := 0
 		var minDataID string
 		var minDistance float64
-		for _ = range bricks {
-			for k, v := range <-ch {
-				if recvCnt == 0 {
-					minDataID = v.DataID
-					minDistance = v.Distance
-				} else {
-					if minDistance > v.Distance {
-						minDataID = v.DataID
-						minDistance = v.Distance
-					}
-				}
-				responses[k] = v
-				recvCnt += 1
+		for _, v := range brickResponses {
+			if !v.Success || v.DataID == "" {
+				continue
 			}
-		}
-		childSpan.Finish()
-
-		isNew := false
-		// TODO: Implement load distance parameter from outside
-		if minDistance > 100.0 {
-			isNew = true
-			go processEachNode(ch, minBrick, true)
-			for _, v := range <-ch {
+			if recvCnt == 0 || minDistance > v.Distance {
 				minDataID = v.DataID
 				minDistance = v.Distance
 			}
+			recvCnt += 1
+		}
+		partial := len(unansweredBricks) > 0
+		childSpan.Finish()
+		pt.Done("merge")
+
+		// The nearest point may be in an unanswered brick, so a partial result is never registered.
+		isNew := recvCnt > 0 && minDistance > params.noveltyThreshold
+		registered := false
+		if isNew && !params.searchOnly && !partial && hasRegisterTarget {
+			node, resps := fo.register(ctx, minBrick)
+			nodeResponses = append(nodeResponses, node)
+			if node.Success && resps[0].Registered {
+				minDataID = resps[0].DataID
+				minDistance = resps[0].Distance
+				registered = true
+			}
+			pt.Done("register")
 		}
 
 		t_end := time.Now().UnixNano()
+		explain := explainNodes(nodeResponses, pt)
+		recordSlowQuery(ctx, r.URL.Path, params.namespace.Name, params.featureGroupID, 1, t_end-t_start, explain)
+		if !params.explain {
+			explain = nil
+		}
 
-		childSpan = tracer.StartSpan("marshalProxyQueryResponse", tracer.ChildOf(span.Context()))
+		childSpan, _ = tracing.StartSpan(ctx, "marshalProxyQueryResponse")
 		jsonBytes, _ := json.Marshal(ProxyQueryResponse{
-			Bricks:       bricks,
-			NodeResponse: responses,
+			Bricks:         bricks,
+			NodeResponses:  nodeResponses,
+			BrickResponses: brickResponses,
 			Result: ProxyQueryResult{
-				DataID:   minDataID,
-				Distance: minDistance,
-				IsNew:    isNew,
+				DataID:           minDataID,
+				Distance:         minDistance,
+				IsNew:            isNew,
+				Registered:       registered,
+				NoveltyThreshold: params.noveltyThreshold,
 			},
+			Partial:            partial,
+			UnansweredBricks:   unansweredBricks,
 			RequestProcessTime: (t_end - t_start),
+			Explain:            explain,
 		})
 		w.WriteHeader(http.StatusOK)
 		w.Write(jsonBytes)
@@ -363,28 +229,47 @@ func handlerOfProxyQuery(peer *state.Peer) func(w http.ResponseWriter, r *http.R
 	}
 }
 
-func StartReverseProxy(peer *state.Peer, httpListen string, errs chan error) {
+func StartReverseProxy(peer *state.Peer, c *cluster.ClusterConfigInfo, ready *health.Checker, rl *reload.Reloader, logger *zap.Logger, errs chan error) *http.Server {
+	httpListen := *c.FeatureApiHttpListen
 
-	logger := log.New(os.Stderr, "(Reverse API) > ", log.LstdFlags)
+	logger = logger.Named("proxy")
 
-	logRequest := func(handler http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			fmt.Printf("%s %s %s\n", r.RemoteAddr, r.Method, r.URL)
-			handler.ServeHTTP(w, r)
-		})
+	r := mux.NewRouter()
+	r.Use(logging.Middleware(logger), tracing.Middleware, catalog.Middleware(peer))
+	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("{\"Status\": \"OK From Reverse Proxy\"}"))
+	})
+	r.HandleFunc("/healthz", health.LivenessHandler())
+	r.HandleFunc("/readyz", ready.ReadinessHandler())
+	r.HandleFunc("/stat", handlerOfProxyStat(peer, c, false))
+	r.HandleFunc("/api/v1/namespaces", catalog.NamespaceListHandler(peer))
+	r.HandleFunc("/api/v1/namespaces/{namespace}", catalog.NamespaceHandler(peer))
+	catalog.HandleFunc(r, "/api/v1/stat", handlerOfProxyStat(peer, c, true))
+	catalog.HandleFunc(r, "/api/v1/bricks", handlerOfProxyBricks(peer))
+	catalog.HandleFunc(r, "/api/v1/groups", catalog.ListHandler(peer))
+	catalog.HandleFunc(r, "/api/v1/groups/{groupID}", catalog.GroupHandler(peer))
+	catalog.HandleFunc(r, "/api/v1/aliases", catalog.AliasListHandler(peer))
+	catalog.HandleFunc(r, "/api/v1/aliases/{alias}", catalog.AliasHandler(peer))
+	catalog.HandleFunc(r, "/api/v1/searchQuery", handlerOfProxyQuery(peer, c))
+	catalog.HandleFunc(r, "/api/v1/batchSearchQuery", handlerOfProxyBatchQuery(peer, c))
+	catalog.HandleFunc(r, "/api/v1/stream", handlerOfProxyStream(peer, c))
+	catalog.HandleFunc(r, "/api/v1/export", handlerOfProxyExport(peer))
+	r.Handle("/metrics", metrics.Handler())
+	r.Handle("/admin/loglevel", logging.LevelHandler())
+	SetSlowQueryThreshold(c.Runtime().SlowQueryThreshold)
+	r.HandleFunc("/admin/slowqueries", slowQueries.Handler())
+	r.HandleFunc("/admin/reload", rl.Handler())
+	srv := &http.Server{
+		Addr:    httpListen,
+		Handler: r,
 	}
-
+	go pruneNodeConns(peer)
 	go func(errs chan error) {
-		logger.Printf("HTTP server starting (%s)\n", httpListen)
-		r := httptrace.NewRouter(
-			httptrace.WithServiceName("ProyxyAPI"),
-		)
-		r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("{\"Status\": \"OK From Reverse Proxy\"}"))
-		})
-		r.HandleFunc("/stat", handlerOfProxyStat(peer))
-		r.HandleFunc("/api/v1/searchQuery", handlerOfProxyQuery(peer))
-		errs <- http.ListenAndServe(httpListen, logRequest(r))
+		logger.Info("HTTP server starting", zap.String("address", httpListen))
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			errs <- err
+		}
 	}(errs)
+	return srv
 }
@@ -0,0 +1,309 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/config"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+
+	"github.com/weaveworks/mesh"
+	"go.uber.org/zap"
+)
+
+func TestProxyQuery(t *testing.T) {
+	t.Run("it takes the novelty threshold in order of precedence successfully", testProxyQuery_threshold)
+	t.Run("it never registers with searchOnly", testProxyQuery_searchOnly)
+	t.Run("it answers partially when a node times out", testProxyQuery_timeout)
+	t.Run("it retries a failed node on a replica successfully", testProxyQuery_retry)
+}
+
+// calcNodeStub is a calc node which answers every brick it is asked for with distance,
+// and registers a data point into any brick.
+type calcNodeStub struct {
+	distance float64
+	// delay holds every answer, and status, when not zero, replaces it.
+	delay      time.Duration
+	status     int
+	bricks     []state.BrickInfo
+	searches   int32
+	registered int32
+}
+
+func (cn *calcNodeStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if cn.delay > 0 {
+		select {
+		case <-time.After(cn.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if cn.status != 0 {
+		w.WriteHeader(cn.status)
+		return
+	}
+	if r.URL.Path == "/admin/bricks" {
+		json.NewEncoder(w).Encode(cn.bricks)
+		return
+	}
+	v := r.URL.Query()
+	if v.Get("onlyRegister") == "true" {
+		atomic.AddInt32(&cn.registered, 1)
+		json.NewEncoder(w).Encode(api.SearchQueryResponse{UniqueID: v.Get("uniqueID"), DataID: "new", Distance: -1, Registered: true})
+		return
+	}
+	atomic.AddInt32(&cn.searches, 1)
+	resp := api.SearchQueryResponse{}
+	for _, uniqueID := range v["uniqueID"] {
+		resp.Bricks = append(resp.Bricks, api.BrickSearchResult{
+			UniqueID: uniqueID,
+			Success:  true,
+			DataID:   "data-" + uniqueID,
+			Distance: cn.distance,
+		})
+	}
+	if strings.HasSuffix(r.URL.Path, "/batchSearchQuery") {
+		// The stub answers batches of a single query, as the stream sends.
+		json.NewEncoder(w).Encode(api.BatchSearchQueryResponse{Results: []api.SearchQueryResponse{resp}})
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// startCalcNode serves cn, which has the bricks, as the calc node of nodeName.
+func startCalcNode(t *testing.T, cn *calcNodeStub, nodeName string, bricks ...state.BrickInfo) (*httptest.Server, []BrickInfoWithNodeInfo) {
+	cn.bricks = bricks
+	srv := httptest.NewServer(cn)
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	portInt, _ := strconv.Atoi(port)
+	result := make([]BrickInfoWithNodeInfo, 0, len(bricks))
+	for _, b := range bricks {
+		result = append(result, BrickInfoWithNodeInfo{
+			BrickInfo:     b,
+			NodeName:      nodeName,
+			NodeIpAddress: host,
+			NodeApiPort:   portInt,
+		})
+	}
+	return srv, result
+}
+
+// newTestPeer returns the peer of a proxy which has received the bricks of the calc nodes by gossip.
+func newTestPeer(t *testing.T, bricks []BrickInfoWithNodeInfo, groups ...catalog.Group) *state.Peer {
+	nodeInfos := map[string]state.NodeInfo{}
+	for _, b := range bricks {
+		ni, ok := nodeInfos[b.NodeName]
+		if !ok {
+			ni = state.NodeInfo{
+				Bricks:        &[]state.BrickInfo{},
+				IpAddress:     b.NodeIpAddress,
+				ApiPort:       ":" + strconv.Itoa(b.NodeApiPort),
+				Meta:          b.NodeMeta,
+				LastUpdatedAt: time.Now(),
+			}
+		}
+		*ni.Bricks = append(*ni.Bricks, b.BrickInfo)
+		nodeInfos[b.NodeName] = ni
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(map[mesh.PeerName]state.StateContent{mesh.PeerName(2): {NodeInfos: nodeInfos}}); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	peer := state.NewPeer(mesh.PeerName(1), zap.NewNop())
+	if _, err := peer.OnGossipBroadcast(mesh.PeerName(2), buf.Bytes()); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	for _, g := range groups {
+		peer.SetGroup(g)
+	}
+	return peer
+}
+
+// newTestConfig returns the configuration of a proxy whose runtime settings are changed by f.
+func newTestConfig(f func(rt *cluster.Runtime)) *cluster.ClusterConfigInfo {
+	c := cluster.NewConfig(config.Default())
+	rt := *c.Runtime()
+	f(&rt)
+	c.SetRuntime(&rt)
+	return &c
+}
+
+func proxyQuery(peer *state.Peer, c *cluster.ClusterConfigInfo, query string) (*httptest.ResponseRecorder, ProxyQueryResponse) {
+	body, _ := json.Marshal(QueryInputForm{})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/searchQuery?"+query, bytes.NewReader(body))
+	req.Header.Set("Content-Type", ContentTypeJSON)
+	rec := httptest.NewRecorder()
+	handlerOfProxyQuery(peer, c)(rec, req)
+	var resp ProxyQueryResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp
+}
+
+func testProxyQuery_threshold(t *testing.T) {
+	// prepare
+	cn := &calcNodeStub{distance: 2.0}
+	srv, bricks := startCalcNode(t, cn, "a",
+		state.BrickInfo{UniqueID: "u1", BrickID: "b1", NumOfBrickTotalCap: 100},
+		state.BrickInfo{UniqueID: "u2", BrickID: "b2", FeatureGroupID: 1, NumOfBrickTotalCap: 100},
+	)
+	defer srv.Close()
+	c := newTestConfig(func(rt *cluster.Runtime) {
+		rt.NodeTimeout = time.Second
+		rt.NoveltyThreshold = 100
+		rt.NoveltyThresholds = cluster.GroupThresholds{0: 1.5}
+	})
+	groupThreshold := 3.0
+	withThreshold := catalog.DefaultGroup()
+	withThreshold.ID = 1
+	withThreshold.Name = "with-threshold"
+	withThreshold.NoveltyThreshold = &groupThreshold
+	peer := newTestPeer(t, bricks, catalog.DefaultGroup(), withThreshold)
+
+	for _, tc := range []struct {
+		query     string
+		threshold float64
+		isNew     bool
+	}{
+		// the threshold of the group in the configuration wins over the one of the proxy
+		{"featureGroupID=0", 1.5, true},
+		// the one of the request wins over the configuration
+		{"featureGroupID=0&noveltyThreshold=2.5", 2.5, false},
+		// the one of the catalog wins over the configuration
+		{"featureGroupID=1", 3.0, false},
+		// and the one of the request wins over the catalog
+		{"featureGroupID=1&noveltyThreshold=0.5", 0.5, true},
+	} {
+		// exec
+		rec, resp := proxyQuery(peer, c, tc.query)
+
+		// assert
+		if rec.Code != http.StatusOK {
+			t.Fatalf("fail. %s: %d %s", tc.query, rec.Code, rec.Body.String())
+		}
+		if resp.Result.NoveltyThreshold != tc.threshold || resp.Result.IsNew != tc.isNew {
+			t.Fatalf("fail. %s: threshold not match. %+v", tc.query, resp.Result)
+		}
+	}
+	if rec, _ := proxyQuery(peer, c, "featureGroupID=0&noveltyThreshold=-1"); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("fail. negative threshold accepted. %d", rec.Code)
+	}
+}
+
+func testProxyQuery_searchOnly(t *testing.T) {
+	// prepare
+	cn := &calcNodeStub{distance: 2.0}
+	srv, bricks := startCalcNode(t, cn, "a", state.BrickInfo{UniqueID: "u1", BrickID: "b1", NumOfBrickTotalCap: 100})
+	defer srv.Close()
+	c := newTestConfig(func(rt *cluster.Runtime) {
+		rt.NodeTimeout = time.Second
+		rt.NoveltyThreshold = 1.0
+	})
+	peer := newTestPeer(t, bricks, catalog.DefaultGroup())
+
+	// exec
+	_, searched := proxyQuery(peer, c, "featureGroupID=0&searchOnly=true")
+	registeredOnSearch := atomic.LoadInt32(&cn.registered)
+	_, registered := proxyQuery(peer, c, "featureGroupID=0")
+
+	// assert
+	if !searched.Result.IsNew || searched.Result.Registered || registeredOnSearch != 0 {
+		t.Fatalf("fail. registered with searchOnly. %+v %d", searched.Result, registeredOnSearch)
+	}
+	if searched.Result.DataID != "data-u1" || searched.Result.Distance != 2.0 {
+		t.Fatalf("fail. nearest data point not match. %+v", searched.Result)
+	}
+	if !registered.Result.Registered || registered.Result.DataID != "new" || atomic.LoadInt32(&cn.registered) != 1 {
+		t.Fatalf("fail. new query not registered. %+v", registered.Result)
+	}
+}
+
+func testProxyQuery_timeout(t *testing.T) {
+	// prepare
+	fast := &calcNodeStub{distance: 5.0}
+	fastSrv, fastBricks := startCalcNode(t, fast, "fast", state.BrickInfo{UniqueID: "u1", BrickID: "b1", NumOfBrickTotalCap: 100})
+	defer fastSrv.Close()
+	hung := &calcNodeStub{distance: 0.1, delay: time.Second}
+	hungSrv, hungBricks := startCalcNode(t, hung, "hung", state.BrickInfo{UniqueID: "u2", BrickID: "b2", NumOfBrickTotalCap: 100})
+	defer hungSrv.Close()
+	c := newTestConfig(func(rt *cluster.Runtime) {
+		rt.NodeTimeout = 5 * time.Second
+		rt.NoveltyThreshold = 1.0
+	})
+	peer := newTestPeer(t, append(fastBricks, hungBricks...), catalog.DefaultGroup())
+
+	// exec
+	ta := time.Now()
+	rec, resp := proxyQuery(peer, c, "featureGroupID=0&timeout=100ms")
+	elapsed := time.Since(ta)
+
+	// assert
+	if rec.Code != http.StatusOK {
+		t.Fatalf("fail. %d %s", rec.Code, rec.Body.String())
+	}
+	if elapsed > 500*time.Millisecond {
+		t.Fatalf("fail. the hung node was waited for. %s", elapsed)
+	}
+	if !resp.Partial || len(resp.UnansweredBricks) != 1 || resp.UnansweredBricks[0] != "u2" {
+		t.Fatalf("fail. partial result not match. %v %v", resp.Partial, resp.UnansweredBricks)
+	}
+	if resp.BrickResponses["u2"].Success {
+		t.Fatalf("fail. the hung node answered. %+v", resp.BrickResponses["u2"])
+	}
+	// the failed brick must not be merged as the nearest one, and a partial result is not registered
+	if resp.Result.DataID != "data-u1" || resp.Result.Distance != 5.0 {
+		t.Fatalf("fail. result not match. %+v", resp.Result)
+	}
+	if !resp.Result.IsNew || resp.Result.Registered || atomic.LoadInt32(&fast.registered) != 0 {
+		t.Fatalf("fail. partial result registered. %+v", resp.Result)
+	}
+}
+
+func testProxyQuery_retry(t *testing.T) {
+	// prepare
+	down := &calcNodeStub{status: http.StatusInternalServerError}
+	downSrv, downBricks := startCalcNode(t, down, "down", state.BrickInfo{UniqueID: "u1", BrickID: "b1", NumOfBrickTotalCap: 100})
+	defer downSrv.Close()
+	up := &calcNodeStub{distance: 0.5}
+	upSrv, upBricks := startCalcNode(t, up, "up", state.BrickInfo{UniqueID: "u1-replica", BrickID: "b1", NumOfBrickTotalCap: 100})
+	defer upSrv.Close()
+	// replicas on draining nodes are tried last, so the node which is down is tried first
+	upBricks[0].NodeMeta.Draining = true
+	c := newTestConfig(func(rt *cluster.Runtime) {
+		rt.NodeTimeout = time.Second
+		rt.NodeRetries = 1
+		rt.NoveltyThreshold = 1.0
+	})
+	noRetries := newTestConfig(func(rt *cluster.Runtime) {
+		rt.NodeTimeout = time.Second
+		rt.NodeRetries = 0
+		rt.NoveltyThreshold = 1.0
+	})
+	peer := newTestPeer(t, append(downBricks, upBricks...), catalog.DefaultGroup())
+
+	// exec
+	_, retried := proxyQuery(peer, c, "featureGroupID=0")
+	_, notRetried := proxyQuery(peer, noRetries, "featureGroupID=0")
+
+	// assert
+	if retried.Partial || retried.Result.DataID != "data-u1-replica" || retried.Result.Distance != 0.5 {
+		t.Fatalf("fail. replica not used. %v %+v", retried.UnansweredBricks, retried.Result)
+	}
+	if retried.BrickResponses["u1-replica"].Attempts != 2 {
+		t.Fatalf("fail. attempts not match. %+v", retried.BrickResponses)
+	}
+	if !notRetried.Partial || len(notRetried.UnansweredBricks) != 1 || notRetried.UnansweredBricks[0] != "u1" || notRetried.Result.DataID != "" {
+		t.Fatalf("fail. retried without retries. %v %+v", notRetried.UnansweredBricks, notRetried.Result)
+	}
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+)
+
+// brickInfosOfNode lists the bricks of a node together with the node's address and metadata.
+func brickInfosOfNode(nodeName string, v state.NodeInfo) []BrickInfoWithNodeInfo {
+	if v.Bricks == nil {
+		return nil
+	}
+	nodeAPIPorts := strings.Split(v.ApiPort, ":")
+	nodeAPIPortInt, _ := strconv.Atoi(nodeAPIPorts[len(nodeAPIPorts)-1])
+	bricks := make([]BrickInfoWithNodeInfo, 0, len(*v.Bricks))
+	for _, v2 := range *v.Bricks {
+		bricks = append(bricks, BrickInfoWithNodeInfo{
+			BrickInfo:       v2,
+			NodeName:        nodeName,
+			NodeIpAddress:   v.IpAddress,
+			NodeApiPort:     nodeAPIPortInt,
+			NodeGrpcAddress: v.GrpcAddress(),
+			NodeMeta:        v.Meta,
+		})
+	}
+	return bricks
+}
+
+// RegisterSelector narrows down the nodes which new data points are sent to.
+// It is read from the "zone" and "nodeSelector" (key=value, repeatable) query parameters.
+type RegisterSelector struct {
+	Zone   string
+	Labels map[string]string
+}
+
+func newRegisterSelector(v url.Values) RegisterSelector {
+	sel := RegisterSelector{
+		Zone:   v.Get("zone"),
+		Labels: map[string]string{},
+	}
+	for _, s := range v["nodeSelector"] {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) == 2 {
+			sel.Labels[kv[0]] = kv[1]
+		}
+	}
+	return sel
+}
+
+func (sel RegisterSelector) match(meta state.NodeMeta) bool {
+	if sel.Zone != "" && sel.Zone != meta.Zone {
+		return false
+	}
+	for k, v := range sel.Labels {
+		if meta.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// selectBrickForRegistration picks the brick which numOfPoints new data points go into.
+// Draining nodes and bricks without enough room are skipped, and the fill ratio is divided by
+// the capacity weight of the node so that heavier nodes get more points.
+func selectBrickForRegistration(bricks []BrickInfoWithNodeInfo, sel RegisterSelector, numOfPoints int) (BrickInfoWithNodeInfo, bool) {
+	var minBrick BrickInfoWithNodeInfo
+	found := false
+	minScore := 0.0
+	for _, b := range bricks {
+		if b.NodeMeta.Draining {
+			continue
+		}
+		if b.NumOfBrickTotalCap <= 0 || b.NumOfAvailablePoints+numOfPoints > b.NumOfBrickTotalCap {
+			continue
+		}
+		if !sel.match(b.NodeMeta) {
+			continue
+		}
+		usage := float64(b.NumOfAvailablePoints) / float64(b.NumOfBrickTotalCap)
+		score := usage / b.NodeMeta.Weight()
+		if !found || score < minScore {
+			minBrick = b
+			minScore = score
+			found = true
+		}
+	}
+	return minBrick, found
+}
+
+// pointsOfGroup sums the data points of bricks, counting each set of replicas once.
+func pointsOfGroup(bricks []BrickInfoWithNodeInfo) int {
+	points := 0
+	seen := map[string]struct{}{}
+	for _, b := range bricks {
+		if _, ok := seen[b.BrickID]; ok {
+			continue
+		}
+		seen[b.BrickID] = struct{}{}
+		points += b.NumOfAvailablePoints
+	}
+	return points
+}
+
+// groupReplicas groups bricks which share a BrickID, i.e. replicas of the same brick.
+// Replicas on nodes which are not draining come first.
+func groupReplicas(bricks []BrickInfoWithNodeInfo) [][]BrickInfoWithNodeInfo {
+	order := []string{}
+	replicas := map[string][]BrickInfoWithNodeInfo{}
+	for _, b := range bricks {
+		if _, ok := replicas[b.BrickID]; !ok {
+			order = append(order, b.BrickID)
+		}
+		replicas[b.BrickID] = append(replicas[b.BrickID], b)
+	}
+	result := make([][]BrickInfoWithNodeInfo, 0, len(order))
+	for _, brickID := range order {
+		set := replicas[brickID]
+		sort.SliceStable(set, func(i, j int) bool {
+			return !set[i].NodeMeta.Draining && set[j].NodeMeta.Draining
+		})
+		result = append(result, set)
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+)
+
+func TestRouting(t *testing.T) {
+	t.Run("it registers into nodes which gossip no metadata successfully", testRouting_zeroMeta)
+	t.Run("it prefers nodes with a larger weight successfully", testRouting_weight)
+}
+
+func brickOnNode(nodeName string, points int, meta state.NodeMeta) BrickInfoWithNodeInfo {
+	return BrickInfoWithNodeInfo{
+		BrickInfo: state.BrickInfo{UniqueID: "u-" + nodeName, BrickID: "b-" + nodeName, NumOfBrickTotalCap: 100, NumOfAvailablePoints: points},
+		NodeName:  nodeName,
+		NodeMeta:  meta,
+	}
+}
+
+func testRouting_zeroMeta(t *testing.T) {
+	// prepare
+	// nodes of older versions are decoded with a zero NodeMeta
+	bricks := []BrickInfoWithNodeInfo{
+		brickOnNode("old-a", 50, state.NodeMeta{}),
+		brickOnNode("old-b", 10, state.NodeMeta{}),
+		brickOnNode("draining", 0, state.NodeMeta{Draining: true}),
+	}
+
+	// exec
+	b, found := selectBrickForRegistration(bricks, RegisterSelector{}, 1)
+
+	// assert
+	if !found {
+		t.Fatal("fail. no brick selected among nodes with a zero NodeMeta.")
+	}
+	if b.NodeName != "old-b" {
+		t.Fatalf("fail. the least filled node must be selected. %s", b.NodeName)
+	}
+}
+
+func testRouting_weight(t *testing.T) {
+	// prepare
+	bricks := []BrickInfoWithNodeInfo{
+		brickOnNode("light", 20, state.NodeMeta{CapacityWeight: 1}),
+		brickOnNode("heavy", 30, state.NodeMeta{CapacityWeight: 2}),
+		brickOnNode("full", 100, state.NodeMeta{CapacityWeight: 10}),
+	}
+
+	// exec
+	b, found := selectBrickForRegistration(bricks, RegisterSelector{}, 1)
+
+	// assert
+	if !found || b.NodeName != "heavy" {
+		t.Fatalf("fail. the heavier node must be selected. %+v", b)
+	}
+}
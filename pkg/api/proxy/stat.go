@@ -0,0 +1,285 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/health"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+	"github.com/abeja-inc/feature-search-db/pkg/tracing"
+)
+
+// BrickStat is a brick of a node with its fill ratio.
+type BrickStat struct {
+	state.BrickInfo
+	FillRatio float64 `json:"fillRatio"`
+}
+
+// NodeStatResponse is the health of a calc node.
+// Bricks come from the node itself when it answered, otherwise from the gossiped state.
+type NodeStatResponse struct {
+	NodeName             string         `json:"nodeName"`
+	Success              bool           `json:"success"`
+	Address              string         `json:"address"`
+	ResponseTime         int64          `json:"responseTime"`
+	StatusCode           int            `json:"statusCode"`
+	Error                string         `json:"error,omitempty"`
+	LastUpdatedAt        time.Time      `json:"lastUpdatedAt"`
+	HeartbeatAge         int64          `json:"heartbeatAge"`
+	Meta                 state.NodeMeta `json:"meta"`
+	Bricks               []BrickStat    `json:"bricks"`
+	NumOfBrickTotalCap   int            `json:"numOfBrickTotalCap"`
+	NumOfAvailablePoints int            `json:"numOfAvailablePoints"`
+	FillRatio            float64        `json:"fillRatio"`
+}
+
+// FeatureGroupStat is the cluster-wide total of a feature group.
+type FeatureGroupStat struct {
+	Namespace            string  `json:"namespace"`
+	FeatureGroupID       int     `json:"groupID"`
+	NumOfBricks          int     `json:"numOfBricks"`
+	NumOfNodes           int     `json:"numOfNodes"`
+	NumOfBrickTotalCap   int     `json:"numOfBrickTotalCap"`
+	NumOfAvailablePoints int     `json:"numOfAvailablePoints"`
+	FillRatio            float64 `json:"fillRatio"`
+}
+
+type ProxyStatResponse struct {
+	Bricks            []BrickInfoWithNodeInfo     `json:"bricks"`
+	Response          map[string]NodeStatResponse `json:"responses"`
+	FeatureGroups     []FeatureGroupStat          `json:"featureGroups"`
+	NumOfNodes        int                         `json:"numOfNodes"`
+	NumOfHealthyNodes int                         `json:"numOfHealthyNodes"`
+	// Namespace, Usage and Quota are of the namespace of a scoped stat.
+	Namespace          string         `json:"namespace,omitempty"`
+	Usage              *catalog.Usage `json:"usage,omitempty"`
+	Quota              *catalog.Quota `json:"quota,omitempty"`
+	RequestProcessTime int64          `json:"requestProcessTime"`
+}
+
+func fillRatio(numOfAvailablePoints int, numOfBrickTotalCap int) float64 {
+	if numOfBrickTotalCap <= 0 {
+		return 0
+	}
+	return float64(numOfAvailablePoints) / float64(numOfBrickTotalCap)
+}
+
+// statNode asks a calc node for its bricks, which tells both liveness and latency.
+// Only the bricks of the namespace are kept unless it is empty.
+func statNode(ctx context.Context, timeout time.Duration, nodeName string, v state.NodeInfo, namespace string) NodeStatResponse {
+	ta := time.Now().UnixNano()
+	address := fmt.Sprintf("http://%s/admin/bricks", v.APIAddress())
+	result := NodeStatResponse{
+		NodeName:      nodeName,
+		Address:       address,
+		LastUpdatedAt: v.LastUpdatedAt,
+		HeartbeatAge:  time.Since(v.LastUpdatedAt).Nanoseconds(),
+		Meta:          v.Meta,
+	}
+	brickInfos := []state.BrickInfo{}
+	if v.Bricks != nil {
+		brickInfos = *v.Bricks
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, address, nil)
+	tracing.Inject(ctx, req.Header)
+	logging.InjectRequestID(ctx, req.Header)
+	resp, err := nodeClient.Do(req.WithContext(ctx))
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		defer resp.Body.Close()
+		result.StatusCode = resp.StatusCode
+		b, err := ioutil.ReadAll(resp.Body)
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case resp.StatusCode != http.StatusOK:
+			result.Error = string(b)
+			if result.Error == "" {
+				result.Error = http.StatusText(resp.StatusCode)
+			}
+		default:
+			var live []state.BrickInfo
+			if err := json.Unmarshal(b, &live); err != nil {
+				result.Error = err.Error()
+			} else {
+				brickInfos = live
+				result.Success = true
+			}
+		}
+	}
+	result.ResponseTime = time.Now().UnixNano() - ta
+
+	result.Bricks = make([]BrickStat, 0, len(brickInfos))
+	for _, b := range brickInfos {
+		if namespace != "" && b.GetNamespace() != namespace {
+			continue
+		}
+		result.Bricks = append(result.Bricks, BrickStat{
+			BrickInfo: b,
+			FillRatio: fillRatio(b.NumOfAvailablePoints, b.NumOfBrickTotalCap),
+		})
+		result.NumOfBrickTotalCap += b.NumOfBrickTotalCap
+		result.NumOfAvailablePoints += b.NumOfAvailablePoints
+	}
+	result.FillRatio = fillRatio(result.NumOfAvailablePoints, result.NumOfBrickTotalCap)
+	return result
+}
+
+// featureGroupStats sums up the bricks of every node per feature group.
+func featureGroupStats(responses map[string]NodeStatResponse) []FeatureGroupStat {
+	stats := map[string]*FeatureGroupStat{}
+	nodes := map[string]map[string]struct{}{}
+	for nodeName, v := range responses {
+		for _, b := range v.Bricks {
+			key := catalog.Group{Namespace: b.GetNamespace(), ID: b.FeatureGroupID}.Key()
+			st, ok := stats[key]
+			if !ok {
+				st = &FeatureGroupStat{Namespace: b.GetNamespace(), FeatureGroupID: b.FeatureGroupID}
+				stats[key] = st
+				nodes[key] = map[string]struct{}{}
+			}
+			st.NumOfBricks += 1
+			st.NumOfBrickTotalCap += b.NumOfBrickTotalCap
+			st.NumOfAvailablePoints += b.NumOfAvailablePoints
+			nodes[key][nodeName] = struct{}{}
+		}
+	}
+	result := make([]FeatureGroupStat, 0, len(stats))
+	for key, st := range stats {
+		st.NumOfNodes = len(nodes[key])
+		st.FillRatio = fillRatio(st.NumOfAvailablePoints, st.NumOfBrickTotalCap)
+		result = append(result, *st)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].FeatureGroupID < result[j].FeatureGroupID
+	})
+	return result
+}
+
+// handlerOfProxyStat reports the health of the nodes and the totals of the feature groups.
+// /stat is the view of the operators over every namespace; with scoped, only the bricks of the
+// namespace of the request are counted, together with its usage and quota.
+func handlerOfProxyStat(peer *state.Peer, c *cluster.ClusterConfigInfo, scoped bool) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t_start := time.Now().UnixNano()
+		// Allow only GET Method
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+
+		nodeTimeout := c.Runtime().NodeTimeout
+		if s := r.URL.Query().Get("timeout"); s != "" {
+			var err error
+			nodeTimeout, err = time.ParseDuration(s)
+			if err != nil || nodeTimeout <= 0 {
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{"Invalid timeout"})
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write(jsonBytes)
+				return
+			}
+		}
+
+		namespace := ""
+		if scoped {
+			namespace = catalog.NamespaceOf(r)
+		}
+
+		// Create NodeLists
+		status := peer.GetAllState()
+		bricks := clusterBricks(status, namespace)
+
+		// Access Each Node concurrently
+		ch := make(chan NodeStatResponse)
+		for nodeName, v := range status.NodeInfos {
+			go func(nodeName string, v state.NodeInfo) {
+				ch <- statNode(r.Context(), nodeTimeout, nodeName, v, namespace)
+			}(nodeName, v)
+		}
+		responses := map[string]NodeStatResponse{}
+		numOfHealthyNodes := 0
+		for _ = range status.NodeInfos {
+			resp := <-ch
+			responses[resp.NodeName] = resp
+			if resp.Success {
+				numOfHealthyNodes += 1
+			}
+		}
+
+		resp := ProxyStatResponse{
+			Bricks:            bricks,
+			Response:          responses,
+			FeatureGroups:     featureGroupStats(responses),
+			NumOfNodes:        len(responses),
+			NumOfHealthyNodes: numOfHealthyNodes,
+		}
+		if scoped {
+			ns, _ := catalog.LookupNamespace(peer, namespace)
+			usage := status.Usage(namespace)
+			resp.Namespace = namespace
+			resp.Usage = &usage
+			resp.Quota = &ns.Quota
+		}
+		t_end := time.Now().UnixNano()
+		resp.RequestProcessTime = t_end - t_start
+
+		jsonBytes, _ := json.Marshal(resp)
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonBytes)
+	}
+}
+
+// CoverageCheck fails until every feature group known in the cluster has a brick on a live node.
+func CoverageCheck(peer *state.Peer, c *cluster.ClusterConfigInfo) health.Check {
+	return func() error {
+		return checkCoverage(peer.GetAllState(), c.HeartbeatTimeout())
+	}
+}
+
+func checkCoverage(status state.StateContent, heartbeatTimeout time.Duration) error {
+	// Groups of different namespaces may have the same ID.
+	covered := map[string]bool{}
+	for _, v := range status.NodeInfos {
+		if v.Bricks == nil {
+			continue
+		}
+		alive := v.IsAlive(heartbeatTimeout)
+		for _, b := range *v.Bricks {
+			key := catalog.Group{Namespace: b.GetNamespace(), ID: b.FeatureGroupID}.Key()
+			covered[key] = covered[key] || alive
+		}
+	}
+	if len(covered) == 0 {
+		return errors.New("no feature groups known")
+	}
+	uncovered := []string{}
+	for key, ok := range covered {
+		if !ok {
+			uncovered = append(uncovered, key)
+		}
+	}
+	if len(uncovered) > 0 {
+		sort.Strings(uncovered)
+		return fmt.Errorf("no live node for feature groups %v", uncovered)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+)
+
+func TestProxyStat(t *testing.T) {
+	t.Run("it reports every node concurrently past failures successfully", testProxyStat_failures)
+}
+
+func TestCoverage(t *testing.T) {
+	t.Run("it checks every feature group has a live node successfully", testCoverage_check)
+	t.Run("it checks groups of the same ID in namespaces apart successfully", testCoverage_namespaces)
+}
+
+func testCoverage_check(t *testing.T) {
+	// prepare
+	nodeInfo := func(lastUpdatedAt time.Time, featureGroupIDs ...int) state.NodeInfo {
+		bricks := []state.BrickInfo{}
+		for _, featureGroupID := range featureGroupIDs {
+			bricks = append(bricks, state.BrickInfo{FeatureGroupID: featureGroupID})
+		}
+		return state.NodeInfo{Bricks: &bricks, LastUpdatedAt: lastUpdatedAt}
+	}
+	heartbeatTimeout := 30 * time.Second
+	stale := time.Now().Add(-2 * heartbeatTimeout)
+	status := state.StateContent{NodeInfos: map[string]state.NodeInfo{
+		"a": nodeInfo(time.Now(), 0, 1),
+		"b": nodeInfo(stale, 1, 2),
+	}}
+
+	// exec
+	err := checkCoverage(status, heartbeatTimeout)
+	status.NodeInfos["c"] = nodeInfo(time.Now(), 2)
+	err2 := checkCoverage(status, heartbeatTimeout)
+	err3 := checkCoverage(state.StateContent{NodeInfos: map[string]state.NodeInfo{}}, heartbeatTimeout)
+
+	// assert
+	if err == nil || err.Error() != "no live node for feature groups [default/2]" {
+		t.Fatalf("fail. group 2 must be uncovered. %v", err)
+	}
+	if err2 != nil {
+		t.Fatalf("fail. %v", err2)
+	}
+	if err3 == nil {
+		t.Fatalf("fail. empty cluster must not be ready")
+	}
+}
+
+func testCoverage_namespaces(t *testing.T) {
+	// prepare
+	heartbeatTimeout := 30 * time.Second
+	nodeInfo := func(lastUpdatedAt time.Time, namespace string) state.NodeInfo {
+		bricks := []state.BrickInfo{{FeatureGroupID: 1, Namespace: namespace}}
+		return state.NodeInfo{Bricks: &bricks, LastUpdatedAt: lastUpdatedAt}
+	}
+	status := state.StateContent{NodeInfos: map[string]state.NodeInfo{
+		"a": nodeInfo(time.Now(), catalog.DefaultNamespace),
+		"b": nodeInfo(time.Now().Add(-2*heartbeatTimeout), "team-a"),
+	}}
+
+	// exec
+	err := checkCoverage(status, heartbeatTimeout)
+
+	// assert
+	if err == nil || err.Error() != "no live node for feature groups [team-a/1]" {
+		t.Fatalf("fail. group 1 of team-a must be uncovered. %v", err)
+	}
+}
+
+func testProxyStat_failures(t *testing.T) {
+	// prepare
+	up := &calcNodeStub{}
+	upSrv, upBricks := startCalcNode(t, up, "up",
+		state.BrickInfo{UniqueID: "u1", BrickID: "b1", NumOfBrickTotalCap: 100, NumOfAvailablePoints: 50},
+		state.BrickInfo{UniqueID: "u2", BrickID: "b2", FeatureGroupID: 1, NumOfBrickTotalCap: 100, NumOfAvailablePoints: 10},
+	)
+	defer upSrv.Close()
+	down := &calcNodeStub{status: http.StatusInternalServerError}
+	downSrv, downBricks := startCalcNode(t, down, "down",
+		state.BrickInfo{UniqueID: "u3", BrickID: "b1", NumOfBrickTotalCap: 100, NumOfAvailablePoints: 50},
+	)
+	defer downSrv.Close()
+	hung1 := &calcNodeStub{delay: time.Second}
+	hung1Srv, hung1Bricks := startCalcNode(t, hung1, "hung1", state.BrickInfo{UniqueID: "u4", BrickID: "b4", NumOfBrickTotalCap: 100})
+	defer hung1Srv.Close()
+	hung2 := &calcNodeStub{delay: time.Second}
+	hung2Srv, hung2Bricks := startCalcNode(t, hung2, "hung2", state.BrickInfo{UniqueID: "u5", BrickID: "b5", NumOfBrickTotalCap: 100})
+	defer hung2Srv.Close()
+	bricks := append(append(append(upBricks, downBricks...), hung1Bricks...), hung2Bricks...)
+	peer := newTestPeer(t, bricks)
+	c := newTestConfig(func(rt *cluster.Runtime) {
+		rt.NodeTimeout = 200 * time.Millisecond
+	})
+
+	// exec
+	ta := time.Now()
+	rec := httptest.NewRecorder()
+	handlerOfProxyStat(peer, c, false)(rec, httptest.NewRequest(http.MethodGet, "/stat", nil))
+	elapsed := time.Since(ta)
+
+	// assert
+	if rec.Code != http.StatusOK {
+		t.Fatalf("fail. %d %s", rec.Code, rec.Body.String())
+	}
+	if elapsed > 350*time.Millisecond {
+		t.Fatalf("fail. nodes were not asked concurrently. %s", elapsed)
+	}
+	var resp ProxyStatResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if resp.NumOfNodes != 4 || resp.NumOfHealthyNodes != 1 {
+		t.Fatalf("fail. number of nodes not match. %d %d", resp.NumOfNodes, resp.NumOfHealthyNodes)
+	}
+	upStat := resp.Response["up"]
+	if !upStat.Success || len(upStat.Bricks) != 2 || upStat.FillRatio != 0.3 || upStat.HeartbeatAge <= 0 {
+		t.Fatalf("fail. stat of the healthy node not match. %+v", upStat)
+	}
+	for _, nodeName := range []string{"down", "hung1", "hung2"} {
+		if st := resp.Response[nodeName]; st.Success || st.Error == "" || len(st.Bricks) != 1 {
+			t.Fatalf("fail. stat of the failed node %s not match. %+v", nodeName, st)
+		}
+	}
+	// the bricks of failed nodes are counted from the gossiped state
+	if len(resp.FeatureGroups) != 2 {
+		t.Fatalf("fail. feature groups not match. %+v", resp.FeatureGroups)
+	}
+	g := resp.FeatureGroups[0]
+	if g.FeatureGroupID != 0 || g.NumOfBricks != 4 || g.NumOfNodes != 4 || g.NumOfAvailablePoints != 100 || g.NumOfBrickTotalCap != 400 {
+		t.Fatalf("fail. totals of the feature group not match. %+v", g)
+	}
+}
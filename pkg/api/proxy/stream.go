@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api/rpc"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc/metadata"
+)
+
+// streamWriteTimeout disconnects a client which does not read its results.
+const streamWriteTimeout = 10 * time.Second
+
+// StreamQueryInputForm is a query sent as a text message over the search stream.
+type StreamQueryInputForm struct {
+	RequestID string       `json:"requestID"`
+	Vals      [512]float64 `json:"vals"`
+}
+
+// StreamQueryResponse answers the StreamQueryInputForm of RequestID.
+type StreamQueryResponse struct {
+	RequestID          string           `json:"requestID"`
+	Result             ProxyQueryResult `json:"result"`
+	Partial            bool             `json:"partial"`
+	UnansweredBricks   []string         `json:"unansweredBricks"`
+	RequestProcessTime int64            `json:"requestProcessTime"`
+	Error              string           `json:"error,omitempty"`
+}
+
+// newStreamUpgrader accepts WebSockets from the pages of the proxy itself and of origins,
+// so that other web sites cannot search or register on behalf of the browsers of users.
+// Clients other than browsers send no Origin, and are accepted.
+func newStreamUpgrader(origins []string) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1 << 16,
+		WriteBufferSize: 1 << 12,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			for _, o := range origins {
+				if o == "*" || strings.EqualFold(o, origin) {
+					return true
+				}
+			}
+			u, err := url.Parse(origin)
+			return err == nil && strings.EqualFold(u.Host, r.Host)
+		},
+	}
+}
+
+// requestOfParams carries the query parameters of the stream in every request of it.
+func requestOfParams(params proxyQueryParams) *rpc.SearchRequest {
+	return &rpc.SearchRequest{
+		FeatureGroupId:   int32(params.featureGroupID),
+		CalcMode:         params.calcMode,
+		SearchOnly:       params.searchOnly,
+		NoveltyThreshold: &wrappers.DoubleValue{Value: params.noveltyThreshold},
+		TimeoutMs:        int64(params.nodeTimeout / time.Millisecond),
+		Zone:             params.selector.Zone,
+		NodeSelector:     params.selector.Labels,
+	}
+}
+
+// handlerOfProxyStream runs the queries sent over a WebSocket the same as /api/v1/searchQuery.
+// The query parameters apply to the whole stream. Results are sent in completion order
+// with the requestID of their query, and the stream is not read any further while
+// rpc.MaxStreamInFlight queries are in flight.
+func handlerOfProxyStream(peer *state.Peer, c *cluster.ClusterConfigInfo) http.HandlerFunc {
+	s := &proxyServer{peer: peer, c: c}
+	upgrader := newStreamUpgrader(c.StreamOrigins)
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns := catalog.NamespaceOf(r)
+		params, err := parseProxyQueryParams(ns, r.URL.Query(), c, peer)
+		if err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{err.Error()})
+			w.WriteHeader(statusOfParamsError(err))
+			w.Write(jsonBytes)
+			return
+		}
+		template := requestOfParams(params)
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var writeMtx sync.Mutex
+		write := func(resp StreamQueryResponse) error {
+			writeMtx.Lock()
+			defer writeMtx.Unlock()
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			return conn.WriteJSON(resp)
+		}
+		recv := func() (*rpc.SearchRequest, error) {
+			for {
+				messageType, b, err := conn.ReadMessage()
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					return nil, io.EOF
+				}
+				if err != nil {
+					return nil, err
+				}
+				var form StreamQueryInputForm
+				if messageType != websocket.TextMessage || json.Unmarshal(b, &form) != nil {
+					if err := write(StreamQueryResponse{RequestID: form.RequestID, Error: "Failed to parse json."}); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				req := *template
+				req.RequestId = form.RequestID
+				req.Vectors = []*rpc.Vector{{Vals: form.Vals[:]}}
+				return &req, nil
+			}
+		}
+		send := func(resp *rpc.SearchResponse) error {
+			out := StreamQueryResponse{
+				RequestID:          resp.RequestId,
+				Partial:            resp.Partial,
+				UnansweredBricks:   resp.UnansweredBricks,
+				RequestProcessTime: resp.ElapsedTime,
+				Error:              resp.Error,
+			}
+			if len(resp.Results) > 0 {
+				res := resp.Results[0]
+				out.Result = ProxyQueryResult{
+					DataID:           res.DataId,
+					Distance:         res.Distance,
+					IsNew:            res.IsNew,
+					Registered:       res.Registered,
+					NoveltyThreshold: res.NoveltyThreshold,
+				}
+			}
+			return write(out)
+		}
+		// The queries are run as gRPC requests of the namespace.
+		ctx := metadata.NewIncomingContext(r.Context(), metadata.Pairs(rpc.NamespaceKey, ns))
+		rpc.ServeRequests(ctx, recv, send, s.Search)
+	}
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestProxyStream(t *testing.T) {
+	t.Run("it answers every request of the stream by its ID successfully", testProxyStream_requests)
+	t.Run("it accepts only allowed origins", testProxyStream_origin)
+}
+
+// startProxyStream serves the search stream of a proxy in front of a calc node stub.
+func startProxyStream(t *testing.T, origins []string) (*httptest.Server, func()) {
+	cn := &calcNodeStub{distance: 0.5}
+	nodeSrv, bricks := startCalcNode(t, cn, "a", state.BrickInfo{UniqueID: "u1", BrickID: "b1", NumOfBrickTotalCap: 100})
+	c := newTestConfig(func(rt *cluster.Runtime) {
+		rt.NodeTimeout = time.Second
+	})
+	c.StreamOrigins = origins
+	peer := newTestPeer(t, bricks, catalog.DefaultGroup())
+	srv := httptest.NewServer(handlerOfProxyStream(peer, c))
+	return srv, func() {
+		srv.Close()
+		nodeSrv.Close()
+	}
+}
+
+func dialStream(srv *httptest.Server, origin string) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/stream?featureGroupID=0&searchOnly=true"
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+func testProxyStream_requests(t *testing.T) {
+	// prepare
+	srv, closeAll := startProxyStream(t, nil)
+	defer closeAll()
+	conn, _, err := dialStream(srv, "")
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	defer conn.Close()
+
+	// exec
+	for _, requestID := range []string{"frame-1", "frame-2"} {
+		if err := conn.WriteJSON(StreamQueryInputForm{RequestID: requestID}); err != nil {
+			t.Fatalf("fail. %v", err)
+		}
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"requestID": "frame-3", "vals": "abc"}`))
+	conn.WriteMessage(websocket.TextMessage, []byte(`not json`))
+	conn.WriteMessage(websocket.BinaryMessage, []byte(`{"requestID": "frame-4"}`))
+	responses := map[string][]StreamQueryResponse{}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 5; i++ {
+		var resp StreamQueryResponse
+		if err := conn.ReadJSON(&resp); err != nil {
+			t.Fatalf("fail. %d responses read. %v", i, err)
+		}
+		responses[resp.RequestID] = append(responses[resp.RequestID], resp)
+	}
+
+	// assert
+	for _, requestID := range []string{"frame-1", "frame-2"} {
+		resps := responses[requestID]
+		if len(resps) != 1 || resps[0].Error != "" || resps[0].Result.DataID != "data-u1" || resps[0].Result.Distance != 0.5 {
+			t.Fatalf("fail. response of %s not match. %+v", requestID, resps)
+		}
+		if resps[0].Result.Registered {
+			t.Fatalf("fail. %s registered with searchOnly.", requestID)
+		}
+	}
+	if resps := responses["frame-3"]; len(resps) != 1 || resps[0].Error == "" {
+		t.Fatalf("fail. malformed query answered without an error. %+v", resps)
+	}
+	// Neither the text which is not json nor the binary message is read for its requestID.
+	if resps := responses[""]; len(resps) != 2 || resps[0].Error == "" || resps[1].Error == "" {
+		t.Fatalf("fail. unparsable messages answered without an error. %+v", resps)
+	}
+}
+
+func testProxyStream_origin(t *testing.T) {
+	// prepare
+	srv, closeAll := startProxyStream(t, []string{"https://app.example.com"})
+	defer closeAll()
+
+	for _, c := range []struct {
+		origin  string
+		allowed bool
+	}{
+		{"", true},
+		{srv.URL, true},
+		{"https://app.example.com", true},
+		{"https://evil.example.com", false},
+	} {
+		// exec
+		conn, resp, err := dialStream(srv, c.origin)
+
+		// assert
+		if c.allowed && err != nil {
+			t.Fatalf("fail. origin %q rejected. %v", c.origin, err)
+		}
+		if !c.allowed && (err == nil || resp.StatusCode != http.StatusForbidden) {
+			t.Fatalf("fail. origin %q accepted.", c.origin)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/api/proxy"
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/bulk"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/data"
+	"github.com/abeja-inc/feature-search-db/pkg/metrics"
+)
+
+// searchBrickBatch finds the nearest data point in fp for every target in one pass.
+func searchBrickBatch(fp *brick.FeatureBrick, targets []*data.PosVector) []api.BrickSearchResult {
+	results := make([]api.BrickSearchResult, len(targets))
+	for i := range results {
+		results[i] = api.BrickSearchResult{
+			UniqueID: fp.GetUniqueIDstr(),
+			Success:  true,
+		}
+	}
+	fp.Search(func(numOfAvailablePoints int) {
+		if numOfAvailablePoints == 0 {
+			return
+		}
+		params := fp.CreateSearchParam(map[string]interface{}{
+			"posVectors":           targets,
+			"numOfAvailablePoints": numOfAvailablePoints,
+		})
+		ta := time.Now().UnixNano()
+		rets := fp.FindBatch(params)
+		tb := time.Now().UnixNano()
+		for i, ret := range rets {
+			results[i].DataID = ret.Result.GetDataIDstr()
+			results[i].Distance = ret.Distance
+			results[i].ElapsedTime = tb - ta
+		}
+	})
+	return results
+}
+
+var errReadOnly = bulk.ErrReadOnly
+
+func targetsOfForms(forms []proxy.QueryInputForm) []*data.PosVector {
+	targets := make([]*data.PosVector, 0, len(forms))
+	for _, q := range forms {
+		target := data.NewPosVector(false, 512)
+		target.LoadPositionFromArray(q.Vals)
+		targets = append(targets, &target)
+	}
+	return targets
+}
+
+// registerQueries adds every target into fp as a new data point, as long as the quota of its namespace allows.
+func registerQueries(bp *brick.BrickPool, groups catalog.Store, fp *brick.FeatureBrick, targets []*data.PosVector) (api.BatchSearchQueryResponse, error) {
+	resp := api.BatchSearchQueryResponse{
+		Results: make([]api.SearchQueryResponse, len(targets)),
+	}
+	if err := checkQuota(groups, fp.GetNamespace(), len(targets), 0); err != nil {
+		return resp, err
+	}
+	if err := bp.BeginWrite(); err != nil {
+		return resp, err
+	}
+	ta := time.Now().UnixNano()
+	dataPoints, err := fp.AddNewDataPoints(targets)
+	bp.EndWrite()
+	if err != nil {
+		return resp, err
+	}
+	resp.ElapsedTime = time.Now().UnixNano() - ta
+	metrics.ObserveInsert(fp.GetNamespace(), fp.GetFeatureGroupIDint(), len(dataPoints), time.Duration(resp.ElapsedTime))
+	for i, dp := range dataPoints {
+		resp.Results[i] = api.SearchQueryResponse{
+			UniqueID:    fp.GetUniqueIDstr(),
+			DataID:      dp.GetDataIDstr(),
+			Distance:    -1,
+			ElapsedTime: resp.ElapsedTime,
+			Registered:  true,
+		}
+	}
+	return resp, nil
+}
+
+// searchQueries finds the nearest data point of every target in fps.
+// Bricks in missing are reported as failed for every target.
+func searchQueries(fps []*brick.FeatureBrick, missing []string, targets []*data.PosVector, calcMode string) api.BatchSearchQueryResponse {
+	ta := time.Now().UnixNano()
+	resp := api.BatchSearchQueryResponse{
+		Results: make([]api.SearchQueryResponse, len(targets)),
+	}
+	for i := range resp.Results {
+		resp.Results[i] = api.SearchQueryResponse{
+			CalcMode: calcMode,
+			Bricks:   make([]api.BrickSearchResult, 0, len(fps)+len(missing)),
+		}
+		for _, uniqueID := range missing {
+			resp.Results[i].Bricks = append(resp.Results[i].Bricks, api.BrickSearchResult{
+				UniqueID: uniqueID,
+				Success:  false,
+				Error:    "Not found Brick",
+			})
+		}
+	}
+	for _, fp := range fps {
+		for i, ret := range searchBrickBatch(fp, targets) {
+			res := &resp.Results[i]
+			res.Bricks = append(res.Bricks, ret)
+			if ret.DataID == "" {
+				continue
+			}
+			if res.DataID == "" || ret.Distance < res.Distance {
+				res.UniqueID = ret.UniqueID
+				res.DataID = ret.DataID
+				res.Distance = ret.Distance
+			}
+		}
+	}
+	resp.ElapsedTime = time.Now().UnixNano() - ta
+	metrics.ObserveSearch(fps, len(targets), time.Duration(resp.ElapsedTime))
+	for i := range resp.Results {
+		resp.Results[i].ElapsedTime = resp.ElapsedTime
+	}
+	return resp
+}
+
+// explainBatch tells how fps were searched for the queries of resp.
+func explainBatch(fps []*brick.FeatureBrick, resp api.BatchSearchQueryResponse, pt *api.PhaseTimer) *api.SearchExplain {
+	var results []api.BrickSearchResult
+	if len(resp.Results) > 0 {
+		results = resp.Results[0].Bricks
+	}
+	explain := explainSearch(fps, results, len(resp.Results))
+	explain.Phases = pt.Phases
+	return explain
+}
+
+func handlerOfBatchQueryAPI(bp *brick.BrickPool, groups catalog.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		defer r.Body.Close()
+		pt := api.NewPhaseTimer()
+
+		v := r.URL.Query()
+		ns := catalog.NamespaceOf(r)
+		group, status, err := groupOfQuery(ns, v, groups)
+		if err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{err.Error()})
+			w.WriteHeader(status)
+			w.Write(jsonBytes)
+			return
+		}
+		featureGroupIDint := group.ID
+		featureGroupID := brick.BrickFeatureGroupID(featureGroupIDint)
+
+		onlyRegister := false
+		if _, ok := v["onlyRegister"]; ok {
+			onlyRegister, err = strconv.ParseBool(v["onlyRegister"][0])
+			if err != nil {
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{"Invalid Flag (onlyRegister)"})
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write(jsonBytes)
+				return
+			}
+		}
+
+		calcMode := string(api.CalcModeNaive)
+		if _, ok := v["calcMode"]; ok {
+			calcMode = v["calcMode"][0]
+		}
+
+		// Parse payload from client
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{"Failed to read payload."})
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write(jsonBytes)
+			return
+		}
+		queryInputForms, err := parseQueryInputForms(r.Header.Get("Content-Type"), b, true, group)
+		if err == proxy.ErrInvalidContentType {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid Content-Type"))
+			return
+		}
+		if err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{err.Error()})
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write(jsonBytes)
+			return
+		}
+
+		targets := targetsOfForms(queryInputForms)
+		pt.Done("parse")
+
+		fps, missing, err := bricksOfQuery(bp, ns, featureGroupID, v["uniqueID"])
+		if err != nil || (onlyRegister && len(missing) > 0) {
+			if err == nil {
+				err = fmt.Errorf("Not found Brick (%s)", missing[0])
+			}
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{err.Error()})
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(jsonBytes)
+			return
+		}
+		pt.Done("lookup")
+
+		var resp api.BatchSearchQueryResponse
+		if onlyRegister {
+			resp, err = registerQueries(bp, groups, fps[0], targets)
+			if errors.Is(err, catalog.ErrQuotaExceeded) || errors.Is(err, catalog.ErrUnknownNamespace) {
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{err.Error()})
+				w.WriteHeader(statusOfQuotaError(err))
+				w.Write(jsonBytes)
+				return
+			}
+			if err == errReadOnly {
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{"This node is read-only."})
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write(jsonBytes)
+				return
+			}
+			if err != nil {
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{"Failed to register new dataPoints"})
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write(jsonBytes)
+				return
+			}
+		} else {
+			resp = searchQueries(fps, missing, targets, calcMode)
+			pt.Done("search")
+			recordSlowQuery(r.Context(), r.URL.Path, ns, featureGroupIDint, len(targets), pt.Total(), explainBatch(fps, resp, pt))
+		}
+
+		jsonBytes, _ := json.Marshal(resp)
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonBytes)
+	}
+}
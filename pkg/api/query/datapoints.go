@@ -0,0 +1,214 @@
+package query
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/data"
+
+	"github.com/rs/xid"
+)
+
+const (
+	defaultDataPointPageSize = 1000
+	maxDataPointPageSize     = 10000
+	// hashesChunkSize is the number of data points written at a time when every data point is listed.
+	hashesChunkSize = 1000
+)
+
+// encodeCursor makes an opaque cursor of the last data point of a page.
+// The order is in the cursor so that it is not used with another order.
+func encodeCursor(order brick.DataPointOrder, dp *data.DataPoint) string {
+	s := string(order) + ":" + strconv.FormatInt(dp.CreatedAt.UnixNano(), 10) + ":" + dp.GetDataIDstr()
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func decodeCursor(order brick.DataPointOrder, cursor string) (*brick.DataPointCursor, error) {
+	errInvalid := errors.New("Invalid cursor")
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalid
+	}
+	fields := strings.Split(string(b), ":")
+	if len(fields) != 3 || fields[0] != string(order) {
+		return nil, errInvalid
+	}
+	nsec, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, errInvalid
+	}
+	dataID, err := xid.FromString(fields[2])
+	if err != nil {
+		return nil, errInvalid
+	}
+	return &brick.DataPointCursor{CreatedAt: time.Unix(0, nsec), DataID: data.DataID(dataID)}, nil
+}
+
+// listQueryParams are the query parameters which ask for a page of the data points.
+var listQueryParams = []string{"order", "cursor", "limit", "from", "to", "vectors"}
+
+// isPaged tells whether the request asks for a page. Otherwise every data point is listed
+// as a map of data IDs to hashes, as it was before the data points were paged.
+func isPaged(r *http.Request) bool {
+	v := r.URL.Query()
+	for _, name := range listQueryParams {
+		if _, ok := v[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// writeHashes writes the data IDs of every available data point of the brick mapped to the hashes
+// of their vectors, as api.DataPointHashesResponse. The data points are copied out and written
+// a chunk at a time, so neither the brick nor the response is held as a whole.
+func writeHashes(w http.ResponseWriter, fb *brick.FeatureBrick) {
+	flusher, _ := w.(http.Flusher)
+	ids := fb.DataIDs()
+	w.Write([]byte(`{"dataPoints":{`))
+	first := true
+	for start := 0; start < len(ids); start += hashesChunkSize {
+		end := start + hashesChunkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var buf bytes.Buffer
+		for _, dp := range fb.DataPointsByID(ids[start:end]) {
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			hash, _ := dp.PosVector.CalcHash()
+			key, _ := json.Marshal(dp.GetDataIDstr())
+			value, _ := json.Marshal(hash)
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		w.Write(buf.Bytes())
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	w.Write([]byte("}}"))
+}
+
+// parseListQuery reads order (insertion or createdAt), cursor, limit and from / to in RFC 3339.
+func parseListQuery(r *http.Request) (brick.ListQuery, error) {
+	v := r.URL.Query()
+	q := brick.ListQuery{Order: brick.OrderByInsertion, Limit: defaultDataPointPageSize}
+	switch order := brick.DataPointOrder(v.Get("order")); order {
+	case "":
+	case brick.OrderByInsertion, brick.OrderByCreatedAt:
+		q.Order = order
+	default:
+		return q, errors.New("Invalid order")
+	}
+	if s := v.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > maxDataPointPageSize {
+			return q, errors.New("Invalid limit")
+		}
+		q.Limit = limit
+	}
+	if s := v.Get("cursor"); s != "" {
+		after, err := decodeCursor(q.Order, s)
+		if err != nil {
+			return q, err
+		}
+		q.After = after
+	}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		if s := v.Get(p.name); s != "" {
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return q, errors.New("Invalid " + p.name)
+			}
+			*p.t = t
+		}
+	}
+	return q, nil
+}
+
+// handlerOfDataPoints lists a page of the data points of a brick, or every data point of it
+// without any paging parameter. Neither is marshaled as a whole; they are written as they are read.
+func handlerOfDataPoints(bp *brick.BrickPool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+
+		fb := brickOfRequest(bp, r)
+		if fb == nil {
+			resp := struct {
+				Msg string `json:"msg"`
+			}{"Not Found target brick."}
+			jsonBytes, _ := json.Marshal(resp)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(jsonBytes)
+			return
+		}
+		if !isPaged(r) {
+			w.WriteHeader(http.StatusOK)
+			writeHashes(w, fb)
+			return
+		}
+		q, err := parseListQuery(r)
+		if err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{err.Error()})
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write(jsonBytes)
+			return
+		}
+		withVectors, _ := strconv.ParseBool(r.URL.Query().Get("vectors"))
+
+		dps, more := fb.ListDataPoints(q)
+		nextCursor := ""
+		if more {
+			nextCursor = encodeCursor(q.Order, &dps[len(dps)-1])
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"dataPoints":[`))
+		for i := range dps {
+			if i > 0 {
+				w.Write([]byte(","))
+			}
+			hash, _ := dps[i].PosVector.CalcHash()
+			item := api.DataPointListItem{
+				DataID:     dps[i].GetDataIDstr(),
+				Hash:       hash,
+				CreatedAt:  dps[i].CreatedAt,
+				ExternalID: dps[i].ExternalID,
+				Meta:       dps[i].Meta,
+			}
+			if withVectors {
+				item.PosVector = dps[i].PosVector.Vals
+			}
+			jsonBytes, _ := json.Marshal(item)
+			w.Write(jsonBytes)
+		}
+		w.Write([]byte("]"))
+		if nextCursor != "" {
+			jsonBytes, _ := json.Marshal(nextCursor)
+			w.Write([]byte(`,"nextCursor":`))
+			w.Write(jsonBytes)
+		}
+		w.Write([]byte("}"))
+	}
+}
@@ -0,0 +1,125 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/api/proxy"
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+)
+
+// exportChunkSize is the number of data points copied out of a brick under its lock at once.
+const exportChunkSize = 1000
+
+// bricksToExport returns the bricks of uniqueIDs, or of the feature group, or every brick of the namespace,
+// in the order of uniqueID.
+func bricksToExport(bp *brick.BrickPool, namespace string, featureGroupID int, uniqueIDs []string) ([]*brick.FeatureBrick, error) {
+	fbs := []*brick.FeatureBrick{}
+	switch {
+	case len(uniqueIDs) > 0:
+		for _, uniqueID := range uniqueIDs {
+			fb, _ := bp.GetBrickByUniqueIDstr(uniqueID)
+			if fb == nil || fb.GetNamespace() != namespace {
+				return nil, fmt.Errorf("Not found Brick (%s)", uniqueID)
+			}
+			fbs = append(fbs, fb)
+		}
+		return fbs, nil
+	case featureGroupID >= 0:
+		found, _ := bp.GetBricksOfGroup(namespace, brick.BrickFeatureGroupID(featureGroupID))
+		fbs = append(fbs, found...)
+	default:
+		all, _ := bp.GetAllBricks()
+		for _, fb := range all {
+			if fb.GetNamespace() == namespace {
+				fbs = append(fbs, fb)
+			}
+		}
+	}
+	sort.Slice(fbs, func(i, j int) bool {
+		return fbs[i].GetUniqueIDstr() < fbs[j].GetUniqueIDstr()
+	})
+	return fbs, nil
+}
+
+// handlerOfExport streams every available data point of the bricks as JSON lines.
+// The data IDs of a brick are taken when its turn comes, and its data points are then copied out
+// by ID a chunk at a time, so inserts are not blocked for long. Each data point which is there for
+// the whole export is sent exactly once, deleted ones are skipped, and later inserts are left out.
+func handlerOfExport(bp *brick.BrickPool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		v := r.URL.Query()
+		featureGroupID := -1
+		if s := v.Get("featureGroupID"); s != "" {
+			var err error
+			featureGroupID, err = strconv.Atoi(s)
+			if err != nil || featureGroupID < 0 {
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{"Invalid GroupID"})
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write(jsonBytes)
+				return
+			}
+		}
+		withVectors := v.Get("vectors") != "false"
+
+		fbs, err := bricksToExport(bp, catalog.NamespaceOf(r), featureGroupID, v["uniqueID"])
+		if err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{err.Error()})
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(jsonBytes)
+			return
+		}
+
+		w.Header().Set("Content-Type", proxy.ContentTypeNDJSON)
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		for _, fb := range fbs {
+			uniqueID := fb.GetUniqueIDstr()
+			ids := fb.DataIDs()
+			for start := 0; start < len(ids); start += exportChunkSize {
+				if r.Context().Err() != nil {
+					return
+				}
+				end := start + exportChunkSize
+				if end > len(ids) {
+					end = len(ids)
+				}
+				dps := fb.DataPointsByID(ids[start:end])
+				for i := range dps {
+					line := api.ExportedDataPoint{
+						DataID:         dps[i].GetDataIDstr(),
+						UniqueID:       uniqueID,
+						FeatureGroupID: fb.GetFeatureGroupIDint(),
+						ExternalID:     dps[i].ExternalID,
+						CreatedAt:      dps[i].CreatedAt,
+						Meta:           dps[i].Meta,
+					}
+					if withVectors {
+						line.Vals = dps[i].PosVector.Vals
+					}
+					if err := enc.Encode(line); err != nil {
+						return
+					}
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/api/proxy"
+	"github.com/abeja-inc/feature-search-db/pkg/api/rpc"
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/data"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+	"github.com/abeja-inc/feature-search-db/pkg/tracing"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// featureDbServer is the gRPC API of a calc node. It works the same as the HTTP API.
+type featureDbServer struct {
+	bp     *brick.BrickPool
+	groups catalog.Store
+}
+
+var _ rpc.FeatureDBServer = &featureDbServer{}
+
+// StartFeatureDbGrpcServer serves the gRPC API on c.GrpcListen.
+func StartFeatureDbGrpcServer(bp *brick.BrickPool, c *cluster.ClusterConfigInfo, groups catalog.Store, logger *zap.Logger, errs chan error) *grpc.Server {
+	logger = logger.Named("query")
+	SetSlowQueryThreshold(c.Runtime().SlowQueryThreshold)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(logging.UnaryServerInterceptor(logger), tracing.UnaryServerInterceptor),
+		grpc.ChainStreamInterceptor(logging.StreamServerInterceptor(logger), tracing.StreamServerInterceptor),
+	)
+	rpc.RegisterFeatureDBServer(srv, &featureDbServer{bp: bp, groups: groups})
+	go func(errs chan error) {
+		lis, err := net.Listen("tcp", *c.GrpcListen)
+		if err != nil {
+			errs <- err
+			return
+		}
+		logger.Info("gRPC server starting", zap.String("address", *c.GrpcListen))
+		if err := srv.Serve(lis); err != nil && err != grpc.ErrServerStopped {
+			errs <- err
+		}
+	}(errs)
+	return srv
+}
+
+// targetsOfRequest reads the vectors of req, from the payload when it is given, and checks them against their feature group.
+// A request which is not batch must have exactly one vector.
+func (s *featureDbServer) targetsOfRequest(ctx context.Context, req *rpc.SearchRequest, batch bool) ([]*data.PosVector, error) {
+	g, err := catalog.Lookup(s.groups, rpc.NamespaceOf(ctx), int(req.FeatureGroupId))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if len(req.Payload) > 0 {
+		forms, err := parseQueryInputForms(req.ContentType, req.Payload, batch, g)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return targetsOfForms(forms), nil
+	}
+	if len(req.Vectors) == 0 || (!batch && len(req.Vectors) != 1) {
+		return nil, status.Error(codes.InvalidArgument, "Invalid number of vectors")
+	}
+	forms := make([]proxy.QueryInputForm, len(req.Vectors))
+	for i, v := range req.Vectors {
+		if err := g.CheckVectors(len(v.Vals), 0); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		copy(forms[i].Vals[:], v.Vals)
+	}
+	return targetsOfForms(forms), nil
+}
+
+func (s *featureDbServer) search(ctx context.Context, req *rpc.SearchRequest, batch bool) (*rpc.SearchResponse, error) {
+	pt := api.NewPhaseTimer()
+	targets, err := s.targetsOfRequest(ctx, req, batch)
+	if err != nil {
+		return nil, err
+	}
+	pt.Done("parse")
+	fps, missing, err := bricksOfQuery(s.bp, rpc.NamespaceOf(ctx), brick.BrickFeatureGroupID(req.FeatureGroupId), req.UniqueIds)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	pt.Done("lookup")
+	calcMode := req.CalcMode
+	if calcMode == "" {
+		calcMode = string(api.CalcModeNaive)
+	}
+	resp := searchQueries(fps, missing, targets, calcMode)
+	pt.Done("search")
+	method, _ := grpc.Method(ctx)
+	recordSlowQuery(ctx, method, rpc.NamespaceOf(ctx), int(req.FeatureGroupId), len(targets), pt.Total(), explainBatch(fps, resp, pt))
+	return rpc.FromBatchSearchQueryResponse(resp), nil
+}
+
+func (s *featureDbServer) Search(ctx context.Context, req *rpc.SearchRequest) (*rpc.SearchResponse, error) {
+	return s.search(ctx, req, false)
+}
+
+func (s *featureDbServer) BatchSearch(ctx context.Context, req *rpc.SearchRequest) (*rpc.SearchResponse, error) {
+	return s.search(ctx, req, true)
+}
+
+func (s *featureDbServer) StreamSearch(stream rpc.FeatureDB_StreamSearchServer) error {
+	return rpc.ServeStream(stream, func(ctx context.Context, req *rpc.SearchRequest) (*rpc.SearchResponse, error) {
+		return s.search(ctx, req, false)
+	})
+}
+
+// Register adds the vectors into the first brick named by unique_ids,
+// or the first brick of the feature group.
+func (s *featureDbServer) Register(ctx context.Context, req *rpc.SearchRequest) (*rpc.SearchResponse, error) {
+	targets, err := s.targetsOfRequest(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	fps, missing, err := bricksOfQuery(s.bp, rpc.NamespaceOf(ctx), brick.BrickFeatureGroupID(req.FeatureGroupId), req.UniqueIds)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if len(missing) > 0 {
+		return nil, status.Errorf(codes.NotFound, "Not found Brick (%s)", missing[0])
+	}
+	// Other errors, quota exceeded among them, tell that the data points do not fit.
+	resp, err := registerQueries(s.bp, s.groups, fps[0], targets)
+	if err == errReadOnly {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if errors.Is(err, catalog.ErrUnknownNamespace) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return rpc.FromBatchSearchQueryResponse(resp), nil
+}
+
+// Delete removes the data points from the bricks of the feature group, or from the brick of unique_id.
+func (s *featureDbServer) Delete(ctx context.Context, req *rpc.DeleteRequest) (*rpc.DeleteResponse, error) {
+	if err := s.bp.BeginWrite(); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	defer s.bp.EndWrite()
+	var uniqueIDs []string
+	if req.UniqueId != "" {
+		uniqueIDs = []string{req.UniqueId}
+	}
+	fps, missing, err := bricksOfQuery(s.bp, rpc.NamespaceOf(ctx), brick.BrickFeatureGroupID(req.FeatureGroupId), uniqueIDs)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if len(missing) > 0 {
+		return nil, status.Errorf(codes.NotFound, "Not found Brick (%s)", missing[0])
+	}
+	resp := &rpc.DeleteResponse{}
+	rest := req.DataIds
+	for _, fp := range fps {
+		if len(rest) == 0 {
+			break
+		}
+		notFound := fp.DeleteDataPoints(rest)
+		missed := map[string]bool{}
+		for _, dataID := range notFound {
+			missed[dataID] = true
+		}
+		for _, dataID := range rest {
+			if !missed[dataID] {
+				resp.Deleted = append(resp.Deleted, dataID)
+			}
+		}
+		rest = notFound
+	}
+	resp.NotFound = rest
+	return resp, nil
+}
+
+func (s *featureDbServer) ListBricks(ctx context.Context, req *rpc.ListBricksRequest) (*rpc.ListBricksResponse, error) {
+	ns := rpc.NamespaceOf(ctx)
+	bricks, _ := s.bp.GetAllBricks()
+	resp := &rpc.ListBricksResponse{}
+	for _, fb := range bricks {
+		if fb.GetNamespace() != ns {
+			continue
+		}
+		if req.FeatureGroupId != nil && int32(fb.GetFeatureGroupIDint()) != req.FeatureGroupId.Value {
+			continue
+		}
+		resp.Bricks = append(resp.Bricks, &rpc.Brick{
+			UniqueId:             fb.GetUniqueIDstr(),
+			BrickId:              fb.GetBrickIDstr(),
+			FeatureGroupId:       int32(fb.GetFeatureGroupIDint()),
+			NumOfBrickTotalCap:   int64(fb.NumOfBrickTotalCap),
+			NumOfAvailablePoints: int64(fb.NumOfAvailablePoints),
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,454 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/bulk"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+	"github.com/abeja-inc/feature-search-db/pkg/vecio"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+)
+
+type importJob struct {
+	resp   api.ImportJobResponse
+	cancel context.CancelFunc
+}
+
+// importJobs keeps the running import jobs of files on the node, and the last ones which ended.
+// Imports of uploads are not kept since their requests wait for them.
+type importJobs struct {
+	mtx  sync.Mutex
+	jobs map[string]*importJob
+	// keep is how many of the jobs which ended are kept.
+	keep int
+}
+
+var jobs = &importJobs{jobs: map[string]*importJob{}, keep: 100}
+
+func (js *importJobs) add(job *importJob) {
+	js.mtx.Lock()
+	defer js.mtx.Unlock()
+	js.prune()
+	js.jobs[job.resp.JobID] = job
+}
+
+// prune forgets the jobs which ended but the last js.keep of them.
+func (js *importJobs) prune() {
+	ended := []*importJob{}
+	for _, job := range js.jobs {
+		if job.resp.State != api.JobStateRunning {
+			ended = append(ended, job)
+		}
+	}
+	if len(ended) <= js.keep {
+		return
+	}
+	sort.Slice(ended, func(i, j int) bool {
+		return ended[i].resp.StartedAt.After(ended[j].resp.StartedAt)
+	})
+	for _, job := range ended[js.keep:] {
+		delete(js.jobs, job.resp.JobID)
+	}
+}
+
+// get returns the job unless it is unknown or of another namespace.
+func (js *importJobs) get(namespace string, jobID string) (api.ImportJobResponse, bool) {
+	js.mtx.Lock()
+	defer js.mtx.Unlock()
+	job, ok := js.jobs[jobID]
+	if !ok || job.resp.Namespace != namespace {
+		return api.ImportJobResponse{}, false
+	}
+	return job.resp, true
+}
+
+func (js *importJobs) list(namespace string) []api.ImportJobResponse {
+	js.mtx.Lock()
+	defer js.mtx.Unlock()
+	resps := make([]api.ImportJobResponse, 0, len(js.jobs))
+	for _, job := range js.jobs {
+		if job.resp.Namespace == namespace {
+			resps = append(resps, job.resp)
+		}
+	}
+	sort.Slice(resps, func(i, j int) bool {
+		return resps[i].StartedAt.Before(resps[j].StartedAt)
+	})
+	return resps
+}
+
+func (js *importJobs) snapshot(job *importJob) api.ImportJobResponse {
+	js.mtx.Lock()
+	defer js.mtx.Unlock()
+	return job.resp
+}
+
+func (js *importJobs) update(job *importJob, fn func(resp *api.ImportJobResponse)) api.ImportJobResponse {
+	js.mtx.Lock()
+	defer js.mtx.Unlock()
+	fn(&job.resp)
+	return job.resp
+}
+
+func (js *importJobs) cancel(namespace string, jobID string) bool {
+	js.mtx.Lock()
+	defer js.mtx.Unlock()
+	job, ok := js.jobs[jobID]
+	ok = ok && job.resp.Namespace == namespace
+	if ok {
+		job.cancel()
+	}
+	return ok
+}
+
+func progressInto(resp *api.ImportJobResponse, p bulk.Progress) {
+	resp.Offset = p.Offset
+	resp.Inserted = p.Inserted
+	resp.Bricks = append([]string{}, p.Bricks...)
+	resp.UpdatedAt = p.UpdatedAt
+}
+
+// checkQuota returns catalog.ErrQuotaExceeded unless vectors more data points and memoryBytes more memory
+// fit in the quota of the namespace. Proxies check it before they write, and calc nodes check it again
+// for writes sent to them directly.
+func checkQuota(groups catalog.Store, namespace string, vectors int, memoryBytes int64) error {
+	ns, err := catalog.LookupNamespace(groups, namespace)
+	if err != nil {
+		return err
+	}
+	return ns.Quota.Check(groups.Usage(namespace), vectors, memoryBytes)
+}
+
+// statusOfQuotaError tells the HTTP status of an error of checkQuota.
+func statusOfQuotaError(err error) int {
+	if errors.Is(err, catalog.ErrUnknownNamespace) {
+		return http.StatusNotFound
+	}
+	return http.StatusTooManyRequests
+}
+
+// clusterState is a catalog.Store which also knows the bricks of the cluster, as state.Peer does.
+type clusterState interface {
+	GetAllState() state.StateContent
+}
+
+// isHeld tells whether a node of the cluster holds a replica of the brick, as when a drain moves it.
+func isHeld(groups catalog.Store, brickID string) bool {
+	cs, ok := groups.(clusterState)
+	if !ok {
+		return false
+	}
+	for _, ni := range cs.GetAllState().NodeInfos {
+		if ni.Bricks == nil {
+			continue
+		}
+		for _, b := range *ni.Bricks {
+			if b.BrickID == brickID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newBrickFunc creates bricks for imports, of the brick size of the feature group
+// or else of the size of the initial brick, as long as the memory quota of the namespace allows.
+func newBrickFunc(bp *brick.BrickPool, c *cluster.ClusterConfigInfo, groups catalog.Store, namespace string, featureGroupID brick.BrickFeatureGroupID) func() (*brick.FeatureBrick, error) {
+	return func() (*brick.FeatureBrick, error) {
+		strategy, err := newSearchStrategy(c.Runtime(), groups, namespace, int(featureGroupID))
+		if err != nil {
+			return nil, err
+		}
+		size := *c.SizeOfInitBrick
+		if g, ok := groups.Group(namespace, int(featureGroupID)); ok && g.Capacity.BrickSize > 0 {
+			size = g.Capacity.BrickSize
+		}
+		if err := checkQuota(groups, namespace, 0, int64(size)*brick.PointSize); err != nil {
+			return nil, err
+		}
+		fb := brick.NewBrick(size, featureGroupID, strategy)
+		fb.Namespace = namespace
+		if err := bp.RegisterIntoPool(&fb); err != nil {
+			return nil, err
+		}
+		return &fb, nil
+	}
+}
+
+// runImportJob reads the source to the end and records the outcome in the job.
+// The checkpoint file, if any, is saved after every batch.
+func runImportJob(ctx context.Context, bp *brick.BrickPool, c *cluster.ClusterConfigInfo, groups catalog.Store, j *importJob, src io.Reader, skip int, batchSize int) (api.ImportJobResponse, error) {
+	job := jobs.snapshot(j)
+	r, err := vecio.NewReader(job.Format, src)
+	if err != nil {
+		resp := jobs.update(j, func(resp *api.ImportJobResponse) {
+			resp.State = api.JobStateFailed
+			resp.Msg = err.Error()
+		})
+		return resp, err
+	}
+	// The vector quota of the namespace is what is left of it when the job starts.
+	ns, _ := catalog.LookupNamespace(groups, job.Namespace)
+	limit := 0
+	if ns.Quota.MaxVectors > 0 {
+		limit = ns.Quota.MaxVectors - groups.Usage(job.Namespace).Vectors
+		if limit <= 0 {
+			err := fmt.Errorf("%w (%d vectors)", catalog.ErrQuotaExceeded, ns.Quota.MaxVectors)
+			resp := jobs.update(j, func(resp *api.ImportJobResponse) {
+				resp.State = api.JobStateFailed
+				resp.Msg = err.Error()
+			})
+			return resp, err
+		}
+	}
+	im := &bulk.Importer{
+		Pool:           bp,
+		Namespace:      job.Namespace,
+		FeatureGroupID: brick.BrickFeatureGroupID(job.FeatureGroupID),
+		BatchSize:      batchSize,
+		Limit:          limit,
+		NewBrick:       newBrickFunc(bp, c, groups, job.Namespace, brick.BrickFeatureGroupID(job.FeatureGroupID)),
+		OnBatch: func(p bulk.Progress) error {
+			jobs.update(j, func(resp *api.ImportJobResponse) {
+				progressInto(resp, p)
+			})
+			if job.Checkpoint == "" {
+				return nil
+			}
+			return bulk.SaveCheckpoint(job.Checkpoint, bulk.Checkpoint{
+				Source:         job.Source,
+				Namespace:      job.Namespace,
+				FeatureGroupID: job.FeatureGroupID,
+				Offset:         p.Offset,
+			})
+		},
+	}
+	p, err := im.Run(ctx, r, skip)
+	if err == bulk.ErrLimitReached {
+		err = fmt.Errorf("%w (%d vectors)", catalog.ErrQuotaExceeded, ns.Quota.MaxVectors)
+	}
+	resp := jobs.update(j, func(resp *api.ImportJobResponse) {
+		progressInto(resp, p)
+		switch {
+		case err == nil:
+			resp.State = api.JobStateDone
+		case ctx.Err() != nil:
+			resp.State = api.JobStateCanceled
+			resp.Msg = ctx.Err().Error()
+		default:
+			resp.State = api.JobStateFailed
+			resp.Msg = err.Error()
+		}
+	})
+	logging.FromContext(ctx).Info("import job finished",
+		zap.String("jobID", resp.JobID), zap.String("state", string(resp.State)), zap.Int("inserted", resp.Inserted))
+	return resp, err
+}
+
+// handlerOfImportJob starts a bulk import into a feature group.
+// With "path", the file on the node is imported in the background and the job is returned at once.
+// Otherwise the request body is imported and the job is returned when it is done.
+func handlerOfImportJob(bp *brick.BrickPool, c *cluster.ClusterConfigInfo, groups catalog.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		defer r.Body.Close()
+
+		writeError := func(status int, msg string) {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{msg})
+			w.WriteHeader(status)
+			w.Write(jsonBytes)
+		}
+
+		v := r.URL.Query()
+		namespace := catalog.NamespaceOf(r)
+		featureGroupID, err := strconv.Atoi(v.Get("featureGroupID"))
+		if err != nil {
+			writeError(http.StatusUnprocessableEntity, "Invalid GroupID")
+			return
+		}
+		if _, err := catalog.Lookup(groups, namespace, featureGroupID); err != nil {
+			writeError(http.StatusNotFound, err.Error())
+			return
+		}
+		path, err := c.StoragePath(v.Get("path"))
+		if err != nil {
+			writeError(http.StatusUnprocessableEntity, fmt.Sprintf("Invalid path: %v", err))
+			return
+		}
+		format := v.Get("format")
+		if format == "" {
+			format = vecio.FormatOf(path)
+		}
+		skip := 0
+		if s := v.Get("skip"); s != "" {
+			skip, err = strconv.Atoi(s)
+			if err != nil || skip < 0 {
+				writeError(http.StatusUnprocessableEntity, "Invalid skip")
+				return
+			}
+		}
+		batchSize := 1000
+		if s := v.Get("batchSize"); s != "" {
+			batchSize, err = strconv.Atoi(s)
+			if err != nil || batchSize <= 0 {
+				writeError(http.StatusUnprocessableEntity, "Invalid batchSize")
+				return
+			}
+		}
+		checkpoint, err := c.StoragePath(v.Get("checkpoint"))
+		if err != nil {
+			writeError(http.StatusUnprocessableEntity, fmt.Sprintf("Invalid checkpoint: %v", err))
+			return
+		}
+		if checkpoint != "" && path == "" {
+			writeError(http.StatusUnprocessableEntity, "checkpoint needs path")
+			return
+		}
+		if bp.IsReadOnly() {
+			writeError(http.StatusServiceUnavailable, errReadOnly.Error())
+			return
+		}
+
+		// An import of the same file into the same group resumes from its checkpoint.
+		if checkpoint != "" {
+			cp, err := bulk.LoadCheckpoint(checkpoint)
+			if err != nil {
+				writeError(http.StatusUnprocessableEntity, fmt.Sprintf("Failed to read checkpoint: %v", err))
+				return
+			}
+			if cp.Source != "" && (cp.Source != path || cp.FeatureGroupID != featureGroupID || (cp.Namespace != "" && cp.Namespace != namespace)) {
+				writeError(http.StatusConflict, "The checkpoint is of another import.")
+				return
+			}
+			if cp.Offset > skip {
+				skip = cp.Offset
+			}
+		}
+
+		source := path
+		if path == "" {
+			source = "upload from " + r.RemoteAddr
+		}
+		// A job of a file outlives the request, but keeps its logger.
+		parent := logging.WithLogger(context.Background(), logging.FromContext(r.Context()))
+		if path == "" {
+			parent = r.Context()
+		}
+		ctx, cancel := context.WithCancel(parent)
+		now := time.Now()
+		job := &importJob{
+			resp: api.ImportJobResponse{
+				JobID:          xid.New().String(),
+				Namespace:      namespace,
+				FeatureGroupID: featureGroupID,
+				Source:         source,
+				Format:         format,
+				Checkpoint:     checkpoint,
+				State:          api.JobStateRunning,
+				Offset:         skip,
+				Bricks:         []string{},
+				StartedAt:      now,
+				UpdatedAt:      now,
+			},
+			cancel: cancel,
+		}
+
+		if path == "" {
+			defer cancel()
+			resp, err := runImportJob(ctx, bp, c, groups, job, r.Body, skip, batchSize)
+			status := http.StatusOK
+			switch {
+			case err == errReadOnly:
+				status = http.StatusServiceUnavailable
+			case err != nil:
+				status = http.StatusUnprocessableEntity
+			}
+			jsonBytes, _ := json.Marshal(resp)
+			w.WriteHeader(status)
+			w.Write(jsonBytes)
+			return
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			cancel()
+			writeError(http.StatusNotFound, err.Error())
+			return
+		}
+		jobs.add(job)
+		go func() {
+			defer f.Close()
+			defer cancel()
+			runImportJob(ctx, bp, c, groups, job, f, skip, batchSize)
+		}()
+		jsonBytes, _ := json.Marshal(job.resp)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(jsonBytes)
+	}
+}
+
+func handlerOfJobs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		jsonBytes, _ := json.Marshal(jobs.list(catalog.NamespaceOf(r)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonBytes)
+	}
+}
+
+// handlerOfJob returns a job on GET and cancels it on DELETE.
+func handlerOfJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		namespace := catalog.NamespaceOf(r)
+		jobID := mux.Vars(r)["jobID"]
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodDelete:
+			jobs.cancel(namespace, jobID)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		job, ok := jobs.get(namespace, jobID)
+		if !ok {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{"Not Found target job."})
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(jsonBytes)
+			return
+		}
+		jsonBytes, _ := json.Marshal(job)
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonBytes)
+	}
+}
@@ -1,57 +1,195 @@
 package query
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"os"
 	"strconv"
-	"strings"
 	"time"
 
-	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"github.com/abeja-inc/feature-search-db/pkg/api"
 	"github.com/abeja-inc/feature-search-db/pkg/api/proxy"
 	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
 	"github.com/abeja-inc/feature-search-db/pkg/cluster"
 	"github.com/abeja-inc/feature-search-db/pkg/data"
+	"github.com/abeja-inc/feature-search-db/pkg/health"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+	"github.com/abeja-inc/feature-search-db/pkg/metrics"
+	"github.com/abeja-inc/feature-search-db/pkg/reload"
 	"github.com/abeja-inc/feature-search-db/pkg/state"
+	"github.com/abeja-inc/feature-search-db/pkg/tracing"
 
 	"github.com/gorilla/mux"
-	httptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gorilla/mux"
+	"go.uber.org/zap"
 )
 
-func StartFeatureDbServer(bp *brick.BrickPool, c *cluster.ClusterConfigInfo, errs chan error) {
-	logger := log.New(os.Stderr, "(Feature API) > ", log.LstdFlags)
-	logRequest := func(handler http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			fmt.Printf("%s %s %s\n", r.RemoteAddr, r.Method, r.URL)
-			handler.ServeHTTP(w, r)
-		})
-	}
+func StartFeatureDbServer(bp *brick.BrickPool, c *cluster.ClusterConfigInfo, groups catalog.Store, ready *health.Checker, rl *reload.Reloader, logger *zap.Logger, errs chan error) *http.Server {
+	logger = logger.Named("query")
 	// Calcノードが提供するAPI群のエンドポイント定義
+	r := mux.NewRouter()
+	r.Use(logging.Middleware(logger), tracing.Middleware, catalog.Middleware(groups))
+	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("{\"Status\": \"OK From FeatureDb\"}"))
+	})
+	// 死活監視とトラフィック受け入れ可否
+	r.HandleFunc("/healthz", health.LivenessHandler())
+	r.HandleFunc("/readyz", ready.ReadinessHandler())
+	// /api/v1/ 以下はネームスペースごと (/api/v1/namespaces/{namespace}/ 以下、省略時はdefault)
+	catalog.HandleFunc(r, "/api/v1/bricks", handlerOfBricks(bp, true))
+	// 他ノードからのBrick受け入れ用 (drain時の移行先)
+	catalog.HandleFunc(r, "/api/v1/bricks/import", handlerOfImportingBrick(bp, c, groups))
+	catalog.HandleFunc(r, "/api/v1/bricks/{uniqueID}", handlerOfDetailOfBrick(bp))
+	catalog.HandleFunc(r, "/api/v1/bricks/{uniqueID}/datapoints", handlerOfDataPoints(bp))
+	catalog.HandleFunc(r, "/api/v1/bricks/{uniqueID}/datapoints/{dataID}", handlerOfDownloadingDataPoint(bp))
+	// ノード間のBrick共有用 (※差分転送実装がまだ)
+	catalog.HandleFunc(r, "/api/v1/bricks/{uniqueID}/download", handlerOfDownloadingBrick(bp))
+	// 特徴量検索用エンドポイント
+	catalog.HandleFunc(r, "/api/v1/searchQuery", handlerOfQueryAPI(bp, groups))
+	catalog.HandleFunc(r, "/api/v1/batchSearchQuery", handlerOfBatchQueryAPI(bp, groups))
+	// 一括インポート
+	catalog.HandleFunc(r, "/api/v1/jobs", handlerOfJobs())
+	catalog.HandleFunc(r, "/api/v1/jobs/import", handlerOfImportJob(bp, c, groups))
+	catalog.HandleFunc(r, "/api/v1/jobs/{jobID}", handlerOfJob())
+	// 特徴量グループのカタログ (クラスタ内で共有)
+	r.HandleFunc("/api/v1/namespaces", catalog.NamespaceListHandler(groups))
+	r.HandleFunc("/api/v1/namespaces/{namespace}", catalog.NamespaceHandler(groups))
+	catalog.HandleFunc(r, "/api/v1/groups", catalog.ListHandler(groups))
+	catalog.HandleFunc(r, "/api/v1/groups/{groupID}", catalog.GroupHandler(groups))
+	catalog.HandleFunc(r, "/api/v1/aliases", catalog.AliasListHandler(groups))
+	catalog.HandleFunc(r, "/api/v1/aliases/{alias}", catalog.AliasHandler(groups))
+	// 一括エクスポート
+	catalog.HandleFunc(r, "/api/v1/export", handlerOfExport(bp))
+	// 全ネームスペースのBrick一覧 (proxyの/statから)
+	r.HandleFunc("/admin/bricks", handlerOfBricks(bp, false))
+	// Prometheus
+	metrics.RegisterBrickPool(bp)
+	r.Handle("/metrics", metrics.Handler())
+	// 実行中のログレベル変更
+	r.Handle("/admin/loglevel", logging.LevelHandler())
+	// 遅いクエリの一覧
+	SetSlowQueryThreshold(c.Runtime().SlowQueryThreshold)
+	r.HandleFunc("/admin/slowqueries", slowQueries.Handler())
+	// 設定の再読み込み (SIGHUPでも可)
+	r.HandleFunc("/admin/reload", rl.Handler())
+	srv := &http.Server{
+		Addr:    *c.FeatureApiHttpListen,
+		Handler: r,
+	}
 	go func(errs chan error) {
-		logger.Printf("HTTP server starting (%s)\n", *c.FeatureApiHttpListen)
-		r := httptrace.NewRouter(
-			httptrace.WithServiceName("QueryAPI"),
-		)
-		r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("{\"Status\": \"OK From FeatureDb\"}"))
-		})
-		r.HandleFunc("/api/v1/bricks", handlerOfBricks(bp))
-		r.HandleFunc("/api/v1/bricks/{uniqueID}", handlerOfDetailOfBrick(bp))
-		r.HandleFunc("/api/v1/bricks/{uniqueID}/datapoints", handlerOfDataPoints(bp))
-		r.HandleFunc("/api/v1/bricks/{uniqueID}/datapoints/{dataID}", handlerOfDownloadingDataPoint(bp))
-		// ノード間のBrick共有用 (※差分転送実装がまだ)
-		r.HandleFunc("/api/v1/bricks/{uniqueID}/download", handlerOfDownloadingBrick(bp))
-		// 特徴量検索用エンドポイント
-		r.HandleFunc("/api/v1/searchQuery", handlerOfQueryAPI(bp))
-		errs <- http.ListenAndServe(*c.FeatureApiHttpListen, logRequest(r))
+		logger.Info("HTTP server starting", zap.String("address", *c.FeatureApiHttpListen))
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			errs <- err
+		}
 	}(errs)
+	return srv
+}
+
+func handlerOfImportingBrick(bp *brick.BrickPool, c *cluster.ClusterConfigInfo, groups catalog.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		defer r.Body.Close()
+
+		if bp.IsReadOnly() {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{"This node is read-only."})
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write(jsonBytes)
+			return
+		}
+
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{"Failed to read payload."})
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write(jsonBytes)
+			return
+		}
+
+		rt := c.Runtime()
+		strategy, err := brick.NewSearchStrategy(rt.SearchStrategy)
+		if err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{err.Error()})
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(jsonBytes)
+			return
+		}
+		ta := time.Now().UnixNano()
+		fb, err := brick.DecodeBrick(b, strategy)
+		tb := time.Now().UnixNano()
+		logging.FromContext(r.Context()).Debug("brick decoded", zap.Int64("nsec", tb-ta))
+		if err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{"Failed to decode brick."})
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write(jsonBytes)
+			return
+		}
+		if ns := catalog.NamespaceOf(r); fb.GetNamespace() != ns {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{fmt.Sprintf("The brick is of namespace %q, not %q.", fb.GetNamespace(), ns)})
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write(jsonBytes)
+			return
+		}
+		// The brick is searched with the strategy of its feature group, which is known only after decoding.
+		if err := applySearchStrategy(fb, rt, groups); err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{err.Error()})
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(jsonBytes)
+			return
+		}
+		// A brick which the cluster already holds, as one a drain moves here, adds nothing to the namespace
+		// but for a while. Any other brick must fit in its quota.
+		if !isHeld(groups, fb.GetBrickIDstr()) {
+			if err := checkQuota(groups, fb.GetNamespace(), fb.NumOfAvailablePoints, fb.MemoryBytes()); err != nil {
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{err.Error()})
+				w.WriteHeader(statusOfQuotaError(err))
+				w.Write(jsonBytes)
+				return
+			}
+		}
+		// The pool may have become read-only while the brick was read.
+		if err := bp.BeginWrite(); err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{err.Error()})
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write(jsonBytes)
+			return
+		}
+		err = bp.RegisterIntoPool(fb)
+		bp.EndWrite()
+		if err != nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{err.Error()})
+			w.WriteHeader(http.StatusConflict)
+			w.Write(jsonBytes)
+			return
+		}
+
+		jsonBytes, _ := json.Marshal(state.BrickInfoOf(fb))
+		w.WriteHeader(http.StatusCreated)
+		w.Write(jsonBytes)
+	}
 }
 
 func handlerOfDownloadingBrick(bp *brick.BrickPool) http.HandlerFunc {
@@ -62,10 +200,7 @@ func handlerOfDownloadingBrick(bp *brick.BrickPool) http.HandlerFunc {
 			return
 		}
 
-		vars := mux.Vars(r)
-		IDstr := vars["uniqueID"]
-
-		fb, _ := bp.GetBrickByUniqueIDstr(IDstr)
+		fb := brickOfRequest(bp, r)
 		if fb == nil {
 			resp := struct {
 				Msg string `json:"msg"`
@@ -79,7 +214,7 @@ func handlerOfDownloadingBrick(bp *brick.BrickPool) http.HandlerFunc {
 		ta := time.Now().UnixNano()
 		encodedBrick := fb.Encode()
 		tb := time.Now().UnixNano()
-		fmt.Printf("Encode time = %d nsec \n", tb-ta)
+		logging.FromContext(r.Context()).Debug("brick encoded", zap.Int64("nsec", tb-ta))
 
 		w.Header().Add("Content-Length", strconv.Itoa(len(encodedBrick)))
 		w.Header().Add("Content-Type", "application/force-download")
@@ -97,9 +232,8 @@ func handlerOfDownloadingDataPoint(bp *brick.BrickPool) http.HandlerFunc {
 		}
 
 		vars := mux.Vars(r)
-		brickUniqueIDstr := vars["uniqueID"]
 
-		fb, _ := bp.GetBrickByUniqueIDstr(brickUniqueIDstr)
+		fb := brickOfRequest(bp, r)
 		if fb == nil {
 			resp := struct {
 				Msg string `json:"msg"`
@@ -128,20 +262,15 @@ func handlerOfDownloadingDataPoint(bp *brick.BrickPool) http.HandlerFunc {
 
 		}
 
-		resp := struct {
-			DataID     string    `json:"dataID"`
-			Available  bool      `json:"available"`
-			PosVector  []float64 `json:"posVector"`
-			Hash       string    `json:"hash"`
-			CreatedAt  time.Time `json:"createdAt"`
-			SearchTime int64     `json:"searchTime"`
-		}{
-			dataPoint.GetDataIDstr(),
-			dataPoint.Available,
-			dataPoint.PosVector.Vals,
-			dataPoint.PosVector.Hash,
-			dataPoint.CreatedAt,
-			elapsedTime,
+		resp := api.DataPointResponse{
+			DataID:     dataPoint.GetDataIDstr(),
+			Available:  dataPoint.Available,
+			PosVector:  dataPoint.PosVector.Vals,
+			Hash:       dataPoint.PosVector.Hash,
+			CreatedAt:  dataPoint.CreatedAt,
+			SearchTime: elapsedTime,
+			ExternalID: dataPoint.ExternalID,
+			Meta:       dataPoint.Meta,
 		}
 		jsonBytes, _ := json.Marshal(resp)
 		w.WriteHeader(http.StatusOK)
@@ -157,10 +286,7 @@ func handlerOfDetailOfBrick(bp *brick.BrickPool) http.HandlerFunc {
 			return
 		}
 
-		vars := mux.Vars(r)
-		IDstr := vars["uniqueID"]
-
-		fb, _ := bp.GetBrickByUniqueIDstr(IDstr)
+		fb := brickOfRequest(bp, r)
 		if fb == nil {
 			resp := struct {
 				Msg string `json:"msg"`
@@ -171,62 +297,14 @@ func handlerOfDetailOfBrick(bp *brick.BrickPool) http.HandlerFunc {
 			return
 		}
 
-		resp := state.BrickInfo{
-			UniqueID:             fb.GetUniqueIDstr(),
-			BrickID:              fb.GetBrickIDstr(),
-			FeatureGroupID:       fb.GetFeatureGroupIDint(),
-			NumOfBrickTotalCap:   fb.NumOfBrickTotalCap,
-			NumOfAvailablePoints: fb.NumOfAvailablePoints,
-		}
-		jsonBytes, _ := json.Marshal(resp)
+		jsonBytes, _ := json.Marshal(state.BrickInfoOf(fb))
 		w.WriteHeader(http.StatusOK)
 		w.Write(jsonBytes)
 	}
 }
 
-func handlerOfDataPoints(bp *brick.BrickPool) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			w.Write([]byte("Invalid method"))
-			return
-		}
-
-		vars := mux.Vars(r)
-		IDstr := vars["uniqueID"]
-
-		fb, _ := bp.GetBrickByUniqueIDstr(IDstr)
-		if fb == nil {
-			resp := struct {
-				Msg string `json:"msg"`
-			}{"Not Found target brick."}
-			jsonBytes, _ := json.Marshal(resp)
-			w.WriteHeader(http.StatusNotFound)
-			w.Write(jsonBytes)
-			return
-		}
-
-		dataPoints := map[string]string{}
-		for _, dp := range fb.DataPoints {
-			if !dp.Available {
-				continue
-			}
-			hash, _ := dp.PosVector.CalcHash()
-			dataPoints[dp.GetDataIDstr()] = hash
-		}
-
-		resp := struct {
-			DataPoints map[string]string `json: "dataPoints"`
-		}{
-			DataPoints: dataPoints,
-		}
-		jsonBytes, _ := json.Marshal(resp)
-		w.WriteHeader(http.StatusOK)
-		w.Write(jsonBytes)
-	}
-}
-
-func handlerOfBricks(bp *brick.BrickPool) http.HandlerFunc {
+// handlerOfBricks lists the bricks of this node, only those of the namespace of the request with scoped.
+func handlerOfBricks(bp *brick.BrickPool, scoped bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -234,16 +312,14 @@ func handlerOfBricks(bp *brick.BrickPool) http.HandlerFunc {
 			return
 		}
 
+		ns := catalog.NamespaceOf(r)
 		bricks, _ := bp.GetAllBricks()
 		resp := make([]state.BrickInfo, 0, len(bricks))
 		for _, fb := range bricks {
-			resp = append(resp, state.BrickInfo{
-				UniqueID:             fb.GetUniqueIDstr(),
-				BrickID:              fb.GetBrickIDstr(),
-				FeatureGroupID:       fb.GetFeatureGroupIDint(),
-				NumOfBrickTotalCap:   fb.NumOfBrickTotalCap,
-				NumOfAvailablePoints: fb.NumOfAvailablePoints,
-			})
+			if scoped && fb.GetNamespace() != ns {
+				continue
+			}
+			resp = append(resp, state.BrickInfoOf(fb))
 		}
 		jsonBytes, _ := json.Marshal(resp)
 		w.WriteHeader(http.StatusOK)
@@ -251,11 +327,10 @@ func handlerOfBricks(bp *brick.BrickPool) http.HandlerFunc {
 	}
 }
 
-func handlerOfQueryAPI(bp *brick.BrickPool) http.HandlerFunc {
+func handlerOfQueryAPI(bp *brick.BrickPool, groups catalog.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		span := tracer.StartSpan("handlerOfQueryAPI")
+		span, ctx := tracing.StartSpan(r.Context(), "handlerOfQueryAPI")
 		defer span.Finish()
-		var childSpan tracer.Span
 
 		if r.Method != http.MethodPost {
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -263,14 +338,7 @@ func handlerOfQueryAPI(bp *brick.BrickPool) http.HandlerFunc {
 			return
 		}
 		defer r.Body.Close()
-
-		// Check Content-Type
-		contentType := r.Header.Get("Content-Type")
-		if strings.ToLower(contentType) != "application/json" {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			w.Write([]byte("Invalid Content-Type"))
-			return
-		}
+		pt := api.NewPhaseTimer()
 
 		// Parse GET Query
 		v := r.URL.Query()
@@ -280,24 +348,18 @@ func handlerOfQueryAPI(bp *brick.BrickPool) http.HandlerFunc {
 			}
 		*/
 
-		if _, ok := v["featureGroupID"]; !ok {
-			// featureGroupID is Necesarry parameter
-			jsonBytes, _ := json.Marshal(struct {
-				Msg string `json:"msg"`
-			}{"GroupID must be specified"})
-			w.WriteHeader(http.StatusUnprocessableEntity)
-			w.Write(jsonBytes)
-			return
-		}
-		featureGroupIDint, err := strconv.Atoi(v["featureGroupID"][0])
+		// featureGroupID, or an alias of it, is Necesarry parameter
+		ns := catalog.NamespaceOf(r)
+		group, status, err := groupOfQuery(ns, v, groups)
 		if err != nil {
 			jsonBytes, _ := json.Marshal(struct {
 				Msg string `json:"msg"`
-			}{"Invalid GroupID"})
-			w.WriteHeader(http.StatusUnprocessableEntity)
+			}{err.Error()})
+			w.WriteHeader(status)
 			w.Write(jsonBytes)
 			return
 		}
+		featureGroupIDint := group.ID
 		featureGroupID := brick.BrickFeatureGroupID(featureGroupIDint)
 
 		onlyRegister := false
@@ -313,13 +375,25 @@ func handlerOfQueryAPI(bp *brick.BrickPool) http.HandlerFunc {
 			}
 		}
 
+		explain := false
+		if _, ok := v["explain"]; ok {
+			explain, err = strconv.ParseBool(v["explain"][0])
+			if err != nil {
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{"Invalid Flag (explain)"})
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write(jsonBytes)
+				return
+			}
+		}
+
 		calcMode := string(api.CalcModeNaive)
 		if _, ok := v["calcMode"]; ok {
 			calcMode = v["calcMode"][0]
 		}
 
 		// Parse payload from client
-		var queryInputForm proxy.QueryInputForm
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
 			jsonBytes, _ := json.Marshal(struct {
@@ -329,38 +403,71 @@ func handlerOfQueryAPI(bp *brick.BrickPool) http.HandlerFunc {
 			w.Write(jsonBytes)
 			return
 		}
-		err = json.NewDecoder(bytes.NewReader(b)).Decode(&queryInputForm)
+		queryInputForms, err := parseQueryInputForms(r.Header.Get("Content-Type"), b, false, group)
+		if err == proxy.ErrInvalidContentType {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid Content-Type"))
+			return
+		}
 		if err != nil {
 			jsonBytes, _ := json.Marshal(struct {
 				Msg string `json:"msg"`
-			}{"Failed to parse json."})
+			}{err.Error()})
 			w.WriteHeader(http.StatusUnprocessableEntity)
 			w.Write(jsonBytes)
 			return
 		}
 
 		target := data.NewPosVector(false, 512)
-		target.LoadPositionFromArray(queryInputForm.Vals)
-		fps, _ := bp.GetBrickByGroupID(featureGroupID)
-		if fps == nil {
+		target.LoadPositionFromArray(queryInputForms[0].Vals)
+		pt.Done("parse")
+		// The proxy names the bricks to search by uniqueID.
+		// Without it, every brick of the feature group is searched.
+		fps, missing, err := bricksOfQuery(bp, ns, featureGroupID, v["uniqueID"])
+		if err != nil || (onlyRegister && len(missing) > 0) {
+			if err == nil {
+				err = fmt.Errorf("Not found Brick (%s)", missing[0])
+			}
 			jsonBytes, _ := json.Marshal(struct {
 				Msg string `json:"msg"`
-			}{"Not found Brick"})
+			}{err.Error()})
 			w.WriteHeader(http.StatusNotFound)
 			w.Write(jsonBytes)
 			return
 		}
-		fp := fps[0]
+		pt.Done("lookup")
 
-		childSpan = tracer.StartSpan("registerOrFindOperation", tracer.ChildOf(span.Context()))
+		childSpan, childCtx := tracing.StartSpan(ctx, "registerOrFindOperation")
 		if onlyRegister {
-			childSpan2 := tracer.StartSpan("AddNewDataPoint", tracer.ChildOf(childSpan.Context()))
+			if err := checkQuota(groups, ns, 1, 0); err != nil {
+				childSpan.Finish()
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{err.Error()})
+				w.WriteHeader(statusOfQuotaError(err))
+				w.Write(jsonBytes)
+				return
+			}
+			if err := bp.BeginWrite(); err != nil {
+				childSpan.Finish()
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{err.Error()})
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write(jsonBytes)
+				return
+			}
+			fp := fps[0]
+			childSpan2, _ := tracing.StartSpan(childCtx, "AddNewDataPoint")
 			ta := time.Now().UnixNano()
 			datPoint, err := fp.AddNewDataPoint(&target)
 			tb := time.Now().UnixNano()
+			bp.EndWrite()
 			childSpan2.Finish()
 			elapsedTime := tb - ta
+			metrics.ObserveInsert(fp.GetNamespace(), fp.GetFeatureGroupIDint(), 1, time.Duration(elapsedTime))
 			if err != nil {
+				childSpan.Finish()
 				jsonBytes, _ := json.Marshal(struct {
 					Msg string `json:"msg"`
 				}{"Failed to register new dataPoint"})
@@ -368,12 +475,8 @@ func handlerOfQueryAPI(bp *brick.BrickPool) http.HandlerFunc {
 				w.Write(jsonBytes)
 				return
 			}
-			jsonBytes, _ := json.Marshal(struct {
-				DataID      string  `json:"dataID"`
-				Distance    float64 `json:"distance"`
-				ElapsedTime int64   `json:"elapsedTime"`
-				Registered  bool    `json:"registered"`
-			}{
+			jsonBytes, _ := json.Marshal(api.SearchQueryResponse{
+				UniqueID:    fp.GetUniqueIDstr(),
 				DataID:      datPoint.GetDataIDstr(),
 				Distance:    -1,
 				ElapsedTime: elapsedTime,
@@ -382,30 +485,46 @@ func handlerOfQueryAPI(bp *brick.BrickPool) http.HandlerFunc {
 			w.WriteHeader(http.StatusOK)
 			w.Write(jsonBytes)
 		} else {
-			childSpan2 := tracer.StartSpan("FindSimilarDataPoint", tracer.ChildOf(childSpan.Context()))
-			rawParam := map[string]interface{}{ // TODO: refactor to strategic
-				"posVector": &target,
-				"numOfAvailablePoints": fp.NumOfAvailablePoints,
-			}
-			params := fp.CreateSearchParam(rawParam)
+			childSpan2, _ := tracing.StartSpan(childCtx, "FindSimilarDataPoint")
 			ta := time.Now().UnixNano()
-			ret := fp.Find(params)
+			resp := api.SearchQueryResponse{
+				Registered: false,
+				CalcMode:   calcMode,
+				Bricks:     make([]api.BrickSearchResult, 0, len(fps)+len(missing)),
+			}
+			for _, uniqueID := range missing {
+				resp.Bricks = append(resp.Bricks, api.BrickSearchResult{
+					UniqueID: uniqueID,
+					Success:  false,
+					Error:    "Not found Brick",
+				})
+			}
+			found := false
+			for _, fp := range fps {
+				ret := searchBrick(fp, &target)
+				resp.Bricks = append(resp.Bricks, ret)
+				if ret.DataID == "" {
+					continue
+				}
+				if !found || ret.Distance < resp.Distance {
+					resp.UniqueID = ret.UniqueID
+					resp.DataID = ret.DataID
+					resp.Distance = ret.Distance
+					found = true
+				}
+			}
 			tb := time.Now().UnixNano()
 			childSpan2.Finish()
-			elapsedTime := tb - ta
-			jsonBytes, _ := json.Marshal(struct {
-				DataID      string  `json:"dataID"`
-				Distance    float64 `json:"distance"`
-				ElapsedTime int64   `json:"elapsedTime"`
-				Registered  bool    `json:"registered"`
-				CalcMode    string  `json:"calcMode"`
-			}{
-				DataID:      ret.Result.GetDataIDstr(),
-				Distance:    ret.Distance,
-				ElapsedTime: elapsedTime,
-				Registered:  false,
-				CalcMode:    calcMode,
-			})
+			resp.ElapsedTime = tb - ta
+			metrics.ObserveSearch(fps, 1, time.Duration(resp.ElapsedTime))
+			pt.Done("search")
+			searchExplain := explainSearch(fps, resp.Bricks, 1)
+			searchExplain.Phases = pt.Phases
+			if explain {
+				resp.Explain = searchExplain
+			}
+			recordSlowQuery(ctx, r.URL.Path, ns, featureGroupIDint, 1, pt.Total(), searchExplain)
+			jsonBytes, _ := json.Marshal(resp)
 			w.WriteHeader(http.StatusOK)
 			w.Write(jsonBytes)
 		}
@@ -0,0 +1,245 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/api/rpc"
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/config"
+	"github.com/abeja-inc/feature-search-db/pkg/data"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+
+	"github.com/gorilla/mux"
+	"github.com/weaveworks/mesh"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestQueryAPI(t *testing.T) {
+	t.Run("it registers no more data points than the quota of the namespace successfully", testQueryAPI_quota)
+	t.Run("it imports no files outside the import dir successfully", testQueryAPI_importPath)
+	t.Run("it keeps the last jobs which ended successfully", testImportJobs_prune)
+	t.Run("it lists every data point of a large brick chunk by chunk successfully", testQueryAPI_hashes)
+}
+
+// newBrickOf returns a brick of the namespace with n data points.
+func newBrickOf(namespace string, n int) *brick.FeatureBrick {
+	fb := brick.NewBrick(10, brick.BrickFeatureGroupID(0), brick.NewLinerFindStrategy())
+	fb.Namespace = namespace
+	for i := 0; i < n; i++ {
+		pv := data.NewPosVector(true, 512)
+		fb.AddNewDataPoint(&pv)
+	}
+	return &fb
+}
+
+// newQuotaPeer returns the catalog of a namespace of maxVectors, whose bricks are held by another node.
+func newQuotaPeer(t *testing.T, namespace string, maxVectors int, bricks ...*brick.FeatureBrick) *state.Peer {
+	infos := []state.BrickInfo{}
+	for _, fb := range bricks {
+		infos = append(infos, state.BrickInfoOf(fb))
+	}
+	var buf bytes.Buffer
+	set := map[mesh.PeerName]state.StateContent{
+		mesh.PeerName(2): {NodeInfos: map[string]state.NodeInfo{"other": {Bricks: &infos, LastUpdatedAt: time.Now()}}},
+	}
+	if err := gob.NewEncoder(&buf).Encode(set); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	peer := state.NewPeer(mesh.PeerName(1), zap.NewNop())
+	if _, err := peer.OnGossipBroadcast(mesh.PeerName(2), buf.Bytes()); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	peer.SetNamespace(catalog.Namespace{Name: namespace, Quota: catalog.Quota{MaxVectors: maxVectors}, UpdatedAt: time.Now()})
+	g := catalog.Group{Namespace: namespace, ID: 0, Name: "products", UpdatedAt: time.Now()}
+	g.SetDefaults()
+	peer.SetGroup(g)
+	return peer
+}
+
+func post(h http.Handler, path string, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func testQueryAPI_quota(t *testing.T) {
+	// prepare
+	held := newBrickOf("team-a", 2)
+	peer := newQuotaPeer(t, "team-a", 3, held)
+	bp := &brick.BrickPool{}
+	bp.InitBrickPool()
+	bp.RegisterIntoPool(newBrickOf("team-a", 0))
+	other := &brick.BrickPool{}
+	other.InitBrickPool()
+	c := cluster.NewConfig(config.Default())
+	r := mux.NewRouter()
+	catalog.HandleFunc(r, "/api/v1/searchQuery", handlerOfQueryAPI(bp, peer))
+	catalog.HandleFunc(r, "/api/v1/batchSearchQuery", handlerOfBatchQueryAPI(bp, peer))
+	catalog.HandleFunc(r, "/api/v1/bricks/import", handlerOfImportingBrick(other, &c, peer))
+	vals := make([]float64, 512)
+	query, _ := json.Marshal(map[string]interface{}{"vals": vals})
+	batch, _ := json.Marshal(map[string]interface{}{"queries": []interface{}{map[string]interface{}{"vals": vals}, map[string]interface{}{"vals": vals}}})
+	srv := &featureDbServer{bp: bp, groups: peer}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(rpc.NamespaceKey, "team-a"))
+
+	// exec
+	one := post(r, "/api/v1/namespaces/team-a/searchQuery?featureGroupID=0&onlyRegister=true", "application/json", query)
+	two := post(r, "/api/v1/namespaces/team-a/batchSearchQuery?featureGroupID=0&onlyRegister=true", "application/json", batch)
+	_, grpcErr := srv.Register(ctx, &rpc.SearchRequest{FeatureGroupId: 0, Vectors: []*rpc.Vector{{Vals: vals}, {Vals: vals}}})
+	newBrick := post(r, "/api/v1/namespaces/team-a/bricks/import", "application/octet-stream", newBrickOf("team-a", 2).Encode())
+	moved := post(r, "/api/v1/namespaces/team-a/bricks/import", "application/octet-stream", held.Encode())
+
+	// assert
+	if one.Code != http.StatusOK {
+		t.Fatalf("fail. data point within the quota not registered. %d %s", one.Code, one.Body.String())
+	}
+	if two.Code != http.StatusTooManyRequests {
+		t.Fatalf("fail. batch over the quota registered. %d %s", two.Code, two.Body.String())
+	}
+	if status.Code(grpcErr) != codes.ResourceExhausted {
+		t.Fatalf("fail. gRPC registration over the quota not rejected. %v", grpcErr)
+	}
+	if newBrick.Code != http.StatusTooManyRequests {
+		t.Fatalf("fail. brick over the quota imported. %d %s", newBrick.Code, newBrick.Body.String())
+	}
+	if moved.Code != http.StatusCreated {
+		t.Fatalf("fail. brick which the cluster holds not imported. %d %s", moved.Code, moved.Body.String())
+	}
+}
+
+func testQueryAPI_importPath(t *testing.T) {
+	// prepare
+	dir, err := ioutil.TempDir("", "import")
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	defer os.RemoveAll(dir)
+	peer := newQuotaPeer(t, catalog.DefaultNamespace, 0)
+	bp := &brick.BrickPool{}
+	bp.InitBrickPool()
+	cfg := config.Default()
+	cfg.Storage.ImportDir = dir
+	c := cluster.NewConfig(cfg)
+	unset := cluster.NewConfig(config.Default())
+	r := mux.NewRouter()
+	catalog.HandleFunc(r, "/api/v1/jobs/import", handlerOfImportJob(bp, &c, peer))
+	noDir := mux.NewRouter()
+	catalog.HandleFunc(noDir, "/api/v1/jobs/import", handlerOfImportJob(bp, &unset, peer))
+
+	// exec
+	absolute := post(r, "/api/v1/jobs/import?featureGroupID=0&path=/etc/passwd&format=jsonl", "application/json", nil)
+	parent := post(r, "/api/v1/jobs/import?featureGroupID=0&path=../x&format=jsonl", "application/json", nil)
+	nested := post(r, "/api/v1/jobs/import?featureGroupID=0&path=a/../../x&format=jsonl", "application/json", nil)
+	checkpoint := post(r, "/api/v1/jobs/import?featureGroupID=0&path=x.jsonl&checkpoint=../x", "application/json", nil)
+	withoutDir := post(noDir, "/api/v1/jobs/import?featureGroupID=0&path=x.jsonl", "application/json", nil)
+
+	// assert
+	for name, rec := range map[string]*httptest.ResponseRecorder{
+		"absolute path": absolute, "parent path": parent, "nested parent path": nested,
+		"parent checkpoint": checkpoint, "path without import dir": withoutDir,
+	} {
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("fail. import of %s not rejected. %d %s", name, rec.Code, rec.Body.String())
+		}
+	}
+	if len(jobs.list(catalog.DefaultNamespace)) != 0 {
+		t.Fatalf("fail. jobs started. %v", jobs.list(catalog.DefaultNamespace))
+	}
+}
+
+func testImportJobs_prune(t *testing.T) {
+	// prepare
+	js := &importJobs{jobs: map[string]*importJob{}, keep: 2}
+	start := time.Now()
+	newJob := func(id string, state api.JobState, i int) *importJob {
+		return &importJob{resp: api.ImportJobResponse{JobID: id, State: state, StartedAt: start.Add(time.Duration(i) * time.Second)}}
+	}
+	js.add(newJob("running", api.JobStateRunning, 0))
+	js.add(newJob("done1", api.JobStateDone, 1))
+	js.add(newJob("failed2", api.JobStateFailed, 2))
+	js.add(newJob("done3", api.JobStateDone, 3))
+
+	// exec
+	js.add(newJob("running4", api.JobStateRunning, 4))
+
+	// assert
+	if len(js.jobs) != 4 {
+		t.Fatalf("fail. number of jobs not match. %d", len(js.jobs))
+	}
+	for _, id := range []string{"running", "failed2", "done3", "running4"} {
+		if _, ok := js.jobs[id]; !ok {
+			t.Fatalf("fail. job %s not kept", id)
+		}
+	}
+}
+
+// writeRecorder records the size of every write to the response.
+type writeRecorder struct {
+	*httptest.ResponseRecorder
+	writes []int
+}
+
+func (wr *writeRecorder) Write(b []byte) (int, error) {
+	wr.writes = append(wr.writes, len(b))
+	return wr.ResponseRecorder.Write(b)
+}
+
+func testQueryAPI_hashes(t *testing.T) {
+	// prepare
+	n := 2*hashesChunkSize + 500
+	fb := brick.NewBrick(n, brick.BrickFeatureGroupID(0), brick.NewLinerFindStrategy())
+	pvs := make([]*data.PosVector, n)
+	for i := range pvs {
+		pv := data.NewPosVector(true, 512)
+		pvs[i] = &pv
+	}
+	fb.AddNewDataPoints(pvs)
+	bp := &brick.BrickPool{}
+	bp.InitBrickPool()
+	bp.RegisterIntoPool(&fb)
+	r := mux.NewRouter()
+	catalog.HandleFunc(r, "/api/v1/bricks/{uniqueID}/datapoints", handlerOfDataPoints(bp))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/bricks/"+fb.GetUniqueIDstr()+"/datapoints", nil)
+	rec := &writeRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+	// exec
+	r.ServeHTTP(rec, req)
+
+	// assert
+	var resp api.DataPointHashesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.DataPoints) != n {
+		t.Fatalf("fail. number of data points not match. %d %v", len(resp.DataPoints), err)
+	}
+	for i := 0; i < fb.NumOfAvailablePoints; i++ {
+		hash, _ := fb.DataPoints[i].PosVector.CalcHash()
+		if resp.DataPoints[fb.DataPoints[i].GetDataIDstr()] != hash {
+			t.Fatalf("fail. hash of data point %d not match.", i)
+		}
+	}
+	largest := 0
+	for _, size := range rec.writes {
+		if size > largest {
+			largest = size
+		}
+	}
+	if len(rec.writes) < 3 || largest > rec.Body.Len()/2 {
+		t.Fatalf("fail. response written as a whole. %d writes, largest %d of %d bytes", len(rec.writes), largest, rec.Body.Len())
+	}
+}
@@ -0,0 +1,187 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/api/proxy"
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/data"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+	"github.com/abeja-inc/feature-search-db/pkg/slowlog"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// slowQueries keeps the slow searches of this node for /admin/slowqueries.
+// Its threshold is set when the servers start, and again when the config is reloaded.
+var slowQueries = slowlog.New(slowlog.DefaultSize, 0)
+
+// SetSlowQueryThreshold changes the time from which a search is kept on /admin/slowqueries.
+func SetSlowQueryThreshold(threshold time.Duration) {
+	slowQueries.SetThreshold(threshold)
+}
+
+// groupOfQuery reads the feature group of a query of the namespace, named by "featureGroupID" or by "alias",
+// and returns the HTTP status of the error when it is not in the catalog.
+func groupOfQuery(namespace string, v url.Values, groups catalog.Store) (catalog.Group, int, error) {
+	var featureGroupID int
+	var err error
+	if _, ok := v["alias"]; ok {
+		featureGroupID, err = catalog.ResolveAlias(groups, namespace, v["alias"][0])
+		if err != nil {
+			return catalog.Group{}, http.StatusNotFound, err
+		}
+	} else {
+		if _, ok := v["featureGroupID"]; !ok {
+			return catalog.Group{}, http.StatusUnprocessableEntity, errors.New("GroupID or alias must be specified")
+		}
+		featureGroupID, err = strconv.Atoi(v["featureGroupID"][0])
+		if err != nil {
+			return catalog.Group{}, http.StatusUnprocessableEntity, errors.New("Invalid GroupID")
+		}
+	}
+	g, err := catalog.Lookup(groups, namespace, featureGroupID)
+	if err != nil {
+		return g, http.StatusNotFound, err
+	}
+	return g, http.StatusOK, nil
+}
+
+// brickOfRequest returns the brick of the "uniqueID" path variable, or nil when it is not on this node
+// or belongs to another namespace than the request.
+func brickOfRequest(bp *brick.BrickPool, r *http.Request) *brick.FeatureBrick {
+	fb, _ := bp.GetBrickByUniqueIDstr(mux.Vars(r)["uniqueID"])
+	if fb == nil || fb.GetNamespace() != catalog.NamespaceOf(r) {
+		return nil
+	}
+	return fb
+}
+
+// bricksOfQuery resolves the bricks a query of the namespace is run against.
+// A named brick which is not on this node or belongs to another feature group
+// is returned in missing, so that it can be reported per brick.
+func bricksOfQuery(bp *brick.BrickPool, namespace string, featureGroupID brick.BrickFeatureGroupID, uniqueIDs []string) (fps []*brick.FeatureBrick, missing []string, err error) {
+	if len(uniqueIDs) == 0 {
+		fps, _ = bp.GetBricksOfGroup(namespace, featureGroupID)
+		if len(fps) == 0 {
+			return nil, nil, fmt.Errorf("Not found Brick")
+		}
+		return fps, nil, nil
+	}
+	fps = make([]*brick.FeatureBrick, 0, len(uniqueIDs))
+	for _, uniqueID := range uniqueIDs {
+		fp, _ := bp.GetBrickByUniqueIDstr(uniqueID)
+		if fp == nil || fp.FeatureGroupID != featureGroupID || fp.GetNamespace() != namespace {
+			missing = append(missing, uniqueID)
+			continue
+		}
+		fps = append(fps, fp)
+	}
+	if len(fps) == 0 {
+		return nil, missing, fmt.Errorf("Not found Brick")
+	}
+	return fps, missing, nil
+}
+
+// searchBrick finds the nearest data point to target in fp.
+func searchBrick(fp *brick.FeatureBrick, target *data.PosVector) api.BrickSearchResult {
+	result := api.BrickSearchResult{
+		UniqueID: fp.GetUniqueIDstr(),
+		Success:  true,
+	}
+	fp.Search(func(numOfAvailablePoints int) {
+		if numOfAvailablePoints == 0 {
+			return
+		}
+		rawParam := map[string]interface{}{ // TODO: refactor to strategic
+			"posVector":            target,
+			"numOfAvailablePoints": numOfAvailablePoints,
+		}
+		params := fp.CreateSearchParam(rawParam)
+		ta := time.Now().UnixNano()
+		ret := fp.Find(params)
+		tb := time.Now().UnixNano()
+		result.DataID = ret.Result.GetDataIDstr()
+		result.Distance = ret.Distance
+		result.ElapsedTime = tb - ta
+	})
+	return result
+}
+
+// explainSearch tells how fps were searched for the number of queries.
+// results are the results of the bricks, which are matched with fps by uniqueID.
+func explainSearch(fps []*brick.FeatureBrick, results []api.BrickSearchResult, queries int) *api.SearchExplain {
+	elapsedTimes := map[string]int64{}
+	for _, ret := range results {
+		elapsedTimes[ret.UniqueID] = ret.ElapsedTime
+	}
+	explain := &api.SearchExplain{
+		Bricks: make([]api.BrickExplain, 0, len(fps)),
+		Phases: []api.ExplainPhase{},
+	}
+	for _, fp := range fps {
+		var numOfAvailablePoints int
+		fp.Search(func(n int) {
+			numOfAvailablePoints = n
+		})
+		goroutines := []int{}
+		if numOfAvailablePoints > 0 {
+			goroutines = fp.SearchSplit(numOfAvailablePoints)
+		}
+		explain.Strategy = fp.StrategyName()
+		explain.BricksScanned++
+		explain.PointsVisited += numOfAvailablePoints
+		explain.Bricks = append(explain.Bricks, api.BrickExplain{
+			UniqueID:      fp.GetUniqueIDstr(),
+			Strategy:      fp.StrategyName(),
+			PointsVisited: numOfAvailablePoints,
+			Goroutines:    goroutines,
+			ElapsedTime:   elapsedTimes[fp.GetUniqueIDstr()],
+		})
+	}
+	explain.DistanceEvaluations = explain.PointsVisited * queries
+	return explain
+}
+
+// recordSlowQuery keeps a search which took the threshold or longer in slowQueries.
+func recordSlowQuery(ctx context.Context, endpoint string, namespace string, featureGroupID int, queries int, elapsedTime int64, explain *api.SearchExplain) {
+	kept := slowQueries.Record(slowlog.Entry{
+		RequestID:      logging.RequestID(ctx),
+		Endpoint:       endpoint,
+		Namespace:      namespace,
+		FeatureGroupID: featureGroupID,
+		Queries:        queries,
+		ElapsedTime:    elapsedTime,
+		Explain:        explain,
+	})
+	if kept {
+		logging.FromContext(ctx).Warn("slow query",
+			zap.String("endpoint", endpoint),
+			zap.String("namespace", namespace),
+			zap.Int("featureGroupID", featureGroupID),
+			zap.Int("queries", queries),
+			zap.Duration("elapsed", time.Duration(elapsedTime)),
+		)
+	}
+}
+
+// parseQueryInputForms decodes a query body, either JSON or binary vectors, of the feature group g.
+func parseQueryInputForms(contentType string, b []byte, batch bool, g catalog.Group) ([]proxy.QueryInputForm, error) {
+	payload, err := proxy.ParseQueryPayload(contentType, b, batch)
+	if err != nil {
+		return nil, err
+	}
+	if err := payload.CheckGroup(g); err != nil {
+		return nil, err
+	}
+	return payload.Forms()
+}
@@ -0,0 +1,47 @@
+package query
+
+import (
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+)
+
+// strategyName returns the strategy of the feature group of the namespace in the catalog, or else the one of rt.
+func strategyName(rt *cluster.Runtime, groups catalog.Store, namespace string, featureGroupID int) string {
+	if g, ok := groups.Group(namespace, featureGroupID); ok && g.Strategy != "" {
+		return g.Strategy
+	}
+	return rt.GetSearchStrategy(featureGroupID)
+}
+
+// newSearchStrategy builds the strategy which the bricks of the feature group are searched with.
+func newSearchStrategy(rt *cluster.Runtime, groups catalog.Store, namespace string, featureGroupID int) (brick.SearchStrategy, error) {
+	return brick.NewSearchStrategy(strategyName(rt, groups, namespace, featureGroupID))
+}
+
+// ApplySearchStrategies gives every brick of bp the strategy of its feature group in the catalog or rt.
+// Searches which have already started finish with the old strategy.
+func ApplySearchStrategies(bp *brick.BrickPool, rt *cluster.Runtime, groups catalog.Store) error {
+	fbs, err := bp.GetAllBricks()
+	if err != nil {
+		return err
+	}
+	for _, fb := range fbs {
+		if err := applySearchStrategy(fb, rt, groups); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applySearchStrategy(fb *brick.FeatureBrick, rt *cluster.Runtime, groups catalog.Store) error {
+	if fb.StrategyName() == strategyName(rt, groups, fb.GetNamespace(), fb.GetFeatureGroupIDint()) {
+		return nil
+	}
+	strategy, err := newSearchStrategy(rt, groups, fb.GetNamespace(), fb.GetFeatureGroupIDint())
+	if err != nil {
+		return err
+	}
+	fb.SetSearchStrategy(strategy)
+	return nil
+}
@@ -0,0 +1,1134 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: featuredb.proto
+
+package rpc
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	wrappers "github.com/golang/protobuf/ptypes/wrappers"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type Vector struct {
+	Vals                 []float64 `protobuf:"fixed64,1,rep,packed,name=vals,proto3" json:"vals,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *Vector) Reset()         { *m = Vector{} }
+func (m *Vector) String() string { return proto.CompactTextString(m) }
+func (*Vector) ProtoMessage()    {}
+func (*Vector) Descriptor() ([]byte, []int) {
+	return fileDescriptor_073bc2a55365c3cc, []int{0}
+}
+
+func (m *Vector) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Vector.Unmarshal(m, b)
+}
+func (m *Vector) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Vector.Marshal(b, m, deterministic)
+}
+func (m *Vector) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Vector.Merge(m, src)
+}
+func (m *Vector) XXX_Size() int {
+	return xxx_messageInfo_Vector.Size(m)
+}
+func (m *Vector) XXX_DiscardUnknown() {
+	xxx_messageInfo_Vector.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Vector proto.InternalMessageInfo
+
+func (m *Vector) GetVals() []float64 {
+	if m != nil {
+		return m.Vals
+	}
+	return nil
+}
+
+type SearchRequest struct {
+	RequestId      string `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	FeatureGroupId int32  `protobuf:"varint,2,opt,name=feature_group_id,json=featureGroupId,proto3" json:"feature_group_id,omitempty"`
+	CalcMode       string `protobuf:"bytes,3,opt,name=calc_mode,json=calcMode,proto3" json:"calc_mode,omitempty"`
+	// unique_ids names the bricks to search on a calc node.
+	// Every brick of the feature group is searched when it is empty.
+	UniqueIds []string  `protobuf:"bytes,4,rep,name=unique_ids,json=uniqueIds,proto3" json:"unique_ids,omitempty"`
+	Vectors   []*Vector `protobuf:"bytes,5,rep,name=vectors,proto3" json:"vectors,omitempty"`
+	// payload is a body of the HTTP API, JSON or binary vectors, which is used instead of vectors.
+	// Register takes the JSON of a batch.
+	Payload     []byte `protobuf:"bytes,6,opt,name=payload,proto3" json:"payload,omitempty"`
+	ContentType string `protobuf:"bytes,7,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	// The fields below are used by the reverse proxy.
+	SearchOnly           bool                  `protobuf:"varint,8,opt,name=search_only,json=searchOnly,proto3" json:"search_only,omitempty"`
+	NoveltyThreshold     *wrappers.DoubleValue `protobuf:"bytes,9,opt,name=novelty_threshold,json=noveltyThreshold,proto3" json:"novelty_threshold,omitempty"`
+	TimeoutMs            int64                 `protobuf:"varint,10,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"`
+	Zone                 string                `protobuf:"bytes,11,opt,name=zone,proto3" json:"zone,omitempty"`
+	NodeSelector         map[string]string     `protobuf:"bytes,12,rep,name=node_selector,json=nodeSelector,proto3" json:"node_selector,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}              `json:"-"`
+	XXX_unrecognized     []byte                `json:"-"`
+	XXX_sizecache        int32                 `json:"-"`
+}
+
+func (m *SearchRequest) Reset()         { *m = SearchRequest{} }
+func (m *SearchRequest) String() string { return proto.CompactTextString(m) }
+func (*SearchRequest) ProtoMessage()    {}
+func (*SearchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_073bc2a55365c3cc, []int{1}
+}
+
+func (m *SearchRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SearchRequest.Unmarshal(m, b)
+}
+func (m *SearchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SearchRequest.Marshal(b, m, deterministic)
+}
+func (m *SearchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SearchRequest.Merge(m, src)
+}
+func (m *SearchRequest) XXX_Size() int {
+	return xxx_messageInfo_SearchRequest.Size(m)
+}
+func (m *SearchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SearchRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SearchRequest proto.InternalMessageInfo
+
+func (m *SearchRequest) GetRequestId() string {
+	if m != nil {
+		return m.RequestId
+	}
+	return ""
+}
+
+func (m *SearchRequest) GetFeatureGroupId() int32 {
+	if m != nil {
+		return m.FeatureGroupId
+	}
+	return 0
+}
+
+func (m *SearchRequest) GetCalcMode() string {
+	if m != nil {
+		return m.CalcMode
+	}
+	return ""
+}
+
+func (m *SearchRequest) GetUniqueIds() []string {
+	if m != nil {
+		return m.UniqueIds
+	}
+	return nil
+}
+
+func (m *SearchRequest) GetVectors() []*Vector {
+	if m != nil {
+		return m.Vectors
+	}
+	return nil
+}
+
+func (m *SearchRequest) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *SearchRequest) GetContentType() string {
+	if m != nil {
+		return m.ContentType
+	}
+	return ""
+}
+
+func (m *SearchRequest) GetSearchOnly() bool {
+	if m != nil {
+		return m.SearchOnly
+	}
+	return false
+}
+
+func (m *SearchRequest) GetNoveltyThreshold() *wrappers.DoubleValue {
+	if m != nil {
+		return m.NoveltyThreshold
+	}
+	return nil
+}
+
+func (m *SearchRequest) GetTimeoutMs() int64 {
+	if m != nil {
+		return m.TimeoutMs
+	}
+	return 0
+}
+
+func (m *SearchRequest) GetZone() string {
+	if m != nil {
+		return m.Zone
+	}
+	return ""
+}
+
+func (m *SearchRequest) GetNodeSelector() map[string]string {
+	if m != nil {
+		return m.NodeSelector
+	}
+	return nil
+}
+
+type BrickResult struct {
+	UniqueId string `protobuf:"bytes,1,opt,name=unique_id,json=uniqueId,proto3" json:"unique_id,omitempty"`
+	BrickId  string `protobuf:"bytes,2,opt,name=brick_id,json=brickId,proto3" json:"brick_id,omitempty"`
+	NodeName string `protobuf:"bytes,3,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`
+	Success  bool   `protobuf:"varint,4,opt,name=success,proto3" json:"success,omitempty"`
+	// data_id is empty when the brick has no data point yet.
+	DataId               string   `protobuf:"bytes,5,opt,name=data_id,json=dataId,proto3" json:"data_id,omitempty"`
+	Distance             float64  `protobuf:"fixed64,6,opt,name=distance,proto3" json:"distance,omitempty"`
+	ElapsedTime          int64    `protobuf:"varint,7,opt,name=elapsed_time,json=elapsedTime,proto3" json:"elapsed_time,omitempty"`
+	Attempts             int32    `protobuf:"varint,8,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	Error                string   `protobuf:"bytes,9,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BrickResult) Reset()         { *m = BrickResult{} }
+func (m *BrickResult) String() string { return proto.CompactTextString(m) }
+func (*BrickResult) ProtoMessage()    {}
+func (*BrickResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_073bc2a55365c3cc, []int{2}
+}
+
+func (m *BrickResult) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BrickResult.Unmarshal(m, b)
+}
+func (m *BrickResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BrickResult.Marshal(b, m, deterministic)
+}
+func (m *BrickResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BrickResult.Merge(m, src)
+}
+func (m *BrickResult) XXX_Size() int {
+	return xxx_messageInfo_BrickResult.Size(m)
+}
+func (m *BrickResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_BrickResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BrickResult proto.InternalMessageInfo
+
+func (m *BrickResult) GetUniqueId() string {
+	if m != nil {
+		return m.UniqueId
+	}
+	return ""
+}
+
+func (m *BrickResult) GetBrickId() string {
+	if m != nil {
+		return m.BrickId
+	}
+	return ""
+}
+
+func (m *BrickResult) GetNodeName() string {
+	if m != nil {
+		return m.NodeName
+	}
+	return ""
+}
+
+func (m *BrickResult) GetSuccess() bool {
+	if m != nil {
+		return m.Success
+	}
+	return false
+}
+
+func (m *BrickResult) GetDataId() string {
+	if m != nil {
+		return m.DataId
+	}
+	return ""
+}
+
+func (m *BrickResult) GetDistance() float64 {
+	if m != nil {
+		return m.Distance
+	}
+	return 0
+}
+
+func (m *BrickResult) GetElapsedTime() int64 {
+	if m != nil {
+		return m.ElapsedTime
+	}
+	return 0
+}
+
+func (m *BrickResult) GetAttempts() int32 {
+	if m != nil {
+		return m.Attempts
+	}
+	return 0
+}
+
+func (m *BrickResult) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type SearchResult struct {
+	UniqueId             string         `protobuf:"bytes,1,opt,name=unique_id,json=uniqueId,proto3" json:"unique_id,omitempty"`
+	DataId               string         `protobuf:"bytes,2,opt,name=data_id,json=dataId,proto3" json:"data_id,omitempty"`
+	Distance             float64        `protobuf:"fixed64,3,opt,name=distance,proto3" json:"distance,omitempty"`
+	IsNew                bool           `protobuf:"varint,4,opt,name=is_new,json=isNew,proto3" json:"is_new,omitempty"`
+	Registered           bool           `protobuf:"varint,5,opt,name=registered,proto3" json:"registered,omitempty"`
+	NoveltyThreshold     float64        `protobuf:"fixed64,6,opt,name=novelty_threshold,json=noveltyThreshold,proto3" json:"novelty_threshold,omitempty"`
+	Bricks               []*BrickResult `protobuf:"bytes,7,rep,name=bricks,proto3" json:"bricks,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *SearchResult) Reset()         { *m = SearchResult{} }
+func (m *SearchResult) String() string { return proto.CompactTextString(m) }
+func (*SearchResult) ProtoMessage()    {}
+func (*SearchResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_073bc2a55365c3cc, []int{3}
+}
+
+func (m *SearchResult) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SearchResult.Unmarshal(m, b)
+}
+func (m *SearchResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SearchResult.Marshal(b, m, deterministic)
+}
+func (m *SearchResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SearchResult.Merge(m, src)
+}
+func (m *SearchResult) XXX_Size() int {
+	return xxx_messageInfo_SearchResult.Size(m)
+}
+func (m *SearchResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_SearchResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SearchResult proto.InternalMessageInfo
+
+func (m *SearchResult) GetUniqueId() string {
+	if m != nil {
+		return m.UniqueId
+	}
+	return ""
+}
+
+func (m *SearchResult) GetDataId() string {
+	if m != nil {
+		return m.DataId
+	}
+	return ""
+}
+
+func (m *SearchResult) GetDistance() float64 {
+	if m != nil {
+		return m.Distance
+	}
+	return 0
+}
+
+func (m *SearchResult) GetIsNew() bool {
+	if m != nil {
+		return m.IsNew
+	}
+	return false
+}
+
+func (m *SearchResult) GetRegistered() bool {
+	if m != nil {
+		return m.Registered
+	}
+	return false
+}
+
+func (m *SearchResult) GetNoveltyThreshold() float64 {
+	if m != nil {
+		return m.NoveltyThreshold
+	}
+	return 0
+}
+
+func (m *SearchResult) GetBricks() []*BrickResult {
+	if m != nil {
+		return m.Bricks
+	}
+	return nil
+}
+
+type SearchResponse struct {
+	RequestId string `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	// results are in the order of the vectors.
+	Results          []*SearchResult `protobuf:"bytes,2,rep,name=results,proto3" json:"results,omitempty"`
+	Partial          bool            `protobuf:"varint,3,opt,name=partial,proto3" json:"partial,omitempty"`
+	UnansweredBricks []string        `protobuf:"bytes,4,rep,name=unanswered_bricks,json=unansweredBricks,proto3" json:"unanswered_bricks,omitempty"`
+	ElapsedTime      int64           `protobuf:"varint,5,opt,name=elapsed_time,json=elapsedTime,proto3" json:"elapsed_time,omitempty"`
+	// error is set on a stream response whose request has failed.
+	Error                string   `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SearchResponse) Reset()         { *m = SearchResponse{} }
+func (m *SearchResponse) String() string { return proto.CompactTextString(m) }
+func (*SearchResponse) ProtoMessage()    {}
+func (*SearchResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_073bc2a55365c3cc, []int{4}
+}
+
+func (m *SearchResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SearchResponse.Unmarshal(m, b)
+}
+func (m *SearchResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SearchResponse.Marshal(b, m, deterministic)
+}
+func (m *SearchResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SearchResponse.Merge(m, src)
+}
+func (m *SearchResponse) XXX_Size() int {
+	return xxx_messageInfo_SearchResponse.Size(m)
+}
+func (m *SearchResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SearchResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SearchResponse proto.InternalMessageInfo
+
+func (m *SearchResponse) GetRequestId() string {
+	if m != nil {
+		return m.RequestId
+	}
+	return ""
+}
+
+func (m *SearchResponse) GetResults() []*SearchResult {
+	if m != nil {
+		return m.Results
+	}
+	return nil
+}
+
+func (m *SearchResponse) GetPartial() bool {
+	if m != nil {
+		return m.Partial
+	}
+	return false
+}
+
+func (m *SearchResponse) GetUnansweredBricks() []string {
+	if m != nil {
+		return m.UnansweredBricks
+	}
+	return nil
+}
+
+func (m *SearchResponse) GetElapsedTime() int64 {
+	if m != nil {
+		return m.ElapsedTime
+	}
+	return 0
+}
+
+func (m *SearchResponse) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type DeleteRequest struct {
+	FeatureGroupId int32 `protobuf:"varint,1,opt,name=feature_group_id,json=featureGroupId,proto3" json:"feature_group_id,omitempty"`
+	// unique_id limits the deletion to a brick on a calc node.
+	UniqueId             string   `protobuf:"bytes,2,opt,name=unique_id,json=uniqueId,proto3" json:"unique_id,omitempty"`
+	DataIds              []string `protobuf:"bytes,3,rep,name=data_ids,json=dataIds,proto3" json:"data_ids,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteRequest) Reset()         { *m = DeleteRequest{} }
+func (m *DeleteRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteRequest) ProtoMessage()    {}
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_073bc2a55365c3cc, []int{5}
+}
+
+func (m *DeleteRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteRequest.Unmarshal(m, b)
+}
+func (m *DeleteRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteRequest.Marshal(b, m, deterministic)
+}
+func (m *DeleteRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteRequest.Merge(m, src)
+}
+func (m *DeleteRequest) XXX_Size() int {
+	return xxx_messageInfo_DeleteRequest.Size(m)
+}
+func (m *DeleteRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteRequest proto.InternalMessageInfo
+
+func (m *DeleteRequest) GetFeatureGroupId() int32 {
+	if m != nil {
+		return m.FeatureGroupId
+	}
+	return 0
+}
+
+func (m *DeleteRequest) GetUniqueId() string {
+	if m != nil {
+		return m.UniqueId
+	}
+	return ""
+}
+
+func (m *DeleteRequest) GetDataIds() []string {
+	if m != nil {
+		return m.DataIds
+	}
+	return nil
+}
+
+type DeleteResponse struct {
+	Deleted              []string `protobuf:"bytes,1,rep,name=deleted,proto3" json:"deleted,omitempty"`
+	NotFound             []string `protobuf:"bytes,2,rep,name=not_found,json=notFound,proto3" json:"not_found,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteResponse) Reset()         { *m = DeleteResponse{} }
+func (m *DeleteResponse) String() string { return proto.CompactTextString(m) }
+func (*DeleteResponse) ProtoMessage()    {}
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_073bc2a55365c3cc, []int{6}
+}
+
+func (m *DeleteResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteResponse.Unmarshal(m, b)
+}
+func (m *DeleteResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteResponse.Marshal(b, m, deterministic)
+}
+func (m *DeleteResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteResponse.Merge(m, src)
+}
+func (m *DeleteResponse) XXX_Size() int {
+	return xxx_messageInfo_DeleteResponse.Size(m)
+}
+func (m *DeleteResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteResponse proto.InternalMessageInfo
+
+func (m *DeleteResponse) GetDeleted() []string {
+	if m != nil {
+		return m.Deleted
+	}
+	return nil
+}
+
+func (m *DeleteResponse) GetNotFound() []string {
+	if m != nil {
+		return m.NotFound
+	}
+	return nil
+}
+
+type ListBricksRequest struct {
+	// Every brick is listed when feature_group_id is not given.
+	FeatureGroupId       *wrappers.Int32Value `protobuf:"bytes,1,opt,name=feature_group_id,json=featureGroupId,proto3" json:"feature_group_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *ListBricksRequest) Reset()         { *m = ListBricksRequest{} }
+func (m *ListBricksRequest) String() string { return proto.CompactTextString(m) }
+func (*ListBricksRequest) ProtoMessage()    {}
+func (*ListBricksRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_073bc2a55365c3cc, []int{7}
+}
+
+func (m *ListBricksRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListBricksRequest.Unmarshal(m, b)
+}
+func (m *ListBricksRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListBricksRequest.Marshal(b, m, deterministic)
+}
+func (m *ListBricksRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListBricksRequest.Merge(m, src)
+}
+func (m *ListBricksRequest) XXX_Size() int {
+	return xxx_messageInfo_ListBricksRequest.Size(m)
+}
+func (m *ListBricksRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListBricksRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListBricksRequest proto.InternalMessageInfo
+
+func (m *ListBricksRequest) GetFeatureGroupId() *wrappers.Int32Value {
+	if m != nil {
+		return m.FeatureGroupId
+	}
+	return nil
+}
+
+type Brick struct {
+	UniqueId             string   `protobuf:"bytes,1,opt,name=unique_id,json=uniqueId,proto3" json:"unique_id,omitempty"`
+	BrickId              string   `protobuf:"bytes,2,opt,name=brick_id,json=brickId,proto3" json:"brick_id,omitempty"`
+	FeatureGroupId       int32    `protobuf:"varint,3,opt,name=feature_group_id,json=featureGroupId,proto3" json:"feature_group_id,omitempty"`
+	NumOfBrickTotalCap   int64    `protobuf:"varint,4,opt,name=num_of_brick_total_cap,json=numOfBrickTotalCap,proto3" json:"num_of_brick_total_cap,omitempty"`
+	NumOfAvailablePoints int64    `protobuf:"varint,5,opt,name=num_of_available_points,json=numOfAvailablePoints,proto3" json:"num_of_available_points,omitempty"`
+	NodeName             string   `protobuf:"bytes,6,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`
+	NodeAddress          string   `protobuf:"bytes,7,opt,name=node_address,json=nodeAddress,proto3" json:"node_address,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Brick) Reset()         { *m = Brick{} }
+func (m *Brick) String() string { return proto.CompactTextString(m) }
+func (*Brick) ProtoMessage()    {}
+func (*Brick) Descriptor() ([]byte, []int) {
+	return fileDescriptor_073bc2a55365c3cc, []int{8}
+}
+
+func (m *Brick) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Brick.Unmarshal(m, b)
+}
+func (m *Brick) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Brick.Marshal(b, m, deterministic)
+}
+func (m *Brick) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Brick.Merge(m, src)
+}
+func (m *Brick) XXX_Size() int {
+	return xxx_messageInfo_Brick.Size(m)
+}
+func (m *Brick) XXX_DiscardUnknown() {
+	xxx_messageInfo_Brick.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Brick proto.InternalMessageInfo
+
+func (m *Brick) GetUniqueId() string {
+	if m != nil {
+		return m.UniqueId
+	}
+	return ""
+}
+
+func (m *Brick) GetBrickId() string {
+	if m != nil {
+		return m.BrickId
+	}
+	return ""
+}
+
+func (m *Brick) GetFeatureGroupId() int32 {
+	if m != nil {
+		return m.FeatureGroupId
+	}
+	return 0
+}
+
+func (m *Brick) GetNumOfBrickTotalCap() int64 {
+	if m != nil {
+		return m.NumOfBrickTotalCap
+	}
+	return 0
+}
+
+func (m *Brick) GetNumOfAvailablePoints() int64 {
+	if m != nil {
+		return m.NumOfAvailablePoints
+	}
+	return 0
+}
+
+func (m *Brick) GetNodeName() string {
+	if m != nil {
+		return m.NodeName
+	}
+	return ""
+}
+
+func (m *Brick) GetNodeAddress() string {
+	if m != nil {
+		return m.NodeAddress
+	}
+	return ""
+}
+
+type ListBricksResponse struct {
+	Bricks               []*Brick `protobuf:"bytes,1,rep,name=bricks,proto3" json:"bricks,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListBricksResponse) Reset()         { *m = ListBricksResponse{} }
+func (m *ListBricksResponse) String() string { return proto.CompactTextString(m) }
+func (*ListBricksResponse) ProtoMessage()    {}
+func (*ListBricksResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_073bc2a55365c3cc, []int{9}
+}
+
+func (m *ListBricksResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListBricksResponse.Unmarshal(m, b)
+}
+func (m *ListBricksResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListBricksResponse.Marshal(b, m, deterministic)
+}
+func (m *ListBricksResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListBricksResponse.Merge(m, src)
+}
+func (m *ListBricksResponse) XXX_Size() int {
+	return xxx_messageInfo_ListBricksResponse.Size(m)
+}
+func (m *ListBricksResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListBricksResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListBricksResponse proto.InternalMessageInfo
+
+func (m *ListBricksResponse) GetBricks() []*Brick {
+	if m != nil {
+		return m.Bricks
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Vector)(nil), "featuredb.Vector")
+	proto.RegisterType((*SearchRequest)(nil), "featuredb.SearchRequest")
+	proto.RegisterMapType((map[string]string)(nil), "featuredb.SearchRequest.NodeSelectorEntry")
+	proto.RegisterType((*BrickResult)(nil), "featuredb.BrickResult")
+	proto.RegisterType((*SearchResult)(nil), "featuredb.SearchResult")
+	proto.RegisterType((*SearchResponse)(nil), "featuredb.SearchResponse")
+	proto.RegisterType((*DeleteRequest)(nil), "featuredb.DeleteRequest")
+	proto.RegisterType((*DeleteResponse)(nil), "featuredb.DeleteResponse")
+	proto.RegisterType((*ListBricksRequest)(nil), "featuredb.ListBricksRequest")
+	proto.RegisterType((*Brick)(nil), "featuredb.Brick")
+	proto.RegisterType((*ListBricksResponse)(nil), "featuredb.ListBricksResponse")
+}
+
+func init() { proto.RegisterFile("featuredb.proto", fileDescriptor_073bc2a55365c3cc) }
+
+var fileDescriptor_073bc2a55365c3cc = []byte{
+	// 1059 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x56, 0x5d, 0x6e, 0xdb, 0x46,
+	0x10, 0x06, 0x45, 0xeb, 0x6f, 0x24, 0xbb, 0xf6, 0x22, 0x8d, 0x69, 0xc5, 0x49, 0x15, 0x3d, 0x09,
+	0x0d, 0x2c, 0xb5, 0x0a, 0x5a, 0x04, 0x2d, 0xd2, 0x20, 0xae, 0x13, 0x43, 0x40, 0x63, 0x17, 0xb4,
+	0x91, 0x87, 0xbc, 0x10, 0x2b, 0x72, 0x2c, 0xb3, 0x26, 0x77, 0x69, 0xee, 0xd2, 0x86, 0x7a, 0x80,
+	0x9e, 0xa0, 0x27, 0xe8, 0x05, 0x7a, 0xa7, 0x9e, 0xa1, 0x07, 0x08, 0xf6, 0x87, 0xb2, 0x6c, 0xc9,
+	0x08, 0x90, 0xbc, 0x71, 0x7e, 0x76, 0x77, 0xe6, 0xfb, 0xbe, 0x19, 0x09, 0xbe, 0x3a, 0x43, 0x2a,
+	0x8b, 0x1c, 0xa3, 0xc9, 0x20, 0xcb, 0xb9, 0xe4, 0xa4, 0x39, 0x77, 0x74, 0x9e, 0x4c, 0x39, 0x9f,
+	0x26, 0x38, 0xd4, 0x81, 0x49, 0x71, 0x36, 0xbc, 0xce, 0x69, 0x96, 0x61, 0x2e, 0x4c, 0x6a, 0x6f,
+	0x17, 0x6a, 0xef, 0x31, 0x94, 0x3c, 0x27, 0x04, 0xd6, 0xae, 0x68, 0x22, 0x3c, 0xa7, 0xeb, 0xf6,
+	0x1d, 0x5f, 0x7f, 0xf7, 0xfe, 0x5d, 0x83, 0xf5, 0x13, 0xa4, 0x79, 0x78, 0xee, 0xe3, 0x65, 0x81,
+	0x42, 0x92, 0xc7, 0x00, 0xb9, 0xf9, 0x0c, 0xe2, 0xc8, 0x73, 0xba, 0x4e, 0xbf, 0xe9, 0x37, 0xad,
+	0x67, 0x1c, 0x91, 0x3e, 0x6c, 0xda, 0xb7, 0x83, 0x69, 0xce, 0x8b, 0x4c, 0x25, 0x55, 0xba, 0x4e,
+	0xbf, 0xea, 0x6f, 0x58, 0xff, 0xa1, 0x72, 0x8f, 0x23, 0xf2, 0x08, 0x9a, 0x21, 0x4d, 0xc2, 0x20,
+	0xe5, 0x11, 0x7a, 0xae, 0xbe, 0xa7, 0xa1, 0x1c, 0xef, 0x78, 0x84, 0xea, 0x95, 0x82, 0xc5, 0x97,
+	0x05, 0x06, 0x71, 0x24, 0xbc, 0xb5, 0xae, 0xab, 0x5e, 0x31, 0x9e, 0x71, 0x24, 0xc8, 0x33, 0xa8,
+	0x5f, 0xe9, 0xa2, 0x85, 0x57, 0xed, 0xba, 0xfd, 0xd6, 0x68, 0x6b, 0x70, 0x03, 0x81, 0x69, 0xc7,
+	0x2f, 0x33, 0x88, 0x07, 0xf5, 0x8c, 0xce, 0x12, 0x4e, 0x23, 0xaf, 0xd6, 0x75, 0xfa, 0x6d, 0xbf,
+	0x34, 0xc9, 0x53, 0x68, 0x87, 0x9c, 0x49, 0x64, 0x32, 0x90, 0xb3, 0x0c, 0xbd, 0xba, 0xae, 0xa2,
+	0x65, 0x7d, 0xa7, 0xb3, 0x0c, 0xc9, 0x37, 0xd0, 0x12, 0xba, 0xff, 0x80, 0xb3, 0x64, 0xe6, 0x35,
+	0xba, 0x4e, 0xbf, 0xe1, 0x83, 0x71, 0x1d, 0xb3, 0x64, 0x46, 0xc6, 0xb0, 0xc5, 0xf8, 0x15, 0x26,
+	0x72, 0x16, 0xc8, 0xf3, 0x1c, 0xc5, 0x39, 0x4f, 0x22, 0xaf, 0xd9, 0x75, 0xfa, 0xad, 0xd1, 0xee,
+	0xc0, 0x60, 0x3f, 0x28, 0xb1, 0x1f, 0x1c, 0xf0, 0x62, 0x92, 0xe0, 0x7b, 0x9a, 0x14, 0xe8, 0x6f,
+	0xda, 0x63, 0xa7, 0xe5, 0x29, 0xd5, 0xb4, 0x8c, 0x53, 0xe4, 0x85, 0x0c, 0x52, 0xe1, 0x41, 0xd7,
+	0xe9, 0xbb, 0x7e, 0xd3, 0x7a, 0xde, 0x09, 0xc5, 0xcf, 0x9f, 0x9c, 0xa1, 0xd7, 0xd2, 0x55, 0xea,
+	0x6f, 0x72, 0x0c, 0xeb, 0x8c, 0x47, 0x18, 0x08, 0x4c, 0x74, 0xb7, 0x5e, 0x5b, 0xc3, 0xf1, 0xed,
+	0x02, 0x1c, 0xb7, 0xe8, 0x1b, 0x1c, 0xf1, 0x08, 0x4f, 0x6c, 0xf2, 0x1b, 0x26, 0xf3, 0x99, 0xdf,
+	0x66, 0x0b, 0xae, 0xce, 0x2b, 0xd8, 0x5a, 0x4a, 0x21, 0x9b, 0xe0, 0x5e, 0xe0, 0xcc, 0x92, 0xad,
+	0x3e, 0xc9, 0x03, 0xa8, 0x5e, 0xa9, 0x2e, 0x34, 0xb7, 0x4d, 0xdf, 0x18, 0x3f, 0x55, 0x5e, 0x38,
+	0xbd, 0xbf, 0x2a, 0xd0, 0xda, 0xcf, 0xe3, 0xf0, 0xc2, 0x47, 0x51, 0x24, 0x52, 0xd1, 0x3c, 0x67,
+	0xd2, 0xde, 0xd0, 0x28, 0x89, 0x24, 0x3b, 0xd0, 0x98, 0xa8, 0xdc, 0x52, 0x25, 0x4d, 0xbf, 0xae,
+	0x6d, 0x23, 0x0f, 0xdd, 0x19, 0xa3, 0xe9, 0x5c, 0x1e, 0xca, 0x71, 0x44, 0x53, 0x54, 0x94, 0x8a,
+	0x22, 0x0c, 0x51, 0x28, 0x6d, 0x28, 0x46, 0x4a, 0x93, 0x6c, 0x43, 0x3d, 0xa2, 0x92, 0xaa, 0x0b,
+	0xab, 0xfa, 0x50, 0x4d, 0x99, 0xe3, 0x88, 0x74, 0xa0, 0x11, 0xc5, 0x42, 0x52, 0x16, 0xa2, 0x96,
+	0x81, 0xe3, 0xcf, 0x6d, 0xa5, 0x03, 0x4c, 0x68, 0x26, 0x30, 0x0a, 0x14, 0xdc, 0x5a, 0x07, 0xae,
+	0xdf, 0xb2, 0xbe, 0xd3, 0x38, 0x45, 0x75, 0x9c, 0x4a, 0x89, 0x69, 0x26, 0x85, 0x16, 0x41, 0xd5,
+	0x9f, 0xdb, 0x0a, 0x0c, 0xcc, 0x73, 0x9e, 0x6b, 0xda, 0x9b, 0xbe, 0x31, 0x7a, 0xff, 0x3b, 0xd0,
+	0x2e, 0xb1, 0xff, 0x34, 0x12, 0x0b, 0x75, 0x57, 0xee, 0xad, 0xdb, 0xbd, 0x53, 0xf7, 0xd7, 0x50,
+	0x8b, 0x45, 0xc0, 0xf0, 0xda, 0xa2, 0x50, 0x8d, 0xc5, 0x11, 0x5e, 0x93, 0x27, 0x6a, 0x44, 0xa7,
+	0xb1, 0x90, 0x98, 0xa3, 0x81, 0xa1, 0xe1, 0x2f, 0x78, 0xc8, 0xb3, 0x55, 0x92, 0x35, 0x98, 0x2c,
+	0x8b, 0x72, 0x00, 0x35, 0x4d, 0x89, 0xf0, 0xea, 0x5a, 0x5a, 0x0f, 0x17, 0xa4, 0xb5, 0xc0, 0xb3,
+	0x6f, 0xb3, 0x7a, 0xff, 0x39, 0xb0, 0x31, 0x6f, 0x3b, 0xe3, 0x4c, 0xe0, 0xa7, 0x56, 0xc6, 0xf7,
+	0x50, 0xcf, 0xf5, 0x1d, 0xc2, 0xab, 0xe8, 0x27, 0xb6, 0x57, 0xa8, 0x57, 0xbf, 0x51, 0xe6, 0x99,
+	0x91, 0xce, 0x65, 0x4c, 0x13, 0x8d, 0x49, 0xc3, 0x2f, 0x4d, 0xd5, 0x5b, 0xc1, 0x28, 0x13, 0xd7,
+	0xaa, 0xd3, 0xc0, 0x56, 0x6e, 0xf6, 0xc7, 0xe6, 0x4d, 0x40, 0x17, 0x2e, 0x96, 0x78, 0xaf, 0x2e,
+	0xf3, 0x3e, 0xe7, 0xb6, 0xb6, 0xc8, 0xed, 0x25, 0xac, 0x1f, 0x60, 0x82, 0x12, 0xcb, 0xad, 0xb8,
+	0x6a, 0xed, 0x39, 0xf7, 0xad, 0xbd, 0x1b, 0x15, 0x54, 0x96, 0xe7, 0xc1, 0xaa, 0x40, 0x78, 0xae,
+	0x2e, 0xba, 0x6e, 0x64, 0x20, 0x7a, 0x87, 0xb0, 0x51, 0x3e, 0x69, 0x61, 0xf5, 0xa0, 0x1e, 0x69,
+	0x4f, 0xe4, 0x39, 0x36, 0xd7, 0x98, 0x66, 0x76, 0x64, 0x70, 0xc6, 0x0b, 0x16, 0x69, 0x4c, 0xf5,
+	0xec, 0xc8, 0xb7, 0xca, 0xee, 0x7d, 0x80, 0xad, 0xdf, 0x62, 0x21, 0x0d, 0x04, 0x65, 0xfd, 0x6f,
+	0xee, 0xa9, 0xbf, 0x35, 0x7a, 0xb4, 0xb4, 0xc4, 0xc6, 0x4c, 0x3e, 0x1f, 0x99, 0x1d, 0x76, 0xa7,
+	0xb9, 0xde, 0xdf, 0x15, 0xa8, 0xea, 0x8b, 0x3f, 0x7b, 0xec, 0x57, 0x01, 0xe9, 0xae, 0x04, 0x72,
+	0x04, 0x0f, 0x59, 0x91, 0x06, 0xfc, 0xcc, 0xb0, 0x1c, 0x48, 0x2e, 0x69, 0x12, 0x84, 0x34, 0xd3,
+	0xc3, 0xe0, 0xfa, 0x84, 0x15, 0xe9, 0xf1, 0x99, 0xae, 0xe6, 0x54, 0x85, 0x7e, 0xa5, 0x19, 0xf9,
+	0x01, 0xb6, 0xed, 0x19, 0x7a, 0x45, 0xe3, 0x84, 0x4e, 0x12, 0x0c, 0x32, 0x1e, 0x33, 0x29, 0x2c,
+	0xf7, 0x0f, 0xf4, 0xa1, 0xd7, 0x65, 0xf0, 0x77, 0x1d, 0xbb, 0xbd, 0x8b, 0x6a, 0x77, 0x76, 0xd1,
+	0x53, 0xd0, 0x1b, 0x34, 0xa0, 0x51, 0x94, 0xab, 0x85, 0x64, 0x7f, 0x44, 0x94, 0xef, 0xb5, 0x71,
+	0xf5, 0x7e, 0x01, 0xb2, 0x08, 0xb9, 0xe5, 0xaf, 0x3f, 0x9f, 0x2c, 0x47, 0xcb, 0x7e, 0x73, 0x69,
+	0xb2, 0x6c, 0x7c, 0xf4, 0x8f, 0x0b, 0xcd, 0xb7, 0x26, 0x76, 0xb0, 0x4f, 0x5e, 0x42, 0xcd, 0x4c,
+	0x05, 0xf1, 0xee, 0x5b, 0xf3, 0x9d, 0x9d, 0x15, 0x11, 0xfb, 0xec, 0x3e, 0xb4, 0xf6, 0xa9, 0x0c,
+	0xcf, 0xbf, 0xe4, 0x8e, 0x43, 0x68, 0x9f, 0xc8, 0x1c, 0x69, 0xfa, 0x05, 0x97, 0xf4, 0x9d, 0xef,
+	0x1c, 0xf2, 0x0a, 0x1a, 0xbe, 0x5d, 0x4c, 0x9f, 0x57, 0xc9, 0x4b, 0xa8, 0x99, 0xb1, 0xb8, 0x75,
+	0xfc, 0xd6, 0x70, 0x76, 0x76, 0x56, 0x44, 0xec, 0xf1, 0x31, 0xc0, 0x0d, 0x33, 0x64, 0x77, 0x21,
+	0x71, 0x69, 0x46, 0x3a, 0x8f, 0xef, 0x89, 0x9a, 0xab, 0xf6, 0x5f, 0x7c, 0xf8, 0x71, 0x1a, 0xcb,
+	0xf3, 0x62, 0x32, 0x08, 0x79, 0x3a, 0xa4, 0x13, 0xfc, 0x83, 0xee, 0xc5, 0x2c, 0x1c, 0xda, 0x43,
+	0x7b, 0xe6, 0x3f, 0xc3, 0x5e, 0x34, 0x19, 0x66, 0x17, 0xd3, 0x21, 0xcd, 0xe2, 0x61, 0x9e, 0x85,
+	0x3f, 0xe7, 0x59, 0x38, 0xa9, 0xe9, 0xd1, 0x7a, 0xfe, 0x71, 0x00, 0xc1, 0x77, 0x14, 0x44, 0xc7,
+	0x09, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// FeatureDBClient is the client API for FeatureDB service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type FeatureDBClient interface {
+	// Search finds the nearest data point of one vector.
+	// The reverse proxy registers the vector when it is new.
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	// BatchSearch finds the nearest data points of many vectors at once.
+	BatchSearch(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	// StreamSearch takes one vector per request and answers in completion order.
+	// Responses carry the request_id of their request.
+	StreamSearch(ctx context.Context, opts ...grpc.CallOption) (FeatureDB_StreamSearchClient, error)
+	// Register adds the vectors as new data points without searching.
+	Register(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	// Delete removes data points by their data IDs.
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// ListBricks lists the bricks.
+	ListBricks(ctx context.Context, in *ListBricksRequest, opts ...grpc.CallOption) (*ListBricksResponse, error)
+}
+
+type featureDBClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewFeatureDBClient(cc *grpc.ClientConn) FeatureDBClient {
+	return &featureDBClient{cc}
+}
+
+func (c *featureDBClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, "/featuredb.FeatureDB/Search", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *featureDBClient) BatchSearch(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, "/featuredb.FeatureDB/BatchSearch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *featureDBClient) StreamSearch(ctx context.Context, opts ...grpc.CallOption) (FeatureDB_StreamSearchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_FeatureDB_serviceDesc.Streams[0], "/featuredb.FeatureDB/StreamSearch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &featureDBStreamSearchClient{stream}
+	return x, nil
+}
+
+type FeatureDB_StreamSearchClient interface {
+	Send(*SearchRequest) error
+	Recv() (*SearchResponse, error)
+	grpc.ClientStream
+}
+
+type featureDBStreamSearchClient struct {
+	grpc.ClientStream
+}
+
+func (x *featureDBStreamSearchClient) Send(m *SearchRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *featureDBStreamSearchClient) Recv() (*SearchResponse, error) {
+	m := new(SearchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *featureDBClient) Register(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, "/featuredb.FeatureDB/Register", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *featureDBClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/featuredb.FeatureDB/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *featureDBClient) ListBricks(ctx context.Context, in *ListBricksRequest, opts ...grpc.CallOption) (*ListBricksResponse, error) {
+	out := new(ListBricksResponse)
+	err := c.cc.Invoke(ctx, "/featuredb.FeatureDB/ListBricks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FeatureDBServer is the server API for FeatureDB service.
+type FeatureDBServer interface {
+	// Search finds the nearest data point of one vector.
+	// The reverse proxy registers the vector when it is new.
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+	// BatchSearch finds the nearest data points of many vectors at once.
+	BatchSearch(context.Context, *SearchRequest) (*SearchResponse, error)
+	// StreamSearch takes one vector per request and answers in completion order.
+	// Responses carry the request_id of their request.
+	StreamSearch(FeatureDB_StreamSearchServer) error
+	// Register adds the vectors as new data points without searching.
+	Register(context.Context, *SearchRequest) (*SearchResponse, error)
+	// Delete removes data points by their data IDs.
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// ListBricks lists the bricks.
+	ListBricks(context.Context, *ListBricksRequest) (*ListBricksResponse, error)
+}
+
+// UnimplementedFeatureDBServer can be embedded to have forward compatible implementations.
+type UnimplementedFeatureDBServer struct {
+}
+
+func (*UnimplementedFeatureDBServer) Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (*UnimplementedFeatureDBServer) BatchSearch(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchSearch not implemented")
+}
+func (*UnimplementedFeatureDBServer) StreamSearch(srv FeatureDB_StreamSearchServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamSearch not implemented")
+}
+func (*UnimplementedFeatureDBServer) Register(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (*UnimplementedFeatureDBServer) Delete(ctx context.Context, req *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (*UnimplementedFeatureDBServer) ListBricks(ctx context.Context, req *ListBricksRequest) (*ListBricksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBricks not implemented")
+}
+
+func RegisterFeatureDBServer(s *grpc.Server, srv FeatureDBServer) {
+	s.RegisterService(&_FeatureDB_serviceDesc, srv)
+}
+
+func _FeatureDB_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FeatureDBServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/featuredb.FeatureDB/Search",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FeatureDBServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FeatureDB_BatchSearch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FeatureDBServer).BatchSearch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/featuredb.FeatureDB/BatchSearch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FeatureDBServer).BatchSearch(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FeatureDB_StreamSearch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FeatureDBServer).StreamSearch(&featureDBStreamSearchServer{stream})
+}
+
+type FeatureDB_StreamSearchServer interface {
+	Send(*SearchResponse) error
+	Recv() (*SearchRequest, error)
+	grpc.ServerStream
+}
+
+type featureDBStreamSearchServer struct {
+	grpc.ServerStream
+}
+
+func (x *featureDBStreamSearchServer) Send(m *SearchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *featureDBStreamSearchServer) Recv() (*SearchRequest, error) {
+	m := new(SearchRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _FeatureDB_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FeatureDBServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/featuredb.FeatureDB/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FeatureDBServer).Register(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FeatureDB_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FeatureDBServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/featuredb.FeatureDB/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FeatureDBServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FeatureDB_ListBricks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBricksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FeatureDBServer).ListBricks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/featuredb.FeatureDB/ListBricks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FeatureDBServer).ListBricks(ctx, req.(*ListBricksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _FeatureDB_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "featuredb.FeatureDB",
+	HandlerType: (*FeatureDBServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Search",
+			Handler:    _FeatureDB_Search_Handler,
+		},
+		{
+			MethodName: "BatchSearch",
+			Handler:    _FeatureDB_BatchSearch_Handler,
+		},
+		{
+			MethodName: "Register",
+			Handler:    _FeatureDB_Register_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _FeatureDB_Delete_Handler,
+		},
+		{
+			MethodName: "ListBricks",
+			Handler:    _FeatureDB_ListBricks_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamSearch",
+			Handler:       _FeatureDB_StreamSearch_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "featuredb.proto",
+}
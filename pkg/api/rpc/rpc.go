@@ -0,0 +1,148 @@
+// Package rpc is the gRPC API of calc nodes and reverse proxies.
+package rpc
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. featuredb.proto
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// MaxStreamInFlight is the number of stream requests processed at once.
+// A stream is not read any further while this many requests are in flight.
+const MaxStreamInFlight = 16
+
+// NamespaceKey is the metadata key of the namespace of a request. Requests without it are of the default namespace.
+const NamespaceKey = "namespace"
+
+// WithNamespace sends the namespace with the requests made with the returned context.
+func WithNamespace(ctx context.Context, namespace string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, NamespaceKey, namespace)
+}
+
+// NamespaceOf returns the namespace which the client has sent with the request of ctx.
+func NamespaceOf(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(NamespaceKey); len(v) > 0 && v[0] != "" {
+			return v[0]
+		}
+	}
+	return catalog.DefaultNamespace
+}
+
+// FromBrickSearchResult converts a search result of a brick on a calc node.
+func FromBrickSearchResult(br api.BrickSearchResult) *BrickResult {
+	return &BrickResult{
+		UniqueId:    br.UniqueID,
+		Success:     br.Success,
+		DataId:      br.DataID,
+		Distance:    br.Distance,
+		ElapsedTime: br.ElapsedTime,
+		Error:       br.Error,
+	}
+}
+
+// FromBatchSearchQueryResponse converts a response of a calc node.
+func FromBatchSearchQueryResponse(resp api.BatchSearchQueryResponse) *SearchResponse {
+	result := &SearchResponse{
+		Results:     make([]*SearchResult, 0, len(resp.Results)),
+		ElapsedTime: resp.ElapsedTime,
+	}
+	for _, r := range resp.Results {
+		sr := &SearchResult{
+			UniqueId:   r.UniqueID,
+			DataId:     r.DataID,
+			Distance:   r.Distance,
+			Registered: r.Registered,
+			Bricks:     make([]*BrickResult, 0, len(r.Bricks)),
+		}
+		for _, br := range r.Bricks {
+			sr.Bricks = append(sr.Bricks, FromBrickSearchResult(br))
+		}
+		result.Results = append(result.Results, sr)
+	}
+	return result
+}
+
+// ToSearchQueryResponses converts a response of a calc node back, one per query.
+func ToSearchQueryResponses(resp *SearchResponse) []api.SearchQueryResponse {
+	results := make([]api.SearchQueryResponse, 0, len(resp.GetResults()))
+	for _, r := range resp.GetResults() {
+		sqr := api.SearchQueryResponse{
+			UniqueID:    r.UniqueId,
+			DataID:      r.DataId,
+			Distance:    r.Distance,
+			ElapsedTime: resp.ElapsedTime,
+			Registered:  r.Registered,
+			Bricks:      make([]api.BrickSearchResult, 0, len(r.Bricks)),
+		}
+		for _, br := range r.Bricks {
+			sqr.Bricks = append(sqr.Bricks, api.BrickSearchResult{
+				UniqueID:    br.UniqueId,
+				Success:     br.Success,
+				DataID:      br.DataId,
+				Distance:    br.Distance,
+				ElapsedTime: br.ElapsedTime,
+				Error:       br.Error,
+			})
+		}
+		results = append(results, sqr)
+	}
+	return results
+}
+
+// ServeStream answers each request of a StreamSearch stream with search.
+func ServeStream(stream FeatureDB_StreamSearchServer, search func(ctx context.Context, req *SearchRequest) (*SearchResponse, error)) error {
+	return ServeRequests(stream.Context(), stream.Recv, stream.Send, search)
+}
+
+// ServeRequests answers each request from recv with search until recv returns io.EOF.
+// Up to MaxStreamInFlight requests run at once and responses are sent in completion order.
+// A failed request is answered with its error instead of ending the stream.
+func ServeRequests(ctx context.Context, recv func() (*SearchRequest, error), send func(*SearchResponse) error, search func(ctx context.Context, req *SearchRequest) (*SearchResponse, error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var sendMtx sync.Mutex
+	var wg sync.WaitGroup
+	var sendErr error
+	sem := make(chan struct{}, MaxStreamInFlight)
+	defer wg.Wait()
+	for {
+		req, err := recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func(req *SearchRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			resp, err := search(ctx, req)
+			if err != nil {
+				resp = &SearchResponse{Error: err.Error()}
+			}
+			resp.RequestId = req.RequestId
+			sendMtx.Lock()
+			defer sendMtx.Unlock()
+			if sendErr != nil {
+				return
+			}
+			if sendErr = send(resp); sendErr != nil {
+				cancel()
+			}
+		}(req)
+	}
+}
@@ -0,0 +1,104 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServeRequests(t *testing.T) {
+	t.Run("it answers in completion order successfully", testServeRequests_order)
+	t.Run("it limits requests in flight successfully", testServeRequests_inFlight)
+}
+
+func testServeRequests_order(t *testing.T) {
+	// prepare
+	reqs := []*SearchRequest{{RequestId: "slow"}, {RequestId: "fast"}, {RequestId: "fail"}}
+	recv := func() (*SearchRequest, error) {
+		if len(reqs) == 0 {
+			return nil, io.EOF
+		}
+		req := reqs[0]
+		reqs = reqs[1:]
+		return req, nil
+	}
+	var mtx sync.Mutex
+	resps := []*SearchResponse{}
+	send := func(resp *SearchResponse) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		resps = append(resps, resp)
+		return nil
+	}
+	search := func(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+		switch req.RequestId {
+		case "slow":
+			time.Sleep(50 * time.Millisecond)
+		case "fail":
+			time.Sleep(20 * time.Millisecond)
+			return nil, errors.New("failed")
+		}
+		return &SearchResponse{}, nil
+	}
+
+	// exec
+	err := ServeRequests(context.Background(), recv, send, search)
+
+	// assert
+	if err != nil || len(resps) != 3 {
+		t.Fatalf("fail. every request must be answered. %v %d", err, len(resps))
+	}
+	if resps[0].RequestId != "fast" || resps[1].RequestId != "fail" || resps[2].RequestId != "slow" {
+		t.Fatalf("fail. responses are not in completion order. %v", resps)
+	}
+	if resps[1].Error != "failed" {
+		t.Fatalf("fail. error not reported. %v", resps[1])
+	}
+}
+
+func testServeRequests_inFlight(t *testing.T) {
+	// prepare
+	n := MaxStreamInFlight * 3
+	i := 0
+	recv := func() (*SearchRequest, error) {
+		if i == n {
+			return nil, io.EOF
+		}
+		i++
+		return &SearchRequest{RequestId: fmt.Sprint(i)}, nil
+	}
+	var mtx sync.Mutex
+	inFlight, maxInFlight, answered := 0, 0, 0
+	search := func(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+		mtx.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mtx.Unlock()
+		time.Sleep(time.Millisecond)
+		mtx.Lock()
+		inFlight--
+		mtx.Unlock()
+		return &SearchResponse{}, nil
+	}
+	send := func(resp *SearchResponse) error {
+		answered++
+		return nil
+	}
+
+	// exec
+	ServeRequests(context.Background(), recv, send, search)
+
+	// assert
+	if answered != n {
+		t.Fatalf("fail. number of responses not match. %d", answered)
+	}
+	if maxInFlight > MaxStreamInFlight {
+		t.Fatalf("fail. too many requests in flight. %d", maxInFlight)
+	}
+}
@@ -1,5 +1,7 @@
 package api
 
+import "time"
+
 type CalcModeType string
 
 var (
@@ -7,3 +9,111 @@ var (
 	CalcModeGoRoutine CalcModeType = "goroutine"
 )
 
+// BrickSearchResult is the nearest data point found in one brick.
+// DataID is empty when the brick has no data point yet.
+type BrickSearchResult struct {
+	UniqueID    string  `json:"uniqueID"`
+	Success     bool    `json:"success"`
+	DataID      string  `json:"dataID"`
+	Distance    float64 `json:"distance"`
+	ElapsedTime int64   `json:"elapsedTime"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// SearchQueryResponse is the response of /api/v1/searchQuery on calc nodes.
+// DataID and Distance are the best of Bricks, or the registered data point when Registered.
+type SearchQueryResponse struct {
+	UniqueID    string              `json:"uniqueID"`
+	DataID      string              `json:"dataID"`
+	Distance    float64             `json:"distance"`
+	ElapsedTime int64               `json:"elapsedTime"`
+	Registered  bool                `json:"registered"`
+	CalcMode    string              `json:"calcMode,omitempty"`
+	Bricks      []BrickSearchResult `json:"bricks,omitempty"`
+	Explain     *SearchExplain      `json:"explain,omitempty"`
+}
+
+// BatchSearchQueryResponse is the response of /api/v1/batchSearchQuery on calc nodes.
+// Results are in the order of the queries.
+type BatchSearchQueryResponse struct {
+	Results     []SearchQueryResponse `json:"results"`
+	ElapsedTime int64                 `json:"elapsedTime"`
+}
+
+// DataPointResponse is a data point of a brick on calc nodes.
+type DataPointResponse struct {
+	DataID     string    `json:"dataID"`
+	Available  bool      `json:"available"`
+	PosVector  []float64 `json:"posVector"`
+	Hash       string    `json:"hash"`
+	CreatedAt  time.Time `json:"createdAt"`
+	SearchTime int64     `json:"searchTime"`
+	// ExternalID and Meta are set only for data points of bulk imports.
+	ExternalID string            `json:"externalID,omitempty"`
+	Meta       map[string]string `json:"meta,omitempty"`
+}
+
+// DataPointListItem is a data point in a page of the data points of a brick.
+// PosVector is set only when vectors are asked for.
+type DataPointListItem struct {
+	DataID     string            `json:"dataID"`
+	Hash       string            `json:"hash"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	ExternalID string            `json:"externalID,omitempty"`
+	Meta       map[string]string `json:"meta,omitempty"`
+	PosVector  []float64         `json:"posVector,omitempty"`
+}
+
+// DataPointHashesResponse maps the data IDs of a brick to the hashes of their vectors.
+// It is the response of the data point list without any paging parameter.
+type DataPointHashesResponse struct {
+	DataPoints map[string]string `json:"dataPoints"`
+}
+
+// DataPointListResponse is a page of the data points of a brick.
+// NextCursor is empty on the last page.
+type DataPointListResponse struct {
+	DataPoints []DataPointListItem `json:"dataPoints"`
+	NextCursor string              `json:"nextCursor,omitempty"`
+}
+
+type JobState string
+
+var (
+	JobStateRunning  JobState = "running"
+	JobStateDone     JobState = "done"
+	JobStateFailed   JobState = "failed"
+	JobStateCanceled JobState = "canceled"
+)
+
+// ImportJobResponse is a bulk import on calc nodes.
+// Offset is the number of records of the source which are done, so an import
+// is resumed by skipping that many records.
+type ImportJobResponse struct {
+	JobID          string    `json:"jobID"`
+	Namespace      string    `json:"namespace"`
+	FeatureGroupID int       `json:"groupID"`
+	Source         string    `json:"source"`
+	Format         string    `json:"format"`
+	Checkpoint     string    `json:"checkpoint,omitempty"`
+	State          JobState  `json:"state"`
+	Offset         int       `json:"offset"`
+	Inserted       int       `json:"inserted"`
+	Bricks         []string  `json:"bricks"`
+	StartedAt      time.Time `json:"startedAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+	Msg            string    `json:"msg,omitempty"`
+}
+
+// ExportedDataPoint is a line of /api/v1/export.
+// Only the last line of an export which failed midway has Error.
+type ExportedDataPoint struct {
+	DataID         string            `json:"dataID,omitempty"`
+	UniqueID       string            `json:"uniqueID,omitempty"`
+	FeatureGroupID int               `json:"groupID"`
+	ExternalID     string            `json:"externalID,omitempty"`
+	Vals           []float64         `json:"vals,omitempty"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	Meta           map[string]string `json:"meta,omitempty"`
+	Error          string            `json:"error,omitempty"`
+}
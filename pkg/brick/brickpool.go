@@ -7,8 +7,15 @@ import (
 	"github.com/rs/xid"
 )
 
+// ErrReadOnly is returned by BeginWrite while the pool is read-only.
+var ErrReadOnly = errors.New("This node is read-only.")
+
 type BrickPool struct {
-	mutex                        *sync.Mutex
+	mutex *sync.Mutex
+	// writes is held for reading by every write in flight, and for writing by SetReadOnly.
+	writes                       *sync.RWMutex
+	readOnly                     bool
+	loaded                       bool
 	UniqueIDRelationMapper       map[BrickID]*FeatureBrick
 	BrickIDRelationMapper        map[BrickID][]*FeatureBrick
 	FeatureGroupIDRelationMapper map[BrickFeatureGroupID][]*FeatureBrick
@@ -17,6 +24,7 @@ type BrickPool struct {
 func (bp *BrickPool) InitBrickPool() error {
 	var mutex sync.Mutex
 	bp.mutex = &mutex
+	bp.writes = &sync.RWMutex{}
 	bp.UniqueIDRelationMapper = map[BrickID]*FeatureBrick{}
 	bp.BrickIDRelationMapper = map[BrickID][]*FeatureBrick{}
 	bp.FeatureGroupIDRelationMapper = map[BrickFeatureGroupID][]*FeatureBrick{}
@@ -27,7 +35,7 @@ func (bp *BrickPool) RegisterIntoPool(fb *FeatureBrick) error {
 	bp.mutex.Lock()
 	defer bp.mutex.Unlock()
 
-	if _, ok := bp.UniqueIDRelationMapper[fb.BrickID]; ok {
+	if _, ok := bp.UniqueIDRelationMapper[fb.UniqueID]; ok {
 		return errors.New("Already registered.")
 	}
 	bp.UniqueIDRelationMapper[fb.UniqueID] = fb
@@ -49,8 +57,90 @@ func (bp *BrickPool) RegisterIntoPool(fb *FeatureBrick) error {
 	return nil
 }
 
+// UnregisterFromPool removes the brick from every mapper of the pool.
+func (bp *BrickPool) UnregisterFromPool(fb *FeatureBrick) error {
+	bp.mutex.Lock()
+	defer bp.mutex.Unlock()
+
+	if _, ok := bp.UniqueIDRelationMapper[fb.UniqueID]; !ok {
+		return errors.New("Not registered.")
+	}
+	delete(bp.UniqueIDRelationMapper, fb.UniqueID)
+	bp.BrickIDRelationMapper[fb.BrickID] = removeBrick(bp.BrickIDRelationMapper[fb.BrickID], fb)
+	if len(bp.BrickIDRelationMapper[fb.BrickID]) == 0 {
+		delete(bp.BrickIDRelationMapper, fb.BrickID)
+	}
+	bp.FeatureGroupIDRelationMapper[fb.FeatureGroupID] = removeBrick(bp.FeatureGroupIDRelationMapper[fb.FeatureGroupID], fb)
+	if len(bp.FeatureGroupIDRelationMapper[fb.FeatureGroupID]) == 0 {
+		delete(bp.FeatureGroupIDRelationMapper, fb.FeatureGroupID)
+	}
+	return nil
+}
+
+func removeBrick(fbs []*FeatureBrick, target *FeatureBrick) []*FeatureBrick {
+	result := make([]*FeatureBrick, 0, len(fbs))
+	for _, fb := range fbs {
+		if fb != target {
+			result = append(result, fb)
+		}
+	}
+	return result
+}
+
+// SetReadOnly stops (or resumes) accepting new data points.
+// It is used while the node is draining or shutting down, and returns once the writes in flight are done,
+// so that the bricks are not written after it.
+func (bp *BrickPool) SetReadOnly(readOnly bool) {
+	bp.writes.Lock()
+	defer bp.writes.Unlock()
+	bp.mutex.Lock()
+	defer bp.mutex.Unlock()
+	bp.readOnly = readOnly
+}
+
+// BeginWrite returns ErrReadOnly on a read-only pool. Otherwise the pool stays writable until EndWrite,
+// which must be called once the write is done.
+func (bp *BrickPool) BeginWrite() error {
+	bp.writes.RLock()
+	if bp.IsReadOnly() {
+		bp.writes.RUnlock()
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// EndWrite ends a write which BeginWrite began.
+func (bp *BrickPool) EndWrite() {
+	bp.writes.RUnlock()
+}
+
+func (bp *BrickPool) IsReadOnly() bool {
+	bp.mutex.Lock()
+	defer bp.mutex.Unlock()
+	return bp.readOnly
+}
+
+// SetLoaded marks that the bricks of the node have been filled and registered.
+func (bp *BrickPool) SetLoaded() {
+	bp.mutex.Lock()
+	defer bp.mutex.Unlock()
+	bp.loaded = true
+}
+
+func (bp *BrickPool) IsLoaded() bool {
+	bp.mutex.Lock()
+	defer bp.mutex.Unlock()
+	return bp.loaded
+}
+
 func (bp *BrickPool) GetAllBricks() (map[BrickID]*FeatureBrick, error) {
-	return bp.UniqueIDRelationMapper, nil
+	bp.mutex.Lock()
+	defer bp.mutex.Unlock()
+	bricks := make(map[BrickID]*FeatureBrick, len(bp.UniqueIDRelationMapper))
+	for k, v := range bp.UniqueIDRelationMapper {
+		bricks[k] = v
+	}
+	return bricks, nil
 }
 
 func (bp *BrickPool) GetAllBrickUniqueIDs() ([]string, error) {
@@ -105,3 +195,22 @@ func (bp *BrickPool) GetBrickByGroupID(featureGroupID BrickFeatureGroupID) ([]*F
 	}
 	return nil, errors.New("Could not find target brick")
 }
+
+// GetBricksOfGroup returns the bricks of the feature group of the namespace.
+// Groups of different namespaces may share an ID.
+func (bp *BrickPool) GetBricksOfGroup(namespace string, featureGroupID BrickFeatureGroupID) ([]*FeatureBrick, error) {
+	all, err := bp.GetBrickByGroupID(featureGroupID)
+	if err != nil {
+		return nil, err
+	}
+	fbs := make([]*FeatureBrick, 0, len(all))
+	for _, fb := range all {
+		if fb.GetNamespace() == namespace {
+			fbs = append(fbs, fb)
+		}
+	}
+	if len(fbs) == 0 {
+		return nil, errors.New("Could not find target brick")
+	}
+	return fbs, nil
+}
@@ -0,0 +1,47 @@
+package brick
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBrickPool(t *testing.T) {
+	t.Run("it waits for the writes in flight before becoming read-only", testBrickPool_setReadOnly)
+}
+
+func testBrickPool_setReadOnly(t *testing.T) {
+	// prepare
+	bp := &BrickPool{}
+	bp.InitBrickPool()
+	if err := bp.BeginWrite(); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+
+	// exec
+	done := make(chan struct{})
+	go func() {
+		bp.SetReadOnly(true)
+		close(done)
+	}()
+
+	// assert
+	select {
+	case <-done:
+		t.Fatal("fail. read-only while a write is in flight.")
+	case <-time.After(50 * time.Millisecond):
+	}
+	bp.EndWrite()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("fail. still not read-only after the write.")
+	}
+	if err := bp.BeginWrite(); err != ErrReadOnly {
+		t.Fatalf("fail. write began on a read-only pool. %v", err)
+	}
+	bp.SetReadOnly(false)
+	if err := bp.BeginWrite(); err != nil {
+		t.Fatalf("fail. write not begun after resuming. %v", err)
+	}
+	bp.EndWrite()
+}
@@ -4,29 +4,40 @@ import (
 	"bytes"
 	"encoding/gob"
 	"errors"
-	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/abeja-inc/feature-search-db/pkg/calculation"
 	"github.com/abeja-inc/feature-search-db/pkg/data"
 
 	"github.com/rs/xid"
+	"go.uber.org/zap"
 )
 
 type BrickID xid.ID
 type BrickFeatureGroupID int
 
+// DefaultNamespace is the namespace of bricks which were created without one.
+const DefaultNamespace = "default"
+
+// PointSize is the number of bytes a data point takes in a brick, which allocates all of them up front.
+const PointSize = 8 * 512
+
 type FeatureBrick struct {
-	UniqueID             BrickID
-	BrickID              BrickID
-	FeatureGroupID       BrickFeatureGroupID
+	UniqueID       BrickID
+	BrickID        BrickID
+	FeatureGroupID BrickFeatureGroupID
+	// Namespace is the namespace of the feature group, DefaultNamespace when empty.
+	Namespace            string
 	NumOfBrickTotalCap   int
 	NumOfAvailablePoints int
 	DataPoints           []data.DataPoint
 	DataPointMapper      map[data.DataID]*data.DataPoint
-	mutex                *sync.Mutex
-	searchStrategy       SearchStrategy
+	// mutex is held for reading while the brick is searched or read, and for writing while data points are written.
+	mutex *sync.RWMutex
+	// searchStrategy holds the SearchStrategy, which can be replaced while the brick is searched.
+	searchStrategy *atomic.Value
 }
 
 func NewBrick(
@@ -39,7 +50,9 @@ func NewBrick(
 		dataPoints[i].Available = false
 		dataPoints[i].PosVector = data.NewPosVector(false, 512)
 	}
-	var mutex sync.Mutex
+	var mutex sync.RWMutex
+	var searchStrategy atomic.Value
+	searchStrategy.Store(strategyHolder{strategy})
 	return FeatureBrick{
 		UniqueID:             BrickID(xid.New()),
 		BrickID:              BrickID(xid.New()),
@@ -49,7 +62,7 @@ func NewBrick(
 		DataPoints:           dataPoints,
 		DataPointMapper:      map[data.DataID]*data.DataPoint{},
 		mutex:                &mutex,
-		searchStrategy:       strategy,
+		searchStrategy:       &searchStrategy,
 	}
 }
 
@@ -73,6 +86,18 @@ func (fp *FeatureBrick) GetFeatureGroupIDint() int {
 	return int(fp.FeatureGroupID)
 }
 
+func (fp *FeatureBrick) GetNamespace() string {
+	if fp.Namespace == "" {
+		return DefaultNamespace
+	}
+	return fp.Namespace
+}
+
+// MemoryBytes is the memory which the data points of the brick take.
+func (fp *FeatureBrick) MemoryBytes() int64 {
+	return int64(fp.NumOfBrickTotalCap) * PointSize
+}
+
 func (fp *FeatureBrick) Encode() []byte {
 	buf := bytes.NewBuffer(nil)
 	_ = gob.NewEncoder(buf).Encode(fp)
@@ -80,12 +105,41 @@ func (fp *FeatureBrick) Encode() []byte {
 
 }
 
-func (fp *FeatureBrick) ShowDebug() {
-	log.Printf("fp.BrickID=%v\n", fp.BrickID)
-	log.Printf("fp.NumOfAvailablePoints=%d\n", fp.NumOfAvailablePoints)
-	log.Printf("fp.NumOfBrickTotalCap=%d\n", fp.NumOfBrickTotalCap)
-	log.Printf("len(fp.DataPoints)=%d\n", len(fp.DataPoints))
-	log.Printf("cap(fp.DataPoints)=%d\n", cap(fp.DataPoints))
+// DecodeBrick restores a brick which was serialized by Encode.
+// Unexported fields are not transferred, so the lock and the search strategy
+// are set up again and DataPointMapper is rebuilt to point into DataPoints.
+func DecodeBrick(b []byte, strategy SearchStrategy) (*FeatureBrick, error) {
+	var fp FeatureBrick
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&fp); err != nil {
+		return nil, err
+	}
+	if fp.NumOfBrickTotalCap != len(fp.DataPoints) {
+		return nil, errors.New("Broken brick.")
+	}
+	var mutex sync.RWMutex
+	fp.mutex = &mutex
+	fp.searchStrategy = &atomic.Value{}
+	fp.searchStrategy.Store(strategyHolder{strategy})
+	fp.DataPointMapper = map[data.DataID]*data.DataPoint{}
+	for i := range fp.DataPoints {
+		if fp.DataPoints[i].PosVector.Vals == nil {
+			fp.DataPoints[i].PosVector = data.NewPosVector(false, 512)
+		}
+		if fp.DataPoints[i].Available {
+			fp.DataPointMapper[fp.DataPoints[i].DataID] = &fp.DataPoints[i]
+		}
+	}
+	return &fp, nil
+}
+
+func (fp *FeatureBrick) ShowDebug(logger *zap.Logger) {
+	logger.Debug("brick",
+		zap.String("brickID", fp.GetBrickIDstr()),
+		zap.Int("numOfAvailablePoints", fp.NumOfAvailablePoints),
+		zap.Int("numOfBrickTotalCap", fp.NumOfBrickTotalCap),
+		zap.Int("len(dataPoints)", len(fp.DataPoints)),
+		zap.Int("cap(dataPoints)", cap(fp.DataPoints)),
+	)
 }
 
 func (fp *FeatureBrick) AddNewDataPoint(pv *data.PosVector) (*data.DataPoint, error) {
@@ -105,11 +159,124 @@ func (fp *FeatureBrick) AddNewDataPoint(pv *data.PosVector) (*data.DataPoint, er
 	return newDataPoint, nil
 }
 
+// AddNewDataPoints registers all of pvs under a single lock acquisition.
+// Nothing is registered when the brick does not have room for all of them.
+func (fp *FeatureBrick) AddNewDataPoints(pvs []*data.PosVector) ([]*data.DataPoint, error) {
+	return fp.ImportDataPoints(pvs, nil, nil)
+}
+
+// ImportDataPoints is AddNewDataPoints with the external ID and metadata of each data point.
+// externalIDs and metas may be nil.
+func (fp *FeatureBrick) ImportDataPoints(pvs []*data.PosVector, externalIDs []string, metas []map[string]string) ([]*data.DataPoint, error) {
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+	if fp.NumOfAvailablePoints+len(pvs) > fp.NumOfBrickTotalCap {
+		return nil, errors.New("This Pool does not have enough room.")
+	}
+	now := time.Now()
+	newDataPoints := make([]*data.DataPoint, 0, len(pvs))
+	for i, pv := range pvs {
+		newDataPoint := &fp.DataPoints[fp.NumOfAvailablePoints]
+		newDataPoint.DataID = data.DataID(xid.New())
+		newDataPoint.Available = true
+		newDataPoint.PosVector.LoadPosition(pv)
+		newDataPoint.CreatedAt = now
+		newDataPoint.ExternalID = ""
+		newDataPoint.Meta = nil
+		if externalIDs != nil {
+			newDataPoint.ExternalID = externalIDs[i]
+		}
+		if metas != nil {
+			newDataPoint.Meta = metas[i]
+		}
+		fp.DataPointMapper[newDataPoint.DataID] = newDataPoint
+		fp.NumOfAvailablePoints += 1
+		newDataPoints = append(newDataPoints, newDataPoint)
+	}
+	return newDataPoints, nil
+}
+
+// strategyHolder lets strategies of different types be stored in the same atomic.Value.
+type strategyHolder struct {
+	strategy SearchStrategy
+}
+
+func (fp *FeatureBrick) strategy() SearchStrategy {
+	return fp.searchStrategy.Load().(strategyHolder).strategy
+}
+
+// SetSearchStrategy replaces the search strategy. Searches which have already started keep the old one.
+func (fp *FeatureBrick) SetSearchStrategy(strategy SearchStrategy) {
+	fp.searchStrategy.Store(strategyHolder{strategy})
+}
+
+// StrategyName returns the name of the search strategy of the brick.
+func (fp *FeatureBrick) StrategyName() string {
+	return StrategyName(fp.strategy())
+}
+
+// SearchSplit returns the number of data points each goroutine visits when searching numOfAvailablePoints.
+func (fp *FeatureBrick) SearchSplit(numOfAvailablePoints int) []int {
+	return fp.strategy().Split(numOfAvailablePoints)
+}
+
 func (fp *FeatureBrick) CreateSearchParam(params map[string]interface{}) SearchParameter {
-	return fp.searchStrategy.CreateSearchParameter(params)
+	return fp.strategy().CreateSearchParameter(params)
 }
 
 func (fp *FeatureBrick) Find(param SearchParameter) (ret *calculation.DistanceComparingState) {
-	return fp.searchStrategy.Search(fp.DataPoints, param)
+	return fp.strategy().Search(fp.DataPoints, param)
+}
+
+// FindBatch finds the nearest data point for each of the "posVectors" parameter in one pass.
+func (fp *FeatureBrick) FindBatch(param SearchParameter) []calculation.DistanceComparingState {
+	return fp.strategy().SearchBatch(fp.DataPoints, param)
+}
+
+// Search calls search with the number of available data points under the read lock of the brick.
+// Find and FindBatch, and the reads of their results, are to be done in search,
+// since deletes move data points between slots and they wait for it to return.
+func (fp *FeatureBrick) Search(search func(numOfAvailablePoints int)) {
+	fp.mutex.RLock()
+	defer fp.mutex.RUnlock()
+	search(fp.NumOfAvailablePoints)
 }
 
+// DeleteDataPoints removes the data points of dataIDs under a single lock acquisition.
+// The last data point is moved into the freed slot so that the available points stay contiguous.
+// It returns the data IDs which were not in the brick.
+func (fp *FeatureBrick) DeleteDataPoints(dataIDs []string) (notFound []string) {
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+	for _, dataIDstr := range dataIDs {
+		id, err := xid.FromString(dataIDstr)
+		if err != nil {
+			notFound = append(notFound, dataIDstr)
+			continue
+		}
+		dp, ok := fp.DataPointMapper[data.DataID(id)]
+		if !ok {
+			notFound = append(notFound, dataIDstr)
+			continue
+		}
+		delete(fp.DataPointMapper, dp.DataID)
+		last := &fp.DataPoints[fp.NumOfAvailablePoints-1]
+		if dp != last {
+			dp.DataID = last.DataID
+			dp.CreatedAt = last.CreatedAt
+			dp.ExternalID = last.ExternalID
+			dp.Meta = last.Meta
+			copy(dp.PosVector.Vals, last.PosVector.Vals)
+			dp.PosVector.Hash = last.PosVector.Hash
+			fp.DataPointMapper[dp.DataID] = dp
+		}
+		last.DataID = data.DataID{}
+		last.Available = false
+		last.PosVector.Hash = ""
+		last.CreatedAt = time.Time{}
+		last.ExternalID = ""
+		last.Meta = nil
+		fp.NumOfAvailablePoints -= 1
+	}
+	return notFound
+}
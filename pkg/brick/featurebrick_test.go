@@ -2,6 +2,7 @@ package brick
 
 import (
 	"github.com/abeja-inc/feature-search-db/pkg/data"
+	"go.uber.org/zap"
 	"log"
 	"math/rand"
 	"os"
@@ -19,6 +20,14 @@ func init() {
 
 func TestFeatureBrick(t *testing.T) {
 	t.Run("it testFeatureBrick_Find successfully", testFeatureBrick_Find)
+	t.Run("it testFeatureBrick_FindBatch successfully", testFeatureBrick_FindBatch)
+	t.Run("it testFeatureBrick_AddNewDataPoints successfully", testFeatureBrick_AddNewDataPoints)
+	t.Run("it testFeatureBrick_DeleteDataPoints successfully", testFeatureBrick_DeleteDataPoints)
+	t.Run("it finds the right data point while deleting successfully", testFeatureBrick_SearchWhileDeleting)
+	t.Run("it testFeatureBrick_ListDataPoints successfully", testFeatureBrick_ListDataPoints)
+	t.Run("it testFeatureBrick_DataPointsByID successfully", testFeatureBrick_DataPointsByID)
+	t.Run("it testFeatureBrick_SearchSplit successfully", testFeatureBrick_SearchSplit)
+	t.Run("it testFeatureBrick_SetSearchStrategy successfully", testFeatureBrick_SetSearchStrategy)
 }
 
 func testFeatureBrick_Find(t *testing.T) {
@@ -29,7 +38,7 @@ func testFeatureBrick_Find(t *testing.T) {
 		BrickFeatureGroupID(0),
 		strategy,
 	)
-	_ = InsertRandomValuesIntoPool(&brick, DataCap)
+	_ = InsertRandomValuesIntoPool(&brick, DataCap, zap.NewNop())
 
 	// Test exist posVector in brick
 	{
@@ -67,6 +76,228 @@ func testFeatureBrick_Find(t *testing.T) {
 	}
 }
 
+func testFeatureBrick_FindBatch(t *testing.T) {
+	for _, strategy := range []SearchStrategy{NewLinerFindStrategy(), NewLinerDividingFindStrategy(3)} {
+		// prepare
+		brick := NewBrick(1000,
+			BrickFeatureGroupID(0),
+			strategy,
+		)
+		_ = InsertRandomValuesIntoPool(&brick, 1000, zap.NewNop())
+		posVectors := []*data.PosVector{}
+		for i := 0; i < 10; i++ {
+			posVector := data.NewPosVector(true, 512)
+			posVectors = append(posVectors, &posVector)
+		}
+		posVectors = append(posVectors, &brick.DataPoints[rand.Intn(1000)].PosVector)
+
+		// exec
+		param := strategy.CreateSearchParameter(map[string]interface{}{
+			"posVectors":           posVectors,
+			"numOfAvailablePoints": brick.NumOfAvailablePoints,
+		})
+		results := brick.FindBatch(param)
+
+		// assert
+		if len(results) != len(posVectors) {
+			t.Fatal("fail. number of results not match.")
+		}
+		for i, posVector := range posVectors {
+			distCompState := brick.Find(strategy.CreateSearchParameter(map[string]interface{}{
+				"posVector":            posVector,
+				"numOfAvailablePoints": brick.NumOfAvailablePoints,
+			}))
+			if results[i].Result != distCompState.Result || results[i].Distance != distCompState.Distance {
+				t.Fatalf("fail. result of query %d not match.", i)
+			}
+		}
+		if results[len(results)-1].Distance != 0 {
+			t.Fatal("fail. distance not match.")
+		}
+	}
+}
+
+func testFeatureBrick_AddNewDataPoints(t *testing.T) {
+	// prepare
+	brick := NewBrick(3,
+		BrickFeatureGroupID(0),
+		NewLinerFindStrategy(),
+	)
+	a := data.NewPosVector(true, 512)
+	b := data.NewPosVector(true, 512)
+
+	// exec
+	dataPoints, err := brick.AddNewDataPoints([]*data.PosVector{&a, &b})
+
+	// assert
+	if err != nil || len(dataPoints) != 2 || brick.NumOfAvailablePoints != 2 {
+		t.Fatal("fail. data points not registered.")
+	}
+	if dp, _ := brick.FindDataPointByDataIDstr(dataPoints[1].GetDataIDstr()); dp == nil || dp.PosVector.Vals[0] != b.Vals[0] {
+		t.Fatal("fail. data point not found.")
+	}
+	if _, err := brick.AddNewDataPoints([]*data.PosVector{&a, &b}); err == nil || brick.NumOfAvailablePoints != 2 {
+		t.Fatal("fail. overflowing batch must be rejected.")
+	}
+}
+
+func testFeatureBrick_DeleteDataPoints(t *testing.T) {
+	// prepare
+	brick := NewBrick(3,
+		BrickFeatureGroupID(0),
+		NewLinerFindStrategy(),
+	)
+	a := data.NewPosVector(true, 512)
+	b := data.NewPosVector(true, 512)
+	c := data.NewPosVector(true, 512)
+	dataPoints, _ := brick.AddNewDataPoints([]*data.PosVector{&a, &b, &c})
+	idA, idC := dataPoints[0].GetDataIDstr(), dataPoints[2].GetDataIDstr()
+
+	// exec
+	notFound := brick.DeleteDataPoints([]string{idA, idA})
+
+	// assert
+	if len(notFound) != 1 || brick.NumOfAvailablePoints != 2 {
+		t.Fatalf("fail. data point not deleted. %v", notFound)
+	}
+	if dp, _ := brick.FindDataPointByDataIDstr(idA); dp != nil {
+		t.Fatal("fail. deleted data point found.")
+	}
+	dp, _ := brick.FindDataPointByDataIDstr(idC)
+	if dp != &brick.DataPoints[0] || dp.PosVector.Vals[0] != c.Vals[0] {
+		t.Fatal("fail. last data point not moved.")
+	}
+	param := brick.CreateSearchParam(map[string]interface{}{
+		"posVector":            &c,
+		"numOfAvailablePoints": brick.NumOfAvailablePoints,
+	})
+	if ret := brick.Find(param); ret.Result.GetDataIDstr() != idC || ret.Distance != 0 {
+		t.Fatal("fail. moved data point not found by search.")
+	}
+}
+
+func testFeatureBrick_SearchWhileDeleting(t *testing.T) {
+	// prepare
+	brick := NewBrick(1000,
+		BrickFeatureGroupID(0),
+		NewLinerDividingFindStrategy(4),
+	)
+	pvs := make([]*data.PosVector, 1000)
+	for i := range pvs {
+		pv := data.NewPosVector(true, 512)
+		pvs[i] = &pv
+	}
+	dataPoints, _ := brick.AddNewDataPoints(pvs)
+	ids := []string{}
+	for _, dp := range dataPoints {
+		ids = append(ids, dp.GetDataIDstr())
+	}
+	// The last data point is searched for, and is moved into a freed slot by the first delete.
+	target := pvs[len(pvs)-1]
+	want := ids[len(ids)-1]
+
+	// exec
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, id := range ids[:len(ids)-1] {
+			brick.DeleteDataPoints([]string{id})
+		}
+	}()
+	found := []string{}
+	for searching := true; searching; {
+		select {
+		case <-done:
+			searching = false
+		default:
+		}
+		brick.Search(func(numOfAvailablePoints int) {
+			param := brick.CreateSearchParam(map[string]interface{}{
+				"posVector":            target,
+				"numOfAvailablePoints": numOfAvailablePoints,
+			})
+			ret := brick.Find(param)
+			if ret.Distance != 0 {
+				found = append(found, "")
+				return
+			}
+			found = append(found, ret.Result.GetDataIDstr())
+		})
+	}
+
+	// assert
+	if brick.NumOfAvailablePoints != 1 {
+		t.Fatalf("fail. number of data points not match. %d", brick.NumOfAvailablePoints)
+	}
+	for i := range found {
+		if found[i] != want {
+			t.Fatalf("fail. search %d found another data point. %s", i, found[i])
+		}
+	}
+}
+
+func testFeatureBrick_ListDataPoints(t *testing.T) {
+	// prepare
+	brick := NewBrick(10,
+		BrickFeatureGroupID(0),
+		NewLinerFindStrategy(),
+	)
+	pvs := make([]*data.PosVector, 10)
+	for i := range pvs {
+		pv := data.NewPosVector(true, 512)
+		pvs[i] = &pv
+	}
+	dataPoints, _ := brick.AddNewDataPoints(pvs)
+	ids := []string{}
+	for _, dp := range dataPoints {
+		ids = append(ids, dp.GetDataIDstr())
+	}
+	brick.DeleteDataPoints([]string{ids[2]})
+	ids = append(ids[:2], ids[3:]...)
+	base := time.Now()
+	for i := range brick.DataPoints[:brick.NumOfAvailablePoints] {
+		brick.DataPoints[i].CreatedAt = base.Add(-time.Duration(i) * time.Second)
+	}
+
+	// exec
+	listed := []string{}
+	q := ListQuery{Order: OrderByInsertion, Limit: 4}
+	for {
+		dps, more := brick.ListDataPoints(q)
+		for i := range dps {
+			listed = append(listed, dps[i].GetDataIDstr())
+		}
+		if !more {
+			break
+		}
+		if q.After == nil {
+			// A delete moves the last data point into the slot, which must not skip it.
+			brick.DeleteDataPoints([]string{listed[len(listed)-1]})
+		}
+		last := dps[len(dps)-1]
+		q.After = &DataPointCursor{CreatedAt: last.CreatedAt, DataID: last.DataID}
+	}
+	byTime, more := brick.ListDataPoints(ListQuery{Order: OrderByCreatedAt, From: base.Add(-3 * time.Second), Limit: 10})
+
+	// assert
+	if len(listed) != len(ids) {
+		t.Fatalf("fail. number of data points not match. %d", len(listed))
+	}
+	for i := range ids {
+		if listed[i] != ids[i] {
+			t.Fatalf("fail. data point %d not in the order of insertion.", i)
+		}
+	}
+	if more || len(byTime) != 4 {
+		t.Fatalf("fail. number of data points from the time not match. %d", len(byTime))
+	}
+	for i := 1; i < len(byTime); i++ {
+		if !byTime[i-1].CreatedAt.Before(byTime[i].CreatedAt) || len(byTime[i].PosVector.Vals) != 512 {
+			t.Fatalf("fail. data point %d not in the order of CreatedAt.", i)
+		}
+	}
+}
+
 func BenchmarkFeatureBrick_Find_naive(b *testing.B) {
 	rand.Seed(time.Now().UnixNano())
 	strategy := NewLinerFindStrategy()
@@ -74,7 +305,7 @@ func BenchmarkFeatureBrick_Find_naive(b *testing.B) {
 		BrickFeatureGroupID(0),
 		strategy,
 	)
-	_ = InsertRandomValuesIntoPool(&brick, DataCap)
+	_ = InsertRandomValuesIntoPool(&brick, DataCap, zap.NewNop())
 
 	{
 		randI := rand.Intn(DataCap)
@@ -99,7 +330,7 @@ func BenchmarkFeatureBrick_Find_divideWith2Goroutine(b *testing.B) {
 		BrickFeatureGroupID(0),
 		strategy,
 	)
-	_ = InsertRandomValuesIntoPool(&brick, DataCap)
+	_ = InsertRandomValuesIntoPool(&brick, DataCap, zap.NewNop())
 
 	{
 		randI := rand.Intn(DataCap)
@@ -116,3 +347,86 @@ func BenchmarkFeatureBrick_Find_divideWith2Goroutine(b *testing.B) {
 		}
 	}
 }
+
+func testFeatureBrick_DataPointsByID(t *testing.T) {
+	// prepare
+	brick := NewBrick(10,
+		BrickFeatureGroupID(0),
+		NewLinerFindStrategy(),
+	)
+	pvs := make([]*data.PosVector, 5)
+	for i := range pvs {
+		pv := data.NewPosVector(true, 512)
+		pvs[i] = &pv
+	}
+	dataPoints, _ := brick.AddNewDataPoints(pvs)
+	ids := brick.DataIDs()
+
+	// exec
+	// Deleting the first data point moves the last one into its slot.
+	brick.DeleteDataPoints([]string{dataPoints[0].GetDataIDstr()})
+	copied := brick.DataPointsByID(ids[:3])
+	rest := brick.DataPointsByID(ids[3:])
+
+	// assert
+	if len(ids) != 5 {
+		t.Fatalf("fail. number of data IDs not match. %d", len(ids))
+	}
+	got := append(copied, rest...)
+	if len(got) != 4 {
+		t.Fatalf("fail. number of data points not match. %d", len(got))
+	}
+	for i := range got {
+		if got[i].DataID != ids[i+1] {
+			t.Fatalf("fail. data point %d not in the order of insertion.", i)
+		}
+		if got[i].PosVector.Vals[0] != pvs[i+1].Vals[0] {
+			t.Fatalf("fail. vector of data point %d not match.", i)
+		}
+	}
+}
+
+func testFeatureBrick_SearchSplit(t *testing.T) {
+	for _, tc := range []struct {
+		strategy SearchStrategy
+		want     []int
+	}{
+		{NewLinerFindStrategy(), []int{1000}},
+		{NewLinerDividingFindStrategy(3), []int{333, 333, 334}},
+	} {
+		// prepare
+		brick := NewBrick(1000,
+			BrickFeatureGroupID(0),
+			tc.strategy,
+		)
+
+		// exec
+		split := brick.SearchSplit(1000)
+
+		// assert
+		if len(split) != len(tc.want) {
+			t.Fatalf("fail. num of goroutines not match. %v", split)
+		}
+		for i := range split {
+			if split[i] != tc.want[i] {
+				t.Fatalf("fail. split not match. %v", split)
+			}
+		}
+	}
+}
+
+func testFeatureBrick_SetSearchStrategy(t *testing.T) {
+	// prepare
+	brick := NewBrick(1000,
+		BrickFeatureGroupID(0),
+		NewLinerFindStrategy(),
+	)
+
+	// exec
+	brick.SetSearchStrategy(NewLinerDividingFindStrategy(4))
+
+	// assert
+	if brick.StrategyName() != "goroutine_4" || len(brick.SearchSplit(1000)) != 4 {
+		t.Fatalf("fail. strategy not replaced. %s", brick.StrategyName())
+	}
+}
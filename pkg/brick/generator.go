@@ -2,14 +2,14 @@ package brick
 
 import (
 	"github.com/abeja-inc/feature-search-db/pkg/data"
-	"log"
+	"go.uber.org/zap"
 	"math/rand"
 	"sync"
 	"time"
 )
 
 // InsertRandomValuesIntoPool inserts randomized values into brick
-func InsertRandomValuesIntoPool(fp *FeatureBrick, capacity int) error {
+func InsertRandomValuesIntoPool(fp *FeatureBrick, capacity int, logger *zap.Logger) error {
 	ta := time.Now().UnixNano()
 	div := 1
 	wg := sync.WaitGroup{}
@@ -24,7 +24,7 @@ func InsertRandomValuesIntoPool(fp *FeatureBrick, capacity int) error {
 		}
 		wg.Add(1)
 		go func(start int, end int) {
-			log.Printf("start=%d end=%d", start, end)
+			logger.Debug("inserting random values", zap.Int("start", start), zap.Int("end", end))
 			for j := start; j < end; j++ {
 				a := data.NewPosVector(true, 512)
 				newDataPoint, _ := fp.AddNewDataPoint(&a)
@@ -35,7 +35,7 @@ func InsertRandomValuesIntoPool(fp *FeatureBrick, capacity int) error {
 	}
 	wg.Wait()
 	tb := time.Now().UnixNano()
-	log.Printf("Init random values within %d msec", (tb-ta)/1000000.0)
-	fp.ShowDebug()
+	logger.Info("Init random values", zap.Int64("msec", (tb-ta)/1000000.0))
+	fp.ShowDebug(logger)
 	return nil
 }
@@ -0,0 +1,146 @@
+package brick
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/data"
+
+	"github.com/rs/xid"
+)
+
+// DataPointOrder is the order in which data points of a brick are listed.
+type DataPointOrder string
+
+const (
+	// OrderByInsertion lists data points by their data IDs, which are in the order of insertion.
+	// Unlike the slots of DataPoints, it does not change when data points are deleted.
+	OrderByInsertion DataPointOrder = "insertion"
+	// OrderByCreatedAt lists data points by CreatedAt, and by data ID for the same time.
+	OrderByCreatedAt DataPointOrder = "createdAt"
+)
+
+// DataPointCursor is the position of the last data point of a page. The next page starts after it.
+type DataPointCursor struct {
+	CreatedAt time.Time
+	DataID    data.DataID
+}
+
+// ListQuery selects a page of data points.
+// From is inclusive and To is exclusive, and zero values leave them open.
+type ListQuery struct {
+	Order DataPointOrder
+	After *DataPointCursor
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+func (q ListQuery) less(a *data.DataPoint, b *data.DataPoint) bool {
+	if q.Order == OrderByCreatedAt && !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return xid.ID(a.DataID).Compare(xid.ID(b.DataID)) < 0
+}
+
+func (q ListQuery) match(dp *data.DataPoint) bool {
+	if !q.From.IsZero() && dp.CreatedAt.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !dp.CreatedAt.Before(q.To) {
+		return false
+	}
+	if q.After != nil {
+		after := data.DataPoint{DataID: q.After.DataID, CreatedAt: q.After.CreatedAt}
+		return q.less(&after, dp)
+	}
+	return true
+}
+
+// pageHeap keeps the first data points of a page with the last one on top.
+type pageHeap struct {
+	q   ListQuery
+	dps []*data.DataPoint
+}
+
+func (h *pageHeap) Len() int           { return len(h.dps) }
+func (h *pageHeap) Less(i, j int) bool { return h.q.less(h.dps[j], h.dps[i]) }
+func (h *pageHeap) Swap(i, j int)      { h.dps[i], h.dps[j] = h.dps[j], h.dps[i] }
+func (h *pageHeap) Push(x interface{}) { h.dps = append(h.dps, x.(*data.DataPoint)) }
+func (h *pageHeap) Pop() interface{} {
+	dp := h.dps[len(h.dps)-1]
+	h.dps = h.dps[:len(h.dps)-1]
+	return dp
+}
+
+// ListDataPoints returns a page of up to q.Limit data points in the order, and whether more follow.
+// The brick is scanned under its lock with only a page of data points kept, and the page is copied out.
+func (fp *FeatureBrick) ListDataPoints(q ListQuery) ([]data.DataPoint, bool) {
+	if q.Limit <= 0 {
+		return []data.DataPoint{}, false
+	}
+	fp.mutex.RLock()
+	defer fp.mutex.RUnlock()
+	// One more than the limit tells whether another page follows.
+	h := &pageHeap{q: q, dps: make([]*data.DataPoint, 0, q.Limit+1)}
+	for i := 0; i < fp.NumOfAvailablePoints; i++ {
+		dp := &fp.DataPoints[i]
+		if !dp.Available || !q.match(dp) {
+			continue
+		}
+		if h.Len() <= q.Limit {
+			heap.Push(h, dp)
+		} else if q.less(dp, h.dps[0]) {
+			h.dps[0] = dp
+			heap.Fix(h, 0)
+		}
+	}
+	more := h.Len() > q.Limit
+	if more {
+		heap.Pop(h)
+	}
+	dps := make([]data.DataPoint, h.Len())
+	for i := len(dps) - 1; i >= 0; i-- {
+		dp := *heap.Pop(h).(*data.DataPoint)
+		dp.PosVector.Vals = append([]float64{}, dp.PosVector.Vals...)
+		dps[i] = dp
+	}
+	return dps, more
+}
+
+// DataIDs returns the data IDs of the available data points in the order of insertion.
+// Only the IDs are copied under the lock, and they are sorted after it is released.
+func (fp *FeatureBrick) DataIDs() []data.DataID {
+	fp.mutex.RLock()
+	ids := make([]data.DataID, 0, fp.NumOfAvailablePoints)
+	for i := 0; i < fp.NumOfAvailablePoints; i++ {
+		if fp.DataPoints[i].Available {
+			ids = append(ids, fp.DataPoints[i].DataID)
+		}
+	}
+	fp.mutex.RUnlock()
+	sort.Slice(ids, func(i, j int) bool {
+		return xid.ID(ids[i]).Compare(xid.ID(ids[j])) < 0
+	})
+	return ids
+}
+
+// DataPointsByID copies the data points of dataIDs out under a single lock acquisition, in the same order.
+// Data points are looked up by ID rather than by slot, so those moved by a delete are still found,
+// and the data IDs which are not in the brick any more are skipped.
+func (fp *FeatureBrick) DataPointsByID(dataIDs []data.DataID) []data.DataPoint {
+	fp.mutex.RLock()
+	defer fp.mutex.RUnlock()
+	dps := make([]data.DataPoint, 0, len(dataIDs))
+	for _, id := range dataIDs {
+		found, ok := fp.DataPointMapper[id]
+		if !ok || !found.Available {
+			continue
+		}
+		dp := *found
+		dp.PosVector.Vals = append([]float64{}, dp.PosVector.Vals...)
+		dps = append(dps, dp)
+	}
+	return dps
+}
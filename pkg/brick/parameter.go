@@ -9,11 +9,13 @@ type SearchParameter interface {
 type LinerFindParameter struct {
 	numOfAvailablePoints int
 	targetVector *data.PosVector
+	targetVectors []*data.PosVector
 }
 
 type LinerDividingFindParameter struct {
 	numOfAvailablePoints int
 	targetVector *data.PosVector
+	targetVectors []*data.PosVector
 }
 
 func (lfp *LinerFindParameter) To() interface{} {
@@ -1,7 +1,10 @@
 package brick
 
 import (
+	"fmt"
 	"math"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/abeja-inc/feature-search-db/pkg/calculation"
@@ -11,6 +14,33 @@ import (
 type SearchStrategy interface {
 	CreateSearchParameter(map[string]interface{}) SearchParameter
 	Search(Data, SearchParameter) *calculation.DistanceComparingState
+	SearchBatch(Data, SearchParameter) []calculation.DistanceComparingState
+	// Split returns the number of data points each goroutine of a search visits.
+	Split(numOfAvailablePoints int) []int
+}
+
+// Number of data points compared against every query of a batch at a time.
+// A block stays in cache while all the queries go through it.
+const batchBlockSize = 64
+
+// searchBlocked finds the nearest data point in dataPoints[start:end] for each target.
+func searchBlocked(dataPoints Data, start int, end int, targets []*data.PosVector) []calculation.DistanceComparingState {
+	ret := make([]calculation.DistanceComparingState, len(targets))
+	for i := range ret {
+		ret[i].SetCandidate(nil, math.MaxFloat64)
+	}
+	for blockStart := start; blockStart < end; blockStart += batchBlockSize {
+		blockEnd := blockStart + batchBlockSize
+		if blockEnd > end {
+			blockEnd = end
+		}
+		for i, target := range targets {
+			for j := blockStart; j < blockEnd; j++ {
+				ret[i].UpdateIfFindMinimum(&dataPoints[j], target)
+			}
+		}
+	}
+	return ret
 }
 
 type LinerFindStrategy struct {
@@ -32,20 +62,62 @@ func NewLinerDividingFindStrategy(
 	}
 }
 
+// NewSearchStrategy builds a strategy from its name given by the "strategy" flag.
+// "naive" selects LinerFindStrategy and "goroutine_N" selects
+// LinerDividingFindStrategy with N goroutines.
+func NewSearchStrategy(name string) (SearchStrategy, error) {
+	switch {
+	case name == "naive":
+		return NewLinerFindStrategy(), nil
+	case strings.HasPrefix(name, "goroutine_"):
+		strs := strings.Split(name, "_")
+		div, err := strconv.Atoi(strs[1])
+		if err != nil || div <= 0 {
+			return nil, fmt.Errorf("failed parse goroutine num: %s", name)
+		}
+		return NewLinerDividingFindStrategy(div), nil
+	default:
+		return NewLinerFindStrategy(), nil
+	}
+}
+
+// StrategyName returns the name of a strategy as NewSearchStrategy takes it.
+func StrategyName(strategy SearchStrategy) string {
+	switch s := strategy.(type) {
+	case *LinerFindStrategy:
+		return "naive"
+	case *LinerDividingFindStrategy:
+		return fmt.Sprintf("goroutine_%d", s.divideNum)
+	}
+	return fmt.Sprintf("%T", strategy)
+}
+
 func (ls *LinerFindStrategy) Search(dataPoints Data, param SearchParameter) *calculation.DistanceComparingState {
 	p := param.To().(*LinerFindParameter)
 	ret := calculation.DistanceComparingState{}
 	ret.SetCandidate(&data.DataPoint{}, math.MaxFloat64)
-	for i := 1; i < p.numOfAvailablePoints; i++ {
+	for i := 0; i < p.numOfAvailablePoints; i++ {
 		ret.UpdateIfFindMinimum(&dataPoints[i], p.targetVector)
 	}
 	return &ret
 }
 
+func (ls *LinerFindStrategy) Split(numOfAvailablePoints int) []int {
+	return []int{numOfAvailablePoints}
+}
+
+func (ls *LinerFindStrategy) SearchBatch(dataPoints Data, param SearchParameter) []calculation.DistanceComparingState {
+	p := param.To().(*LinerFindParameter)
+	return searchBlocked(dataPoints, 0, p.numOfAvailablePoints, p.targetVectors)
+}
+
 // TODO: validation before here
 func (ls *LinerFindStrategy) CreateSearchParameter(p map[string]interface{}) SearchParameter {
+	targetVector, _ := p["posVector"].(*data.PosVector)
+	targetVectors, _ := p["posVectors"].([]*data.PosVector)
 	return &LinerFindParameter{
-		targetVector:         p["posVector"].(*data.PosVector),
+		targetVector:         targetVector,
+		targetVectors:        targetVectors,
 		numOfAvailablePoints: p["numOfAvailablePoints"].(int),
 	}
 }
@@ -88,9 +160,47 @@ func (ldfs *LinerDividingFindStrategy) Search(dataPoints Data, param SearchParam
 	return
 }
 
+// Split divides the data points as Search and SearchBatch do; the last goroutine takes the remainder.
+func (ldfs *LinerDividingFindStrategy) Split(numOfAvailablePoints int) []int {
+	ret := make([]int, ldfs.divideNum)
+	for i := range ret {
+		ret[i] = numOfAvailablePoints / ldfs.divideNum
+	}
+	ret[ldfs.divideNum-1] += numOfAvailablePoints % ldfs.divideNum
+	return ret
+}
+
+func (ldfs *LinerDividingFindStrategy) SearchBatch(dataPoints Data, param SearchParameter) []calculation.DistanceComparingState {
+	p := param.To().(*LinerDividingFindParameter)
+	resc := make(chan []calculation.DistanceComparingState)
+	// 計算範囲の分割と各GoRoutineの起動
+	for i := 0; i < ldfs.divideNum; i++ {
+		start := int(p.numOfAvailablePoints/ldfs.divideNum) * i
+		end := int(p.numOfAvailablePoints/ldfs.divideNum) * (i + 1)
+		if i == (ldfs.divideNum - 1) {
+			end = p.numOfAvailablePoints
+		}
+		go func(start int, end int) {
+			resc <- searchBlocked(dataPoints, start, end, p.targetVectors)
+		}(start, end)
+	}
+	// 各GoRoutineの計算結果の比較
+	ret := <-resc
+	for i := 0; i < (ldfs.divideNum - 1); i++ {
+		tmp := <-resc
+		for j := range ret {
+			ret[j].Merge(&tmp[j])
+		}
+	}
+	return ret
+}
+
 func (ldfs *LinerDividingFindStrategy) CreateSearchParameter(p map[string]interface{}) SearchParameter {
+	targetVector, _ := p["posVector"].(*data.PosVector)
+	targetVectors, _ := p["posVectors"].([]*data.PosVector)
 	return &LinerDividingFindParameter{
-		targetVector:         p["posVector"].(*data.PosVector),
+		targetVector:         targetVector,
+		targetVectors:        targetVectors,
 		numOfAvailablePoints: p["numOfAvailablePoints"].(int),
 	}
 }
@@ -0,0 +1,214 @@
+// Package bulk loads files of vectors into the bricks of a calc node
+// without going through the search API.
+package bulk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/data"
+	"github.com/abeja-inc/feature-search-db/pkg/metrics"
+	"github.com/abeja-inc/feature-search-db/pkg/vecio"
+)
+
+var ErrReadOnly = brick.ErrReadOnly
+
+// ErrLimitReached is returned when a source has more records than the limit of an import.
+var ErrLimitReached = errors.New("The import has reached its limit.")
+
+// Progress is how far an import went.
+type Progress struct {
+	// Offset is the number of records of the source which are done, including skipped ones.
+	Offset    int       `json:"offset"`
+	Inserted  int       `json:"inserted"`
+	Bricks    []string  `json:"bricks"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Importer inserts records into the bricks of a feature group in batches.
+type Importer struct {
+	Pool *brick.BrickPool
+	// Namespace is the namespace of the feature group, brick.DefaultNamespace when empty.
+	Namespace      string
+	FeatureGroupID brick.BrickFeatureGroupID
+	BatchSize      int
+	// NewBrick creates and registers a brick of the feature group when every brick is full.
+	// The import fails on full bricks when it is nil.
+	NewBrick func() (*brick.FeatureBrick, error)
+	// OnBatch is called after each batch is inserted. The import stops when it returns an error.
+	OnBatch func(p Progress) error
+	// Limit, when positive, is the number of records inserted at most.
+	// The import stops with ErrLimitReached on the record after.
+	Limit int
+}
+
+// Run reads r to the end after skipping skip records.
+// The progress is returned also on errors, and records up to its Offset are inserted.
+func (im *Importer) Run(ctx context.Context, r vecio.Reader, skip int) (Progress, error) {
+	p := Progress{Bricks: []string{}, StartedAt: time.Now(), UpdatedAt: time.Now()}
+	if im.Pool.IsReadOnly() {
+		return p, ErrReadOnly
+	}
+	if err := vecio.Skip(r, skip); err != nil {
+		return p, err
+	}
+	p.Offset = skip
+	batchSize := im.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	recs := make([]vecio.Record, 0, batchSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return p, err
+		}
+		recs = recs[:0]
+		var readErr error
+		for len(recs) < batchSize {
+			rec, err := r.Next()
+			if err != nil {
+				readErr = err
+				break
+			}
+			recs = append(recs, rec)
+		}
+		limited := im.Limit > 0 && p.Inserted+len(recs) > im.Limit
+		if limited {
+			recs = recs[:im.Limit-p.Inserted]
+		}
+		if err := im.insert(&p, recs); err != nil {
+			return p, err
+		}
+		if len(recs) > 0 && im.OnBatch != nil {
+			if err := im.OnBatch(p); err != nil {
+				return p, err
+			}
+		}
+		if limited {
+			return p, ErrLimitReached
+		}
+		if readErr == io.EOF {
+			return p, nil
+		}
+		if readErr != nil {
+			return p, readErr
+		}
+	}
+}
+
+// insert fills the bricks with room in order, and creates bricks when they are full.
+func (im *Importer) insert(p *Progress, recs []vecio.Record) error {
+	for len(recs) > 0 {
+		if err := im.Pool.BeginWrite(); err != nil {
+			return err
+		}
+		fb, err := im.brickWithRoom()
+		if err != nil {
+			im.Pool.EndWrite()
+			return err
+		}
+		n := fb.NumOfBrickTotalCap - fb.NumOfAvailablePoints
+		if n > len(recs) {
+			n = len(recs)
+		}
+		pvs := make([]*data.PosVector, n)
+		externalIDs := make([]string, n)
+		metas := make([]map[string]string, n)
+		for i := range recs[:n] {
+			pv := data.NewPosVector(false, vecio.Dim)
+			pv.LoadPositionFromArray(recs[i].Vals)
+			pvs[i] = &pv
+			externalIDs[i] = recs[i].ID
+			metas[i] = recs[i].Meta
+		}
+		// Other writers may have taken the room, then another brick is tried.
+		ta := time.Now()
+		_, err = fb.ImportDataPoints(pvs, externalIDs, metas)
+		im.Pool.EndWrite()
+		if err != nil {
+			continue
+		}
+		metrics.ObserveInsert(fb.GetNamespace(), int(im.FeatureGroupID), n, time.Since(ta))
+		p.Inserted += n
+		p.Offset += n
+		p.UpdatedAt = time.Now()
+		uniqueID := fb.GetUniqueIDstr()
+		if len(p.Bricks) == 0 || p.Bricks[len(p.Bricks)-1] != uniqueID {
+			p.Bricks = append(p.Bricks, uniqueID)
+		}
+		recs = recs[n:]
+	}
+	return nil
+}
+
+func (im *Importer) brickWithRoom() (*brick.FeatureBrick, error) {
+	namespace := im.Namespace
+	if namespace == "" {
+		namespace = brick.DefaultNamespace
+	}
+	fbs, _ := im.Pool.GetBricksOfGroup(namespace, im.FeatureGroupID)
+	for _, fb := range fbs {
+		if fb.NumOfAvailablePoints < fb.NumOfBrickTotalCap {
+			return fb, nil
+		}
+	}
+	if im.NewBrick == nil {
+		return nil, errors.New("Every brick of the feature group is full.")
+	}
+	return im.NewBrick()
+}
+
+// Checkpoint records how far an import of a source went, so that it can be resumed.
+type Checkpoint struct {
+	Source         string    `json:"source"`
+	Namespace      string    `json:"namespace,omitempty"`
+	FeatureGroupID int       `json:"groupID"`
+	Offset         int       `json:"offset"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// LoadCheckpoint reads a checkpoint file. It returns a zero checkpoint when the file does not exist.
+func LoadCheckpoint(path string) (Checkpoint, error) {
+	var cp Checkpoint
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, err
+	}
+	err = json.Unmarshal(b, &cp)
+	return cp, err
+}
+
+// SaveCheckpoint replaces the checkpoint file atomically.
+func SaveCheckpoint(path string, cp Checkpoint) error {
+	cp.UpdatedAt = time.Now()
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
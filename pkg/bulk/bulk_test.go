@@ -0,0 +1,135 @@
+package bulk
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/vecio"
+)
+
+func TestImporter(t *testing.T) {
+	t.Run("it fills bricks and creates new ones successfully", testImporter_Run)
+	t.Run("it resumes from a checkpoint successfully", testImporter_resume)
+	t.Run("it stops at its limit", testImporter_limit)
+}
+
+type sliceReader struct {
+	recs []vecio.Record
+}
+
+func (sr *sliceReader) Next() (vecio.Record, error) {
+	if len(sr.recs) == 0 {
+		return vecio.Record{}, io.EOF
+	}
+	rec := sr.recs[0]
+	sr.recs = sr.recs[1:]
+	return rec, nil
+}
+
+func testRecords(n int) []vecio.Record {
+	recs := make([]vecio.Record, n)
+	for i := range recs {
+		recs[i].ID = string(rune('a' + i))
+		recs[i].Vals[0] = float64(i)
+	}
+	return recs
+}
+
+func newImporter(capacity int) (*Importer, *brick.BrickPool) {
+	bp := &brick.BrickPool{}
+	bp.InitBrickPool()
+	newBrick := func() (*brick.FeatureBrick, error) {
+		fb := brick.NewBrick(capacity, 1, brick.NewLinerFindStrategy())
+		bp.RegisterIntoPool(&fb)
+		return &fb, nil
+	}
+	return &Importer{Pool: bp, FeatureGroupID: 1, BatchSize: 3, NewBrick: newBrick}, bp
+}
+
+func testImporter_Run(t *testing.T) {
+	// prepare
+	im, bp := newImporter(4)
+	batches := 0
+	im.OnBatch = func(p Progress) error {
+		batches += 1
+		return nil
+	}
+
+	// exec
+	p, err := im.Run(context.Background(), &sliceReader{testRecords(10)}, 0)
+
+	// assert
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if p.Inserted != 10 || p.Offset != 10 || batches != 4 {
+		t.Fatalf("fail. progress not match. %+v %d", p, batches)
+	}
+	fbs, _ := bp.GetBrickByGroupID(1)
+	if len(fbs) != 3 || len(p.Bricks) != 3 {
+		t.Fatalf("fail. number of bricks not match. %d", len(fbs))
+	}
+	if fbs[2].NumOfAvailablePoints != 2 || fbs[2].DataPoints[1].ExternalID != "j" || fbs[2].DataPoints[1].PosVector.Vals[0] != 9 {
+		t.Fatalf("fail. last data point not match. %+v", fbs[2].DataPoints[1].ExternalID)
+	}
+}
+
+func testImporter_resume(t *testing.T) {
+	// prepare
+	dir, _ := ioutil.TempDir("", "bulk")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "import.checkpoint")
+	im, _ := newImporter(100)
+	im.OnBatch = func(p Progress) error {
+		return SaveCheckpoint(path, Checkpoint{Source: "src", FeatureGroupID: 1, Offset: p.Offset})
+	}
+	im.Run(context.Background(), &sliceReader{testRecords(5)}, 0)
+
+	// exec
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	p, err := im.Run(context.Background(), &sliceReader{testRecords(8)}, cp.Offset)
+
+	// assert
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if cp.Offset != 5 || cp.Source != "src" {
+		t.Fatalf("fail. checkpoint not match. %+v", cp)
+	}
+	if p.Inserted != 3 || p.Offset != 8 {
+		t.Fatalf("fail. progress not match. %+v", p)
+	}
+	missing, _ := LoadCheckpoint(filepath.Join(dir, "missing"))
+	if missing.Offset != 0 {
+		t.Fatalf("fail. missing checkpoint must be zero. %+v", missing)
+	}
+}
+
+func testImporter_limit(t *testing.T) {
+	// prepare
+	im, bp := newImporter(100)
+	im.Limit = 5
+
+	// exec
+	p, err := im.Run(context.Background(), &sliceReader{testRecords(8)}, 0)
+
+	// assert
+	if err != ErrLimitReached {
+		t.Fatalf("fail. limit not reached. %v", err)
+	}
+	if p.Inserted != 5 || p.Offset != 5 {
+		t.Fatalf("fail. progress not match. %+v", p)
+	}
+	fbs, _ := bp.GetBrickByGroupID(1)
+	if len(fbs) != 1 || fbs[0].NumOfAvailablePoints != 5 {
+		t.Fatalf("fail. records over the limit inserted. %d", fbs[0].NumOfAvailablePoints)
+	}
+}
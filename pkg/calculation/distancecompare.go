@@ -21,3 +21,11 @@ func (dcs *DistanceComparingState) UpdateIfFindMinimum(dp *data.DataPoint, input
 		dcs.Distance = val
 	}
 }
+
+// Merge keeps the nearer of dcs and other.
+func (dcs *DistanceComparingState) Merge(other *DistanceComparingState) {
+	if other.Result != nil && other.Distance < dcs.Distance {
+		dcs.Result = other.Result
+		dcs.Distance = other.Distance
+	}
+}
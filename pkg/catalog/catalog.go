@@ -0,0 +1,232 @@
+// Package catalog defines namespaces and their feature groups: what their vectors are and how they are
+// searched and stored. The catalog is replicated through the cluster state, and nodes check inserts and
+// queries against it.
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+)
+
+const (
+	DTypeFloat32 = "float32"
+	DTypeFloat64 = "float64"
+	// MetricL2 is the euclidean distance, which is the only metric the bricks compute.
+	MetricL2 = "l2"
+	// Dim is the dimension of every vector, which is compiled into the bricks.
+	Dim = 512
+)
+
+// ErrUnknownGroup is returned for a feature group which is not in the catalog.
+var ErrUnknownGroup = errors.New("Unknown feature group")
+
+// ErrUnknownAlias is returned for an alias which is not in the catalog.
+var ErrUnknownAlias = errors.New("Unknown alias")
+
+// validName is what an alias or a namespace may be named, so that it can be a path segment and a query parameter as is.
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// CapacityPolicy tells how much a feature group holds. Zero values leave it to the nodes.
+type CapacityPolicy struct {
+	// BrickSize is the number of data points of the bricks created for the group.
+	BrickSize int `json:"brickSize,omitempty"`
+	// MaxPoints is the number of data points in the cluster above which the proxy registers no more.
+	MaxPoints int `json:"maxPoints,omitempty"`
+}
+
+// Allows tells whether n more data points fit when the group holds points.
+func (cp CapacityPolicy) Allows(points int, n int) bool {
+	return cp.MaxPoints <= 0 || points+n <= cp.MaxPoints
+}
+
+// Group is the definition of a feature group. IDs and names are unique within a namespace.
+type Group struct {
+	Namespace string `json:"namespace"`
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Dim       int    `json:"dim"`
+	// DType is the value type of binary vectors. JSON and gRPC vectors are converted.
+	DType  string `json:"dtype"`
+	Metric string `json:"metric"`
+	// Strategy is the search strategy of the bricks of the group, the strategy of the node when empty.
+	Strategy string `json:"strategy,omitempty"`
+	// NoveltyThreshold is the threshold of the group, the one of the proxy when nil.
+	NoveltyThreshold *float64       `json:"noveltyThreshold,omitempty"`
+	Capacity         CapacityPolicy `json:"capacity"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	UpdatedAt        time.Time      `json:"updatedAt"`
+	// Deleted marks a tombstone, which is gossiped so that every node forgets the group.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Key identifies the group in the cluster state.
+func (g Group) Key() string {
+	return g.Namespace + "/" + strconv.Itoa(g.ID)
+}
+
+// SetDefaults fills the fields which a request may leave out.
+func (g *Group) SetDefaults() {
+	if g.Dim == 0 {
+		g.Dim = Dim
+	}
+	if g.DType == "" {
+		g.DType = DTypeFloat64
+	}
+	if g.Metric == "" {
+		g.Metric = MetricL2
+	}
+}
+
+// Validate checks the definition against what the nodes support.
+func (g Group) Validate() error {
+	if g.ID < 0 {
+		return errors.New("id must not be negative")
+	}
+	if strings.TrimSpace(g.Name) == "" {
+		return errors.New("name must be specified")
+	}
+	if g.Dim != Dim {
+		return fmt.Errorf("dim must be %d", Dim)
+	}
+	if g.DType != DTypeFloat32 && g.DType != DTypeFloat64 {
+		return fmt.Errorf("dtype must be %s or %s", DTypeFloat32, DTypeFloat64)
+	}
+	if g.Metric != MetricL2 {
+		return fmt.Errorf("metric must be %s", MetricL2)
+	}
+	if g.Strategy != "" {
+		if _, err := brick.NewSearchStrategy(g.Strategy); err != nil {
+			return err
+		}
+	}
+	if g.NoveltyThreshold != nil && *g.NoveltyThreshold < 0 {
+		return errors.New("noveltyThreshold must not be negative")
+	}
+	if g.Capacity.BrickSize < 0 || g.Capacity.MaxPoints < 0 {
+		return errors.New("capacity must not be negative")
+	}
+	return nil
+}
+
+// ValueSize is the number of bytes of a value of binary vectors.
+func (g Group) ValueSize() int {
+	if g.DType == DTypeFloat32 {
+		return 4
+	}
+	return 8
+}
+
+// CheckVectors checks vectors of dim values, each of valueSize bytes when they are binary (0 otherwise).
+func (g Group) CheckVectors(dim int, valueSize int) error {
+	if dim != g.Dim {
+		return fmt.Errorf("Invalid dimension (%d), feature group %d has %d", dim, g.ID, g.Dim)
+	}
+	if valueSize != 0 && valueSize != g.ValueSize() {
+		return fmt.Errorf("Invalid value size (%d), feature group %d is %s", valueSize, g.ID, g.DType)
+	}
+	return nil
+}
+
+// DefaultGroup is feature group 0 of the default namespace, which calc nodes put their initial brick in.
+// It is defined at the Unix epoch, so that any definition or deletion through the API wins over it.
+func DefaultGroup() Group {
+	g := Group{
+		Namespace: DefaultNamespace,
+		ID:        0,
+		Name:      "default",
+		CreatedAt: time.Unix(0, 0),
+		UpdatedAt: time.Unix(0, 0),
+	}
+	g.SetDefaults()
+	return g
+}
+
+// Alias is a name which points at a feature group. Requests which name the alias go to the group it points at
+// when they arrive, so that repointing it moves the traffic from one group to another at once.
+type Alias struct {
+	Namespace      string    `json:"namespace"`
+	Name           string    `json:"name"`
+	FeatureGroupID int       `json:"featureGroupID"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+	// Deleted marks a tombstone, which is gossiped so that every node forgets the alias.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Key identifies the alias in the cluster state.
+func (a Alias) Key() string {
+	return a.Namespace + "/" + a.Name
+}
+
+// ValidateAliasName checks that name can be used as an alias.
+func ValidateAliasName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("Invalid alias (%q), letters, digits, '_', '.' and '-' are allowed", name)
+	}
+	return nil
+}
+
+// Store keeps the catalog. state.Peer replicates it through gossip.
+// Groups and aliases are of a namespace, and are not seen from the others.
+type Store interface {
+	// Groups returns the feature groups of the namespace in the order of their IDs.
+	Groups(namespace string) []Group
+	Group(namespace string, id int) (Group, bool)
+	// SetGroup adds, replaces or, with a tombstone, deletes a group.
+	SetGroup(g Group)
+	// AddGroup adds a group unless CheckNewGroup fails on the groups of its namespace,
+	// with the check and the write done at once.
+	AddGroup(g Group) error
+	// Aliases returns the aliases of the namespace in the order of their names.
+	Aliases(namespace string) []Alias
+	Alias(namespace string, name string) (Alias, bool)
+	// SetAlias adds, repoints or, with a tombstone, deletes an alias.
+	SetAlias(a Alias)
+	// CompareAndSetAlias repoints an alias only if it points at the feature group of from,
+	// with the check and the write done at once. It reports whether the alias has been set.
+	CompareAndSetAlias(a Alias, from int) bool
+	// Namespaces returns the namespaces which have been defined in the order of their names.
+	Namespaces() []Namespace
+	Namespace(name string) (Namespace, bool)
+	// SetNamespace adds, replaces or, with a tombstone, deletes a namespace.
+	SetNamespace(n Namespace)
+	// Usage returns what the bricks of the namespace hold in the cluster, which its quota limits.
+	Usage(namespace string) Usage
+}
+
+// CheckNewGroup returns an error when one of groups has the ID or the name of g.
+func CheckNewGroup(groups []Group, g Group) error {
+	for _, other := range groups {
+		if other.ID == g.ID {
+			return fmt.Errorf("Feature group %d already exists", g.ID)
+		}
+		if other.Name == g.Name {
+			return fmt.Errorf("Name %q is used by feature group %d", g.Name, other.ID)
+		}
+	}
+	return nil
+}
+
+// Lookup returns the feature group of id in the namespace, or ErrUnknownGroup.
+func Lookup(s Store, namespace string, id int) (Group, error) {
+	g, ok := s.Group(namespace, id)
+	if !ok {
+		return g, fmt.Errorf("%w (%d)", ErrUnknownGroup, id)
+	}
+	return g, nil
+}
+
+// ResolveAlias returns the ID of the feature group which the alias of name in the namespace points at,
+// or ErrUnknownAlias.
+func ResolveAlias(s Store, namespace string, name string) (int, error) {
+	a, ok := s.Alias(namespace, name)
+	if !ok {
+		return 0, fmt.Errorf("%w (%s)", ErrUnknownAlias, name)
+	}
+	return a.FeatureGroupID, nil
+}
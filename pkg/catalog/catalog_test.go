@@ -0,0 +1,355 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCatalog(t *testing.T) {
+	t.Run("it creates, describes and deletes a group successfully", testCatalog_handlers)
+	t.Run("it rejects invalid or conflicting groups", testCatalog_invalid)
+	t.Run("it checks vectors against the group", testCatalog_checkVectors)
+	t.Run("it repoints an alias successfully", testCatalog_alias)
+	t.Run("it rejects invalid or conflicting aliases", testCatalog_aliasInvalid)
+	t.Run("it isolates namespaces successfully", testCatalog_namespaces)
+	t.Run("it checks usage against the quota", testCatalog_quota)
+}
+
+// memStore is a Store which is not replicated.
+type memStore struct {
+	groups     map[string]Group
+	aliases    map[string]Alias
+	namespaces map[string]Namespace
+	usage      map[string]Usage
+}
+
+func newMemStore() *memStore {
+	return &memStore{groups: map[string]Group{}, aliases: map[string]Alias{}, namespaces: map[string]Namespace{}, usage: map[string]Usage{}}
+}
+
+func (s *memStore) Groups(namespace string) []Group {
+	groups := []Group{}
+	for _, g := range s.groups {
+		if !g.Deleted && g.Namespace == namespace {
+			groups = append(groups, g)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups
+}
+
+func (s *memStore) Group(namespace string, id int) (Group, bool) {
+	g, ok := s.groups[Group{Namespace: namespace, ID: id}.Key()]
+	return g, ok && !g.Deleted
+}
+
+func (s *memStore) SetGroup(g Group) {
+	s.groups[g.Key()] = g
+}
+
+func (s *memStore) AddGroup(g Group) error {
+	if err := CheckNewGroup(s.Groups(g.Namespace), g); err != nil {
+		return err
+	}
+	s.SetGroup(g)
+	return nil
+}
+
+func (s *memStore) Aliases(namespace string) []Alias {
+	aliases := []Alias{}
+	for _, a := range s.aliases {
+		if !a.Deleted && a.Namespace == namespace {
+			aliases = append(aliases, a)
+		}
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+	return aliases
+}
+
+func (s *memStore) Alias(namespace string, name string) (Alias, bool) {
+	a, ok := s.aliases[Alias{Namespace: namespace, Name: name}.Key()]
+	return a, ok && !a.Deleted
+}
+
+func (s *memStore) SetAlias(a Alias) {
+	s.aliases[a.Key()] = a
+}
+
+func (s *memStore) CompareAndSetAlias(a Alias, from int) bool {
+	if old, ok := s.Alias(a.Namespace, a.Name); !ok || old.FeatureGroupID != from {
+		return false
+	}
+	s.SetAlias(a)
+	return true
+}
+
+func (s *memStore) Namespaces() []Namespace {
+	namespaces := []Namespace{}
+	for _, n := range s.namespaces {
+		if !n.Deleted {
+			namespaces = append(namespaces, n)
+		}
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Name < namespaces[j].Name })
+	return namespaces
+}
+
+func (s *memStore) Namespace(name string) (Namespace, bool) {
+	n, ok := s.namespaces[name]
+	return n, ok && !n.Deleted
+}
+
+func (s *memStore) SetNamespace(n Namespace) {
+	s.namespaces[n.Name] = n
+}
+
+func (s *memStore) Usage(namespace string) Usage {
+	return s.usage[namespace]
+}
+
+func newRouter(s Store) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/namespaces", NamespaceListHandler(s))
+	r.HandleFunc("/api/v1/namespaces/{namespace}", NamespaceHandler(s))
+	HandleFunc(r, "/api/v1/groups", ListHandler(s))
+	HandleFunc(r, "/api/v1/groups/{groupID}", GroupHandler(s))
+	HandleFunc(r, "/api/v1/aliases", AliasListHandler(s))
+	HandleFunc(r, "/api/v1/aliases/{alias}", AliasHandler(s))
+	r.Use(Middleware(s))
+	return r
+}
+
+func serve(r http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+	return rec
+}
+
+func testCatalog_handlers(t *testing.T) {
+	// prepare
+	s := newMemStore()
+	r := newRouter(s)
+
+	// exec
+	created := serve(r, http.MethodPost, "/api/v1/groups", `{"id": 7, "name": "products", "dtype": "float32", "noveltyThreshold": 1.5}`)
+	described := serve(r, http.MethodGet, "/api/v1/groups/7", "")
+	deleted := serve(r, http.MethodDelete, "/api/v1/groups/7", "")
+	listed := serve(r, http.MethodGet, "/api/v1/groups", "")
+
+	// assert
+	if created.Code != http.StatusCreated {
+		t.Fatalf("fail. group not created. %d %s", created.Code, created.Body.String())
+	}
+	var g Group
+	if err := json.Unmarshal(described.Body.Bytes(), &g); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if g.Name != "products" || g.Dim != Dim || g.DType != DTypeFloat32 || g.Metric != MetricL2 || *g.NoveltyThreshold != 1.5 {
+		t.Fatalf("fail. group not match. %+v", g)
+	}
+	if deleted.Code != http.StatusNoContent {
+		t.Fatalf("fail. group not deleted. %d", deleted.Code)
+	}
+	if _, err := Lookup(s, DefaultNamespace, 7); err == nil {
+		t.Fatal("fail. deleted group still found.")
+	}
+	if listed.Body.String() != `{"groups":[]}` {
+		t.Fatalf("fail. deleted group still listed. %s", listed.Body.String())
+	}
+}
+
+func testCatalog_invalid(t *testing.T) {
+	// prepare
+	s := newMemStore()
+	r := newRouter(s)
+	serve(r, http.MethodPost, "/api/v1/groups", `{"id": 1, "name": "products"}`)
+
+	for _, c := range []struct {
+		body string
+		code int
+	}{
+		{`{"id": 2}`, http.StatusUnprocessableEntity},
+		{`{"id": 2, "name": "a", "dim": 128}`, http.StatusUnprocessableEntity},
+		{`{"id": 2, "name": "a", "dtype": "int8"}`, http.StatusUnprocessableEntity},
+		{`{"id": 2, "name": "a", "metric": "cosine"}`, http.StatusUnprocessableEntity},
+		{`{"id": 2, "name": "a", "strategy": "goroutine_x"}`, http.StatusUnprocessableEntity},
+		{`{"id": 1, "name": "a"}`, http.StatusConflict},
+		{`{"id": 2, "name": "products"}`, http.StatusConflict},
+	} {
+		// exec
+		rec := serve(r, http.MethodPost, "/api/v1/groups", c.body)
+
+		// assert
+		if rec.Code != c.code {
+			t.Fatalf("fail. %s: %d expected, got %d %s", c.body, c.code, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := serve(r, http.MethodGet, "/api/v1/groups/2", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("fail. unknown group found. %d", rec.Code)
+	}
+}
+
+func testCatalog_checkVectors(t *testing.T) {
+	g := Group{ID: 1, Name: "a", DType: DTypeFloat32}
+	g.SetDefaults()
+
+	if err := g.CheckVectors(Dim, 0); err != nil {
+		t.Fatalf("fail. JSON vectors rejected. %v", err)
+	}
+	if err := g.CheckVectors(Dim, 4); err != nil {
+		t.Fatalf("fail. float32 vectors rejected. %v", err)
+	}
+	if err := g.CheckVectors(Dim, 8); err == nil {
+		t.Fatal("fail. float64 vectors accepted by a float32 group.")
+	}
+	if err := g.CheckVectors(Dim-1, 0); err == nil {
+		t.Fatal("fail. vectors of another dimension accepted.")
+	}
+}
+
+func testCatalog_alias(t *testing.T) {
+	// prepare
+	s := newMemStore()
+	r := newRouter(s)
+	serve(r, http.MethodPost, "/api/v1/groups", `{"id": 11, "name": "products-v1"}`)
+	serve(r, http.MethodPost, "/api/v1/groups", `{"id": 12, "name": "products-v2"}`)
+
+	// exec
+	created := serve(r, http.MethodPut, "/api/v1/aliases/products", `{"featureGroupID": 11}`)
+	before, _ := ResolveAlias(s, DefaultNamespace, "products")
+	swapped := serve(r, http.MethodPut, "/api/v1/aliases/products", `{"featureGroupID": 12, "from": 11}`)
+	after, _ := ResolveAlias(s, DefaultNamespace, "products")
+	listed := serve(r, http.MethodGet, "/api/v1/aliases", "")
+	deleted := serve(r, http.MethodDelete, "/api/v1/aliases/products", "")
+
+	// assert
+	if created.Code != http.StatusOK || swapped.Code != http.StatusOK {
+		t.Fatalf("fail. alias not set. %d %d %s", created.Code, swapped.Code, swapped.Body.String())
+	}
+	if before != 11 || after != 12 {
+		t.Fatalf("fail. alias not repointed. %d %d", before, after)
+	}
+	var list struct {
+		Aliases []Alias `json:"aliases"`
+	}
+	if err := json.Unmarshal(listed.Body.Bytes(), &list); err != nil || len(list.Aliases) != 1 || list.Aliases[0].FeatureGroupID != 12 {
+		t.Fatalf("fail. aliases not match. %s", listed.Body.String())
+	}
+	if deleted.Code != http.StatusNoContent {
+		t.Fatalf("fail. alias not deleted. %d", deleted.Code)
+	}
+	if _, err := ResolveAlias(s, DefaultNamespace, "products"); err == nil {
+		t.Fatal("fail. deleted alias still resolved.")
+	}
+}
+
+func testCatalog_aliasInvalid(t *testing.T) {
+	// prepare
+	s := newMemStore()
+	r := newRouter(s)
+	serve(r, http.MethodPost, "/api/v1/groups", `{"id": 11, "name": "products-v1"}`)
+	serve(r, http.MethodPost, "/api/v1/groups", `{"id": 12, "name": "products-v2"}`)
+	serve(r, http.MethodPut, "/api/v1/aliases/products", `{"featureGroupID": 11}`)
+
+	for _, c := range []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{http.MethodPut, "/api/v1/aliases/products", `{"featureGroupID": 13}`, http.StatusUnprocessableEntity},
+		{http.MethodPut, "/api/v1/aliases/_products", `{"featureGroupID": 12}`, http.StatusUnprocessableEntity},
+		{http.MethodPut, "/api/v1/aliases/products", `{"featureGroupID": 12, "from": 12}`, http.StatusConflict},
+		{http.MethodDelete, "/api/v1/groups/11", "", http.StatusConflict},
+		{http.MethodGet, "/api/v1/aliases/items", "", http.StatusNotFound},
+	} {
+		// exec
+		rec := serve(r, c.method, c.path, c.body)
+
+		// assert
+		if rec.Code != c.code {
+			t.Fatalf("fail. %s %s: %d expected, got %d %s", c.method, c.path, c.code, rec.Code, rec.Body.String())
+		}
+	}
+	if id, _ := ResolveAlias(s, DefaultNamespace, "products"); id != 11 {
+		t.Fatalf("fail. alias repointed by a rejected request. %d", id)
+	}
+}
+
+func testCatalog_namespaces(t *testing.T) {
+	// prepare
+	s := newMemStore()
+	r := newRouter(s)
+	serve(r, http.MethodPost, "/api/v1/groups", `{"id": 1, "name": "products"}`)
+
+	// exec
+	unknown := serve(r, http.MethodGet, "/api/v1/namespaces/team-a/groups", "")
+	created := serve(r, http.MethodPut, "/api/v1/namespaces/team-a", `{"quota": {"maxVectors": 1000}}`)
+	grouped := serve(r, http.MethodPost, "/api/v1/namespaces/team-a/groups", `{"id": 1, "name": "products", "dtype": "float32"}`)
+	aliased := serve(r, http.MethodPut, "/api/v1/namespaces/team-a/aliases/products", `{"featureGroupID": 1}`)
+	conflict := serve(r, http.MethodDelete, "/api/v1/namespaces/team-a", "")
+	listed := serve(r, http.MethodGet, "/api/v1/namespaces", "")
+
+	// assert
+	if unknown.Code != http.StatusNotFound {
+		t.Fatalf("fail. unknown namespace served. %d", unknown.Code)
+	}
+	if created.Code != http.StatusOK || grouped.Code != http.StatusCreated || aliased.Code != http.StatusOK {
+		t.Fatalf("fail. namespace not set up. %d %d %d", created.Code, grouped.Code, aliased.Code)
+	}
+	teamGroup, _ := Lookup(s, "team-a", 1)
+	defaultGroup, _ := Lookup(s, DefaultNamespace, 1)
+	if teamGroup.DType != DTypeFloat32 || defaultGroup.DType != DTypeFloat64 {
+		t.Fatalf("fail. groups of namespaces mixed up. %+v %+v", teamGroup, defaultGroup)
+	}
+	if _, err := ResolveAlias(s, DefaultNamespace, "products"); err == nil {
+		t.Fatal("fail. alias of another namespace resolved.")
+	}
+	if conflict.Code != http.StatusConflict {
+		t.Fatalf("fail. namespace with groups deleted. %d", conflict.Code)
+	}
+	var list struct {
+		Namespaces []Namespace `json:"namespaces"`
+	}
+	if err := json.Unmarshal(listed.Body.Bytes(), &list); err != nil || len(list.Namespaces) != 2 || list.Namespaces[0].Name != DefaultNamespace || list.Namespaces[1].Quota.MaxVectors != 1000 {
+		t.Fatalf("fail. namespaces not match. %s", listed.Body.String())
+	}
+
+	// a namespace is deleted once its groups are
+	serve(r, http.MethodDelete, "/api/v1/namespaces/team-a/aliases/products", "")
+	serve(r, http.MethodDelete, "/api/v1/namespaces/team-a/groups/1", "")
+	if rec := serve(r, http.MethodDelete, "/api/v1/namespaces/team-a", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("fail. namespace not deleted. %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(r, http.MethodGet, "/api/v1/namespaces/team-a/groups", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("fail. deleted namespace still served. %d", rec.Code)
+	}
+	if rec := serve(r, http.MethodDelete, "/api/v1/namespaces/default", ""); rec.Code != http.StatusConflict {
+		t.Fatalf("fail. default namespace deleted. %d", rec.Code)
+	}
+}
+
+func testCatalog_quota(t *testing.T) {
+	q := Quota{MaxVectors: 10, MaxMemoryBytes: 100}
+	u := Usage{Vectors: 8, MemoryBytes: 60}
+
+	if err := q.Check(u, 2, 40); err != nil {
+		t.Fatalf("fail. usage within the quota rejected. %v", err)
+	}
+	if err := q.Check(u, 3, 0); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("fail. vectors over the quota accepted. %v", err)
+	}
+	if err := q.Check(u, 0, 41); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("fail. memory over the quota accepted. %v", err)
+	}
+	if err := (Quota{}).Check(u, 1<<30, 1<<40); err != nil {
+		t.Fatalf("fail. zero quota must be no limit. %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ListHandler lists the feature groups of the namespace of the request on GET and creates one on POST.
+// Creates on the same node are checked against each other, while writes on different nodes
+// at the same time are resolved by the last update.
+func ListHandler(s Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns := NamespaceOf(r)
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, struct {
+				Groups []Group `json:"groups"`
+			}{s.Groups(ns)})
+		case http.MethodPost:
+			defer r.Body.Close()
+			var g Group
+			if err := json.NewDecoder(r.Body).Decode(&g); err != nil {
+				writeMsg(w, http.StatusUnprocessableEntity, "Failed to parse json.")
+				return
+			}
+			g.Namespace = ns
+			g.SetDefaults()
+			if err := g.Validate(); err != nil {
+				writeMsg(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			g.CreatedAt = time.Now()
+			g.UpdatedAt = g.CreatedAt
+			g.Deleted = false
+			if err := s.AddGroup(g); err != nil {
+				writeMsg(w, http.StatusConflict, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusCreated, g)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+		}
+	}
+}
+
+// GroupHandler describes the feature group of the "groupID" path variable on GET and deletes it on DELETE.
+// Bricks of a deleted group stay on the nodes, but are no longer searched nor written.
+// A group which an alias points at is not deleted.
+func GroupHandler(s Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		ns := NamespaceOf(r)
+		id, err := strconv.Atoi(mux.Vars(r)["groupID"])
+		if err != nil {
+			writeMsg(w, http.StatusUnprocessableEntity, "Invalid GroupID")
+			return
+		}
+		g, err := Lookup(s, ns, id)
+		if err != nil {
+			writeMsg(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if r.Method == http.MethodDelete {
+			for _, a := range s.Aliases(ns) {
+				if a.FeatureGroupID == id {
+					writeMsg(w, http.StatusConflict, fmt.Sprintf("Alias %q points at feature group %d", a.Name, id))
+					return
+				}
+			}
+			s.SetGroup(Group{Namespace: ns, ID: id, UpdatedAt: time.Now(), Deleted: true})
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, http.StatusOK, g)
+	}
+}
+
+// AliasListHandler lists the aliases of the namespace of the request on GET.
+func AliasListHandler(s Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Aliases []Alias `json:"aliases"`
+		}{s.Aliases(NamespaceOf(r))})
+	}
+}
+
+// AliasForm is the body of a PUT of an alias.
+type AliasForm struct {
+	FeatureGroupID int `json:"featureGroupID"`
+	// From, when given, is the group the alias must point at for it to be repointed.
+	// It keeps two switches at the same time from overwriting each other unnoticed
+	// when they go to the same node. Switches on different nodes are resolved by the last update.
+	From *int `json:"from,omitempty"`
+}
+
+// AliasHandler describes the alias of the "alias" path variable on GET, creates or repoints it on PUT
+// and deletes it on DELETE.
+func AliasHandler(s Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns := NamespaceOf(r)
+		name := mux.Vars(r)["alias"]
+		switch r.Method {
+		case http.MethodGet:
+			a, ok := s.Alias(ns, name)
+			if !ok {
+				writeMsg(w, http.StatusNotFound, fmt.Sprintf("%v (%s)", ErrUnknownAlias, name))
+				return
+			}
+			writeJSON(w, http.StatusOK, a)
+		case http.MethodPut:
+			defer r.Body.Close()
+			if err := ValidateAliasName(name); err != nil {
+				writeMsg(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			var form AliasForm
+			if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+				writeMsg(w, http.StatusUnprocessableEntity, "Failed to parse json.")
+				return
+			}
+			if _, err := Lookup(s, ns, form.FeatureGroupID); err != nil {
+				writeMsg(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			a := Alias{Namespace: ns, Name: name, FeatureGroupID: form.FeatureGroupID, UpdatedAt: time.Now()}
+			if form.From == nil {
+				s.SetAlias(a)
+			} else if !s.CompareAndSetAlias(a, *form.From) {
+				writeMsg(w, http.StatusConflict, fmt.Sprintf("Alias %q does not point at feature group %d", name, *form.From))
+				return
+			}
+			writeJSON(w, http.StatusOK, a)
+		case http.MethodDelete:
+			if _, ok := s.Alias(ns, name); !ok {
+				writeMsg(w, http.StatusNotFound, fmt.Sprintf("%v (%s)", ErrUnknownAlias, name))
+				return
+			}
+			s.SetAlias(Alias{Namespace: ns, Name: name, UpdatedAt: time.Now(), Deleted: true})
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	jsonBytes, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(jsonBytes)
+}
+
+func writeMsg(w http.ResponseWriter, code int, msg string) {
+	jsonBytes, _ := json.Marshal(struct {
+		Msg string `json:"msg"`
+	}{msg})
+	w.WriteHeader(code)
+	w.Write(jsonBytes)
+}
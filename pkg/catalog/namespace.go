@@ -0,0 +1,206 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/gorilla/mux"
+)
+
+// DefaultNamespace is the namespace of requests whose path names none. It always exists.
+const DefaultNamespace = brick.DefaultNamespace
+
+// ErrUnknownNamespace is returned for a namespace which is not in the catalog.
+var ErrUnknownNamespace = errors.New("Unknown namespace")
+
+// ErrQuotaExceeded is returned for a write which would take a namespace over its quota.
+var ErrQuotaExceeded = errors.New("Quota exceeded")
+
+// Quota limits what the feature groups of a namespace hold in the cluster. Zero values are no limit.
+type Quota struct {
+	// MaxVectors is the number of data points, each set of replicas counted once.
+	MaxVectors int `json:"maxVectors,omitempty"`
+	// MaxMemoryBytes is the memory of the bricks, replicas included.
+	MaxMemoryBytes int64 `json:"maxMemoryBytes,omitempty"`
+}
+
+// Usage is what the feature groups of a namespace hold in the cluster.
+type Usage struct {
+	Vectors     int   `json:"vectors"`
+	MemoryBytes int64 `json:"memoryBytes"`
+}
+
+// Check returns ErrQuotaExceeded unless vectors more data points and memoryBytes more memory fit
+// when the namespace uses u.
+func (q Quota) Check(u Usage, vectors int, memoryBytes int64) error {
+	if q.MaxVectors > 0 && u.Vectors+vectors > q.MaxVectors {
+		return fmt.Errorf("%w (%d of %d vectors used)", ErrQuotaExceeded, u.Vectors, q.MaxVectors)
+	}
+	if q.MaxMemoryBytes > 0 && u.MemoryBytes+memoryBytes > q.MaxMemoryBytes {
+		return fmt.Errorf("%w (%d of %d bytes used)", ErrQuotaExceeded, u.MemoryBytes, q.MaxMemoryBytes)
+	}
+	return nil
+}
+
+// Namespace isolates the feature groups, aliases and bricks of a team from those of the others.
+type Namespace struct {
+	Name      string    `json:"name"`
+	Quota     Quota     `json:"quota"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Deleted marks a tombstone, which is gossiped so that every node forgets the namespace.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Validate checks the name and the quota of the namespace.
+func (n Namespace) Validate() error {
+	if !validName.MatchString(n.Name) {
+		return fmt.Errorf("Invalid namespace (%q), letters, digits, '_', '.' and '-' are allowed", n.Name)
+	}
+	if n.Quota.MaxVectors < 0 || n.Quota.MaxMemoryBytes < 0 {
+		return errors.New("quota must not be negative")
+	}
+	return nil
+}
+
+// LookupNamespace returns the namespace of name, or ErrUnknownNamespace.
+// The default namespace is found without a quota until one is set.
+func LookupNamespace(s Store, name string) (Namespace, error) {
+	n, ok := s.Namespace(name)
+	if ok {
+		return n, nil
+	}
+	if name == DefaultNamespace {
+		return Namespace{Name: DefaultNamespace}, nil
+	}
+	return n, fmt.Errorf("%w (%s)", ErrUnknownNamespace, name)
+}
+
+// NamespaceOf returns the namespace of the "namespace" path variable, or the default namespace.
+func NamespaceOf(r *http.Request) string {
+	if ns := mux.Vars(r)["namespace"]; ns != "" {
+		return ns
+	}
+	return DefaultNamespace
+}
+
+// NamespacePath returns the path of the API under /api/v1/ for the namespace.
+// Paths of the default namespace, and those of the namespaces themselves, are left as they are.
+func NamespacePath(namespace string, path string) string {
+	if namespace == "" || namespace == DefaultNamespace || !strings.HasPrefix(path, "/api/v1/") || strings.HasPrefix(path, "/api/v1/namespaces") {
+		return path
+	}
+	return "/api/v1/namespaces/" + namespace + "/" + strings.TrimPrefix(path, "/api/v1/")
+}
+
+// HandleFunc serves the API of path for the default namespace, and under /api/v1/namespaces/{namespace}/
+// for every namespace.
+func HandleFunc(r *mux.Router, path string, f http.HandlerFunc) {
+	r.HandleFunc(path, f)
+	r.HandleFunc("/api/v1/namespaces/{namespace}/"+strings.TrimPrefix(path, "/api/v1/"), f)
+}
+
+const namespacePath = "/api/v1/namespaces/{namespace}"
+
+// Middleware answers 404 to requests for a namespace which is not in the catalog.
+func Middleware(s Store) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ns, ok := mux.Vars(r)["namespace"]
+			// the path of the namespace itself is left to NamespaceHandler, which creates it on PUT
+			if tpl, _ := mux.CurrentRoute(r).GetPathTemplate(); ok && tpl != namespacePath {
+				if _, err := LookupNamespace(s, ns); err != nil {
+					writeMsg(w, http.StatusNotFound, err.Error())
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// NamespaceListHandler lists the namespaces on GET.
+func NamespaceListHandler(s Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		namespaces := s.Namespaces()
+		if _, ok := s.Namespace(DefaultNamespace); !ok {
+			namespaces = append([]Namespace{{Name: DefaultNamespace}}, namespaces...)
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Namespaces []Namespace `json:"namespaces"`
+		}{namespaces})
+	}
+}
+
+// NamespaceForm is the body of a PUT of a namespace.
+type NamespaceForm struct {
+	Quota Quota `json:"quota"`
+}
+
+// NamespaceHandler describes the namespace of the "namespace" path variable on GET, creates it or sets
+// its quota on PUT and deletes it on DELETE. A namespace which has feature groups is not deleted.
+func NamespaceHandler(s Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := NamespaceOf(r)
+		switch r.Method {
+		case http.MethodGet:
+			n, err := LookupNamespace(s, name)
+			if err != nil {
+				writeMsg(w, http.StatusNotFound, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, n)
+		case http.MethodPut:
+			defer r.Body.Close()
+			var form NamespaceForm
+			if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+				writeMsg(w, http.StatusUnprocessableEntity, "Failed to parse json.")
+				return
+			}
+			n, err := LookupNamespace(s, name)
+			if err != nil {
+				n = Namespace{Name: name, CreatedAt: time.Now()}
+			}
+			if n.CreatedAt.IsZero() {
+				n.CreatedAt = time.Now()
+			}
+			n.Quota = form.Quota
+			n.UpdatedAt = time.Now()
+			n.Deleted = false
+			if err := n.Validate(); err != nil {
+				writeMsg(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			s.SetNamespace(n)
+			writeJSON(w, http.StatusOK, n)
+		case http.MethodDelete:
+			if name == DefaultNamespace {
+				writeMsg(w, http.StatusConflict, "The default namespace cannot be deleted")
+				return
+			}
+			if _, err := LookupNamespace(s, name); err != nil {
+				writeMsg(w, http.StatusNotFound, err.Error())
+				return
+			}
+			if groups := s.Groups(name); len(groups) > 0 {
+				writeMsg(w, http.StatusConflict, fmt.Sprintf("Namespace %q has %d feature groups", name, len(groups)))
+				return
+			}
+			s.SetNamespace(Namespace{Name: name, UpdatedAt: time.Now(), Deleted: true})
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+		}
+	}
+}
@@ -0,0 +1,629 @@
+// Package client is a Go client of feature-search-db.
+//
+// Searches and registrations go to a reverse proxy, while bricks and data points
+// are looked up on a calc node.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/api/proxy"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/cluster"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+)
+
+// FeatureDB is implemented by Client and Fake.
+type FeatureDB interface {
+	Search(ctx context.Context, req SearchRequest) (*proxy.ProxyQueryResponse, error)
+	BatchSearch(ctx context.Context, req BatchSearchRequest) (*proxy.ProxyBatchQueryResponse, error)
+	Register(ctx context.Context, req BatchSearchRequest) (*proxy.ProxyBatchQueryResponse, error)
+	Stat(ctx context.Context) (*proxy.ProxyStatResponse, error)
+	Bricks(ctx context.Context) ([]proxy.BrickInfoWithNodeInfo, error)
+	Brick(ctx context.Context, uniqueID string) (*state.BrickInfo, error)
+	DataPoints(ctx context.Context, uniqueID string, opts DataPointListOptions) (*api.DataPointListResponse, error)
+	DataPoint(ctx context.Context, uniqueID string, dataID string) (*api.DataPointResponse, error)
+}
+
+var _ FeatureDB = &Client{}
+
+// SearchOptions are the query parameters of the search endpoints of the proxy.
+// Zero values leave them to the proxy.
+type SearchOptions struct {
+	// Alias, when given, names the feature group instead of FeatureGroupID.
+	Alias            string
+	CalcMode         string
+	NoveltyThreshold *float64
+	SearchOnly       bool
+	Timeout          time.Duration
+	Zone             string
+	NodeSelector     map[string]string
+}
+
+type SearchRequest struct {
+	FeatureGroupID int
+	Vector         [512]float64
+	SearchOptions
+}
+
+type BatchSearchRequest struct {
+	FeatureGroupID int
+	Vectors        [][512]float64
+	SearchOptions
+}
+
+// APIError is a response of the server other than 2xx.
+type APIError struct {
+	StatusCode int
+	Msg        string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("feature-search-db: %d %s", e.StatusCode, e.Msg)
+}
+
+// Client talks to a proxy or a calc node over HTTP. It is safe for concurrent use,
+// and connections are reused across requests.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retries    int
+	retryWait  time.Duration
+	binary     bool
+	namespace  string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient replaces the http.Client.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithRetries retries idempotent requests up to n times, waiting wait more before each retry.
+// Requests which may register data points are never retried.
+func WithRetries(n int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.retryWait = wait
+	}
+}
+
+// WithBinaryVectors sends vectors in the binary format instead of JSON.
+func WithBinaryVectors() Option {
+	return func(c *Client) {
+		c.binary = true
+	}
+}
+
+// WithNamespace sends the requests of the API to the namespace instead of the default one.
+func WithNamespace(namespace string) Option {
+	return func(c *Client) {
+		c.namespace = namespace
+	}
+}
+
+// New returns a client of the server at baseURL such as "http://127.0.0.1:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				MaxIdleConns:        64,
+				MaxIdleConnsPerHost: 16,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		retries:   2,
+		retryWait: 100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (o SearchOptions) values(featureGroupID int) url.Values {
+	v := url.Values{}
+	if o.Alias != "" {
+		v.Set("alias", o.Alias)
+	} else {
+		v.Set("featureGroupID", strconv.Itoa(featureGroupID))
+	}
+	if o.CalcMode != "" {
+		v.Set("calcMode", o.CalcMode)
+	}
+	if o.NoveltyThreshold != nil {
+		v.Set("noveltyThreshold", strconv.FormatFloat(*o.NoveltyThreshold, 'f', -1, 64))
+	}
+	if o.SearchOnly {
+		v.Set("searchOnly", "true")
+	}
+	if o.Timeout > 0 {
+		v.Set("timeout", o.Timeout.String())
+	}
+	if o.Zone != "" {
+		v.Set("zone", o.Zone)
+	}
+	for k, val := range o.NodeSelector {
+		v.Add("nodeSelector", k+"="+val)
+	}
+	return v
+}
+
+// encodeVectors returns the body of a query and its Content-Type.
+func (c *Client) encodeVectors(vecs [][512]float64, batch bool) ([]byte, string, error) {
+	if c.binary {
+		return proxy.EncodeVectors(vecs, false), proxy.ContentTypeVectors, nil
+	}
+	var b []byte
+	var err error
+	if batch {
+		form := proxy.BatchQueryInputForm{Queries: make([]proxy.QueryInputForm, len(vecs))}
+		for i := range vecs {
+			form.Queries[i].Vals = vecs[i]
+		}
+		b, err = json.Marshal(form)
+	} else {
+		b, err = json.Marshal(proxy.QueryInputForm{Vals: vecs[0]})
+	}
+	return b, proxy.ContentTypeJSON, err
+}
+
+// Search finds the nearest data point of the vector in the cluster.
+// The vector is registered when it is new, unless SearchOnly is set.
+func (c *Client) Search(ctx context.Context, req SearchRequest) (*proxy.ProxyQueryResponse, error) {
+	body, contentType, err := c.encodeVectors([][512]float64{req.Vector}, false)
+	if err != nil {
+		return nil, err
+	}
+	var resp proxy.ProxyQueryResponse
+	path := "/api/v1/searchQuery?" + req.values(req.FeatureGroupID).Encode()
+	if err := c.do(ctx, http.MethodPost, path, body, contentType, req.SearchOnly, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// BatchSearch is Search of many vectors in one request.
+func (c *Client) BatchSearch(ctx context.Context, req BatchSearchRequest) (*proxy.ProxyBatchQueryResponse, error) {
+	body, contentType, err := c.encodeVectors(req.Vectors, true)
+	if err != nil {
+		return nil, err
+	}
+	var resp proxy.ProxyBatchQueryResponse
+	path := "/api/v1/batchSearchQuery?" + req.values(req.FeatureGroupID).Encode()
+	if err := c.do(ctx, http.MethodPost, path, body, contentType, req.SearchOnly, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Register adds the vectors as new data points without searching.
+func (c *Client) Register(ctx context.Context, req BatchSearchRequest) (*proxy.ProxyBatchQueryResponse, error) {
+	body, contentType, err := c.encodeVectors(req.Vectors, true)
+	if err != nil {
+		return nil, err
+	}
+	v := req.values(req.FeatureGroupID)
+	v.Set("onlyRegister", "true")
+	var resp proxy.ProxyBatchQueryResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/batchSearchQuery?"+v.Encode(), body, contentType, false, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Stat reports the health of the cluster from the proxy.
+// The feature groups are those of the namespace of the client, along with its usage and quota.
+func (c *Client) Stat(ctx context.Context) (*proxy.ProxyStatResponse, error) {
+	path := "/stat"
+	if c.namespace != "" {
+		path = "/api/v1/stat"
+	}
+	var resp proxy.ProxyStatResponse
+	if err := c.do(ctx, http.MethodGet, path, nil, "", true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Bricks lists the bricks of a calc node, or of the cluster on the proxy.
+// Node fields are empty in the answer of a calc node.
+func (c *Client) Bricks(ctx context.Context) ([]proxy.BrickInfoWithNodeInfo, error) {
+	var resp []proxy.BrickInfoWithNodeInfo
+	if err := c.do(ctx, http.MethodGet, "/api/v1/bricks", nil, "", true, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Brick returns a brick of a calc node.
+func (c *Client) Brick(ctx context.Context, uniqueID string) (*state.BrickInfo, error) {
+	var resp state.BrickInfo
+	if err := c.do(ctx, http.MethodGet, "/api/v1/bricks/"+url.PathEscape(uniqueID), nil, "", true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Groups lists the feature groups of the catalog.
+func (c *Client) Groups(ctx context.Context) ([]catalog.Group, error) {
+	var resp struct {
+		Groups []catalog.Group `json:"groups"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/groups", nil, "", true, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Groups, nil
+}
+
+// Group describes a feature group of the catalog.
+func (c *Client) Group(ctx context.Context, featureGroupID int) (*catalog.Group, error) {
+	var resp catalog.Group
+	if err := c.do(ctx, http.MethodGet, "/api/v1/groups/"+strconv.Itoa(featureGroupID), nil, "", true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateGroup adds a feature group to the catalog. Fields left out are given their defaults.
+func (c *Client) CreateGroup(ctx context.Context, g catalog.Group) (*catalog.Group, error) {
+	body, err := json.Marshal(g)
+	if err != nil {
+		return nil, err
+	}
+	var resp catalog.Group
+	if err := c.do(ctx, http.MethodPost, "/api/v1/groups", body, "application/json", false, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteGroup removes a feature group from the catalog. Its bricks are no longer searched nor written.
+func (c *Client) DeleteGroup(ctx context.Context, featureGroupID int) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/groups/"+strconv.Itoa(featureGroupID), nil, "", false, nil)
+}
+
+// Aliases lists the aliases of the catalog.
+func (c *Client) Aliases(ctx context.Context) ([]catalog.Alias, error) {
+	var resp struct {
+		Aliases []catalog.Alias `json:"aliases"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/aliases", nil, "", true, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Aliases, nil
+}
+
+// SetAlias points the alias of name at a feature group, creating it if needed.
+// With from, the alias is repointed only if it points at that group.
+func (c *Client) SetAlias(ctx context.Context, name string, featureGroupID int, from *int) (*catalog.Alias, error) {
+	body, err := json.Marshal(catalog.AliasForm{FeatureGroupID: featureGroupID, From: from})
+	if err != nil {
+		return nil, err
+	}
+	var resp catalog.Alias
+	if err := c.do(ctx, http.MethodPut, "/api/v1/aliases/"+url.PathEscape(name), body, "application/json", false, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteAlias removes an alias from the catalog. The feature group it points at is kept.
+func (c *Client) DeleteAlias(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/aliases/"+url.PathEscape(name), nil, "", false, nil)
+}
+
+// Namespaces lists the namespaces of the catalog.
+func (c *Client) Namespaces(ctx context.Context) ([]catalog.Namespace, error) {
+	var resp struct {
+		Namespaces []catalog.Namespace `json:"namespaces"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/namespaces", nil, "", true, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Namespaces, nil
+}
+
+// SetNamespace creates the namespace of name, or sets its quota.
+func (c *Client) SetNamespace(ctx context.Context, name string, quota catalog.Quota) (*catalog.Namespace, error) {
+	body, err := json.Marshal(catalog.NamespaceForm{Quota: quota})
+	if err != nil {
+		return nil, err
+	}
+	var resp catalog.Namespace
+	if err := c.do(ctx, http.MethodPut, "/api/v1/namespaces/"+url.PathEscape(name), body, "application/json", true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteNamespace deletes the namespace of name, which must have no feature groups left.
+func (c *Client) DeleteNamespace(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/namespaces/"+url.PathEscape(name), nil, "", false, nil)
+}
+
+// DataPointListOptions select a page of the data points of a brick. Zero values leave them to the node.
+type DataPointListOptions struct {
+	// Order is "insertion" (the default) or "createdAt".
+	Order string
+	// Cursor is NextCursor of the previous page.
+	Cursor string
+	Limit  int
+	// From is inclusive and To is exclusive.
+	From        time.Time
+	To          time.Time
+	WithVectors bool
+}
+
+func (o DataPointListOptions) values() url.Values {
+	// The order is always sent, since a calc node lists every data point without paging parameters.
+	v := url.Values{}
+	v.Set("order", "insertion")
+	if o.Order != "" {
+		v.Set("order", o.Order)
+	}
+	if o.Cursor != "" {
+		v.Set("cursor", o.Cursor)
+	}
+	if o.Limit > 0 {
+		v.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if !o.From.IsZero() {
+		v.Set("from", o.From.Format(time.RFC3339Nano))
+	}
+	if !o.To.IsZero() {
+		v.Set("to", o.To.Format(time.RFC3339Nano))
+	}
+	if o.WithVectors {
+		v.Set("vectors", "true")
+	}
+	return v
+}
+
+// DataPoints lists a page of the data points of a brick on a calc node.
+// The next page is read by passing NextCursor as Cursor until it is empty.
+func (c *Client) DataPoints(ctx context.Context, uniqueID string, opts DataPointListOptions) (*api.DataPointListResponse, error) {
+	var resp api.DataPointListResponse
+	path := "/api/v1/bricks/" + url.PathEscape(uniqueID) + "/datapoints?" + opts.values().Encode()
+	if err := c.do(ctx, http.MethodGet, path, nil, "", true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DataPoint returns a data point of a brick on a calc node with its vector.
+func (c *Client) DataPoint(ctx context.Context, uniqueID string, dataID string) (*api.DataPointResponse, error) {
+	var resp api.DataPointResponse
+	path := "/api/v1/bricks/" + url.PathEscape(uniqueID) + "/datapoints/" + url.PathEscape(dataID)
+	if err := c.do(ctx, http.MethodGet, path, nil, "", true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ImportRequest is a bulk import into a feature group of a calc node.
+type ImportRequest struct {
+	FeatureGroupID int
+	// Format is one of the vecio formats. It is guessed from Path when empty.
+	Format string
+	// Path is a file on the calc node. The body is imported when it is empty.
+	Path string
+	Body []byte
+	// Checkpoint is a file on the calc node to resume an import of Path from.
+	Checkpoint string
+	// Skip is the number of records at the head of the source to skip.
+	Skip      int
+	BatchSize int
+}
+
+func (req ImportRequest) values() url.Values {
+	v := url.Values{}
+	v.Set("featureGroupID", strconv.Itoa(req.FeatureGroupID))
+	if req.Format != "" {
+		v.Set("format", req.Format)
+	}
+	if req.Path != "" {
+		v.Set("path", req.Path)
+	}
+	if req.Checkpoint != "" {
+		v.Set("checkpoint", req.Checkpoint)
+	}
+	if req.Skip > 0 {
+		v.Set("skip", strconv.Itoa(req.Skip))
+	}
+	if req.BatchSize > 0 {
+		v.Set("batchSize", strconv.Itoa(req.BatchSize))
+	}
+	return v
+}
+
+// Import inserts records into bricks of a calc node without searching.
+// Imports of Body return when they are done, and imports of Path return at once with a running job.
+// The job is returned also on errors when the node has started it, and records up to its Offset are in.
+func (c *Client) Import(ctx context.Context, req ImportRequest) (*api.ImportJobResponse, error) {
+	var resp api.ImportJobResponse
+	err := c.do(ctx, http.MethodPost, "/api/v1/jobs/import?"+req.values().Encode(), req.Body, "application/octet-stream", false, &resp)
+	if err != nil && resp.JobID == "" {
+		return nil, err
+	}
+	return &resp, err
+}
+
+// ImportJob returns an import job of a calc node.
+func (c *Client) ImportJob(ctx context.Context, jobID string) (*api.ImportJobResponse, error) {
+	var resp api.ImportJobResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/jobs/"+url.PathEscape(jobID), nil, "", true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CancelImportJob stops an import job of a calc node. Records imported so far are kept.
+func (c *Client) CancelImportJob(ctx context.Context, jobID string) (*api.ImportJobResponse, error) {
+	var resp api.ImportJobResponse
+	if err := c.do(ctx, http.MethodDelete, "/api/v1/jobs/"+url.PathEscape(jobID), nil, "", false, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Drain asks a calc node to move its bricks to the other nodes and shut down.
+// The client must be of the state API of the node.
+func (c *Client) Drain(ctx context.Context) (*cluster.DrainResponse, error) {
+	var resp cluster.DrainResponse
+	if err := c.do(ctx, http.MethodPost, "/drain", nil, "", false, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ExportRequest selects the data points to export.
+// Every feature group is exported when FeatureGroupID is nil, and UniqueIDs narrow it down to bricks of a calc node.
+type ExportRequest struct {
+	FeatureGroupID *int
+	UniqueIDs      []string
+	WithoutVectors bool
+}
+
+// ExportReader reads the data points of an export one by one as the server sends them.
+type ExportReader struct {
+	body io.ReadCloser
+	dec  *json.Decoder
+}
+
+// Next returns the next data point, or io.EOF at the end of the export.
+// An export which the server could not finish ends with an error.
+func (er *ExportReader) Next() (api.ExportedDataPoint, error) {
+	var dp api.ExportedDataPoint
+	if err := er.dec.Decode(&dp); err != nil {
+		return dp, err
+	}
+	if dp.Error != "" {
+		return dp, fmt.Errorf("export of brick %s failed: %s", dp.UniqueID, dp.Error)
+	}
+	return dp, nil
+}
+
+func (er *ExportReader) Close() error {
+	return er.body.Close()
+}
+
+// Export streams data points of the proxy, or of a calc node. The reader must be closed.
+func (c *Client) Export(ctx context.Context, req ExportRequest) (*ExportReader, error) {
+	v := url.Values{}
+	if req.FeatureGroupID != nil {
+		v.Set("featureGroupID", strconv.Itoa(*req.FeatureGroupID))
+	}
+	for _, uniqueID := range req.UniqueIDs {
+		v.Add("uniqueID", uniqueID)
+	}
+	if req.WithoutVectors {
+		v.Set("vectors", "false")
+	}
+	httpReq, err := http.NewRequest(http.MethodGet, c.baseURL+catalog.NamespacePath(c.namespace, "/api/v1/export?"+v.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, apiErrorOf(resp.StatusCode, b)
+	}
+	return &ExportReader{body: resp.Body, dec: json.NewDecoder(resp.Body)}, nil
+}
+
+// do sends a request and decodes its JSON response into out.
+// Idempotent requests are retried on network errors and 502, 503 and 504.
+func (c *Client) do(ctx context.Context, method string, path string, body []byte, contentType string, idempotent bool, out interface{}) error {
+	retries := 0
+	if idempotent {
+		retries = c.retries
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retryable bool
+		retryable, err = c.doOnce(ctx, method, path, body, contentType, out)
+		if err == nil || !retryable || attempt >= retries {
+			return err
+		}
+		select {
+		case <-time.After(c.retryWait * time.Duration(attempt+1)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *Client) doOnce(ctx context.Context, method string, path string, body []byte, contentType string, out interface{}) (bool, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.baseURL+catalog.NamespacePath(c.namespace, path), r)
+	if err != nil {
+		return false, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return true, err
+	}
+	// The body is read to the end so that the connection is reused.
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return true, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := apiErrorOf(resp.StatusCode, b)
+		// Some errors carry a body like the one of success, such as the progress of a failed import.
+		json.Unmarshal(b, out)
+		switch resp.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true, apiErr
+		}
+		return false, apiErr
+	}
+	if out == nil {
+		return false, nil
+	}
+	return false, json.Unmarshal(b, out)
+}
+
+func apiErrorOf(statusCode int, b []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode}
+	var msg struct {
+		Msg string `json:"msg"`
+	}
+	if json.Unmarshal(b, &msg) == nil && msg.Msg != "" {
+		apiErr.Msg = msg.Msg
+	} else {
+		apiErr.Msg = strings.TrimSpace(string(b))
+	}
+	return apiErr
+}
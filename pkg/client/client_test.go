@@ -0,0 +1,239 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api/proxy"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+)
+
+func TestClient(t *testing.T) {
+	t.Run("it decodes a search response successfully", testClient_search)
+	t.Run("it retries idempotent requests successfully", testClient_retry)
+	t.Run("it does not retry registration", testClient_noRetryRegister)
+	t.Run("it returns the message of an error response", testClient_apiError)
+	t.Run("it sends requests to its namespace successfully", testClient_namespace)
+}
+
+func TestFake(t *testing.T) {
+	t.Run("it registers new vectors successfully", testFake_register)
+	t.Run("it does not register with searchOnly", testFake_searchOnly)
+	t.Run("it resolves an alias successfully", testFake_alias)
+}
+
+func testClient_search(t *testing.T) {
+	// prepare
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/searchQuery" || r.URL.Query().Get("featureGroupID") != "3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var form proxy.QueryInputForm
+		if err := json.NewDecoder(r.Body).Decode(&form); err != nil || form.Vals[1] != 1.5 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		json.NewEncoder(w).Encode(proxy.ProxyQueryResponse{Result: proxy.ProxyQueryResult{DataID: "abc", Distance: 2}})
+	}))
+	defer srv.Close()
+	c := New(srv.URL)
+	var vec [512]float64
+	vec[1] = 1.5
+
+	// exec
+	resp, err := c.Search(context.Background(), SearchRequest{FeatureGroupID: 3, Vector: vec})
+
+	// assert
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if resp.Result.DataID != "abc" || resp.Result.Distance != 2 {
+		t.Fatalf("fail. result not match. %+v", resp.Result)
+	}
+}
+
+func testClient_namespace(t *testing.T) {
+	// prepare
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	c := New(srv.URL, WithNamespace("team-a"))
+
+	// exec
+	c.Groups(context.Background())
+	c.Stat(context.Background())
+	c.SetNamespace(context.Background(), "team-a", catalog.Quota{MaxVectors: 10})
+
+	// assert
+	expected := []string{"/api/v1/namespaces/team-a/groups", "/api/v1/namespaces/team-a/stat", "/api/v1/namespaces/team-a"}
+	if len(paths) != len(expected) {
+		t.Fatalf("fail. paths not match. %v", paths)
+	}
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Fatalf("fail. paths not match. %v", paths)
+		}
+	}
+}
+
+func testClient_retry(t *testing.T) {
+	// prepare
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+	c := New(srv.URL, WithRetries(2, time.Millisecond))
+
+	// exec
+	bricks, err := c.Bricks(context.Background())
+
+	// assert
+	if err != nil || len(bricks) != 0 {
+		t.Fatalf("fail. %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("fail. number of calls not match. %d", calls)
+	}
+}
+
+func testClient_noRetryRegister(t *testing.T) {
+	// prepare
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	c := New(srv.URL, WithRetries(2, time.Millisecond))
+
+	// exec
+	_, err := c.Register(context.Background(), BatchSearchRequest{FeatureGroupID: 0, Vectors: make([][512]float64, 2)})
+
+	// assert
+	if err == nil {
+		t.Fatalf("fail. error is expected")
+	}
+	if calls != 1 {
+		t.Fatalf("fail. number of calls not match. %d", calls)
+	}
+}
+
+func testClient_apiError(t *testing.T) {
+	// prepare
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"msg":"Not Found target brick."}`))
+	}))
+	defer srv.Close()
+	c := New(srv.URL)
+
+	// exec
+	_, err := c.Brick(context.Background(), "x")
+
+	// assert
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("fail. APIError is expected. %v", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Msg != "Not Found target brick." {
+		t.Fatalf("fail. error not match. %+v", apiErr)
+	}
+}
+
+func testFake_register(t *testing.T) {
+	// prepare
+	f := NewFake()
+	ctx := context.Background()
+	var a, b [512]float64
+	b[0] = 1000
+
+	// exec
+	first, _ := f.Search(ctx, SearchRequest{FeatureGroupID: 0, Vector: a})
+	reg, err := f.Register(ctx, BatchSearchRequest{FeatureGroupID: 0, Vectors: [][512]float64{a}})
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	near, _ := f.Search(ctx, SearchRequest{FeatureGroupID: 0, Vector: a})
+	far, _ := f.Search(ctx, SearchRequest{FeatureGroupID: 0, Vector: b})
+
+	// assert
+	if first.Result.DataID != "" || first.Result.Registered {
+		t.Fatalf("fail. empty brick must not answer. %+v", first.Result)
+	}
+	if near.Result.DataID != reg.Results[0].DataID || near.Result.IsNew {
+		t.Fatalf("fail. nearest point not match. %+v", near.Result)
+	}
+	if !far.Result.IsNew || !far.Result.Registered {
+		t.Fatalf("fail. new vector must be registered. %+v", far.Result)
+	}
+	bricks, _ := f.Bricks(ctx)
+	if len(bricks) != 1 || bricks[0].NumOfAvailablePoints != 2 {
+		t.Fatalf("fail. bricks not match. %+v", bricks)
+	}
+	dp, err := f.DataPoint(ctx, bricks[0].UniqueID, far.Result.DataID)
+	if err != nil || dp.PosVector[0] != 1000 {
+		t.Fatalf("fail. data point not match. %v", err)
+	}
+}
+
+func testFake_searchOnly(t *testing.T) {
+	// prepare
+	f := NewFake()
+	ctx := context.Background()
+	var a, b [512]float64
+	b[0] = 1000
+	f.Register(ctx, BatchSearchRequest{FeatureGroupID: 0, Vectors: [][512]float64{a}})
+
+	// exec
+	resp, err := f.BatchSearch(ctx, BatchSearchRequest{
+		FeatureGroupID: 0,
+		Vectors:        [][512]float64{a, b},
+		SearchOptions:  SearchOptions{SearchOnly: true},
+	})
+
+	// assert
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if resp.Results[0].IsNew || !resp.Results[1].IsNew || resp.Results[1].Registered {
+		t.Fatalf("fail. results not match. %+v", resp.Results)
+	}
+}
+
+func testFake_alias(t *testing.T) {
+	// prepare
+	f := NewFake()
+	ctx := context.Background()
+	var a [512]float64
+	f.Register(ctx, BatchSearchRequest{FeatureGroupID: 12, Vectors: [][512]float64{a}})
+	f.Aliases["products"] = 12
+
+	// exec
+	resp, err := f.Search(ctx, SearchRequest{Vector: a, SearchOptions: SearchOptions{Alias: "products", SearchOnly: true}})
+	_, unknownErr := f.Search(ctx, SearchRequest{Vector: a, SearchOptions: SearchOptions{Alias: "items"}})
+
+	// assert
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if resp.Result.DataID == "" || resp.Result.Distance != 0 || resp.Bricks[0].FeatureGroupID != 12 {
+		t.Fatalf("fail. group of the alias not searched. %+v", resp)
+	}
+	if apiErr, ok := unknownErr.(*APIError); !ok || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("fail. unknown alias not rejected. %v", unknownErr)
+	}
+}
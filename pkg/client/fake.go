@@ -0,0 +1,376 @@
+package client
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/api"
+	"github.com/abeja-inc/feature-search-db/pkg/api/proxy"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+
+	"github.com/rs/xid"
+)
+
+// Fake is an in-memory FeatureDB for unit tests.
+// It behaves like a cluster of one node which has one brick per feature group.
+type Fake struct {
+	// NoveltyThreshold is used when a request does not give one.
+	NoveltyThreshold float64
+	// Capacity is the number of data points of each brick.
+	Capacity int
+	// Aliases resolve SearchOptions.Alias to feature groups.
+	Aliases map[string]int
+
+	mtx    sync.Mutex
+	bricks map[int]*fakeBrick
+}
+
+var _ FeatureDB = &Fake{}
+
+type fakeBrick struct {
+	info   state.BrickInfo
+	points []api.DataPointResponse
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		NoveltyThreshold: 100.0,
+		Capacity:         100000,
+		Aliases:          map[string]int{},
+		bricks:           map[int]*fakeBrick{},
+	}
+}
+
+func (f *Fake) brickOf(featureGroupID int) *fakeBrick {
+	fb, ok := f.bricks[featureGroupID]
+	if !ok {
+		fb = &fakeBrick{
+			info: state.BrickInfo{
+				UniqueID:           xid.New().String(),
+				BrickID:            xid.New().String(),
+				FeatureGroupID:     featureGroupID,
+				NumOfBrickTotalCap: f.Capacity,
+			},
+		}
+		f.bricks[featureGroupID] = fb
+	}
+	return fb
+}
+
+func (f *Fake) findBrick(uniqueID string) *fakeBrick {
+	for _, fb := range f.bricks {
+		if fb.info.UniqueID == uniqueID {
+			return fb
+		}
+	}
+	return nil
+}
+
+func (fb *fakeBrick) nearest(vec [512]float64) (string, float64, bool) {
+	var dataID string
+	var minDistance float64
+	for i, p := range fb.points {
+		var acc float64
+		for j := range vec {
+			acc += (p.PosVector[j] - vec[j]) * (p.PosVector[j] - vec[j])
+		}
+		distance := math.Sqrt(acc)
+		if i == 0 || distance < minDistance {
+			dataID = p.DataID
+			minDistance = distance
+		}
+	}
+	return dataID, minDistance, len(fb.points) > 0
+}
+
+func (fb *fakeBrick) add(vecs [][512]float64) ([]string, error) {
+	if len(fb.points)+len(vecs) > fb.info.NumOfBrickTotalCap {
+		return nil, &APIError{StatusCode: http.StatusServiceUnavailable, Msg: "This Pool does not have enough room."}
+	}
+	dataIDs := make([]string, 0, len(vecs))
+	for _, vec := range vecs {
+		v := vec
+		dp := api.DataPointResponse{
+			DataID:    xid.New().String(),
+			Available: true,
+			PosVector: v[:],
+			CreatedAt: time.Now(),
+		}
+		fb.points = append(fb.points, dp)
+		dataIDs = append(dataIDs, dp.DataID)
+	}
+	fb.info.NumOfAvailablePoints = len(fb.points)
+	return dataIDs, nil
+}
+
+// groupOf returns the feature group of a request, which o may name by its alias.
+func (f *Fake) groupOf(featureGroupID int, o SearchOptions) (int, error) {
+	if o.Alias == "" {
+		return featureGroupID, nil
+	}
+	id, ok := f.Aliases[o.Alias]
+	if !ok {
+		return 0, &APIError{StatusCode: http.StatusNotFound, Msg: "Unknown alias (" + o.Alias + ")"}
+	}
+	return id, nil
+}
+
+func (f *Fake) threshold(o SearchOptions) float64 {
+	if o.NoveltyThreshold != nil {
+		return *o.NoveltyThreshold
+	}
+	return f.NoveltyThreshold
+}
+
+// search runs the queries as the proxy does. Queries of a batch are not compared with each other.
+func (f *Fake) search(featureGroupID int, vecs [][512]float64, o SearchOptions) ([]proxy.ProxyQueryResult, error) {
+	fb := f.brickOf(featureGroupID)
+	threshold := f.threshold(o)
+	results := make([]proxy.ProxyQueryResult, len(vecs))
+	newQueries := []int{}
+	for i, vec := range vecs {
+		dataID, distance, found := fb.nearest(vec)
+		results[i] = proxy.ProxyQueryResult{
+			DataID:           dataID,
+			Distance:         distance,
+			IsNew:            found && distance > threshold,
+			NoveltyThreshold: threshold,
+		}
+		if results[i].IsNew && !o.SearchOnly {
+			newQueries = append(newQueries, i)
+		}
+	}
+	if len(newQueries) == 0 {
+		return results, nil
+	}
+	newVecs := make([][512]float64, 0, len(newQueries))
+	for _, i := range newQueries {
+		newVecs = append(newVecs, vecs[i])
+	}
+	dataIDs, err := fb.add(newVecs)
+	if err != nil {
+		// The proxy answers without registering when no brick has room.
+		return results, nil
+	}
+	for j, i := range newQueries {
+		results[i].DataID = dataIDs[j]
+		results[i].Distance = -1
+		results[i].Registered = true
+	}
+	return results, nil
+}
+
+func (f *Fake) Search(ctx context.Context, req SearchRequest) (*proxy.ProxyQueryResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	featureGroupID, err := f.groupOf(req.FeatureGroupID, req.SearchOptions)
+	if err != nil {
+		return nil, err
+	}
+	results, err := f.search(featureGroupID, [][512]float64{req.Vector}, req.SearchOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &proxy.ProxyQueryResponse{
+		Bricks:           f.bricksWithNode(featureGroupID),
+		NodeResponses:    []proxy.NodeQueryResponse{},
+		BrickResponses:   map[string]proxy.BrickQueryResponse{},
+		Result:           results[0],
+		UnansweredBricks: []string{},
+	}, nil
+}
+
+func (f *Fake) BatchSearch(ctx context.Context, req BatchSearchRequest) (*proxy.ProxyBatchQueryResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	featureGroupID, err := f.groupOf(req.FeatureGroupID, req.SearchOptions)
+	if err != nil {
+		return nil, err
+	}
+	results, err := f.search(featureGroupID, req.Vectors, req.SearchOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &proxy.ProxyBatchQueryResponse{
+		Bricks:           f.bricksWithNode(featureGroupID),
+		NodeResponses:    []proxy.NodeQueryResponse{},
+		Results:          results,
+		UnansweredBricks: []string{},
+	}, nil
+}
+
+func (f *Fake) Register(ctx context.Context, req BatchSearchRequest) (*proxy.ProxyBatchQueryResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	featureGroupID, err := f.groupOf(req.FeatureGroupID, req.SearchOptions)
+	if err != nil {
+		return nil, err
+	}
+	dataIDs, err := f.brickOf(featureGroupID).add(req.Vectors)
+	if err != nil {
+		return nil, err
+	}
+	threshold := f.threshold(req.SearchOptions)
+	results := make([]proxy.ProxyQueryResult, len(dataIDs))
+	for i, dataID := range dataIDs {
+		results[i] = proxy.ProxyQueryResult{
+			DataID:           dataID,
+			Distance:         -1,
+			Registered:       true,
+			NoveltyThreshold: threshold,
+		}
+	}
+	return &proxy.ProxyBatchQueryResponse{
+		Bricks:           f.bricksWithNode(featureGroupID),
+		NodeResponses:    []proxy.NodeQueryResponse{},
+		Results:          results,
+		UnansweredBricks: []string{},
+	}, nil
+}
+
+func (f *Fake) bricksWithNode(featureGroupID int) []proxy.BrickInfoWithNodeInfo {
+	bricks := []proxy.BrickInfoWithNodeInfo{}
+	for _, b := range f.bricksLocked() {
+		if featureGroupID < 0 || b.FeatureGroupID == featureGroupID {
+			bricks = append(bricks, proxy.BrickInfoWithNodeInfo{
+				BrickInfo: b,
+				NodeName:  "fake",
+				NodeMeta:  state.NodeMeta{Labels: map[string]string{}, CapacityWeight: state.DefaultCapacityWeight},
+			})
+		}
+	}
+	return bricks
+}
+
+func (f *Fake) bricksLocked() []state.BrickInfo {
+	bricks := make([]state.BrickInfo, 0, len(f.bricks))
+	for _, fb := range f.bricks {
+		bricks = append(bricks, fb.info)
+	}
+	sort.Slice(bricks, func(i, j int) bool {
+		return bricks[i].FeatureGroupID < bricks[j].FeatureGroupID
+	})
+	return bricks
+}
+
+func (f *Fake) Stat(ctx context.Context) (*proxy.ProxyStatResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	resp := &proxy.ProxyStatResponse{
+		Bricks:            f.bricksWithNode(-1),
+		Response:          map[string]proxy.NodeStatResponse{},
+		FeatureGroups:     []proxy.FeatureGroupStat{},
+		NumOfNodes:        1,
+		NumOfHealthyNodes: 1,
+	}
+	node := proxy.NodeStatResponse{NodeName: "fake", Success: true, Bricks: []proxy.BrickStat{}}
+	for _, b := range f.bricksLocked() {
+		ratio := float64(b.NumOfAvailablePoints) / float64(b.NumOfBrickTotalCap)
+		node.Bricks = append(node.Bricks, proxy.BrickStat{BrickInfo: b, FillRatio: ratio})
+		node.NumOfBrickTotalCap += b.NumOfBrickTotalCap
+		node.NumOfAvailablePoints += b.NumOfAvailablePoints
+		resp.FeatureGroups = append(resp.FeatureGroups, proxy.FeatureGroupStat{
+			FeatureGroupID:       b.FeatureGroupID,
+			NumOfBricks:          1,
+			NumOfNodes:           1,
+			NumOfBrickTotalCap:   b.NumOfBrickTotalCap,
+			NumOfAvailablePoints: b.NumOfAvailablePoints,
+			FillRatio:            ratio,
+		})
+	}
+	if node.NumOfBrickTotalCap > 0 {
+		node.FillRatio = float64(node.NumOfAvailablePoints) / float64(node.NumOfBrickTotalCap)
+	}
+	resp.Response[node.NodeName] = node
+	return resp, nil
+}
+
+func (f *Fake) Bricks(ctx context.Context) ([]proxy.BrickInfoWithNodeInfo, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.bricksWithNode(-1), nil
+}
+
+func (f *Fake) Brick(ctx context.Context, uniqueID string) (*state.BrickInfo, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	fb := f.findBrick(uniqueID)
+	if fb == nil {
+		return nil, &APIError{StatusCode: http.StatusNotFound, Msg: "Not Found target brick."}
+	}
+	info := fb.info
+	return &info, nil
+}
+
+// DataPoints pages through the data points like a calc node, with the index of the next one as the cursor.
+func (f *Fake) DataPoints(ctx context.Context, uniqueID string, opts DataPointListOptions) (*api.DataPointListResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	fb := f.findBrick(uniqueID)
+	if fb == nil {
+		return nil, &APIError{StatusCode: http.StatusNotFound, Msg: "Not Found target brick."}
+	}
+	points := make([]api.DataPointResponse, 0, len(fb.points))
+	for _, p := range fb.points {
+		if (!opts.From.IsZero() && p.CreatedAt.Before(opts.From)) || (!opts.To.IsZero() && !p.CreatedAt.Before(opts.To)) {
+			continue
+		}
+		points = append(points, p)
+	}
+	switch opts.Order {
+	case "", "insertion":
+	case "createdAt":
+		sort.SliceStable(points, func(i, j int) bool {
+			return points[i].CreatedAt.Before(points[j].CreatedAt)
+		})
+	default:
+		return nil, &APIError{StatusCode: http.StatusUnprocessableEntity, Msg: "Invalid order"}
+	}
+	start := 0
+	if opts.Cursor != "" {
+		var err error
+		if start, err = strconv.Atoi(opts.Cursor); err != nil || start < 0 || start > len(points) {
+			return nil, &APIError{StatusCode: http.StatusUnprocessableEntity, Msg: "Invalid cursor"}
+		}
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+	resp := &api.DataPointListResponse{DataPoints: []api.DataPointListItem{}}
+	end := start + limit
+	if end < len(points) {
+		resp.NextCursor = strconv.Itoa(end)
+	} else {
+		end = len(points)
+	}
+	for _, p := range points[start:end] {
+		item := api.DataPointListItem{DataID: p.DataID, Hash: p.Hash, CreatedAt: p.CreatedAt}
+		if opts.WithVectors {
+			item.PosVector = append([]float64{}, p.PosVector...)
+		}
+		resp.DataPoints = append(resp.DataPoints, item)
+	}
+	return resp, nil
+}
+
+func (f *Fake) DataPoint(ctx context.Context, uniqueID string, dataID string) (*api.DataPointResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	fb := f.findBrick(uniqueID)
+	if fb == nil {
+		return nil, &APIError{StatusCode: http.StatusNotFound, Msg: "Not Brick found."}
+	}
+	for _, p := range fb.points {
+		if p.DataID == dataID {
+			dp := p
+			return &dp, nil
+		}
+	}
+	return nil, &APIError{StatusCode: http.StatusNotFound, Msg: "No DataPoint found."}
+}
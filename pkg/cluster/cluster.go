@@ -1,25 +1,35 @@
 package cluster
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/config"
 	"github.com/abeja-inc/feature-search-db/pkg/state"
 
 	"github.com/weaveworks/mesh"
+	"go.uber.org/zap"
 )
 
 type ClusterPeers map[string]struct{}
 
+// GroupThresholds holds novelty thresholds per feature group.
+type GroupThresholds map[int]float64
+
 type ClusterConfigInfo struct {
 	SizeOfInitBrick      *int
 	IpAddress            *string
@@ -27,81 +37,213 @@ type ClusterConfigInfo struct {
 	NodeRole             *string
 	stateApiHttpListen   *string
 	meshListen           *string
+	meshConnLimit        *int
 	hwaddr               *string
 	nickname             *string
 	password             *string
 	channel              *string
-	SearchStrategy       *string
+	GrpcListen           *string
+	StreamOrigins        []string
+	HeartbeatInterval    *time.Duration
+	ImportDir            *string
 	Peers                ClusterPeers
+	// runtime holds the *Runtime, which is replaced when the configuration is reloaded.
+	runtime *atomic.Value
+}
+
+// Runtime is the part of the configuration which can be reloaded while the node runs.
+// It is replaced as a whole, so a request sees either the old or the new settings and never a mix.
+type Runtime struct {
+	SearchStrategy     string
+	GroupStrategies    map[int]string
+	NoveltyThreshold   float64
+	NoveltyThresholds  GroupThresholds
+	NodeTimeout        time.Duration
+	NodeRetries        int
+	SlowQueryThreshold time.Duration
+}
+
+// NewRuntime takes the reloadable settings out of cfg.
+func NewRuntime(cfg *config.Config) *Runtime {
+	rt := &Runtime{
+		SearchStrategy:     cfg.Search.Strategy,
+		GroupStrategies:    map[int]string{},
+		NoveltyThreshold:   cfg.Search.NoveltyThreshold,
+		NoveltyThresholds:  GroupThresholds{},
+		NodeTimeout:        time.Duration(cfg.Search.NodeTimeout),
+		NodeRetries:        cfg.Search.NodeRetries,
+		SlowQueryThreshold: time.Duration(cfg.Search.SlowQueryThreshold),
+	}
+	for _, g := range cfg.FeatureGroups {
+		if g.NoveltyThreshold != nil {
+			rt.NoveltyThresholds[g.ID] = *g.NoveltyThreshold
+		}
+		if g.Strategy != "" {
+			rt.GroupStrategies[g.ID] = g.Strategy
+		}
+	}
+	return rt
 }
 
-func NewConfig(
-	sizeOfInitBrick *int,
-	ipAddress *string,
-	featureApiHttpListen *string,
-	nodeRole *string,
-	stateApiHttpListen *string,
-	meshListen *string,
-	hwaddr *string,
-	nickname *string,
-	password *string,
-	channel *string,
-	searchStrategy *string,
-	peers ClusterPeers,
-) ClusterConfigInfo {
-	return ClusterConfigInfo{
-		SizeOfInitBrick:      sizeOfInitBrick,
-		IpAddress:            ipAddress,
-		FeatureApiHttpListen: featureApiHttpListen,
-		NodeRole:             nodeRole,
-		stateApiHttpListen:   stateApiHttpListen,
-		meshListen:           meshListen,
-		hwaddr:               hwaddr,
-		nickname:             nickname,
-		password:             password,
-		channel:              channel,
-		SearchStrategy:       searchStrategy,
+// GetNoveltyThreshold returns the distance above which a query is regarded
+// as a new data point in the feature group.
+func (rt *Runtime) GetNoveltyThreshold(featureGroupID int) float64 {
+	if v, ok := rt.NoveltyThresholds[featureGroupID]; ok {
+		return v
+	}
+	return rt.NoveltyThreshold
+}
+
+// GetSearchStrategy returns the name of the strategy with which the bricks of the feature group are searched.
+func (rt *Runtime) GetSearchStrategy(featureGroupID int) string {
+	if v, ok := rt.GroupStrategies[featureGroupID]; ok {
+		return v
+	}
+	return rt.SearchStrategy
+}
+
+// NewConfig points the settings of the cluster at cfg, which has been loaded by config.Load.
+func NewConfig(cfg *config.Config) ClusterConfigInfo {
+	peers := ClusterPeers{}
+	for _, p := range cfg.Mesh.Peers {
+		peers[p] = struct{}{}
+	}
+	cci := ClusterConfigInfo{
+		SizeOfInitBrick:      &cfg.Storage.SizeOfInitBrick,
+		IpAddress:            &cfg.Node.IPAddress,
+		FeatureApiHttpListen: &cfg.Listen.FeatureAPI,
+		NodeRole:             &cfg.Node.Role,
+		stateApiHttpListen:   &cfg.Listen.StateAPI,
+		meshListen:           &cfg.Mesh.Listen,
+		meshConnLimit:        &cfg.Mesh.ConnLimit,
+		hwaddr:               &cfg.Node.HWAddr,
+		nickname:             &cfg.Node.Nickname,
+		password:             &cfg.Mesh.Password,
+		channel:              &cfg.Mesh.Channel,
+		GrpcListen:           &cfg.Listen.Grpc,
+		StreamOrigins:        cfg.Listen.StreamOrigins,
+		HeartbeatInterval:    (*time.Duration)(&cfg.Mesh.HeartbeatInterval),
+		ImportDir:            &cfg.Storage.ImportDir,
 		Peers:                peers,
+		runtime:              &atomic.Value{},
 	}
+	cci.SetRuntime(NewRuntime(cfg))
+	return cci
+}
+
+// Runtime returns the current reloadable settings. A request should read them once.
+func (cci ClusterConfigInfo) Runtime() *Runtime {
+	return cci.runtime.Load().(*Runtime)
+}
+
+// SetRuntime replaces the reloadable settings, which every copy of cci shares.
+func (cci ClusterConfigInfo) SetRuntime(rt *Runtime) {
+	cci.runtime.Store(rt)
 }
 
 func (cci ClusterConfigInfo) StateConfig() state.PeerConfig {
 	return state.NewPeerConfig(
 		*cci.IpAddress,
 		*cci.FeatureApiHttpListen,
+		*cci.GrpcListen,
 	)
 }
 
-func (cci *ClusterConfigInfo) Show() {
-	fmt.Printf("nodeRole=%s\n", *cci.NodeRole)
-	fmt.Printf("FeatureApiHttpListen=%s\n", *cci.FeatureApiHttpListen)
-	fmt.Printf("stateApiHttpListen=%s\n", *cci.stateApiHttpListen)
-	fmt.Printf("meshListen=%s\n", *cci.meshListen)
-	fmt.Printf("hwaddr=%s\n", *cci.hwaddr)
-	fmt.Printf("nickname=%s\n", *cci.nickname)
-	fmt.Printf("password=%s\n", *cci.password)
-	fmt.Printf("channel=%s\n", *cci.channel)
-	for k, _ := range cci.Peers {
-		fmt.Printf("peers[%s]\n", k)
+// HeartbeatTimeout is how long a calc node can go without a heartbeat before it is regarded as down.
+func (cci ClusterConfigInfo) HeartbeatTimeout() time.Duration {
+	return 3 * *cci.HeartbeatInterval
+}
+
+var (
+	// ErrNoImportDir is returned for a path of a job when the node has no ImportDir.
+	ErrNoImportDir = errors.New("import_dir is not set on the node")
+	// ErrOutsideImportDir is returned for a path which is absolute or leaves ImportDir.
+	ErrOutsideImportDir = errors.New("the path is not under import_dir")
+)
+
+// StoragePath resolves a path of a job on the node, which must be relative to ImportDir and stay under it.
+// An empty path is returned as it is.
+func (cci ClusterConfigInfo) StoragePath(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	if *cci.ImportDir == "" {
+		return "", ErrNoImportDir
+	}
+	path = filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", ErrOutsideImportDir
 	}
+	return filepath.Join(*cci.ImportDir, path), nil
 }
 
-func StartClusteringFunc(c ClusterConfigInfo, errs chan error) *state.Peer {
+// Cluster bundles the gossip peer with the mesh router and the state API
+// server so that the node can leave the cluster cleanly.
+type Cluster struct {
+	*state.Peer
+	name   mesh.PeerName
+	router *mesh.Router
+	server *http.Server
+	logger *zap.Logger
+	writes writeGate
+}
+
+// errStopping is returned by writeGate.setReadOnly for a node which is being drained or shut down.
+var errStopping = errors.New("the node is being drained or shut down")
+
+// writeGate serializes the changes of the read-only state of the pool.
+// Once a drain or the shutdown has made the pool read-only, the state API cannot make it writable again.
+type writeGate struct {
+	mtx      sync.Mutex
+	stopping bool
+}
 
-	logger := log.New(os.Stderr, "(Clustering) "+*c.nickname+"> ", log.LstdFlags)
+func (g *writeGate) stop(bp *brick.BrickPool) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.stopping = true
+	bp.SetReadOnly(true)
+}
+
+// resume lets the state API change the read-only state again, as after a drain which failed.
+// The pool stays read-only until it does.
+func (g *writeGate) resume() {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.stopping = false
+}
+
+func (g *writeGate) setReadOnly(bp *brick.BrickPool, readOnly bool) error {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if !readOnly && g.stopping {
+		return errStopping
+	}
+	bp.SetReadOnly(readOnly)
+	return nil
+}
+
+// StopWrites makes bp read-only for the shutdown of the node, which the state API cannot undo.
+func (cl *Cluster) StopWrites(bp *brick.BrickPool) {
+	cl.writes.stop(bp)
+}
+
+func StartClusteringFunc(c ClusterConfigInfo, bp *brick.BrickPool, logger *zap.Logger, errs chan error) *Cluster {
+
+	logger = logger.Named("cluster").With(zap.String("nickname", *c.nickname))
 
 	host, portStr, err := net.SplitHostPort(*c.meshListen)
 	if err != nil {
-		logger.Fatalf("mesh address: %s: %v", *c.meshListen, err)
+		logger.Fatal("mesh address", zap.String("address", *c.meshListen), zap.Error(err))
 	}
 	port, err := strconv.Atoi(portStr)
 	if err != nil {
-		logger.Fatalf("mesh address: %s: %v", *c.meshListen, err)
+		logger.Fatal("mesh address", zap.String("address", *c.meshListen), zap.Error(err))
 	}
 
 	name, err := mesh.PeerNameFromString(*c.hwaddr)
 	if err != nil {
-		logger.Fatalf("%s: %v", *c.hwaddr, err)
+		logger.Fatal("peer name", zap.String("hwaddr", *c.hwaddr), zap.Error(err))
 	}
 
 	router, err := mesh.NewRouter(mesh.Config{
@@ -109,80 +251,158 @@ func StartClusteringFunc(c ClusterConfigInfo, errs chan error) *state.Peer {
 		Port:               port,
 		ProtocolMinVersion: mesh.ProtocolMinVersion,
 		Password:           []byte(*c.password),
-		ConnLimit:          64,
+		ConnLimit:          *c.meshConnLimit,
 		PeerDiscovery:      true,
 		TrustedSubnets:     []*net.IPNet{},
 	}, name, *c.nickname, mesh.NullOverlay{}, log.New(ioutil.Discard, "", 0))
 
 	if err != nil {
-		logger.Fatalf("Could not create router: %v", err)
+		logger.Fatal("Could not create router", zap.Error(err))
 	}
 
-	peer := state.NewPeer(name, logger)
+	peer := state.NewPeer(name, logger.Named("gossip"))
 	gossip, err := router.NewGossip(*c.channel, peer)
 	if err != nil {
-		logger.Fatalf("Could not create gossip: %v", err)
+		logger.Fatal("Could not create gossip", zap.Error(err))
 	}
 	peer.Register(gossip)
 
 	func() {
-		logger.Printf("mesh router starting (%s)", *c.meshListen)
+		logger.Info("mesh router starting", zap.String("address", *c.meshListen))
 		router.Start()
 	}()
-	defer func() {
-		logger.Printf("mesh router stopping")
-		router.Stop()
-	}()
 	router.ConnectionMaker.InitiateConnections(c.Peers.slice(), true)
 
+	cl := &Cluster{
+		Peer:   peer,
+		name:   name,
+		router: router,
+		logger: logger,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handlerOfClusterApiController(peer, bp, &cl.writes))
+	mux.HandleFunc("/drain", handlerOfDrain(cl, bp, c.StateConfig(), errs))
+	cl.server = &http.Server{
+		Addr:    *c.stateApiHttpListen,
+		Handler: mux,
+	}
 	go func(errs chan error) {
-		logger.Printf("HTTP server starting (%s)", *c.stateApiHttpListen)
-		http.HandleFunc("/", handlerOfClusterApiController(peer))
-		errs <- http.ListenAndServe(*c.stateApiHttpListen, nil)
+		logger.Info("HTTP server starting", zap.String("address", *c.stateApiHttpListen))
+		if err := cl.server.ListenAndServe(); err != http.ErrServerClosed {
+			errs <- err
+		}
 	}(errs)
-	return peer
+	return cl
+}
+
+// Shutdown announces the removal of this node to the other peers,
+// then stops the state API and the mesh router.
+func (cl *Cluster) Shutdown(ctx context.Context) error {
+	cl.logger.Info("broadcasting removal", zap.Stringer("name", cl.name))
+	cl.Del()
+	// Give the gossip a moment to go out before the connections are gone.
+	select {
+	case <-time.After(removalBroadcastWait):
+	case <-ctx.Done():
+	}
+	err := cl.server.Shutdown(ctx)
+	cl.logger.Info("mesh router stopping")
+	cl.router.Stop()
+	return err
+}
+
+// CheckMesh fails until the node has joined the mesh and seen another peer.
+func (cl *Cluster) CheckMesh() error {
+	for _, desc := range cl.router.Peers.Descriptions() {
+		if !desc.Self {
+			return nil
+		}
+	}
+	return errors.New("no peers seen")
+}
+
+// CheckDraining fails while the node is draining.
+func (cl *Cluster) CheckDraining() error {
+	if cl.GetNodeMeta().Draining {
+		return errors.New("draining")
+	}
+	return nil
+}
+
+// SetLabels gossips the labels of the node given by the configuration, removing those of old which are not in new.
+// Labels set through the state API are kept unless the configuration names them.
+func (cl *Cluster) SetLabels(old, new map[string]string) {
+	form := state.NodeMetaForm{Labels: map[string]string{}}
+	for k := range old {
+		form.Labels[k] = ""
+	}
+	for k, v := range new {
+		form.Labels[k] = v
+	}
+	if len(form.Labels) == 0 {
+		return
+	}
+	cl.SetNodeMeta(form)
 }
 
 type PeerController interface {
 	GetAllState() state.StateContent
 	SetNodeInfo(peerConfig state.PeerConfig, bp *brick.BrickPool) state.StateContent
+	SetNodeMeta(form state.NodeMetaForm) state.StateContent
+	GetNodeMeta() state.NodeMeta
 	Del() state.StateContent
 }
 
-func handlerOfClusterApiController(pc PeerController) http.HandlerFunc {
+func handlerOfClusterApiController(pc PeerController, bp *brick.BrickPool, writes *writeGate) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			bytes, _ := json.Marshal(pc.GetAllState())
-			s := string(bytes)
-			fmt.Fprintf(w, s)
+			w.Write(bytes)
 		case http.MethodDelete:
 			bytes, _ := json.Marshal(pc.Del())
-			s := string(bytes)
-			fmt.Fprintf(w, s)
+			w.Write(bytes)
 		case http.MethodPost:
 			defer r.Body.Close()
-			//b, err := ioutil.ReadAll(r.Body)
-			//if err != nil {
-			//}
-			//err = json.NewDecoder(bytes.NewReader(b)).Decode(&queryInputForm)
-			//bytes, _ := json.Marshal(pc.setNodeInfo())
-			//s := string(bytes)
-			//fmt.Fprintf(w, s)
-			fmt.Fprintf(w, "Not Implemented")
+			var form state.NodeMetaForm
+			if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{"Failed to parse json."})
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write(jsonBytes)
+				return
+			}
+			// 0 is the weight of nodes which gossip none, so a node is taken out of rotation by draining it.
+			if form.CapacityWeight != nil && *form.CapacityWeight <= 0 {
+				jsonBytes, _ := json.Marshal(struct {
+					Msg string `json:"msg"`
+				}{"capacityWeight must be positive"})
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write(jsonBytes)
+				return
+			}
+			// A draining node does not accept new data points.
+			if form.Draining != nil && bp != nil {
+				if err := writes.setReadOnly(bp, *form.Draining); err != nil {
+					jsonBytes, _ := json.Marshal(struct {
+						Msg string `json:"msg"`
+					}{err.Error()})
+					w.WriteHeader(http.StatusConflict)
+					w.Write(jsonBytes)
+					return
+				}
+			}
+			bytes, _ := json.Marshal(pc.SetNodeMeta(form))
+			w.Write(bytes)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
 		}
 	}
 }
 
-func (ss ClusterPeers) Set(value string) error {
-	ss[value] = struct{}{}
-	return nil
-}
-
-func (ss ClusterPeers) String() string {
-	return strings.Join(ss.slice(), ",")
-}
-
 func (ss ClusterPeers) slice() []string {
 	slice := make([]string, 0, len(ss))
 	for k := range ss {
@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClusterApi(t *testing.T) {
+	t.Run("it keeps a draining node read-only against metadata updates successfully", testClusterApi_draining)
+}
+
+func postMeta(h http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func testClusterApi_draining(t *testing.T) {
+	// prepare
+	cl := newDrainingCluster(t, "")
+	bp, _ := newPoolWithPoints(1)
+	h := handlerOfClusterApiController(cl.Peer, bp, &cl.writes)
+
+	// exec
+	drained := postMeta(h, `{"draining": true}`)
+	undrained := postMeta(h, `{"draining": false}`)
+	writableByMeta := !bp.IsReadOnly()
+	cl.StopWrites(bp)
+	undrainedWhileStopping := postMeta(h, `{"draining": false}`)
+	readOnlyWhileStopping := bp.IsReadOnly()
+	// a drain without another calc node fails, after which the node can be made writable again
+	failed := newDrainingCluster(t, "")
+	failedPool, _ := newPoolWithPoints(1)
+	_, drainErr := failed.DrainBricks(failedPool)
+	undrainedAfterFailure := postMeta(handlerOfClusterApiController(failed.Peer, failedPool, &failed.writes), `{"draining": false}`)
+
+	// assert
+	if drained.Code != http.StatusOK || undrained.Code != http.StatusOK || !writableByMeta {
+		t.Fatalf("fail. metadata did not switch the node. %d %d %v", drained.Code, undrained.Code, writableByMeta)
+	}
+	if undrainedWhileStopping.Code != http.StatusConflict || !readOnlyWhileStopping {
+		t.Fatalf("fail. stopping node made writable. %d %s", undrainedWhileStopping.Code, undrainedWhileStopping.Body.String())
+	}
+	if drainErr == nil || undrainedAfterFailure.Code != http.StatusOK || failedPool.IsReadOnly() {
+		t.Fatalf("fail. node not made writable after a failed drain. %v %d", drainErr, undrainedAfterFailure.Code)
+	}
+}
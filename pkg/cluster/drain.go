@@ -0,0 +1,141 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+
+	"go.uber.org/zap"
+)
+
+// removalBroadcastWait is how long Shutdown waits after broadcasting Del.
+const removalBroadcastWait = 1 * time.Second
+
+type DrainedBrick struct {
+	UniqueID string `json:"uniqueID"`
+	NodeName string `json:"nodeName"`
+	Address  string `json:"address"`
+}
+
+type DrainResponse struct {
+	Bricks []DrainedBrick `json:"bricks"`
+	Msg    string         `json:"msg,omitempty"`
+}
+
+// ErrDrained is sent to the errors of the node when it has been drained and is to shut down.
+var ErrDrained = errors.New("drained")
+
+// DrainBricks moves every brick of bp to the other calc nodes in the cluster.
+// The pool is switched to read-only first, which waits for the writes in flight,
+// so that no data point is lost between encoding a brick and unregistering it.
+// It stays read-only, and the state API can make it writable again only when the drain fails.
+func (cl *Cluster) DrainBricks(bp *brick.BrickPool) ([]DrainedBrick, error) {
+	cl.writes.stop(bp)
+	done := false
+	defer func() {
+		if !done {
+			cl.writes.resume()
+		}
+	}()
+	draining := true
+	cl.SetNodeMeta(state.NodeMetaForm{Draining: &draining})
+
+	// Calc nodes publish their NodeInfo, so every other entry is a candidate.
+	load := map[string]int{}
+	nodes := map[string]state.NodeInfo{}
+	for nodeName, v := range cl.GetAllState().NodeInfos {
+		if nodeName == cl.name.String() || v.Bricks == nil || v.Meta.Draining {
+			continue
+		}
+		nodes[nodeName] = v
+		for _, b := range *v.Bricks {
+			load[nodeName] += b.NumOfAvailablePoints
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("No other calc node to migrate bricks to")
+	}
+
+	bricks, _ := bp.GetAllBricks()
+	drained := make([]DrainedBrick, 0, len(bricks))
+	for _, fb := range bricks {
+		// Send to the least loaded node.
+		target := ""
+		for nodeName := range nodes {
+			if target == "" || load[nodeName] < load[target] {
+				target = nodeName
+			}
+		}
+		node := nodes[target]
+		address := fmt.Sprintf("http://%s%s", node.APIAddress(), catalog.NamespacePath(fb.GetNamespace(), "/api/v1/bricks/import"))
+		if err := postBrick(address, fb.Encode()); err != nil {
+			return drained, fmt.Errorf("migrating brick %s to %s: %v", fb.GetUniqueIDstr(), target, err)
+		}
+		bp.UnregisterFromPool(fb)
+		load[target] += fb.NumOfAvailablePoints
+		drained = append(drained, DrainedBrick{
+			UniqueID: fb.GetUniqueIDstr(),
+			NodeName: target,
+			Address:  address,
+		})
+		cl.logger.Info("brick migrated", zap.String("uniqueID", fb.GetUniqueIDstr()), zap.String("target", target))
+	}
+	done = true
+	return drained, nil
+}
+
+func postBrick(address string, encodedBrick []byte) error {
+	resp, err := http.Post(address, "application/octet-stream", bytes.NewReader(encodedBrick))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(b))
+	}
+	return nil
+}
+
+// handlerOfDrain migrates all bricks to other nodes and then asks the node
+// to shut down by sending to errs.
+func handlerOfDrain(cl *Cluster, bp *brick.BrickPool, peerConf state.PeerConfig, errs chan error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		if bp == nil {
+			jsonBytes, _ := json.Marshal(DrainResponse{Msg: "This node has no bricks."})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(jsonBytes)
+			return
+		}
+
+		drained, err := cl.DrainBricks(bp)
+		// Publish the brick list as it is now, even after a partial failure.
+		cl.SetNodeInfo(peerConf, bp)
+		if err != nil {
+			jsonBytes, _ := json.Marshal(DrainResponse{Bricks: drained, Msg: err.Error()})
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(jsonBytes)
+			return
+		}
+
+		jsonBytes, _ := json.Marshal(DrainResponse{Bricks: drained, Msg: "drained"})
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonBytes)
+		go func() {
+			errs <- ErrDrained
+		}()
+	}
+}
@@ -0,0 +1,157 @@
+package cluster
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/data"
+	"github.com/abeja-inc/feature-search-db/pkg/state"
+
+	"github.com/weaveworks/mesh"
+	"go.uber.org/zap"
+)
+
+func TestDrain(t *testing.T) {
+	t.Run("it migrates a write in flight with the brick successfully", testDrain_writeInFlight)
+	t.Run("it fails without another calc node", testDrain_noTarget)
+}
+
+// targetNode is a calc node which bricks are drained to.
+type targetNode struct {
+	mtx    sync.Mutex
+	points []int
+}
+
+func (tn *targetNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	fb, err := brick.DecodeBrick(b, brick.NewLinerFindStrategy())
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	tn.mtx.Lock()
+	tn.points = append(tn.points, fb.NumOfAvailablePoints)
+	tn.mtx.Unlock()
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (tn *targetNode) received() []int {
+	tn.mtx.Lock()
+	defer tn.mtx.Unlock()
+	return append([]int{}, tn.points...)
+}
+
+// newDrainingCluster returns the cluster of a calc node which sees the calc node at addr.
+func newDrainingCluster(t *testing.T, addr string) *Cluster {
+	self := state.NewPeer(mesh.PeerName(1), zap.NewNop())
+	if addr == "" {
+		return &Cluster{Peer: self, name: mesh.PeerName(1), logger: zap.NewNop()}
+	}
+	host, port, _ := net.SplitHostPort(addr)
+	other := state.NewPeer(mesh.PeerName(2), zap.NewNop())
+	// a node without bricks is gossiped without a brick list, and is not a calc node then
+	otherPool, _ := newPoolWithPoints(0)
+	other.SetNodeInfo(state.NewPeerConfig(host, ":"+port, ""), otherPool)
+	for _, buf := range other.Gossip().Encode() {
+		if _, err := self.OnGossipBroadcast(mesh.PeerName(2), buf); err != nil {
+			t.Fatalf("fail. %v", err)
+		}
+	}
+	return &Cluster{Peer: self, name: mesh.PeerName(1), logger: zap.NewNop()}
+}
+
+func newPoolWithPoints(n int) (*brick.BrickPool, *brick.FeatureBrick) {
+	bp := &brick.BrickPool{}
+	bp.InitBrickPool()
+	fb := brick.NewBrick(10, brick.BrickFeatureGroupID(0), brick.NewLinerFindStrategy())
+	for i := 0; i < n; i++ {
+		pv := data.NewPosVector(true, 512)
+		fb.AddNewDataPoint(&pv)
+	}
+	bp.RegisterIntoPool(&fb)
+	return bp, &fb
+}
+
+func testDrain_writeInFlight(t *testing.T) {
+	// prepare
+	tn := &targetNode{}
+	srv := httptest.NewServer(tn)
+	defer srv.Close()
+	cl := newDrainingCluster(t, srv.Listener.Addr().String())
+	bp, fb := newPoolWithPoints(3)
+	errs := make(chan error, 1)
+	if err := bp.BeginWrite(); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+
+	// exec
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handlerOfDrain(cl, bp, state.PeerConfig{}, errs).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/drain", nil))
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	migratedEarly := len(tn.received()) > 0
+	pv := data.NewPosVector(true, 512)
+	fb.AddNewDataPoint(&pv)
+	bp.EndWrite()
+	<-done
+
+	// assert
+	if migratedEarly {
+		t.Fatal("fail. brick migrated while a write was in flight.")
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("fail. drain failed. %d %s", rec.Code, rec.Body.String())
+	}
+	var resp DrainResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Bricks) != 1 {
+		t.Fatalf("fail. drained bricks not match. %s", rec.Body.String())
+	}
+	if points := tn.received(); len(points) != 1 || points[0] != 4 {
+		t.Fatalf("fail. the write in flight was not migrated. %v", points)
+	}
+	if bricks, _ := bp.GetAllBricks(); len(bricks) != 0 {
+		t.Fatalf("fail. drained brick still in the pool. %d", len(bricks))
+	}
+	if err := bp.BeginWrite(); err != brick.ErrReadOnly {
+		t.Fatalf("fail. drained node still writable. %v", err)
+	}
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("fail. drained node not shut down.")
+	}
+}
+
+func testDrain_noTarget(t *testing.T) {
+	// prepare
+	cl := newDrainingCluster(t, "")
+	bp, _ := newPoolWithPoints(3)
+	errs := make(chan error, 1)
+
+	// exec
+	rec := httptest.NewRecorder()
+	handlerOfDrain(cl, bp, state.PeerConfig{}, errs).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/drain", nil))
+
+	// assert
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("fail. drain without a target succeeded. %d", rec.Code)
+	}
+	if bricks, _ := bp.GetAllBricks(); len(bricks) != 1 {
+		t.Fatalf("fail. brick lost. %d", len(bricks))
+	}
+	select {
+	case err := <-errs:
+		t.Fatalf("fail. node shut down after a failed drain. %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,263 @@
+// Package config loads the configuration of featuredb.
+// Values come from, in increasing priority, the defaults, a YAML or TOML file,
+// FEATUREDB_* environment variables and the command line flags.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+
+	"github.com/BurntSushi/toml"
+	"github.com/weaveworks/mesh"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	RoleCalc         = "calc"
+	RoleReverseProxy = "reverseProxy"
+)
+
+// Config is the whole configuration of a process. The keys of the file are in the tags.
+type Config struct {
+	Node          NodeConfig           `yaml:"node" toml:"node" json:"node"`
+	Listen        ListenConfig         `yaml:"listen" toml:"listen" json:"listen"`
+	Mesh          MeshConfig           `yaml:"mesh" toml:"mesh" json:"mesh"`
+	Search        SearchConfig         `yaml:"search" toml:"search" json:"search"`
+	FeatureGroups []FeatureGroupConfig `yaml:"featureGroups" toml:"featureGroups" json:"featureGroups"`
+	Storage       StorageConfig        `yaml:"storage" toml:"storage" json:"storage"`
+	Tracing       TracingConfig        `yaml:"tracing" toml:"tracing" json:"tracing"`
+	Logging       LoggingConfig        `yaml:"logging" toml:"logging" json:"logging"`
+}
+
+// NodeConfig tells who the node is. Empty IPAddress, HWAddr and Nickname are detected from the host.
+type NodeConfig struct {
+	Role      string `yaml:"role" toml:"role" json:"role"`
+	IPAddress string `yaml:"ipAddress" toml:"ipAddress" json:"ipAddress"`
+	HWAddr    string `yaml:"hwaddr" toml:"hwaddr" json:"hwaddr"`
+	Nickname  string `yaml:"nickname" toml:"nickname" json:"nickname"`
+	// Labels are gossiped as the labels of the node, on top of those set through the state API.
+	Labels map[string]string `yaml:"labels" toml:"labels" json:"labels,omitempty"`
+}
+
+type ListenConfig struct {
+	FeatureAPI string `yaml:"featureApi" toml:"featureApi" json:"featureApi"`
+	StateAPI   string `yaml:"stateApi" toml:"stateApi" json:"stateApi"`
+	// Grpc disables the gRPC API when empty.
+	Grpc string `yaml:"grpc" toml:"grpc" json:"grpc"`
+	// StreamOrigins are the origins of the web pages, besides the proxy itself, which may open the
+	// search stream of the proxy. "*" allows any.
+	StreamOrigins []string `yaml:"streamOrigins" toml:"streamOrigins" json:"streamOrigins"`
+}
+
+type MeshConfig struct {
+	Listen            string   `yaml:"listen" toml:"listen" json:"listen"`
+	Password          string   `yaml:"password" toml:"password" json:"password"`
+	Channel           string   `yaml:"channel" toml:"channel" json:"channel"`
+	ConnLimit         int      `yaml:"connLimit" toml:"connLimit" json:"connLimit"`
+	Peers             []string `yaml:"peers" toml:"peers" json:"peers"`
+	HeartbeatInterval Duration `yaml:"heartbeatInterval" toml:"heartbeatInterval" json:"heartbeatInterval"`
+}
+
+type SearchConfig struct {
+	Strategy           string   `yaml:"strategy" toml:"strategy" json:"strategy"`
+	NoveltyThreshold   float64  `yaml:"noveltyThreshold" toml:"noveltyThreshold" json:"noveltyThreshold"`
+	NodeTimeout        Duration `yaml:"nodeTimeout" toml:"nodeTimeout" json:"nodeTimeout"`
+	NodeRetries        int      `yaml:"nodeRetries" toml:"nodeRetries" json:"nodeRetries"`
+	SlowQueryThreshold Duration `yaml:"slowQueryThreshold" toml:"slowQueryThreshold" json:"slowQueryThreshold"`
+}
+
+// FeatureGroupConfig overrides the search settings of a feature group.
+type FeatureGroupConfig struct {
+	ID               int      `yaml:"id" toml:"id" json:"id"`
+	NoveltyThreshold *float64 `yaml:"noveltyThreshold" toml:"noveltyThreshold" json:"noveltyThreshold,omitempty"`
+	// Strategy is the search strategy of the bricks of the group, search.strategy when empty.
+	Strategy string `yaml:"strategy" toml:"strategy" json:"strategy,omitempty"`
+}
+
+type StorageConfig struct {
+	SizeOfInitBrick int `yaml:"sizeOfInitBrick" toml:"sizeOfInitBrick" json:"sizeOfInitBrick"`
+	// ImportDir is where files of import jobs are read from, and their checkpoints written to.
+	// Jobs of files are refused when it is empty.
+	ImportDir string `yaml:"importDir" toml:"importDir" json:"importDir"`
+}
+
+type TracingConfig struct {
+	Backend      string `yaml:"backend" toml:"backend" json:"backend"`
+	OTLPEndpoint string `yaml:"otlpEndpoint" toml:"otlpEndpoint" json:"otlpEndpoint"`
+}
+
+type LoggingConfig struct {
+	Level  string `yaml:"level" toml:"level" json:"level"`
+	Format string `yaml:"format" toml:"format" json:"format"`
+}
+
+// Default returns the configuration used when nothing is given.
+func Default() *Config {
+	return &Config{
+		Node: NodeConfig{
+			Role: RoleCalc,
+		},
+		Listen: ListenConfig{
+			FeatureAPI:    ":8081",
+			StateAPI:      ":8001",
+			StreamOrigins: []string{},
+		},
+		Mesh: MeshConfig{
+			Listen:            net.JoinHostPort("0.0.0.0", strconv.Itoa(mesh.Port)),
+			Channel:           "default",
+			ConnLimit:         64,
+			Peers:             []string{},
+			HeartbeatInterval: Duration(10 * time.Second),
+		},
+		Search: SearchConfig{
+			Strategy:           "naive",
+			NoveltyThreshold:   100.0,
+			NodeTimeout:        Duration(5 * time.Second),
+			NodeRetries:        1,
+			SlowQueryThreshold: Duration(time.Second),
+		},
+		FeatureGroups: []FeatureGroupConfig{},
+		Storage: StorageConfig{
+			SizeOfInitBrick: 100000,
+		},
+		Tracing: TracingConfig{
+			Backend:      "datadog",
+			OTLPEndpoint: "localhost:55680",
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "json",
+		},
+	}
+}
+
+// ReadFile reads a YAML (.yaml, .yml) or TOML (.toml) file onto cfg.
+// Keys which are not in the file keep their values, and unknown keys are an error.
+func ReadFile(path string, cfg *Config) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(b, cfg)
+	case ".toml":
+		var md toml.MetaData
+		md, err = toml.DecodeReader(bytes.NewReader(b), cfg)
+		if err == nil && len(md.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown key %s", md.Undecoded()[0])
+		}
+	default:
+		return fmt.Errorf("unknown config format %q (yaml or toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate checks the values which would otherwise fail late or silently.
+func (cfg *Config) Validate() error {
+	if cfg.Node.Role != RoleCalc && cfg.Node.Role != RoleReverseProxy {
+		return fmt.Errorf("unknown node role %q (%s or %s)", cfg.Node.Role, RoleCalc, RoleReverseProxy)
+	}
+	if cfg.Mesh.ConnLimit <= 0 {
+		return errors.New("mesh connLimit must be positive")
+	}
+	if cfg.Mesh.HeartbeatInterval <= 0 {
+		return errors.New("mesh heartbeatInterval must be positive")
+	}
+	if cfg.Search.NodeTimeout <= 0 {
+		return errors.New("search nodeTimeout must be positive")
+	}
+	if cfg.Search.NodeRetries < 0 {
+		return errors.New("search nodeRetries must not be negative")
+	}
+	if cfg.Storage.SizeOfInitBrick <= 0 {
+		return errors.New("storage sizeOfInitBrick must be positive")
+	}
+	if _, err := brick.NewSearchStrategy(cfg.Search.Strategy); err != nil {
+		return fmt.Errorf("search strategy: %v", err)
+	}
+	seen := map[int]bool{}
+	for _, g := range cfg.FeatureGroups {
+		if seen[g.ID] {
+			return fmt.Errorf("feature group %d is defined twice", g.ID)
+		}
+		seen[g.ID] = true
+		if g.Strategy == "" {
+			continue
+		}
+		if _, err := brick.NewSearchStrategy(g.Strategy); err != nil {
+			return fmt.Errorf("strategy of feature group %d: %v", g.ID, err)
+		}
+	}
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(cfg.Logging.Level)); err != nil {
+		return fmt.Errorf("logging level: %v", err)
+	}
+	return nil
+}
+
+// Redacted returns a copy of cfg whose secrets are masked, for printing.
+func (cfg *Config) Redacted() Config {
+	redacted := *cfg
+	if redacted.Mesh.Password != "" {
+		redacted.Mesh.Password = "********"
+	}
+	return redacted
+}
+
+// featureGroup returns the definition of the feature group, adding it when it is not defined.
+func (cfg *Config) featureGroup(id int) *FeatureGroupConfig {
+	for i := range cfg.FeatureGroups {
+		if cfg.FeatureGroups[i].ID == id {
+			return &cfg.FeatureGroups[i]
+		}
+	}
+	cfg.FeatureGroups = append(cfg.FeatureGroups, FeatureGroupConfig{ID: id})
+	return &cfg.FeatureGroups[len(cfg.FeatureGroups)-1]
+}
+
+// Duration is a time.Duration written as "10s" in files, flags and the printed config.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Set parses a flag or an environment variable.
+func (d *Duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	return d.Set(string(b))
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.Set(s)
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
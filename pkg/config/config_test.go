@@ -0,0 +1,136 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	t.Run("it layers the file, env and flags successfully", testConfig_load)
+	t.Run("it reads TOML files successfully", testConfig_toml)
+	t.Run("it rejects unknown keys successfully", testConfig_unknownKey)
+	t.Run("it redacts secrets successfully", testConfig_redacted)
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	return path
+}
+
+func testConfig_load(t *testing.T) {
+	// prepare
+	path := writeFile(t, "featuredb.yaml", `
+node:
+  role: reverseProxy
+mesh:
+  peers: [10.0.0.1:6783, 10.0.0.2:6783]
+  heartbeatInterval: 5s
+search:
+  nodeTimeout: 2s
+  nodeRetries: 3
+featureGroups:
+  - id: 1
+    noveltyThreshold: 50
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+	env := map[string]string{
+		"FEATUREDB_NODE_RETRIES": "4",
+		"FEATUREDB_PEER":         "10.0.0.3:6783",
+	}
+	fs := flag.NewFlagSet("featuredb", flag.ContinueOnError)
+
+	// exec
+	cfg, err := Load(fs, []string{"-config", path, "-node_retries", "5", "-novelty_threshold_group", "2=30"},
+		func(key string) string { return env[key] })
+
+	// assert
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if cfg.Node.Role != RoleReverseProxy || time.Duration(cfg.Mesh.HeartbeatInterval) != 5*time.Second || time.Duration(cfg.Search.NodeTimeout) != 2*time.Second {
+		t.Fatalf("fail. file not read. %+v", cfg)
+	}
+	if cfg.Search.NodeRetries != 5 {
+		t.Fatalf("fail. flag must win over env and file. %d", cfg.Search.NodeRetries)
+	}
+	if len(cfg.Mesh.Peers) != 1 || cfg.Mesh.Peers[0] != "10.0.0.3:6783" {
+		t.Fatalf("fail. env must replace peers of file. %v", cfg.Mesh.Peers)
+	}
+	if len(cfg.FeatureGroups) != 2 || cfg.FeatureGroups[0].NoveltyThreshold != nil || *cfg.FeatureGroups[1].NoveltyThreshold != 30 {
+		t.Fatalf("fail. flag must replace group thresholds of file. %+v", cfg.FeatureGroups)
+	}
+	if cfg.Listen.FeatureAPI != ":8081" || cfg.Mesh.ConnLimit != 64 {
+		t.Fatalf("fail. defaults not kept. %+v", cfg)
+	}
+}
+
+func testConfig_toml(t *testing.T) {
+	// prepare
+	path := writeFile(t, "featuredb.toml", `
+[search]
+strategy = "goroutine_4"
+slowQueryThreshold = "250ms"
+
+[[featureGroups]]
+id = 3
+noveltyThreshold = 12.5
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+	cfg := Default()
+
+	// exec
+	err := ReadFile(path, cfg)
+
+	// assert
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if cfg.Search.Strategy != "goroutine_4" || time.Duration(cfg.Search.SlowQueryThreshold) != 250*time.Millisecond {
+		t.Fatalf("fail. search not read. %+v", cfg.Search)
+	}
+	if len(cfg.FeatureGroups) != 1 || cfg.FeatureGroups[0].ID != 3 || *cfg.FeatureGroups[0].NoveltyThreshold != 12.5 {
+		t.Fatalf("fail. feature groups not read. %+v", cfg.FeatureGroups)
+	}
+}
+
+func testConfig_unknownKey(t *testing.T) {
+	// prepare
+	yamlPath := writeFile(t, "featuredb.yaml", "search:\n  nodeTimeuot: 2s\n")
+	defer os.RemoveAll(filepath.Dir(yamlPath))
+	tomlPath := writeFile(t, "featuredb.toml", "[mesh]\nconnLimt = 3\n")
+	defer os.RemoveAll(filepath.Dir(tomlPath))
+
+	// exec
+	yamlErr := ReadFile(yamlPath, Default())
+	tomlErr := ReadFile(tomlPath, Default())
+
+	// assert
+	if yamlErr == nil || tomlErr == nil {
+		t.Fatalf("fail. unknown keys accepted. %v, %v", yamlErr, tomlErr)
+	}
+}
+
+func testConfig_redacted(t *testing.T) {
+	// prepare
+	cfg := Default()
+	cfg.Mesh.Password = "secret"
+
+	// exec
+	redacted := cfg.Redacted()
+
+	// assert
+	if redacted.Mesh.Password == "secret" || cfg.Mesh.Password != "secret" {
+		t.Fatalf("fail. password not redacted. %s", redacted.Mesh.Password)
+	}
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// Change is a reloadable setting which differs between two configurations.
+// Old or New is empty when the setting is added or removed.
+type Change struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// Diff lists the reloadable settings which differ from old to new,
+// and the keys of the other settings which differ and take effect only after a restart.
+func Diff(old, new *Config) (changes []Change, restart []string) {
+	olds, news := reloadable(old), reloadable(new)
+	keys := make([]string, 0, len(olds)+len(news))
+	for k := range olds {
+		keys = append(keys, k)
+	}
+	for k := range news {
+		if _, ok := olds[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if olds[k] != news[k] {
+			changes = append(changes, Change{Key: k, Old: olds[k], New: news[k]})
+		}
+	}
+
+	oldNode, newNode := old.Node, new.Node
+	oldNode.Labels, newNode.Labels = nil, nil
+	for _, section := range []struct {
+		key      string
+		old, new interface{}
+	}{
+		{"node", oldNode, newNode},
+		{"listen", old.Listen, new.Listen},
+		{"mesh", old.Mesh, new.Mesh},
+		{"storage", old.Storage, new.Storage},
+		{"tracing", old.Tracing, new.Tracing},
+		{"logging.format", old.Logging.Format, new.Logging.Format},
+	} {
+		if !reflect.DeepEqual(section.old, section.new) {
+			restart = append(restart, section.key)
+		}
+	}
+	return changes, restart
+}
+
+// Reloaded returns old with the reloadable settings of new, which is the configuration in effect after a reload.
+func Reloaded(old, new *Config) *Config {
+	cfg := *old
+	cfg.Node.Labels = new.Node.Labels
+	cfg.Logging.Level = new.Logging.Level
+	cfg.Search = new.Search
+	cfg.FeatureGroups = new.FeatureGroups
+	return &cfg
+}
+
+// reloadable flattens the settings which can be changed without a restart into "key": "value".
+func reloadable(cfg *Config) map[string]string {
+	m := map[string]string{
+		"logging.level":             cfg.Logging.Level,
+		"search.strategy":           cfg.Search.Strategy,
+		"search.noveltyThreshold":   strconv.FormatFloat(cfg.Search.NoveltyThreshold, 'g', -1, 64),
+		"search.nodeTimeout":        cfg.Search.NodeTimeout.String(),
+		"search.nodeRetries":        strconv.Itoa(cfg.Search.NodeRetries),
+		"search.slowQueryThreshold": cfg.Search.SlowQueryThreshold.String(),
+	}
+	for _, g := range cfg.FeatureGroups {
+		if g.NoveltyThreshold != nil {
+			m[fmt.Sprintf("featureGroups[%d].noveltyThreshold", g.ID)] = strconv.FormatFloat(*g.NoveltyThreshold, 'g', -1, 64)
+		}
+		if g.Strategy != "" {
+			m[fmt.Sprintf("featureGroups[%d].strategy", g.ID)] = g.Strategy
+		}
+	}
+	for k, v := range cfg.Node.Labels {
+		m["node.labels."+k] = v
+	}
+	return m
+}
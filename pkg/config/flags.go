@@ -0,0 +1,194 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables which override the config file.
+// Each flag has one, e.g. FEATUREDB_NODE_TIMEOUT for -node_timeout.
+const EnvPrefix = "FEATUREDB_"
+
+// configFlag is the flag of the config file, which is also read from FEATUREDB_CONFIG.
+const configFlag = "config"
+
+// EnvName returns the environment variable of a flag.
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(flagName)
+}
+
+// Load builds the configuration from the file given by -config or FEATUREDB_CONFIG,
+// the environment variables of getenv and args, and registers its flags on fs.
+func Load(fs *flag.FlagSet, args []string, getenv func(string) string) (*Config, error) {
+	cfg := Default()
+	path := configPath(args)
+	if path == "" {
+		path = getenv(EnvName(configFlag))
+	}
+	if path != "" {
+		if err := ReadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	lists := registerFlags(fs, cfg)
+	fs.String(configFlag, path, "YAML or TOML config file (env "+EnvName(configFlag)+")")
+	// Repeated flags replace what the file, or the environment, gave instead of adding to it.
+	for _, l := range lists {
+		l.replaceOnSet()
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v := getenv(EnvName(f.Name))
+		if err != nil || f.Name == configFlag || v == "" {
+			return
+		}
+		if setErr := fs.Set(f.Name, v); setErr != nil {
+			err = fmt.Errorf("%s: %v", EnvName(f.Name), setErr)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lists {
+		l.replaceOnSet()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// configPath finds -config in args before the flags are parsed, since it gives the defaults of the others.
+func configPath(args []string) string {
+	for i, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if name == arg || arg == "--" {
+			continue
+		}
+		if strings.HasPrefix(name, configFlag+"=") {
+			return strings.TrimPrefix(name, configFlag+"=")
+		}
+		if name == configFlag && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+type listFlag interface {
+	replaceOnSet()
+}
+
+func registerFlags(fs *flag.FlagSet, cfg *Config) []listFlag {
+	fs.StringVar(&cfg.Node.Role, "node_role", cfg.Node.Role, "RoleName in cluster")
+	fs.StringVar(&cfg.Node.IPAddress, "ipaddress", cfg.Node.IPAddress, "Local IP (detected when empty)")
+	fs.StringVar(&cfg.Node.HWAddr, "hwaddr", cfg.Node.HWAddr, "MAC address, i.e. mesh peer ID (detected when empty)")
+	fs.StringVar(&cfg.Node.Nickname, "nickname", cfg.Node.Nickname, "peer nickname (hostname when empty)")
+	fs.StringVar(&cfg.Listen.FeatureAPI, "feature_api", cfg.Listen.FeatureAPI, "HTTP listen address (API)")
+	fs.StringVar(&cfg.Listen.StateAPI, "state_api", cfg.Listen.StateAPI, "HTTP listen address (ClusterManage)")
+	fs.StringVar(&cfg.Listen.Grpc, "grpc_listen", cfg.Listen.Grpc, "gRPC listen address (disabled when empty)")
+	origins := &stringsFlag{values: &cfg.Listen.StreamOrigins}
+	fs.Var(origins, "stream_origin", "origin of web pages which may open the search stream, * for any (may be repeated, reverseProxy)")
+	fs.StringVar(&cfg.Mesh.Listen, "mesh", cfg.Mesh.Listen, "mesh listen address")
+	fs.StringVar(&cfg.Mesh.Password, "password", cfg.Mesh.Password, "password (optional)")
+	fs.StringVar(&cfg.Mesh.Channel, "channel", cfg.Mesh.Channel, "gossip channel name")
+	fs.IntVar(&cfg.Mesh.ConnLimit, "mesh_conn_limit", cfg.Mesh.ConnLimit, "maximum number of mesh connections")
+	fs.Var(&cfg.Mesh.HeartbeatInterval, "heartbeat_interval", "how often calc nodes gossip their bricks")
+	peers := &stringsFlag{values: &cfg.Mesh.Peers}
+	fs.Var(peers, "peer", "initial peer (may be repeated)")
+	fs.StringVar(&cfg.Search.Strategy, "strategy", cfg.Search.Strategy, "search strategy")
+	fs.Float64Var(&cfg.Search.NoveltyThreshold, "novelty_threshold", cfg.Search.NoveltyThreshold, "distance above which a query is registered as new (reverseProxy)")
+	thresholds := &groupThresholdsFlag{cfg: cfg}
+	fs.Var(thresholds, "novelty_threshold_group", "novelty threshold of a feature group as groupID=threshold (may be repeated)")
+	fs.Var(&cfg.Search.NodeTimeout, "node_timeout", "deadline of each request to a calc node (reverseProxy)")
+	fs.IntVar(&cfg.Search.NodeRetries, "node_retries", cfg.Search.NodeRetries, "retries against other replicas when a calc node fails (reverseProxy)")
+	fs.Var(&cfg.Search.SlowQueryThreshold, "slow_query_threshold", "time from which a query is kept on /admin/slowqueries (disabled when 0)")
+	fs.IntVar(&cfg.Storage.SizeOfInitBrick, "size_of_init_brick", cfg.Storage.SizeOfInitBrick, "Size of Initial brick")
+	fs.StringVar(&cfg.Storage.ImportDir, "import_dir", cfg.Storage.ImportDir, "directory of the files of import jobs and their checkpoints")
+	fs.StringVar(&cfg.Tracing.Backend, "tracer", cfg.Tracing.Backend, "tracing backend (datadog, otlp or none)")
+	fs.StringVar(&cfg.Tracing.OTLPEndpoint, "otlp_endpoint", cfg.Tracing.OTLPEndpoint, "address of the OpenTelemetry collector (otlp tracer)")
+	fs.StringVar(&cfg.Logging.Level, "log_level", cfg.Logging.Level, "log level (debug, info, warn or error), which can be changed on /admin/loglevel")
+	fs.StringVar(&cfg.Logging.Format, "log_format", cfg.Logging.Format, "log format (json or console)")
+	return []listFlag{peers, thresholds, origins}
+}
+
+// stringsFlag is a repeatable flag. An environment variable gives several values separated by commas.
+type stringsFlag struct {
+	values  *[]string
+	replace bool
+}
+
+func (sf *stringsFlag) String() string {
+	if sf.values == nil {
+		return ""
+	}
+	return strings.Join(*sf.values, ",")
+}
+
+func (sf *stringsFlag) Set(value string) error {
+	if sf.replace {
+		*sf.values = []string{}
+		sf.replace = false
+	}
+	for _, v := range strings.Split(value, ",") {
+		if v != "" {
+			*sf.values = append(*sf.values, v)
+		}
+	}
+	return nil
+}
+
+func (sf *stringsFlag) replaceOnSet() {
+	sf.replace = true
+}
+
+// groupThresholdsFlag sets the novelty threshold of feature groups as "groupID=threshold".
+type groupThresholdsFlag struct {
+	cfg     *Config
+	replace bool
+}
+
+func (gf *groupThresholdsFlag) String() string {
+	if gf.cfg == nil {
+		return ""
+	}
+	var strs []string
+	for _, g := range gf.cfg.FeatureGroups {
+		if g.NoveltyThreshold != nil {
+			strs = append(strs, fmt.Sprintf("%d=%g", g.ID, *g.NoveltyThreshold))
+		}
+	}
+	return strings.Join(strs, ",")
+}
+
+func (gf *groupThresholdsFlag) Set(value string) error {
+	if gf.replace {
+		for i := range gf.cfg.FeatureGroups {
+			gf.cfg.FeatureGroups[i].NoveltyThreshold = nil
+		}
+		gf.replace = false
+	}
+	for _, v := range strings.Split(value, ",") {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid group threshold %q (groupID=threshold)", v)
+		}
+		id, err := strconv.Atoi(kv[0])
+		if err != nil {
+			return fmt.Errorf("invalid groupID %q", kv[0])
+		}
+		threshold, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || threshold < 0 {
+			return fmt.Errorf("invalid threshold %q", kv[1])
+		}
+		gf.cfg.featureGroup(id).NoveltyThreshold = &threshold
+	}
+	return nil
+}
+
+func (gf *groupThresholdsFlag) replaceOnSet() {
+	gf.replace = true
+}
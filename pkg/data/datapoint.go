@@ -12,6 +12,9 @@ type DataPoint struct {
 	Available bool
 	PosVector PosVector
 	CreatedAt time.Time
+	// ExternalID and Meta are given by bulk imports.
+	ExternalID string
+	Meta       map[string]string
 }
 
 func (dp *DataPoint) GetDataIDstr() string {
@@ -0,0 +1,96 @@
+// Package health serves the liveness and the readiness of a process on /healthz and /readyz.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Check returns nil when its part of the process is ready, or why it is not.
+type Check func() error
+
+// Checker holds the checks which must all pass for the process to be ready.
+type Checker struct {
+	mtx    sync.Mutex
+	names  []string
+	checks map[string]Check
+}
+
+// Status is the response of /healthz and /readyz, with the result of each check.
+type Status struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// NewChecker makes a Checker without checks.
+func NewChecker() *Checker {
+	return &Checker{checks: map[string]Check{}}
+}
+
+// Add adds a check under name, replacing the check of the same name.
+func (c *Checker) Add(name string, check Check) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Run runs every check, and tells whether all of them passed.
+func (c *Checker) Run() (Status, bool) {
+	c.mtx.Lock()
+	names := append([]string{}, c.names...)
+	checks := make([]Check, 0, len(names))
+	for _, name := range names {
+		checks = append(checks, c.checks[name])
+	}
+	c.mtx.Unlock()
+
+	status := Status{Status: statusOK, Checks: map[string]string{}}
+	ready := true
+	for i, check := range checks {
+		if err := check(); err != nil {
+			status.Checks[names[i]] = err.Error()
+			ready = false
+			continue
+		}
+		status.Checks[names[i]] = statusOK
+	}
+	if !ready {
+		status.Status = statusUnavailable
+	}
+	return status, ready
+}
+
+// ReadinessHandler answers 200 when every check passes, and 503 otherwise.
+func (c *Checker) ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, ready := c.Run()
+		code := http.StatusOK
+		if !ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeStatus(w, code, status)
+	}
+}
+
+// LivenessHandler answers 200 as long as the process can serve HTTP.
+func LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, http.StatusOK, Status{Status: statusOK})
+	}
+}
+
+func writeStatus(w http.ResponseWriter, code int, status Status) {
+	jsonBytes, _ := json.Marshal(status)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(jsonBytes)
+}
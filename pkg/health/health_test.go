@@ -0,0 +1,45 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChecker(t *testing.T) {
+	t.Run("it reports readiness successfully", testChecker_readiness)
+}
+
+func testChecker_readiness(t *testing.T) {
+	// prepare
+	c := NewChecker()
+	loaded := false
+	c.Add("bricks", func() error {
+		if !loaded {
+			return errors.New("bricks are loading")
+		}
+		return nil
+	})
+	c.Add("mesh", func() error { return nil })
+
+	// exec
+	rec := httptest.NewRecorder()
+	c.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	loaded = true
+	rec2 := httptest.NewRecorder()
+	c.ReadinessHandler().ServeHTTP(rec2, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	// assert
+	var status Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || status.Checks["bricks"] != "bricks are loading" || status.Checks["mesh"] != "ok" {
+		t.Fatalf("fail. not ready expected. %d %s", rec.Code, rec.Body.String())
+	}
+	if rec2.Code != http.StatusOK {
+		t.Fatalf("fail. ready expected. %d %s", rec2.Code, rec2.Body.String())
+	}
+}
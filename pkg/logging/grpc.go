@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func requestOfIncoming(ctx context.Context, logger *zap.Logger, method string) context.Context {
+	id := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(RequestIDHeader); len(ids) > 0 {
+			id = ids[0]
+		}
+	}
+	if id == "" {
+		id = xid.New().String()
+	}
+	ctx = withRequest(ctx, logger, id)
+	FromContext(ctx).Info("rpc", zap.String("method", method))
+	return ctx
+}
+
+// UnaryServerInterceptor gives each call an ID, taken from the metadata when the caller sent one, and logs the call.
+func UnaryServerInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(requestOfIncoming(ctx, logger, info.FullMethod), req)
+	}
+}
+
+type loggedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s loggedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamServerInterceptor gives each stream an ID, and logs the stream.
+func StreamServerInterceptor(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := requestOfIncoming(ss.Context(), logger, info.FullMethod)
+		return handler(srv, loggedServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// UnaryClientInterceptor passes the ID of the request in ctx on with each call.
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if id := RequestID(ctx); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(RequestIDHeader), id)
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
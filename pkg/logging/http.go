@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the ID of a request from clients, and from the proxy to calc nodes.
+const RequestIDHeader = "X-Request-ID"
+
+// Middleware gives each request an ID, taken from RequestIDHeader when the caller sent one,
+// and logs the request. Handlers log through FromContext(r.Context()) to have the ID in their logs.
+func Middleware(logger *zap.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if id == "" {
+				id = xid.New().String()
+			}
+			w.Header().Set(RequestIDHeader, id)
+			ctx := withRequest(r.Context(), logger, id)
+			FromContext(ctx).Info("request",
+				zap.String("remote_addr", r.RemoteAddr),
+				zap.String("method", r.Method),
+				zap.String("url", r.URL.String()),
+			)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// InjectRequestID passes the ID of the request in ctx on to a request to another node.
+func InjectRequestID(ctx context.Context, header http.Header) {
+	if id := RequestID(ctx); id != "" {
+		header.Set(RequestIDHeader, id)
+	}
+}
@@ -0,0 +1,93 @@
+// Package logging builds the structured, levelled loggers of featuredb.
+// Each subsystem names its logger, and every logger of the process shares one level,
+// which can be changed while the process runs.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// FormatJSON writes one JSON object per line.
+	FormatJSON = "json"
+	// FormatConsole writes tab separated fields for humans.
+	FormatConsole = "console"
+)
+
+// Config chooses the level and the format of the logs.
+type Config struct {
+	// Level is one of debug, info, warn and error.
+	Level  string
+	Format string
+}
+
+var level = zap.NewAtomicLevel()
+
+// New builds the root logger of the process. Subsystems take theirs with Named.
+func New(cfg Config) (*zap.Logger, error) {
+	if err := SetLevel(cfg.Level); err != nil {
+		return nil, err
+	}
+	encCfg := zap.NewProductionEncoderConfig()
+	encCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+	var enc zapcore.Encoder
+	switch cfg.Format {
+	case FormatJSON, "":
+		enc = zapcore.NewJSONEncoder(encCfg)
+	case FormatConsole:
+		encCfg.EncodeLevel = zapcore.CapitalLevelEncoder
+		enc = zapcore.NewConsoleEncoder(encCfg)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+	return zap.New(zapcore.NewCore(enc, zapcore.Lock(os.Stderr), level), zap.AddCaller()), nil
+}
+
+// SetLevel changes the level of every logger built by New.
+func SetLevel(l string) error {
+	return level.UnmarshalText([]byte(l))
+}
+
+// Level returns the current level.
+func Level() string {
+	return level.String()
+}
+
+// LevelHandler reads the level on GET and changes it on PUT with {"level": "debug"}.
+func LevelHandler() http.Handler {
+	return level
+}
+
+type loggerKey struct{}
+type requestIDKey struct{}
+
+// WithLogger returns ctx carrying the logger.
+func WithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of the request in ctx, which has its request ID.
+// It discards the logs when ctx has no logger.
+func FromContext(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return zap.NewNop()
+}
+
+// RequestID returns the ID of the request in ctx, or "" outside a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func withRequest(ctx context.Context, logger *zap.Logger, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return WithLogger(ctx, logger.With(zap.String("request_id", id)))
+}
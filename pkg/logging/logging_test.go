@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogging(t *testing.T) {
+	t.Run("it logs requests with their IDs successfully", testLogging_requestID)
+	t.Run("it changes the level at runtime successfully", testLogging_level)
+}
+
+func testLogging_requestID(t *testing.T) {
+	// prepare
+	core, logs := observer.New(zapcore.InfoLevel)
+	var forwarded http.Header
+	r := mux.NewRouter()
+	r.Use(Middleware(zap.New(core)))
+	r.HandleFunc("/api/v1/searchQuery", func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Info("searched")
+		forwarded = http.Header{}
+		InjectRequestID(r.Context(), forwarded)
+	})
+
+	// exec
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/searchQuery", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	rec2 := httptest.NewRecorder()
+	r.ServeHTTP(rec2, httptest.NewRequest(http.MethodPost, "/api/v1/searchQuery", nil))
+
+	// assert
+	if rec.Header().Get(RequestIDHeader) != "req-1" {
+		t.Fatalf("fail. request ID not match. %s", rec.Header().Get(RequestIDHeader))
+	}
+	generated := rec2.Header().Get(RequestIDHeader)
+	if generated == "" || generated == "req-1" || forwarded.Get(RequestIDHeader) != generated {
+		t.Fatalf("fail. request ID not generated. %s, forwarded %s", generated, forwarded.Get(RequestIDHeader))
+	}
+	entries := logs.FilterMessage("searched").All()
+	if len(entries) != 2 || entries[0].ContextMap()["request_id"] != "req-1" || entries[1].ContextMap()["request_id"] != generated {
+		t.Fatalf("fail. logs not match. %v", entries)
+	}
+}
+
+func testLogging_level(t *testing.T) {
+	// prepare
+	logger, err := New(Config{Level: "info"})
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	defer SetLevel("info")
+
+	// exec
+	req := httptest.NewRequest(http.MethodPut, "/admin/loglevel", strings.NewReader(`{"level": "debug"}`))
+	rec := httptest.NewRecorder()
+	LevelHandler().ServeHTTP(rec, req)
+
+	// assert
+	if rec.Code != http.StatusOK {
+		t.Fatalf("fail. status not match. %d %s", rec.Code, rec.Body.String())
+	}
+	if Level() != "debug" || !logger.Core().Enabled(zapcore.DebugLevel) {
+		t.Fatalf("fail. level not changed. %s", Level())
+	}
+	if err := SetLevel("verbose"); err == nil {
+		t.Fatalf("fail. unknown level accepted")
+	}
+	if _, err := New(Config{Format: "xml"}); err == nil {
+		t.Fatalf("fail. unknown format accepted")
+	}
+}
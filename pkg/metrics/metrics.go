@@ -0,0 +1,195 @@
+// Package metrics holds the Prometheus metrics of both roles, served on /metrics
+// together with the Go runtime and process metrics of the default registry.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "featuredb"
+
+// Calc nodes
+var (
+	NodeQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "node",
+		Name:      "queries_total",
+		Help:      "Number of queries searched on the calc node.",
+	}, []string{"namespace", "feature_group", "strategy"})
+	NodeSearchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "node",
+		Name:      "search_duration_seconds",
+		Help:      "Time to search a request of one or more queries in the bricks of the calc node.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"namespace", "feature_group", "strategy"})
+	DistanceComputations = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "node",
+		Name:      "distance_computations",
+		Help:      "Number of distances computed for a query on the calc node.",
+		Buckets:   prometheus.ExponentialBuckets(100, 4, 10),
+	}, []string{"namespace", "feature_group", "strategy"})
+	NodeInserts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "node",
+		Name:      "inserts_total",
+		Help:      "Number of data points inserted on the calc node, by registrations and imports.",
+	}, []string{"namespace", "feature_group"})
+	NodeInsertDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "node",
+		Name:      "insert_duration_seconds",
+		Help:      "Time to insert a batch of data points into a brick of the calc node.",
+		Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+	}, []string{"namespace", "feature_group"})
+)
+
+// Reverse proxies
+var (
+	ProxyQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "queries_total",
+		Help:      "Number of queries fanned out by the proxy.",
+	}, []string{"namespace", "feature_group"})
+	ProxySearchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "search_duration_seconds",
+		Help:      "Time to fan a request of one or more queries out to the calc nodes, retries included.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 10),
+	}, []string{"namespace", "feature_group"})
+	ProxyInserts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "inserts_total",
+		Help:      "Number of data points registered through the proxy.",
+	}, []string{"namespace", "feature_group"})
+	NodeRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "node_request_duration_seconds",
+		Help:      "Time of a request from the proxy to a calc node.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 10),
+	}, []string{"node", "protocol"})
+	NodeRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "node_request_errors_total",
+		Help:      "Number of failed requests from the proxy to a calc node.",
+	}, []string{"node", "protocol"})
+)
+
+// Both roles
+var (
+	GossipMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gossip",
+		Name:      "messages_total",
+		Help:      "Number of gossip messages received, by kind (gossip, broadcast or unicast).",
+	}, []string{"kind"})
+	GossipBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gossip",
+		Name:      "received_bytes_total",
+		Help:      "Size of the gossip messages received, by kind.",
+	}, []string{"kind"})
+)
+
+// Group formats a feature group ID as a label value.
+func Group(featureGroupID int) string {
+	return strconv.Itoa(featureGroupID)
+}
+
+var (
+	brickFillRatioDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "brick", "fill_ratio"),
+		"NumOfAvailablePoints / NumOfBrickTotalCap of a brick on the calc node.",
+		[]string{"unique_id", "brick_id", "namespace", "feature_group"}, nil,
+	)
+	brickAvailablePointsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "brick", "available_points"),
+		"Number of data points in a brick on the calc node.",
+		[]string{"unique_id", "brick_id", "namespace", "feature_group"}, nil,
+	)
+	brickCapacityDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "brick", "capacity"),
+		"Number of data points a brick on the calc node can hold.",
+		[]string{"unique_id", "brick_id", "namespace", "feature_group"}, nil,
+	)
+)
+
+// brickCollector reads the bricks of the pool on every scrape, so that removed bricks disappear.
+type brickCollector struct {
+	bp *brick.BrickPool
+}
+
+func (bc brickCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- brickFillRatioDesc
+	ch <- brickAvailablePointsDesc
+	ch <- brickCapacityDesc
+}
+
+func (bc brickCollector) Collect(ch chan<- prometheus.Metric) {
+	bricks, _ := bc.bp.GetAllBricks()
+	for _, fb := range bricks {
+		labels := []string{fb.GetUniqueIDstr(), fb.GetBrickIDstr(), fb.GetNamespace(), Group(fb.GetFeatureGroupIDint())}
+		ratio := 0.0
+		if fb.NumOfBrickTotalCap > 0 {
+			ratio = float64(fb.NumOfAvailablePoints) / float64(fb.NumOfBrickTotalCap)
+		}
+		ch <- prometheus.MustNewConstMetric(brickFillRatioDesc, prometheus.GaugeValue, ratio, labels...)
+		ch <- prometheus.MustNewConstMetric(brickAvailablePointsDesc, prometheus.GaugeValue, float64(fb.NumOfAvailablePoints), labels...)
+		ch <- prometheus.MustNewConstMetric(brickCapacityDesc, prometheus.GaugeValue, float64(fb.NumOfBrickTotalCap), labels...)
+	}
+}
+
+var registerBricksOnce sync.Once
+
+// RegisterBrickPool exports the fill of the bricks of the calc node.
+func RegisterBrickPool(bp *brick.BrickPool) {
+	registerBricksOnce.Do(func() {
+		prometheus.MustRegister(brickCollector{bp: bp})
+	})
+}
+
+// Handler serves every metric in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveSearch records a request of queries which were searched in the bricks.
+// Every data point of a brick is compared with each query, since the strategies are exhaustive.
+func ObserveSearch(fps []*brick.FeatureBrick, queries int, elapsed time.Duration) {
+	if len(fps) == 0 {
+		return
+	}
+	ns, group, strategy := fps[0].GetNamespace(), Group(fps[0].GetFeatureGroupIDint()), fps[0].StrategyName()
+	NodeQueries.WithLabelValues(ns, group, strategy).Add(float64(queries))
+	NodeSearchDuration.WithLabelValues(ns, group, strategy).Observe(elapsed.Seconds())
+	points := 0
+	for _, fp := range fps {
+		points += fp.NumOfAvailablePoints
+	}
+	computations := DistanceComputations.WithLabelValues(ns, group, strategy)
+	for i := 0; i < queries; i++ {
+		computations.Observe(float64(points))
+	}
+}
+
+// ObserveInsert records a batch of data points inserted into a brick of the feature group of the namespace.
+func ObserveInsert(namespace string, featureGroupID int, inserted int, elapsed time.Duration) {
+	group := Group(featureGroupID)
+	NodeInserts.WithLabelValues(namespace, group).Add(float64(inserted))
+	NodeInsertDuration.WithLabelValues(namespace, group).Observe(elapsed.Seconds())
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/data"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBrickCollector(t *testing.T) {
+	t.Run("it exports the fill of bricks successfully", testBrickCollector_fill)
+}
+
+func testBrickCollector_fill(t *testing.T) {
+	// prepare
+	bp := &brick.BrickPool{}
+	bp.InitBrickPool()
+	fb := brick.NewBrick(4, brick.BrickFeatureGroupID(3), brick.NewLinerFindStrategy())
+	fb.Namespace = "team-a"
+	pv := data.NewPosVector(true, 512)
+	fb.AddNewDataPoint(&pv)
+	bp.RegisterIntoPool(&fb)
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(brickCollector{bp: bp})
+
+	// exec
+	mfs, err := reg.Gather()
+
+	// assert
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	values := map[string]float64{}
+	namespaced := 0
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "feature_group" && l.GetValue() != "3" {
+					t.Fatalf("fail. feature group not match. %s", l.GetValue())
+				}
+				if l.GetName() == "namespace" {
+					if l.GetValue() != "team-a" {
+						t.Fatalf("fail. namespace not match. %s", l.GetValue())
+					}
+					namespaced++
+				}
+			}
+			values[mf.GetName()] = m.GetGauge().GetValue()
+		}
+	}
+	if namespaced != 3 {
+		t.Fatalf("fail. metrics without namespace. %d", namespaced)
+	}
+	if values["featuredb_brick_fill_ratio"] != 0.25 || values["featuredb_brick_capacity"] != 4 || values["featuredb_brick_available_points"] != 1 {
+		t.Fatalf("fail. values not match. %v", values)
+	}
+}
@@ -0,0 +1,153 @@
+// Package reload applies a new configuration to a running process on SIGHUP or POST /admin/reload.
+// Only the settings listed by config.Diff are applied. The others are reported and wait for a restart.
+package reload
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/config"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// Apply puts the settings of new into effect. It is called only with a valid configuration,
+// so it must not fail halfway.
+type Apply func(old, new *config.Config)
+
+// Result tells what a reload did.
+type Result struct {
+	Time    time.Time `json:"time"`
+	Trigger string    `json:"trigger"`
+	Applied bool      `json:"applied"`
+	// Changes are the settings which have been applied.
+	Changes []config.Change `json:"changes"`
+	// RequiresRestart are the changed settings which have not been applied.
+	RequiresRestart []string `json:"requiresRestart,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// Reloader loads the configuration again and applies it.
+// Reloads run one at a time, and a configuration which fails to load or validate changes nothing.
+type Reloader struct {
+	mtx     sync.Mutex
+	load    func() (*config.Config, error)
+	current *config.Config
+	applies []Apply
+	last    *Result
+	logger  *zap.Logger
+}
+
+// New makes a Reloader of the process which has started with cfg. load reads the configuration
+// the same way as on startup.
+func New(cfg *config.Config, load func() (*config.Config, error), logger *zap.Logger) *Reloader {
+	return &Reloader{
+		load:    load,
+		current: cfg,
+		logger:  logger.Named("reload"),
+	}
+}
+
+// OnReload adds apply, which is called in the order of addition on every successful reload.
+func (rl *Reloader) OnReload(apply Apply) {
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+	rl.applies = append(rl.applies, apply)
+}
+
+// Reload loads the configuration and applies the reloadable settings which have changed.
+func (rl *Reloader) Reload(trigger string) Result {
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+
+	result := Result{Time: time.Now(), Trigger: trigger, Changes: []config.Change{}}
+	defer func() {
+		rl.last = &result
+	}()
+	cfg, err := rl.load()
+	if err != nil {
+		result.Error = err.Error()
+		rl.logger.Error("config not reloaded", zap.String("trigger", trigger), zap.Error(err))
+		return result
+	}
+
+	changes, restart := config.Diff(rl.current, cfg)
+	// Settings which need a restart keep their values, so that they are reported again until then.
+	reloaded := config.Reloaded(rl.current, cfg)
+	// The level is the only setting which can fail to apply, so it is applied first
+	// and a failure leaves the whole config as it was.
+	if reloaded.Logging.Level != rl.current.Logging.Level {
+		if err := logging.SetLevel(reloaded.Logging.Level); err != nil {
+			result.Error = err.Error()
+			rl.logger.Error("config not reloaded", zap.String("trigger", trigger), zap.Error(err))
+			return result
+		}
+	}
+	for _, apply := range rl.applies {
+		apply(rl.current, reloaded)
+	}
+	rl.current = reloaded
+
+	result.Applied = true
+	result.Changes = append(result.Changes, changes...)
+	result.RequiresRestart = restart
+	rl.logger.Info("config reloaded",
+		zap.String("trigger", trigger),
+		zap.Any("changes", result.Changes),
+		zap.Strings("requiresRestart", restart),
+	)
+	return result
+}
+
+// NotifySignal reloads whenever the process receives one of sigs, typically SIGHUP.
+func (rl *Reloader) NotifySignal(sigs ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	go func() {
+		for sig := range c {
+			rl.Reload(sig.String())
+		}
+	}()
+}
+
+// Handler reloads on POST and answers the result, with 422 when the configuration is invalid.
+// GET answers the result of the last reload.
+func (rl *Reloader) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var result *Result
+		switch r.Method {
+		case http.MethodGet:
+			rl.mtx.Lock()
+			result = rl.last
+			rl.mtx.Unlock()
+		case http.MethodPost:
+			res := rl.Reload("api")
+			result = &res
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+			return
+		}
+		if result == nil {
+			jsonBytes, _ := json.Marshal(struct {
+				Msg string `json:"msg"`
+			}{"Not reloaded yet."})
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(jsonBytes)
+			return
+		}
+		code := http.StatusOK
+		if !result.Applied {
+			code = http.StatusUnprocessableEntity
+		}
+		jsonBytes, _ := json.Marshal(result)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		w.Write(jsonBytes)
+	}
+}
@@ -0,0 +1,111 @@
+package reload
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/config"
+	"github.com/abeja-inc/feature-search-db/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+func TestReloader(t *testing.T) {
+	t.Run("it applies reloadable settings successfully", testReloader_apply)
+	t.Run("it keeps the config when it is invalid successfully", testReloader_invalid)
+	t.Run("it keeps the config when the log level fails to apply successfully", testReloader_level)
+}
+
+func testReloader_apply(t *testing.T) {
+	// prepare
+	next := config.Default()
+	next.Search.NodeTimeout = config.Duration(2 * time.Second)
+	next.Node.Labels = map[string]string{"gpu": "true"}
+	next.Listen.FeatureAPI = ":9081"
+	rl := New(config.Default(), func() (*config.Config, error) { return next, nil }, zap.NewNop())
+	var applied *config.Config
+	rl.OnReload(func(old, new *config.Config) {
+		applied = new
+	})
+
+	// exec
+	rec := httptest.NewRecorder()
+	rl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/reload", nil))
+	again := rl.Reload("test")
+
+	// assert
+	var result Result
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if rec.Code != http.StatusOK || !result.Applied || len(result.Changes) != 2 {
+		t.Fatalf("fail. changes not applied. %d %s", rec.Code, rec.Body.String())
+	}
+	if result.Changes[0].Key != "node.labels.gpu" || result.Changes[1].Key != "search.nodeTimeout" || result.Changes[1].New != "2s" {
+		t.Fatalf("fail. unexpected changes. %+v", result.Changes)
+	}
+	if len(result.RequiresRestart) != 1 || result.RequiresRestart[0] != "listen" {
+		t.Fatalf("fail. restart not reported. %v", result.RequiresRestart)
+	}
+	if applied == nil || time.Duration(applied.Search.NodeTimeout) != 2*time.Second || applied.Listen.FeatureAPI != ":8081" {
+		t.Fatalf("fail. settings which need a restart must keep their values. %+v", applied)
+	}
+	if len(again.Changes) != 0 || len(again.RequiresRestart) != 1 {
+		t.Fatalf("fail. a second reload changes nothing. %+v", again)
+	}
+}
+
+func testReloader_invalid(t *testing.T) {
+	// prepare
+	rl := New(config.Default(), func() (*config.Config, error) { return nil, errors.New("unknown key") }, zap.NewNop())
+	called := false
+	rl.OnReload(func(old, new *config.Config) {
+		called = true
+	})
+
+	// exec
+	rec := httptest.NewRecorder()
+	rl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/reload", nil))
+	last := httptest.NewRecorder()
+	rl.Handler().ServeHTTP(last, httptest.NewRequest(http.MethodGet, "/admin/reload", nil))
+
+	// assert
+	if rec.Code != http.StatusUnprocessableEntity || called {
+		t.Fatalf("fail. invalid config applied. %d %s", rec.Code, rec.Body.String())
+	}
+	if last.Code != http.StatusUnprocessableEntity || last.Body.String() != rec.Body.String() {
+		t.Fatalf("fail. last result not kept. %d %s", last.Code, last.Body.String())
+	}
+}
+
+func testReloader_level(t *testing.T) {
+	// prepare
+	before := logging.Level()
+	defer logging.SetLevel(before)
+	next := config.Default()
+	next.Logging.Level = "verbose"
+	next.Search.NodeTimeout = config.Duration(2 * time.Second)
+	rl := New(config.Default(), func() (*config.Config, error) { return next, nil }, zap.NewNop())
+	called := false
+	rl.OnReload(func(old, new *config.Config) {
+		called = true
+	})
+
+	// exec
+	result := rl.Reload("test")
+	calledOnFailure := called
+	next.Logging.Level = "debug"
+	again := rl.Reload("test")
+
+	// assert
+	if result.Applied || result.Error == "" || calledOnFailure {
+		t.Fatalf("fail. config applied with an unknown level. %+v", result)
+	}
+	if len(again.Changes) != 2 || again.Changes[0].Key != "logging.level" || logging.Level() != "debug" {
+		t.Fatalf("fail. changes of the failed reload not applied later. %+v %s", again, logging.Level())
+	}
+}
@@ -0,0 +1,126 @@
+// Package slowlog keeps the latest slow queries of a process in a ring buffer.
+package slowlog
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultSize is the number of slow queries kept by each process.
+const DefaultSize = 128
+
+// Entry is a query which took the threshold or longer.
+// Explain is the SearchExplain of a calc node or the ProxyExplain of a proxy.
+type Entry struct {
+	Time           time.Time   `json:"time"`
+	RequestID      string      `json:"requestID,omitempty"`
+	Endpoint       string      `json:"endpoint"`
+	Namespace      string      `json:"namespace"`
+	FeatureGroupID int         `json:"featureGroupID"`
+	Queries        int         `json:"queries"`
+	ElapsedTime    int64       `json:"elapsedTime"`
+	Explain        interface{} `json:"explain,omitempty"`
+}
+
+// Log keeps the latest slow queries. The oldest entry is dropped when it is full.
+type Log struct {
+	mtx       sync.Mutex
+	threshold time.Duration
+	entries   []Entry
+	next      int
+	full      bool
+}
+
+// New makes a Log of size entries. A threshold of 0 keeps no queries.
+func New(size int, threshold time.Duration) *Log {
+	return &Log{
+		threshold: threshold,
+		entries:   make([]Entry, size),
+	}
+}
+
+// SetThreshold changes the time from which a query is slow.
+func (l *Log) SetThreshold(threshold time.Duration) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.threshold = threshold
+}
+
+// Threshold returns the time from which a query is slow.
+func (l *Log) Threshold() time.Duration {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.threshold
+}
+
+// IsSlow tells whether a query which took elapsed is kept.
+func (l *Log) IsSlow(elapsed time.Duration) bool {
+	threshold := l.Threshold()
+	return threshold > 0 && elapsed >= threshold
+}
+
+// Record keeps e when it is slow, and tells whether it is kept.
+func (l *Log) Record(e Entry) bool {
+	if !l.IsSlow(time.Duration(e.ElapsedTime)) {
+		return false
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+	return true
+}
+
+// Entries returns the slow queries kept, the newest first.
+func (l *Log) Entries() []Entry {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	ret := make([]Entry, 0, n)
+	for i := 1; i <= n; i++ {
+		ret = append(ret, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return ret
+}
+
+// Reset drops all the entries.
+func (l *Log) Reset() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.entries = make([]Entry, len(l.entries))
+	l.next = 0
+	l.full = false
+}
+
+// Handler lists the slow queries on GET and drops them on DELETE.
+func (l *Log) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			jsonBytes, _ := json.Marshal(struct {
+				Threshold string  `json:"threshold"`
+				Entries   []Entry `json:"entries"`
+			}{l.Threshold().String(), l.Entries()})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(jsonBytes)
+		case http.MethodDelete:
+			l.Reset()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Invalid method"))
+		}
+	}
+}
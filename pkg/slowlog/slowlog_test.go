@@ -0,0 +1,70 @@
+package slowlog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	t.Run("it keeps the latest slow queries successfully", testLog_record)
+	t.Run("it lists slow queries over HTTP successfully", testLog_handler)
+}
+
+func testLog_record(t *testing.T) {
+	// prepare
+	l := New(3, 10*time.Millisecond)
+
+	// exec
+	kept := l.Record(Entry{Queries: 1, ElapsedTime: int64(time.Millisecond)})
+	for i := 2; i <= 5; i++ {
+		l.Record(Entry{Queries: i, ElapsedTime: int64(10 * time.Millisecond)})
+	}
+
+	// assert
+	if kept {
+		t.Fatalf("fail. fast query kept")
+	}
+	entries := l.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("fail. num of entries not match. %d", len(entries))
+	}
+	for i, want := range []int{5, 4, 3} {
+		if entries[i].Queries != want || entries[i].Time.IsZero() {
+			t.Fatalf("fail. entry %d not match. %v", i, entries[i])
+		}
+	}
+	l.SetThreshold(0)
+	if l.Record(Entry{ElapsedTime: int64(time.Hour)}) {
+		t.Fatalf("fail. query kept with threshold 0")
+	}
+}
+
+func testLog_handler(t *testing.T) {
+	// prepare
+	l := New(DefaultSize, time.Millisecond)
+	l.Record(Entry{Endpoint: "/api/v1/searchQuery", ElapsedTime: int64(time.Second)})
+
+	// exec
+	rec := httptest.NewRecorder()
+	l.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/slowqueries", nil))
+	rec2 := httptest.NewRecorder()
+	l.Handler().ServeHTTP(rec2, httptest.NewRequest(http.MethodDelete, "/admin/slowqueries", nil))
+
+	// assert
+	var resp struct {
+		Threshold string  `json:"threshold"`
+		Entries   []Entry `json:"entries"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if resp.Threshold != "1ms" || len(resp.Entries) != 1 || resp.Entries[0].Endpoint != "/api/v1/searchQuery" {
+		t.Fatalf("fail. response not match. %s", rec.Body.String())
+	}
+	if rec2.Code != http.StatusNoContent || len(l.Entries()) != 0 {
+		t.Fatalf("fail. entries not dropped. %d", rec2.Code)
+	}
+}
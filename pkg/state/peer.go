@@ -1,12 +1,15 @@
 package state
 
 import (
-	"log"
 	"bytes"
 	"encoding/gob"
+	"sort"
 
 	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+	"github.com/abeja-inc/feature-search-db/pkg/metrics"
 	"github.com/weaveworks/mesh"
+	"go.uber.org/zap"
 )
 
 // Peer encapsulates State and implements mesh.Gossiper.
@@ -18,31 +21,37 @@ type Peer struct {
 	send    mesh.Gossip
 	actions chan<- func()
 	quit    chan struct{}
-	logger  *log.Logger
+	logger  *zap.Logger
 }
 
 type PeerConfig struct {
-	ipAddress string
+	ipAddress            string
 	featureApiHttpListen string
+	grpcListen           string
 }
 
 func NewPeerConfig(
 	ipAddress string,
 	featureApiHttpListen string,
-	)PeerConfig{
+	grpcListen string,
+) PeerConfig {
 	return PeerConfig{
 		ipAddress:            ipAddress,
 		featureApiHttpListen: featureApiHttpListen,
+		grpcListen:           grpcListen,
 	}
 }
 
 // peer implements mesh.Gossiper.
 var _ mesh.Gossiper = &Peer{}
 
+// peer replicates the catalog.
+var _ catalog.Store = &Peer{}
+
 // Construct a peer with empty State.
 // Be sure to Register a channel, later,
 // so we can make outbound communication.
-func NewPeer(self mesh.PeerName, logger *log.Logger) *Peer {
+func NewPeer(self mesh.PeerName, logger *zap.Logger) *Peer {
 	actions := make(chan func())
 	p := &Peer{
 		st:      newState(self),
@@ -84,7 +93,7 @@ func (p *Peer) Del() (result StateContent) {
 		if p.send != nil {
 			p.send.GossipBroadcast(st)
 		} else {
-			p.logger.Printf("no sender configured; not broadcasting update right now")
+			p.logger.Warn("no sender configured; not broadcasting update right now")
 		}
 		result = st.getAllState()
 	}
@@ -100,7 +109,24 @@ func (p *Peer) SetNodeInfo(peerConf PeerConfig, bp *brick.BrickPool) (result Sta
 		if p.send != nil {
 			p.send.GossipBroadcast(st)
 		} else {
-			p.logger.Printf("no sender configured; not broadcasting update right now")
+			p.logger.Warn("no sender configured; not broadcasting update right now")
+		}
+		result = st.getAllState()
+	}
+	<-c
+	return result
+}
+
+// SetNodeMeta updates the metadata of this node and broadcasts it.
+func (p *Peer) SetNodeMeta(form NodeMetaForm) (result StateContent) {
+	c := make(chan struct{})
+	p.actions <- func() {
+		defer close(c)
+		st := p.st.setNodeMeta(form)
+		if p.send != nil {
+			p.send.GossipBroadcast(st)
+		} else {
+			p.logger.Warn("no sender configured; not broadcasting update right now")
 		}
 		result = st.getAllState()
 	}
@@ -108,59 +134,211 @@ func (p *Peer) SetNodeInfo(peerConf PeerConfig, bp *brick.BrickPool) (result Sta
 	return result
 }
 
+// SetGroup writes a feature group to the catalog and broadcasts it.
+func (p *Peer) SetGroup(g catalog.Group) {
+	c := make(chan struct{})
+	p.actions <- func() {
+		defer close(c)
+		st := p.st.setGroup(g)
+		if p.send != nil {
+			p.send.GossipBroadcast(st)
+		} else {
+			p.logger.Warn("no sender configured; not broadcasting update right now")
+		}
+	}
+	<-c
+}
+
+// AddGroup writes a new feature group to the catalog and broadcasts it,
+// unless the namespace has a group of its ID or name.
+func (p *Peer) AddGroup(g catalog.Group) error {
+	c := make(chan error, 1)
+	p.actions <- func() {
+		st, err := p.st.addGroup(g)
+		if err != nil {
+			c <- err
+			return
+		}
+		if p.send != nil {
+			p.send.GossipBroadcast(st)
+		} else {
+			p.logger.Warn("no sender configured; not broadcasting update right now")
+		}
+		c <- nil
+	}
+	return <-c
+}
+
+// Groups returns the feature groups of the namespace in the order of their IDs.
+func (p *Peer) Groups(namespace string) []catalog.Group {
+	groups := p.st.getGroups(namespace)
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups
+}
+
+// Group returns the feature group of id in the namespace unless it is unknown or deleted.
+func (p *Peer) Group(namespace string, id int) (catalog.Group, bool) {
+	return p.st.getGroup(namespace, id)
+}
+
+// SetAlias writes an alias to the catalog and broadcasts it.
+// Each node sees either the old or the new feature group of the alias, never a mix.
+func (p *Peer) SetAlias(a catalog.Alias) {
+	c := make(chan struct{})
+	p.actions <- func() {
+		defer close(c)
+		st := p.st.setAlias(a)
+		if p.send != nil {
+			p.send.GossipBroadcast(st)
+		} else {
+			p.logger.Warn("no sender configured; not broadcasting update right now")
+		}
+	}
+	<-c
+}
+
+// CompareAndSetAlias repoints an alias and broadcasts it only if it points at the feature group of from.
+func (p *Peer) CompareAndSetAlias(a catalog.Alias, from int) bool {
+	c := make(chan bool, 1)
+	p.actions <- func() {
+		st, ok := p.st.compareAndSetAlias(a, from)
+		if !ok {
+			c <- false
+			return
+		}
+		if p.send != nil {
+			p.send.GossipBroadcast(st)
+		} else {
+			p.logger.Warn("no sender configured; not broadcasting update right now")
+		}
+		c <- true
+	}
+	return <-c
+}
+
+// Aliases returns the aliases of the namespace in the order of their names.
+func (p *Peer) Aliases(namespace string) []catalog.Alias {
+	aliases := p.st.getAliases(namespace)
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+	return aliases
+}
+
+// Alias returns the alias of name in the namespace unless it is unknown or deleted.
+func (p *Peer) Alias(namespace string, name string) (catalog.Alias, bool) {
+	return p.st.getAlias(namespace, name)
+}
+
+// SetNamespace writes a namespace to the catalog and broadcasts it.
+func (p *Peer) SetNamespace(n catalog.Namespace) {
+	c := make(chan struct{})
+	p.actions <- func() {
+		defer close(c)
+		st := p.st.setNamespace(n)
+		if p.send != nil {
+			p.send.GossipBroadcast(st)
+		} else {
+			p.logger.Warn("no sender configured; not broadcasting update right now")
+		}
+	}
+	<-c
+}
+
+// Namespaces returns the namespaces of the catalog in the order of their names.
+func (p *Peer) Namespaces() []catalog.Namespace {
+	namespaces := p.st.getNamespaces()
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Name < namespaces[j].Name })
+	return namespaces
+}
+
+// Namespace returns the namespace of name unless it is unknown or deleted.
+func (p *Peer) Namespace(name string) (catalog.Namespace, bool) {
+	return p.st.getNamespace(name)
+}
+
+// Usage returns what the bricks of the namespace hold on the nodes of the cluster.
+func (p *Peer) Usage(namespace string) catalog.Usage {
+	return p.GetAllState().Usage(namespace)
+}
+
+// GetNodeMeta returns the metadata of this node.
+func (p *Peer) GetNodeMeta() NodeMeta {
+	return p.st.getNodeMeta()
+}
+
 func (p *Peer) stop() {
 	close(p.quit)
 }
 
+func observeGossip(kind string, buf []byte) {
+	metrics.GossipMessages.WithLabelValues(kind).Inc()
+	metrics.GossipBytes.WithLabelValues(kind).Add(float64(len(buf)))
+}
+
+// countNodes counts the node infos in a set, which the gossip logs show instead of the whole set.
+func countNodes(set map[mesh.PeerName]StateContent) int {
+	n := 0
+	for _, v := range set {
+		n += len(v.NodeInfos)
+	}
+	return n
+}
+
+func countNodesOf(data mesh.GossipData) int {
+	if st, ok := data.(*State); ok && st != nil {
+		return countNodes(st.set)
+	}
+	return 0
+}
+
 // Return a copy of our complete State.
 func (p *Peer) Gossip() (complete mesh.GossipData) {
 	complete = p.st.copy()
-	p.logger.Printf("Gossip => complete %v", complete.(*State).set)
+	p.logger.Debug("gossip", zap.Int("nodes", countNodesOf(complete)))
 	return complete
 }
 
 // Merge the gossiped data represented by buf into our State.
 // Return the State information that was modified.
 func (p *Peer) OnGossip(buf []byte) (delta mesh.GossipData, err error) {
+	observeGossip("gossip", buf)
 	var set map[mesh.PeerName]StateContent
 	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&set); err != nil {
 		return nil, err
 	}
 
+	received := countNodes(set)
 	delta = p.st.mergeDelta(set)
-	if delta == nil {
-		p.logger.Printf("OnGossip %v => delta %v", set, delta)
-	} else {
-		p.logger.Printf("OnGossip %v => delta %v", set, delta.(*State).set)
-	}
+	p.logger.Debug("on gossip", zap.Int("bytes", len(buf)), zap.Int("nodes", received), zap.Int("delta", countNodesOf(delta)))
 	return delta, nil
 }
 
 // Merge the gossiped data represented by buf into our State.
 // Return the State information that was modified.
 func (p *Peer) OnGossipBroadcast(src mesh.PeerName, buf []byte) (received mesh.GossipData, err error) {
+	observeGossip("broadcast", buf)
 	var set map[mesh.PeerName]StateContent
 	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&set); err != nil {
 		return nil, err
 	}
 
+	nodes := countNodes(set)
 	received = p.st.mergeReceived(set)
-	if received == nil {
-		p.logger.Printf("OnGossipBroadcast %s %v => delta %v", src, set, received)
-	} else {
-		p.logger.Printf("OnGossipBroadcast %s %v => delta %v", src, set, received.(*State).set)
-	}
+	p.logger.Debug("on gossip broadcast", zap.Stringer("src", src), zap.Int("bytes", len(buf)),
+		zap.Int("nodes", nodes), zap.Int("delta", countNodesOf(received)))
 	return received, nil
 }
 
 // Merge the gossiped data represented by buf into our State.
 func (p *Peer) OnGossipUnicast(src mesh.PeerName, buf []byte) error {
+	observeGossip("unicast", buf)
 	var set map[mesh.PeerName]StateContent
 	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&set); err != nil {
 		return err
 	}
 
+	nodes := countNodes(set)
 	complete := p.st.mergeComplete(set)
-	p.logger.Printf("OnGossipUnicast %s %v => complete %v", src, set, complete)
+	p.logger.Debug("on gossip unicast", zap.Stringer("src", src), zap.Int("bytes", len(buf)),
+		zap.Int("nodes", nodes), zap.Int("complete", countNodesOf(complete)))
 	return nil
 }
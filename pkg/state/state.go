@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"encoding/gob"
 	"fmt"
-	"log"
+	"net"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
 
 	"github.com/weaveworks/mesh"
 )
@@ -17,25 +19,178 @@ type BrickInfo struct {
 	UniqueID             string `json:"uniqueID"`
 	BrickID              string `json:"brickID"`
 	FeatureGroupID       int    `json:"groupID"`
+	Namespace            string `json:"namespace"`
 	NumOfBrickTotalCap   int    `json:"numOfBrickTotalCap"`
 	NumOfAvailablePoints int    `json:"numOfAvailablePoints"`
 }
 
+// BrickInfoOf describes a brick of this node.
+func BrickInfoOf(fb *brick.FeatureBrick) BrickInfo {
+	return BrickInfo{
+		UniqueID:             fb.GetUniqueIDstr(),
+		BrickID:              fb.GetBrickIDstr(),
+		FeatureGroupID:       fb.GetFeatureGroupIDint(),
+		Namespace:            fb.GetNamespace(),
+		NumOfBrickTotalCap:   fb.NumOfBrickTotalCap,
+		NumOfAvailablePoints: fb.NumOfAvailablePoints,
+	}
+}
+
+// GetNamespace returns the namespace of the brick. Nodes of older versions leave it empty.
+func (bi BrickInfo) GetNamespace() string {
+	if bi.Namespace == "" {
+		return catalog.DefaultNamespace
+	}
+	return bi.Namespace
+}
+
+// NodeMeta is the metadata of a node which is set by operators
+// through the state API. The proxy uses it when routing.
+type NodeMeta struct {
+	Labels         map[string]string `json:"labels"`
+	Zone           string            `json:"zone"`
+	Draining       bool              `json:"draining"`
+	CapacityWeight float64           `json:"capacityWeight"`
+}
+
+// NodeMetaForm is a partial update of NodeMeta. Nil fields are left as they are,
+// and a label with an empty value is removed.
+type NodeMetaForm struct {
+	Labels         map[string]string `json:"labels"`
+	Zone           *string           `json:"zone"`
+	Draining       *bool             `json:"draining"`
+	CapacityWeight *float64          `json:"capacityWeight"`
+}
+
+const DefaultCapacityWeight = 1.0
+
+func newNodeMeta() NodeMeta {
+	return NodeMeta{
+		Labels:         map[string]string{},
+		CapacityWeight: DefaultCapacityWeight,
+	}
+}
+
+// Weight returns the capacity weight of the node. Nodes of versions which did not gossip a weight
+// have none, and are weighted as DefaultCapacityWeight.
+func (nm NodeMeta) Weight() float64 {
+	if nm.CapacityWeight <= 0 {
+		return DefaultCapacityWeight
+	}
+	return nm.CapacityWeight
+}
+
+func (nm NodeMeta) apply(form NodeMetaForm) NodeMeta {
+	labels := make(map[string]string, len(nm.Labels)+len(form.Labels))
+	for k, v := range nm.Labels {
+		labels[k] = v
+	}
+	for k, v := range form.Labels {
+		if v == "" {
+			delete(labels, k)
+			continue
+		}
+		labels[k] = v
+	}
+	nm.Labels = labels
+	if form.Zone != nil {
+		nm.Zone = *form.Zone
+	}
+	if form.Draining != nil {
+		nm.Draining = *form.Draining
+	}
+	if form.CapacityWeight != nil {
+		nm.CapacityWeight = *form.CapacityWeight
+	}
+	return nm
+}
+
 type NodeInfo struct {
 	Bricks        *[]BrickInfo `json:"bricks"`
 	Count         int          `json:"count"`
 	IpAddress     string       `json:"ipAddress"`
 	ApiPort       string       `json:"api_port"`
+	GrpcPort      string       `json:"grpc_port,omitempty"`
+	Meta          NodeMeta     `json:"meta"`
 	LaunchAt      time.Time    `json:"launch_at"`
 	LastUpdatedAt time.Time    `json:"last_updated_at"`
 }
 
 func (ni *NodeInfo) GetLastUpdatedAt() int64 {
-	return ni.LastUpdatedAt.Unix()
+	if ni.LastUpdatedAt.IsZero() {
+		return 0
+	}
+	return ni.LastUpdatedAt.UnixNano()
+}
+
+// IsAlive reports whether the node has sent a heartbeat within timeout.
+func (ni *NodeInfo) IsAlive(timeout time.Duration) bool {
+	return !ni.isDeleted() && time.Since(ni.LastUpdatedAt) <= timeout
+}
+
+// isDeleted reports whether ni is the tombstone which Del broadcasts.
+func (ni *NodeInfo) isDeleted() bool {
+	return ni.Bricks == nil && ni.LastUpdatedAt.IsZero()
+}
+
+// APIAddress returns "host:port" of the feature API of the node.
+// ApiPort holds the listen address, so its host part is replaced by IpAddress.
+func (ni *NodeInfo) APIAddress() string {
+	return ni.addressOf(ni.ApiPort)
+}
+
+// GrpcAddress returns "host:port" of the gRPC API of the node,
+// or "" when the node does not serve it.
+func (ni *NodeInfo) GrpcAddress() string {
+	if ni.GrpcPort == "" {
+		return ""
+	}
+	return ni.addressOf(ni.GrpcPort)
+}
+
+func (ni *NodeInfo) addressOf(listen string) string {
+	_, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		port = strings.TrimPrefix(listen, ":")
+	}
+	return net.JoinHostPort(ni.IpAddress, port)
 }
 
 type StateContent struct {
 	NodeInfos map[string]NodeInfo
+	// Groups are the definitions of feature groups which the peer has written, tombstones included.
+	// They are keyed by catalog.Group.Key, and across peers, the last update of a group wins.
+	Groups map[string]catalog.Group
+	// Aliases are the names of feature groups which the peer has written, tombstones included.
+	// They are keyed by catalog.Alias.Key, and across peers, the last update of an alias wins.
+	Aliases map[string]catalog.Alias
+	// Namespaces are the namespaces which the peer has written, tombstones included.
+	// Across peers, the last update of a namespace wins.
+	Namespaces map[string]catalog.Namespace
+}
+
+// Usage sums what the bricks of the namespace hold on the nodes of the state.
+// Data points of replicas are counted once, and their memory on every node.
+func (sc StateContent) Usage(namespace string) catalog.Usage {
+	var u catalog.Usage
+	seen := map[string]struct{}{}
+	for _, ni := range sc.NodeInfos {
+		if ni.Bricks == nil {
+			continue
+		}
+		for _, b := range *ni.Bricks {
+			if b.GetNamespace() != namespace {
+				continue
+			}
+			u.MemoryBytes += int64(b.NumOfBrickTotalCap) * brick.PointSize
+			if _, ok := seen[b.BrickID]; ok {
+				continue
+			}
+			seen[b.BrickID] = struct{}{}
+			u.Vectors += b.NumOfAvailablePoints
+		}
+	}
+	return u
 }
 
 // State is an implementation of a G-counter.
@@ -43,6 +198,7 @@ type State struct {
 	mtx  sync.RWMutex
 	set  map[mesh.PeerName]StateContent
 	self mesh.PeerName
+	meta NodeMeta
 }
 
 // State implements GossipData.
@@ -55,6 +211,7 @@ func newState(self mesh.PeerName) *State {
 	return &State{
 		set:  map[mesh.PeerName]StateContent{},
 		self: self,
+		meta: newNodeMeta(),
 	}
 }
 
@@ -68,7 +225,7 @@ func (st *State) getAllState() (result StateContent) {
 		for nodeInfoKey, nodeInfoVal := range v.NodeInfos {
 			resultNodeInfo := result.NodeInfos[nodeInfoKey]
 			// Deleted
-			if nodeInfoVal == (NodeInfo{}) {
+			if nodeInfoVal.isDeleted() {
 				continue
 			}
 			if nodeInfoVal.GetLastUpdatedAt() > resultNodeInfo.GetLastUpdatedAt() {
@@ -76,9 +233,320 @@ func (st *State) getAllState() (result StateContent) {
 			}
 		}
 	}
+	// Groups
+	result.Groups = map[string]catalog.Group{}
+	for key, g := range st.latestGroups() {
+		if !g.Deleted {
+			result.Groups[key] = g
+		}
+	}
+	// Aliases
+	result.Aliases = map[string]catalog.Alias{}
+	for name, a := range st.latestAliases() {
+		if !a.Deleted {
+			result.Aliases[name] = a
+		}
+	}
+	// Namespaces
+	result.Namespaces = map[string]catalog.Namespace{}
+	for name, n := range st.latestNamespaces() {
+		if !n.Deleted {
+			result.Namespaces[name] = n
+		}
+	}
 	return result
 }
 
+// latestGroups returns the last update of each feature group, tombstones included.
+func (st *State) latestGroups() map[string]catalog.Group {
+	groups := map[string]catalog.Group{}
+	for _, v := range st.set {
+		for key, g := range v.Groups {
+			if g.UpdatedAt.After(groups[key].UpdatedAt) {
+				groups[key] = g
+			}
+		}
+	}
+	return groups
+}
+
+func (st *State) getGroups(namespace string) []catalog.Group {
+	st.mtx.RLock()
+	defer st.mtx.RUnlock()
+	groups := []catalog.Group{}
+	for _, g := range st.latestGroups() {
+		if !g.Deleted && g.Namespace == namespace {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+func (st *State) getGroup(namespace string, id int) (catalog.Group, bool) {
+	st.mtx.RLock()
+	defer st.mtx.RUnlock()
+	key := catalog.Group{Namespace: namespace, ID: id}.Key()
+	var latest catalog.Group
+	for _, v := range st.set {
+		if g, ok := v.Groups[key]; ok && g.UpdatedAt.After(latest.UpdatedAt) {
+			latest = g
+		}
+	}
+	return latest, !latest.UpdatedAt.IsZero() && !latest.Deleted
+}
+
+// setGroup writes the definition, or the tombstone, of a feature group as an update of this peer.
+func (st *State) setGroup(g catalog.Group) (complete *State) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	return st.putGroup(g)
+}
+
+// addGroup writes a new feature group as an update of this peer
+// unless catalog.CheckNewGroup fails on the groups of its namespace.
+func (st *State) addGroup(g catalog.Group) (complete *State, err error) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	groups := []catalog.Group{}
+	for _, other := range st.latestGroups() {
+		if !other.Deleted && other.Namespace == g.Namespace {
+			groups = append(groups, other)
+		}
+	}
+	if err := catalog.CheckNewGroup(groups, g); err != nil {
+		return nil, err
+	}
+	return st.putGroup(g), nil
+}
+
+// putGroup writes a feature group with st.mtx held.
+func (st *State) putGroup(g catalog.Group) (complete *State) {
+	v := st.set[st.self]
+	groups := make(map[string]catalog.Group, len(v.Groups)+1)
+	for key, old := range v.Groups {
+		groups[key] = old
+	}
+	groups[g.Key()] = g
+	v.Groups = groups
+	if v.NodeInfos == nil {
+		v.NodeInfos = map[string]NodeInfo{}
+	}
+	st.set[st.self] = v
+	return &State{
+		set: st.set,
+	}
+}
+
+// mergeGroups keeps the groups which are newer than those known of the peer.
+// With prune, the others are removed from groups, so that what is left was novel.
+func (st *State) mergeGroups(peer mesh.PeerName, groups map[string]catalog.Group, prune bool) {
+	if len(groups) == 0 {
+		return
+	}
+	v := st.set[peer]
+	if v.NodeInfos == nil {
+		v.NodeInfos = map[string]NodeInfo{}
+	}
+	if v.Groups == nil {
+		v.Groups = map[string]catalog.Group{}
+	}
+	st.set[peer] = v
+	for key, g := range groups {
+		if !g.UpdatedAt.After(v.Groups[key].UpdatedAt) {
+			if prune {
+				delete(groups, key)
+			}
+			continue
+		}
+		v.Groups[key] = g
+	}
+}
+
+// latestAliases returns the last update of each alias, tombstones included.
+func (st *State) latestAliases() map[string]catalog.Alias {
+	aliases := map[string]catalog.Alias{}
+	for _, v := range st.set {
+		for key, a := range v.Aliases {
+			if a.UpdatedAt.After(aliases[key].UpdatedAt) {
+				aliases[key] = a
+			}
+		}
+	}
+	return aliases
+}
+
+func (st *State) getAliases(namespace string) []catalog.Alias {
+	st.mtx.RLock()
+	defer st.mtx.RUnlock()
+	aliases := []catalog.Alias{}
+	for _, a := range st.latestAliases() {
+		if !a.Deleted && a.Namespace == namespace {
+			aliases = append(aliases, a)
+		}
+	}
+	return aliases
+}
+
+func (st *State) getAlias(namespace string, name string) (catalog.Alias, bool) {
+	st.mtx.RLock()
+	defer st.mtx.RUnlock()
+	return st.latestAlias(catalog.Alias{Namespace: namespace, Name: name}.Key())
+}
+
+// latestAlias returns the alias of key with st.mtx held.
+func (st *State) latestAlias(key string) (catalog.Alias, bool) {
+	var latest catalog.Alias
+	for _, v := range st.set {
+		if a, ok := v.Aliases[key]; ok && a.UpdatedAt.After(latest.UpdatedAt) {
+			latest = a
+		}
+	}
+	return latest, !latest.UpdatedAt.IsZero() && !latest.Deleted
+}
+
+// setAlias writes an alias, or its tombstone, as an update of this peer.
+func (st *State) setAlias(a catalog.Alias) (complete *State) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	return st.putAlias(a)
+}
+
+// compareAndSetAlias writes an alias as an update of this peer only if it points at the group of from.
+func (st *State) compareAndSetAlias(a catalog.Alias, from int) (complete *State, ok bool) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	if old, ok := st.latestAlias(a.Key()); !ok || old.FeatureGroupID != from {
+		return nil, false
+	}
+	return st.putAlias(a), true
+}
+
+// putAlias writes an alias with st.mtx held.
+func (st *State) putAlias(a catalog.Alias) (complete *State) {
+	v := st.set[st.self]
+	aliases := make(map[string]catalog.Alias, len(v.Aliases)+1)
+	for key, old := range v.Aliases {
+		aliases[key] = old
+	}
+	aliases[a.Key()] = a
+	v.Aliases = aliases
+	if v.NodeInfos == nil {
+		v.NodeInfos = map[string]NodeInfo{}
+	}
+	st.set[st.self] = v
+	return &State{
+		set: st.set,
+	}
+}
+
+// mergeAliases keeps the aliases which are newer than those known of the peer.
+// With prune, the others are removed from aliases, so that what is left was novel.
+func (st *State) mergeAliases(peer mesh.PeerName, aliases map[string]catalog.Alias, prune bool) {
+	if len(aliases) == 0 {
+		return
+	}
+	v := st.set[peer]
+	if v.NodeInfos == nil {
+		v.NodeInfos = map[string]NodeInfo{}
+	}
+	if v.Aliases == nil {
+		v.Aliases = map[string]catalog.Alias{}
+	}
+	st.set[peer] = v
+	for key, a := range aliases {
+		if !a.UpdatedAt.After(v.Aliases[key].UpdatedAt) {
+			if prune {
+				delete(aliases, key)
+			}
+			continue
+		}
+		v.Aliases[key] = a
+	}
+}
+
+// latestNamespaces returns the last update of each namespace, tombstones included.
+func (st *State) latestNamespaces() map[string]catalog.Namespace {
+	namespaces := map[string]catalog.Namespace{}
+	for _, v := range st.set {
+		for name, n := range v.Namespaces {
+			if n.UpdatedAt.After(namespaces[name].UpdatedAt) {
+				namespaces[name] = n
+			}
+		}
+	}
+	return namespaces
+}
+
+func (st *State) getNamespaces() []catalog.Namespace {
+	st.mtx.RLock()
+	defer st.mtx.RUnlock()
+	namespaces := []catalog.Namespace{}
+	for _, n := range st.latestNamespaces() {
+		if !n.Deleted {
+			namespaces = append(namespaces, n)
+		}
+	}
+	return namespaces
+}
+
+func (st *State) getNamespace(name string) (catalog.Namespace, bool) {
+	st.mtx.RLock()
+	defer st.mtx.RUnlock()
+	var latest catalog.Namespace
+	for _, v := range st.set {
+		if n, ok := v.Namespaces[name]; ok && n.UpdatedAt.After(latest.UpdatedAt) {
+			latest = n
+		}
+	}
+	return latest, !latest.UpdatedAt.IsZero() && !latest.Deleted
+}
+
+// setNamespace writes a namespace, or its tombstone, as an update of this peer.
+func (st *State) setNamespace(n catalog.Namespace) (complete *State) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+
+	v := st.set[st.self]
+	namespaces := make(map[string]catalog.Namespace, len(v.Namespaces)+1)
+	for name, old := range v.Namespaces {
+		namespaces[name] = old
+	}
+	namespaces[n.Name] = n
+	v.Namespaces = namespaces
+	if v.NodeInfos == nil {
+		v.NodeInfos = map[string]NodeInfo{}
+	}
+	st.set[st.self] = v
+	return &State{
+		set: st.set,
+	}
+}
+
+// mergeNamespaces keeps the namespaces which are newer than those known of the peer.
+// With prune, the others are removed from namespaces, so that what is left was novel.
+func (st *State) mergeNamespaces(peer mesh.PeerName, namespaces map[string]catalog.Namespace, prune bool) {
+	if len(namespaces) == 0 {
+		return
+	}
+	v := st.set[peer]
+	if v.NodeInfos == nil {
+		v.NodeInfos = map[string]NodeInfo{}
+	}
+	if v.Namespaces == nil {
+		v.Namespaces = map[string]catalog.Namespace{}
+	}
+	st.set[peer] = v
+	for name, n := range namespaces {
+		if !n.UpdatedAt.After(v.Namespaces[name].UpdatedAt) {
+			if prune {
+				delete(namespaces, name)
+			}
+			continue
+		}
+		v.Namespaces[name] = n
+	}
+}
+
 func (st *State) del() (complete *State) {
 	st.mtx.Lock()
 	defer st.mtx.Unlock()
@@ -87,6 +555,9 @@ func (st *State) del() (complete *State) {
 			NodeInfos: map[string]NodeInfo{
 				st.self.String(): NodeInfo{},
 			},
+			Groups:     st.set[st.self].Groups,
+			Aliases:    st.set[st.self].Aliases,
+			Namespaces: st.set[st.self].Namespaces,
 		}
 	}
 	return &State{
@@ -105,6 +576,7 @@ func (st *State) setNodeInfo(peerConf PeerConfig, bp *brick.BrickPool) (complete
 			UniqueID:             b.GetUniqueIDstr(),
 			BrickID:              b.GetBrickIDstr(),
 			FeatureGroupID:       b.GetFeatureGroupIDint(),
+			Namespace:            b.GetNamespace(),
 			NumOfBrickTotalCap:   b.NumOfBrickTotalCap,
 			NumOfAvailablePoints: b.NumOfAvailablePoints,
 			//NodeName:             st.self.String(),
@@ -121,11 +593,16 @@ func (st *State) setNodeInfo(peerConf PeerConfig, bp *brick.BrickPool) (complete
 					Count:         c.Count + 1,
 					IpAddress:     fmt.Sprintf("%s", peerConf.ipAddress),
 					ApiPort:       fmt.Sprintf("%s", peerConf.featureApiHttpListen),
+					GrpcPort:      peerConf.grpcListen,
+					Meta:          st.meta,
 					LaunchAt:      c.LaunchAt,
 					LastUpdatedAt: time.Now(),
 					//NodeName:      st.self.String(),
 				},
 			},
+			Groups:     st.set[st.self].Groups,
+			Aliases:    st.set[st.self].Aliases,
+			Namespaces: st.set[st.self].Namespaces,
 		}
 	} else {
 		// NodeInfos
@@ -136,11 +613,42 @@ func (st *State) setNodeInfo(peerConf PeerConfig, bp *brick.BrickPool) (complete
 					Count:         0,
 					IpAddress:     fmt.Sprintf("%s", peerConf.ipAddress),
 					ApiPort:       fmt.Sprintf("%s", peerConf.featureApiHttpListen),
+					GrpcPort:      peerConf.grpcListen,
+					Meta:          st.meta,
 					LaunchAt:      time.Now(),
 					LastUpdatedAt: time.Now(),
 					//NodeName:      st.self.String(),
 				},
 			},
+			Groups:     st.set[st.self].Groups,
+			Aliases:    st.set[st.self].Aliases,
+			Namespaces: st.set[st.self].Namespaces,
+		}
+	}
+	return &State{
+		set: st.set,
+	}
+}
+
+// setNodeMeta updates the metadata of this node. It is kept even if
+// the NodeInfo has not been published yet, and is sent with the next one.
+func (st *State) setNodeMeta(form NodeMetaForm) (complete *State) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+
+	st.meta = st.meta.apply(form)
+	if v, ok := st.set[st.self]; ok {
+		if c, ok := v.NodeInfos[st.self.String()]; ok && !c.isDeleted() {
+			c.Meta = st.meta
+			c.LastUpdatedAt = time.Now()
+			st.set[st.self] = StateContent{
+				NodeInfos: map[string]NodeInfo{
+					st.self.String(): c,
+				},
+				Groups:     v.Groups,
+				Aliases:    v.Aliases,
+				Namespaces: v.Namespaces,
+			}
 		}
 	}
 	return &State{
@@ -148,6 +656,12 @@ func (st *State) setNodeInfo(peerConf PeerConfig, bp *brick.BrickPool) (complete
 	}
 }
 
+func (st *State) getNodeMeta() NodeMeta {
+	st.mtx.RLock()
+	defer st.mtx.RUnlock()
+	return st.meta
+}
+
 func (st *State) copy() *State {
 	st.mtx.RLock()
 	defer st.mtx.RUnlock()
@@ -176,7 +690,6 @@ func (st *State) Merge(other mesh.GossipData) (complete mesh.GossipData) {
 func (st *State) mergeReceived(set map[mesh.PeerName]StateContent) (received mesh.GossipData) {
 	st.mtx.Lock()
 	defer st.mtx.Unlock()
-	log.Println("mergeReceived")
 
 	for peer, v := range set {
 		if _, ok := st.set[peer]; !ok {
@@ -187,7 +700,7 @@ func (st *State) mergeReceived(set map[mesh.PeerName]StateContent) (received mes
 		obj := st.set[peer]
 		for nodeInfoKey, nodeInfoVal := range v.NodeInfos {
 			objNodeInfo := obj.NodeInfos[nodeInfoKey]
-			if nodeInfoVal == (NodeInfo{}) {
+			if nodeInfoVal.isDeleted() {
 				delete(st.set[peer].NodeInfos, nodeInfoKey)
 				continue
 			}
@@ -197,6 +710,9 @@ func (st *State) mergeReceived(set map[mesh.PeerName]StateContent) (received mes
 			}
 			st.set[peer].NodeInfos[nodeInfoKey] = nodeInfoVal
 		}
+		st.mergeGroups(peer, v.Groups, true)
+		st.mergeAliases(peer, v.Aliases, true)
+		st.mergeNamespaces(peer, v.Namespaces, true)
 	}
 	return &State{
 		set: set, // all remaining elements were novel to us
@@ -206,7 +722,6 @@ func (st *State) mergeReceived(set map[mesh.PeerName]StateContent) (received mes
 func (st *State) mergeDelta(set map[mesh.PeerName]StateContent) (delta mesh.GossipData) {
 	st.mtx.Lock()
 	defer st.mtx.Unlock()
-	log.Println("mergeDelta")
 
 	for peer, v := range set {
 		if _, ok := st.set[peer]; !ok {
@@ -217,7 +732,7 @@ func (st *State) mergeDelta(set map[mesh.PeerName]StateContent) (delta mesh.Goss
 		obj := st.set[peer]
 		for nodeInfoKey, nodeInfoVal := range v.NodeInfos {
 			objNodeInfo := obj.NodeInfos[nodeInfoKey]
-			if nodeInfoVal == (NodeInfo{}) {
+			if nodeInfoVal.isDeleted() {
 				delete(st.set[peer].NodeInfos, nodeInfoKey)
 				continue
 			}
@@ -227,6 +742,9 @@ func (st *State) mergeDelta(set map[mesh.PeerName]StateContent) (delta mesh.Goss
 			}
 			st.set[peer].NodeInfos[nodeInfoKey] = nodeInfoVal
 		}
+		st.mergeGroups(peer, v.Groups, true)
+		st.mergeAliases(peer, v.Aliases, true)
+		st.mergeNamespaces(peer, v.Namespaces, true)
 	}
 
 	if len(set) <= 0 {
@@ -240,15 +758,13 @@ func (st *State) mergeDelta(set map[mesh.PeerName]StateContent) (delta mesh.Goss
 func (st *State) mergeComplete(set map[mesh.PeerName]StateContent) (complete mesh.GossipData) {
 	st.mtx.Lock()
 	defer st.mtx.Unlock()
-	log.Println("mergeComplete")
 
 	for peer, v := range set {
-		log.Println(peer)
 		obj := st.set[peer]
 		// Sync NodeInfos
 		for nodeInfoKey, nodeInfoVal := range v.NodeInfos {
 			objNodeInfo := obj.NodeInfos[nodeInfoKey]
-			if nodeInfoVal == (NodeInfo{}) {
+			if nodeInfoVal.isDeleted() {
 				delete(st.set[peer].NodeInfos, nodeInfoKey)
 				continue
 			}
@@ -256,6 +772,9 @@ func (st *State) mergeComplete(set map[mesh.PeerName]StateContent) (complete mes
 				st.set[peer].NodeInfos[nodeInfoKey] = nodeInfoVal
 			}
 		}
+		st.mergeGroups(peer, v.Groups, false)
+		st.mergeAliases(peer, v.Aliases, false)
+		st.mergeNamespaces(peer, v.Namespaces, false)
 	}
 
 	return &State{
@@ -0,0 +1,279 @@
+package state
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abeja-inc/feature-search-db/pkg/brick"
+	"github.com/abeja-inc/feature-search-db/pkg/catalog"
+
+	"github.com/gorilla/mux"
+	"github.com/weaveworks/mesh"
+	"go.uber.org/zap"
+)
+
+func TestState(t *testing.T) {
+	t.Run("it propagates NodeMeta successfully", testState_setNodeMeta)
+	t.Run("it removes deleted node successfully", testState_del)
+	t.Run("it propagates the catalog successfully", testState_groups)
+	t.Run("it propagates the last repointing of an alias", testState_aliases)
+	t.Run("it keeps the catalogs of namespaces apart", testState_namespaces)
+}
+
+func TestPeer(t *testing.T) {
+	t.Run("it repoints an alias from a group only once successfully", testPeer_compareAndSetAlias)
+	t.Run("it creates a group of an ID or a name only once successfully", testPeer_addGroup)
+}
+
+// putConcurrently sends the bodies to the handler at the same time and counts the responses by status.
+func putConcurrently(h http.Handler, method string, path string, bodies []string) map[int]int {
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	codes := map[int]int{}
+	for _, body := range bodies {
+		wg.Add(1)
+		go func(body string) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+			mtx.Lock()
+			codes[rec.Code]++
+			mtx.Unlock()
+		}(body)
+	}
+	wg.Wait()
+	return codes
+}
+
+func newTestBrickPool() *brick.BrickPool {
+	bp := brick.BrickPool{}
+	bp.InitBrickPool()
+	fb := brick.NewBrick(10, brick.BrickFeatureGroupID(0), brick.NewLinerFindStrategy())
+	bp.RegisterIntoPool(&fb)
+	return &bp
+}
+
+// decode passes the gossip data through gob as it goes over the mesh.
+func decode(t *testing.T, st *State) map[mesh.PeerName]StateContent {
+	var set map[mesh.PeerName]StateContent
+	if err := gob.NewDecoder(bytes.NewReader(st.Encode()[0])).Decode(&set); err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func testState_setNodeMeta(t *testing.T) {
+	// prepare
+	a := newState(mesh.PeerName(1))
+	b := newState(mesh.PeerName(2))
+	peerConf := NewPeerConfig("127.0.0.1", ":8081", "")
+	zone := "zone-a"
+	draining := true
+
+	// exec
+	a.setNodeMeta(NodeMetaForm{Zone: &zone, Labels: map[string]string{"gpu": "true"}})
+	b.mergeReceived(decode(t, a.setNodeInfo(peerConf, newTestBrickPool())))
+	b.mergeReceived(decode(t, a.setNodeMeta(NodeMetaForm{Draining: &draining})))
+
+	// assert
+	ni, ok := b.getAllState().NodeInfos[mesh.PeerName(1).String()]
+	if !ok {
+		t.Fatal("fail. node not found.")
+	}
+	if ni.Meta.Zone != zone || ni.Meta.Labels["gpu"] != "true" || !ni.Meta.Draining {
+		t.Fatalf("fail. meta not match. %+v", ni.Meta)
+	}
+	if ni.Meta.CapacityWeight != DefaultCapacityWeight {
+		t.Fatalf("fail. capacityWeight not match. %f", ni.Meta.CapacityWeight)
+	}
+}
+
+func testState_del(t *testing.T) {
+	// prepare
+	a := newState(mesh.PeerName(1))
+	b := newState(mesh.PeerName(2))
+	b.mergeReceived(decode(t, a.setNodeInfo(NewPeerConfig("127.0.0.1", ":8081", ""), newTestBrickPool())))
+
+	// exec
+	b.mergeReceived(decode(t, a.del()))
+
+	// assert
+	if _, ok := b.getAllState().NodeInfos[mesh.PeerName(1).String()]; ok {
+		t.Fatal("fail. deleted node still exists.")
+	}
+}
+
+func testState_groups(t *testing.T) {
+	// prepare
+	a := newState(mesh.PeerName(1))
+	b := newState(mesh.PeerName(2))
+	b.mergeReceived(decode(t, b.setGroup(catalog.DefaultGroup())))
+	g := catalog.Group{Namespace: catalog.DefaultNamespace, ID: 0, Name: "products", DType: catalog.DTypeFloat32, UpdatedAt: time.Now()}
+	g.SetDefaults()
+
+	// exec
+	b.mergeReceived(decode(t, a.setGroup(g)))
+	defined, defOK := b.getGroup(catalog.DefaultNamespace, 0)
+	b.mergeReceived(decode(t, a.setNodeInfo(NewPeerConfig("127.0.0.1", ":8081", ""), newTestBrickPool())))
+	kept, keptOK := b.getGroup(catalog.DefaultNamespace, 0)
+	b.mergeReceived(decode(t, a.setGroup(catalog.Group{Namespace: catalog.DefaultNamespace, ID: 0, UpdatedAt: time.Now(), Deleted: true})))
+	_, deletedOK := b.getGroup(catalog.DefaultNamespace, 0)
+
+	// assert
+	if !defOK || defined.Name != "products" || defined.DType != catalog.DTypeFloat32 {
+		t.Fatalf("fail. definition must win over the default. %+v", defined)
+	}
+	if !keptOK || kept.Name != "products" {
+		t.Fatalf("fail. definition lost by a heartbeat. %+v", kept)
+	}
+	if deletedOK || len(b.getAllState().Groups) != 0 {
+		t.Fatalf("fail. deleted group still exists. %+v", b.getAllState().Groups)
+	}
+}
+
+func testState_aliases(t *testing.T) {
+	// prepare
+	a := newState(mesh.PeerName(1))
+	b := newState(mesh.PeerName(2))
+	c := newState(mesh.PeerName(3))
+	now := time.Now()
+
+	// exec
+	c.mergeReceived(decode(t, a.setAlias(catalog.Alias{Namespace: catalog.DefaultNamespace, Name: "products", FeatureGroupID: 11, UpdatedAt: now})))
+	c.mergeReceived(decode(t, b.setAlias(catalog.Alias{Namespace: catalog.DefaultNamespace, Name: "products", FeatureGroupID: 12, UpdatedAt: now.Add(time.Second)})))
+	swapped, swappedOK := c.getAlias(catalog.DefaultNamespace, "products")
+	// A late delivery of an older update does not point it back.
+	c.mergeReceived(decode(t, a.setAlias(catalog.Alias{Namespace: catalog.DefaultNamespace, Name: "products", FeatureGroupID: 11, UpdatedAt: now.Add(-time.Second)})))
+	kept, _ := c.getAlias(catalog.DefaultNamespace, "products")
+	c.mergeReceived(decode(t, a.setAlias(catalog.Alias{Namespace: catalog.DefaultNamespace, Name: "products", UpdatedAt: now.Add(2 * time.Second), Deleted: true})))
+	_, deletedOK := c.getAlias(catalog.DefaultNamespace, "products")
+
+	// assert
+	if !swappedOK || swapped.FeatureGroupID != 12 {
+		t.Fatalf("fail. alias not repointed. %+v", swapped)
+	}
+	if kept.FeatureGroupID != 12 {
+		t.Fatalf("fail. alias pointed back by an older update. %+v", kept)
+	}
+	if deletedOK || len(c.getAllState().Aliases) != 0 {
+		t.Fatalf("fail. deleted alias still exists. %+v", c.getAllState().Aliases)
+	}
+}
+
+func testState_namespaces(t *testing.T) {
+	// prepare
+	a := newState(mesh.PeerName(1))
+	b := newState(mesh.PeerName(2))
+	now := time.Now()
+	team := catalog.Namespace{Name: "team-a", Quota: catalog.Quota{MaxVectors: 100}, UpdatedAt: now}
+	g := catalog.Group{Namespace: "team-a", ID: 0, Name: "products", UpdatedAt: now}
+
+	// exec
+	b.mergeReceived(decode(t, a.setNamespace(team)))
+	b.mergeReceived(decode(t, a.setGroup(g)))
+	b.mergeReceived(decode(t, a.setGroup(catalog.DefaultGroup())))
+	found, foundOK := b.getNamespace("team-a")
+	teamGroups := b.getGroups("team-a")
+	defaultGroups := b.getGroups(catalog.DefaultNamespace)
+	b.mergeReceived(decode(t, a.setNamespace(catalog.Namespace{Name: "team-a", UpdatedAt: now.Add(time.Second), Deleted: true})))
+	_, deletedOK := b.getNamespace("team-a")
+
+	// assert
+	if !foundOK || found.Quota.MaxVectors != 100 {
+		t.Fatalf("fail. namespace not propagated. %+v", found)
+	}
+	if len(teamGroups) != 1 || teamGroups[0].Name != "products" {
+		t.Fatalf("fail. groups of the namespace not match. %+v", teamGroups)
+	}
+	if len(defaultGroups) != 1 || defaultGroups[0].Name != "default" {
+		t.Fatalf("fail. group seen from another namespace. %+v", defaultGroups)
+	}
+	if deletedOK || len(b.getAllState().Namespaces) != 0 {
+		t.Fatalf("fail. deleted namespace still exists. %+v", b.getAllState().Namespaces)
+	}
+}
+
+func TestStateContent_Usage(t *testing.T) {
+	sc := StateContent{NodeInfos: map[string]NodeInfo{
+		"node1": {Bricks: &[]BrickInfo{
+			{BrickID: "b1", Namespace: "team-a", NumOfBrickTotalCap: 10, NumOfAvailablePoints: 4},
+			{BrickID: "b2", NumOfBrickTotalCap: 10, NumOfAvailablePoints: 7},
+		}},
+		"node2": {Bricks: &[]BrickInfo{
+			{BrickID: "b1", Namespace: "team-a", NumOfBrickTotalCap: 10, NumOfAvailablePoints: 4},
+		}},
+	}}
+
+	team := sc.Usage("team-a")
+	def := sc.Usage(catalog.DefaultNamespace)
+
+	if team.Vectors != 4 || team.MemoryBytes != 20*brick.PointSize {
+		t.Fatalf("fail. replicas must be counted once for vectors and twice for memory. %+v", team)
+	}
+	if def.Vectors != 7 || def.MemoryBytes != 10*brick.PointSize {
+		t.Fatalf("fail. bricks without a namespace must be of the default one. %+v", def)
+	}
+}
+
+func testPeer_compareAndSetAlias(t *testing.T) {
+	// prepare
+	p := NewPeer(mesh.PeerName(1), zap.NewNop())
+	defer p.stop()
+	bodies := []string{}
+	for id := 0; id <= 20; id++ {
+		p.SetGroup(catalog.Group{Namespace: catalog.DefaultNamespace, ID: id, Name: fmt.Sprint("group-", id), UpdatedAt: time.Now()})
+		if id > 0 {
+			bodies = append(bodies, fmt.Sprintf(`{"featureGroupID": %d, "from": 0}`, id))
+		}
+	}
+	p.SetAlias(catalog.Alias{Namespace: catalog.DefaultNamespace, Name: "products", FeatureGroupID: 0, UpdatedAt: time.Now()})
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/aliases/{alias}", catalog.AliasHandler(p))
+
+	// exec
+	codes := putConcurrently(r, http.MethodPut, "/api/v1/aliases/products", bodies)
+
+	// assert
+	if codes[http.StatusOK] != 1 || codes[http.StatusConflict] != len(bodies)-1 {
+		t.Fatalf("fail. alias repointed from the same group more than once. %v", codes)
+	}
+	if a, _ := p.Alias(catalog.DefaultNamespace, "products"); a.FeatureGroupID == 0 {
+		t.Fatalf("fail. alias not repointed. %+v", a)
+	}
+}
+
+func testPeer_addGroup(t *testing.T) {
+	// prepare
+	p := NewPeer(mesh.PeerName(1), zap.NewNop())
+	defer p.stop()
+	sameID := []string{}
+	sameName := []string{}
+	for i := 0; i < 20; i++ {
+		sameID = append(sameID, fmt.Sprintf(`{"id": 1, "name": "group-%d"}`, i))
+		sameName = append(sameName, fmt.Sprintf(`{"id": %d, "name": "products"}`, i+2))
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/groups", catalog.ListHandler(p))
+
+	// exec
+	byID := putConcurrently(r, http.MethodPost, "/api/v1/groups", sameID)
+	byName := putConcurrently(r, http.MethodPost, "/api/v1/groups", sameName)
+
+	// assert
+	if byID[http.StatusCreated] != 1 || byID[http.StatusConflict] != len(sameID)-1 {
+		t.Fatalf("fail. group of an ID created more than once. %v", byID)
+	}
+	if byName[http.StatusCreated] != 1 || byName[http.StatusConflict] != len(sameName)-1 {
+		t.Fatalf("fail. group of a name created more than once. %v", byName)
+	}
+	if groups := p.Groups(catalog.DefaultNamespace); len(groups) != 2 {
+		t.Fatalf("fail. number of groups not match. %+v", groups)
+	}
+}
@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+type remoteSpanContextKey struct{}
+
+type dataDogSpan struct {
+	span ddtrace.Span
+}
+
+func (s dataDogSpan) SetTag(key string, value interface{}) { s.span.SetTag(key, value) }
+func (s dataDogSpan) SetError(err error)                   { s.span.SetTag(ext.Error, err) }
+func (s dataDogSpan) Finish()                              { s.span.Finish() }
+
+// dataDogTracer sends spans to the DataDog agent.
+type dataDogTracer struct{}
+
+func newDataDogTracer(cfg Config) Tracer {
+	tracer.Start(tracer.WithServiceName(cfg.ServiceName), tracer.WithAnalytics(true))
+	return dataDogTracer{}
+}
+
+func (dataDogTracer) StartSpan(ctx context.Context, operationName string) (Span, context.Context) {
+	opts := []ddtrace.StartSpanOption{}
+	if _, ok := tracer.SpanFromContext(ctx); !ok {
+		if remote, ok := ctx.Value(remoteSpanContextKey{}).(ddtrace.SpanContext); ok {
+			opts = append(opts, tracer.ChildOf(remote))
+		}
+	}
+	span, ctx := tracer.StartSpanFromContext(ctx, operationName, opts...)
+	return dataDogSpan{span: span}, ctx
+}
+
+func (dataDogTracer) Inject(ctx context.Context, header http.Header) {
+	if span, ok := tracer.SpanFromContext(ctx); ok {
+		tracer.Inject(span.Context(), tracer.HTTPHeadersCarrier(header))
+	}
+}
+
+func (dataDogTracer) Extract(ctx context.Context, header http.Header) context.Context {
+	remote, err := tracer.Extract(tracer.HTTPHeadersCarrier(header))
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteSpanContextKey{}, remote)
+}
+
+func (dataDogTracer) Stop() {
+	tracer.Stop()
+}
@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The span context travels in gRPC metadata under the same keys as in HTTP headers.
+
+func headerOfMetadata(md metadata.MD) http.Header {
+	header := http.Header{}
+	for k, vs := range md {
+		for _, v := range vs {
+			header.Add(k, v)
+		}
+	}
+	return header
+}
+
+func extractFromIncoming(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return Extract(ctx, headerOfMetadata(md))
+}
+
+func finishRPC(span Span, err error) {
+	span.SetTag("grpc.code", status.Code(err).String())
+	if err != nil {
+		span.SetError(err)
+	}
+	span.Finish()
+}
+
+// UnaryServerInterceptor traces each unary call to a gRPC server.
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	span, ctx := StartSpan(extractFromIncoming(ctx), "grpc.request")
+	span.SetTag("resource.name", info.FullMethod)
+	resp, err := handler(ctx, req)
+	finishRPC(span, err)
+	return resp, err
+}
+
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s tracedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamServerInterceptor traces each stream of a gRPC server as one span.
+func StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	span, ctx := StartSpan(extractFromIncoming(ss.Context()), "grpc.request")
+	span.SetTag("resource.name", info.FullMethod)
+	err := handler(srv, tracedServerStream{ServerStream: ss, ctx: ctx})
+	finishRPC(span, err)
+	return err
+}
+
+// UnaryClientInterceptor sends the span context of ctx along with each unary call.
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	header := http.Header{}
+	Inject(ctx, header)
+	for k, vs := range header {
+		for _, v := range vs {
+			ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+		}
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
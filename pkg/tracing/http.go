@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// statusRecorder keeps the status of a response for the span, and still lets handlers flush and hijack.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+	return h.Hijack()
+}
+
+// Middleware traces each request to a router, as a child of the span of the caller when it sent one.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resource := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				resource = tmpl
+			}
+		}
+		ctx := Extract(r.Context(), r.Header)
+		span, ctx := StartSpan(ctx, "http.request")
+		defer span.Finish()
+		span.SetTag("resource.name", r.Method+" "+resource)
+		span.SetTag("http.method", r.Method)
+		span.SetTag("http.url", r.URL.Path)
+
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r.WithContext(ctx))
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		span.SetTag("http.status_code", sr.status)
+		if sr.status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(sr.status)))
+		}
+	})
+}
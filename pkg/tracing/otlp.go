@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/api/propagation"
+	"go.opentelemetry.io/otel/api/standard"
+	apitrace "go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/codes"
+)
+
+type otlpSpan struct {
+	ctx  context.Context
+	span apitrace.Span
+}
+
+func (s otlpSpan) SetTag(key string, value interface{}) { s.span.SetAttribute(key, value) }
+func (s otlpSpan) SetError(err error) {
+	s.span.RecordError(s.ctx, err, apitrace.WithErrorStatus(codes.Unknown))
+	s.span.SetStatus(codes.Unknown, err.Error())
+}
+func (s otlpSpan) Finish() { s.span.End() }
+
+// otlpTracer sends spans to an OpenTelemetry collector, and propagates them in W3C trace context headers.
+type otlpTracer struct {
+	exporter  *otlp.Exporter
+	processor *sdktrace.BatchSpanProcessor
+	provider  *sdktrace.Provider
+	tracer    apitrace.Tracer
+	props     propagation.Propagators
+}
+
+func newOTLPTracer(cfg Config) (Tracer, error) {
+	exporter, err := otlp.NewExporter(otlp.WithInsecure(), otlp.WithAddress(cfg.OTLPEndpoint))
+	if err != nil {
+		return nil, err
+	}
+	processor, err := sdktrace.NewBatchSpanProcessor(exporter)
+	if err != nil {
+		exporter.Stop()
+		return nil, err
+	}
+	t, err := newOTLPTracerWithProcessor(cfg, processor)
+	if err != nil {
+		exporter.Stop()
+		return nil, err
+	}
+	t.exporter = exporter
+	return t, nil
+}
+
+func newOTLPTracerWithProcessor(cfg Config, processor *sdktrace.BatchSpanProcessor) (*otlpTracer, error) {
+	provider, err := sdktrace.NewProvider(
+		sdktrace.WithConfig(sdktrace.Config{DefaultSampler: sdktrace.AlwaysSample()}),
+		sdktrace.WithResource(resource.New(standard.ServiceNameKey.String(cfg.ServiceName))),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if processor != nil {
+		provider.RegisterSpanProcessor(processor)
+	}
+	propagator := apitrace.DefaultHTTPPropagator()
+	return &otlpTracer{
+		processor: processor,
+		provider:  provider,
+		tracer:    provider.Tracer("featuredb"),
+		props:     propagation.New(propagation.WithInjectors(propagator), propagation.WithExtractors(propagator)),
+	}, nil
+}
+
+func (t *otlpTracer) StartSpan(ctx context.Context, operationName string) (Span, context.Context) {
+	ctx, span := t.tracer.Start(ctx, operationName)
+	return otlpSpan{ctx: ctx, span: span}, ctx
+}
+
+func (t *otlpTracer) Inject(ctx context.Context, header http.Header) {
+	propagation.InjectHTTP(ctx, t.props, header)
+}
+
+func (t *otlpTracer) Extract(ctx context.Context, header http.Header) context.Context {
+	return propagation.ExtractHTTP(ctx, t.props, header)
+}
+
+func (t *otlpTracer) Stop() {
+	if t.processor != nil {
+		// Unregistering shuts the processor down, which exports the spans left in its queue.
+		t.provider.UnregisterSpanProcessor(t.processor)
+	}
+	if t.exporter != nil {
+		t.exporter.Stop()
+	}
+}
@@ -0,0 +1,119 @@
+// Package tracing puts the tracers behind one interface so that the backend is chosen by config.
+// Spans are carried in contexts, and their context crosses the hop from the proxy to calc nodes
+// in HTTP headers and gRPC metadata.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Span is a timed operation of a trace.
+type Span interface {
+	SetTag(key string, value interface{})
+	SetError(err error)
+	Finish()
+}
+
+// Tracer starts spans and moves their context across processes.
+type Tracer interface {
+	// StartSpan starts a child of the span in ctx, or of the remote span extracted into ctx,
+	// and returns ctx with the new span.
+	StartSpan(ctx context.Context, operationName string) (Span, context.Context)
+	// Inject writes the context of the span in ctx into the headers of an outgoing request.
+	Inject(ctx context.Context, header http.Header)
+	// Extract returns ctx with the span context in the headers of an incoming request.
+	Extract(ctx context.Context, header http.Header) context.Context
+	// Stop flushes the spans which have not been sent yet.
+	Stop()
+}
+
+const (
+	BackendDataDog = "datadog"
+	BackendOTLP    = "otlp"
+	BackendNone    = "none"
+)
+
+// Config chooses the backend of tracing.
+type Config struct {
+	// Backend is one of datadog, otlp and none.
+	Backend     string
+	ServiceName string
+	// OTLPEndpoint is the gRPC address of the OpenTelemetry collector.
+	OTLPEndpoint string
+}
+
+var (
+	mtx     sync.RWMutex
+	current Tracer = noopTracer{}
+)
+
+// Start sets up the tracer of the process. It is a no-op tracer until Start is called.
+func Start(cfg Config) error {
+	var t Tracer
+	switch cfg.Backend {
+	case BackendDataDog:
+		t = newDataDogTracer(cfg)
+	case BackendOTLP:
+		var err error
+		if t, err = newOTLPTracer(cfg); err != nil {
+			return err
+		}
+	case BackendNone, "":
+		t = noopTracer{}
+	default:
+		return fmt.Errorf("unknown tracing backend %q", cfg.Backend)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	current = t
+	return nil
+}
+
+// Stop flushes and stops the tracer of the process.
+func Stop() {
+	mtx.Lock()
+	defer mtx.Unlock()
+	current.Stop()
+	current = noopTracer{}
+}
+
+func currentTracer() Tracer {
+	mtx.RLock()
+	defer mtx.RUnlock()
+	return current
+}
+
+// StartSpan starts a span with the tracer of the process.
+func StartSpan(ctx context.Context, operationName string) (Span, context.Context) {
+	return currentTracer().StartSpan(ctx, operationName)
+}
+
+// Inject writes the span context of ctx into the headers of a request to another node.
+func Inject(ctx context.Context, header http.Header) {
+	currentTracer().Inject(ctx, header)
+}
+
+// Extract reads the span context of a request from another node into ctx.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return currentTracer().Extract(ctx, header)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetTag(key string, value interface{}) {}
+func (noopSpan) SetError(err error)                   {}
+func (noopSpan) Finish()                              {}
+
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, operationName string) (Span, context.Context) {
+	return noopSpan{}, ctx
+}
+func (noopTracer) Inject(ctx context.Context, header http.Header) {}
+func (noopTracer) Extract(ctx context.Context, header http.Header) context.Context {
+	return ctx
+}
+func (noopTracer) Stop() {}
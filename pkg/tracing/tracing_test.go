@@ -0,0 +1,146 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	apitrace "go.opentelemetry.io/otel/api/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+func useTracer(t Tracer) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	current = t
+}
+
+func TestTracing(t *testing.T) {
+	t.Run("it continues a trace over HTTP successfully", testTracing_http)
+	t.Run("it continues a trace over gRPC successfully", testTracing_grpc)
+	t.Run("it continues a DataDog trace successfully", testTracing_datadog)
+	t.Run("it does nothing without a backend successfully", testTracing_none)
+}
+
+func testTracing_http(t *testing.T) {
+	// prepare
+	ot, _ := newOTLPTracerWithProcessor(Config{ServiceName: "test"}, nil)
+	useTracer(ot)
+	defer Stop()
+	var got apitrace.SpanContext
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	r.HandleFunc("/api/v1/searchQuery", func(w http.ResponseWriter, r *http.Request) {
+		_, ctx := StartSpan(r.Context(), "handler")
+		got = apitrace.SpanFromContext(ctx).SpanContext()
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	span, ctx := StartSpan(context.Background(), "proxy")
+	defer span.Finish()
+	want := apitrace.SpanFromContext(ctx).SpanContext()
+
+	// exec
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/searchQuery", nil)
+	Inject(ctx, req.Header)
+	resp, err := http.DefaultClient.Do(req)
+
+	// assert
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	resp.Body.Close()
+	if req.Header.Get("traceparent") == "" {
+		t.Fatalf("fail. no trace context in headers. %v", req.Header)
+	}
+	if got.TraceID != want.TraceID || got.SpanID == want.SpanID {
+		t.Fatalf("fail. trace not continued. want trace %s, got %s", want.TraceID, got.TraceID)
+	}
+}
+
+func testTracing_grpc(t *testing.T) {
+	// prepare
+	ot, _ := newOTLPTracerWithProcessor(Config{ServiceName: "test"}, nil)
+	useTracer(ot)
+	defer Stop()
+	span, ctx := StartSpan(context.Background(), "proxy")
+	defer span.Finish()
+	want := apitrace.SpanFromContext(ctx).SpanContext()
+	var md metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	var got apitrace.SpanContext
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = apitrace.SpanFromContext(ctx).SpanContext()
+		return nil, nil
+	}
+
+	// exec
+	UnaryClientInterceptor(ctx, "/rpc.FeatureDB/Search", nil, nil, nil, invoker)
+	_, err := UnaryServerInterceptor(metadata.NewIncomingContext(context.Background(), md), nil,
+		&grpc.UnaryServerInfo{FullMethod: "/rpc.FeatureDB/Search"}, handler)
+
+	// assert
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if got.TraceID != want.TraceID || got.SpanID == want.SpanID {
+		t.Fatalf("fail. trace not continued. want trace %s, got %s", want.TraceID, got.TraceID)
+	}
+}
+
+func testTracing_datadog(t *testing.T) {
+	// prepare
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	useTracer(dataDogTracer{})
+	defer useTracer(noopTracer{})
+	span, ctx := StartSpan(context.Background(), "proxy")
+	header := http.Header{}
+
+	// exec
+	Inject(ctx, header)
+	child, _ := StartSpan(Extract(context.Background(), header), "node")
+	child.Finish()
+	span.Finish()
+
+	// assert
+	spans := mt.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("fail. num of spans not match. %d", len(spans))
+	}
+	parent, _ := tracer.SpanFromContext(ctx)
+	if spans[0].ParentID() != parent.Context().SpanID() || spans[0].TraceID() != parent.Context().TraceID() {
+		t.Fatalf("fail. trace not continued. parent %d, got %d", parent.Context().SpanID(), spans[0].ParentID())
+	}
+}
+
+func testTracing_none(t *testing.T) {
+	// prepare
+	if err := Start(Config{Backend: BackendNone}); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	defer Stop()
+	header := http.Header{}
+
+	// exec
+	span, ctx := StartSpan(context.Background(), "proxy")
+	Inject(ctx, header)
+	span.SetTag("node", "a")
+	span.Finish()
+
+	// assert
+	if len(header) != 0 {
+		t.Fatalf("fail. headers written. %v", header)
+	}
+	if err := Start(Config{Backend: "zipkin"}); err == nil {
+		t.Fatalf("fail. unknown backend accepted")
+	}
+}
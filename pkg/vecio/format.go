@@ -0,0 +1,64 @@
+package vecio
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	FormatJSONL = "jsonl"
+	FormatNpy   = "npy"
+	FormatFvecs = "fvecs"
+	FormatBvecs = "bvecs"
+)
+
+// FormatOf guesses the format from the extension of a file name.
+// Anything but .npy, .fvecs and .bvecs is read as lines of text.
+func FormatOf(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".npy":
+		return FormatNpy
+	case ".fvecs":
+		return FormatFvecs
+	case ".bvecs":
+		return FormatBvecs
+	}
+	return FormatJSONL
+}
+
+// NewReader returns a reader of the format. Only JSON lines carry IDs and metadata.
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatJSONL, "":
+		return NewTextReader(r), nil
+	case FormatNpy:
+		return NewNpyReader(r)
+	case FormatFvecs:
+		return NewFvecsReader(r), nil
+	case FormatBvecs:
+		return NewBvecsReader(r), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+type skipper interface {
+	Skip(n int) error
+}
+
+// Skip discards the next n records of r, without decoding them when the format allows.
+func Skip(r Reader, n int) error {
+	if s, ok := r.(skipper); ok {
+		return s.Skip(n)
+	}
+	for i := 0; i < n; i++ {
+		if _, err := r.Next(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
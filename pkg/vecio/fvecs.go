@@ -0,0 +1,71 @@
+package vecio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// VecsReader reads the fvecs or bvecs format of the TEXMEX corpus.
+// Each vector is a little endian int32 of its dimension followed by
+// float32 (fvecs) or uint8 (bvecs) values.
+type VecsReader struct {
+	r         *bufio.Reader
+	valueSize int
+	read      int
+	buf       []byte
+}
+
+func NewFvecsReader(r io.Reader) *VecsReader {
+	return &VecsReader{r: bufio.NewReaderSize(r, 1024*1024), valueSize: 4, buf: make([]byte, 4+4*Dim)}
+}
+
+func NewBvecsReader(r io.Reader) *VecsReader {
+	return &VecsReader{r: bufio.NewReaderSize(r, 1024*1024), valueSize: 1, buf: make([]byte, 4+Dim)}
+}
+
+func (vr *VecsReader) readVector() error {
+	if _, err := io.ReadFull(vr.r, vr.buf[:4]); err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return fmt.Errorf("vector %d: %v", vr.read, err)
+	}
+	if dim := int32(binary.LittleEndian.Uint32(vr.buf)); dim != Dim {
+		return fmt.Errorf("vector %d: the dimension is %d, not %d", vr.read, dim, Dim)
+	}
+	if _, err := io.ReadFull(vr.r, vr.buf[4:]); err != nil {
+		return fmt.Errorf("vector %d: %v", vr.read, err)
+	}
+	vr.read += 1
+	return nil
+}
+
+func (vr *VecsReader) Next() (Record, error) {
+	var rec Record
+	if err := vr.readVector(); err != nil {
+		return rec, err
+	}
+	if vr.valueSize == 1 {
+		for i, b := range vr.buf[4:] {
+			rec.Vals[i] = float64(b)
+		}
+	} else {
+		decodeFloats(vr.buf[4:], 4, rec.Vals[:])
+	}
+	return rec, nil
+}
+
+// Skip discards the next n vectors without decoding them.
+func (vr *VecsReader) Skip(n int) error {
+	if _, err := io.CopyN(ioutil.Discard, vr.r, int64(n*len(vr.buf))); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	vr.read += n
+	return nil
+}
@@ -0,0 +1,259 @@
+package vecio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var npyMagic = []byte("\x93NUMPY")
+
+// npyMaxHeaderLen caps the header of a .npy file, which numpy keeps far smaller.
+const npyMaxHeaderLen = 64 * 1024
+
+var (
+	npyDescrPattern   = regexp.MustCompile(`'descr':\s*'([^']*)'`)
+	npyFortranPattern = regexp.MustCompile(`'fortran_order':\s*(True|False)`)
+	npyShapePattern   = regexp.MustCompile(`'shape':\s*\(([^)]*)\)`)
+)
+
+// NpyReader reads a NumPy .npy file of float32 or float64 with the shape (N, 512) or (512,).
+// The array must be little endian and in C order.
+type NpyReader struct {
+	r         *bufio.Reader
+	valueSize int
+	count     int
+	read      int
+	buf       []byte
+}
+
+func NewNpyReader(r io.Reader) (*NpyReader, error) {
+	br := bufio.NewReaderSize(r, 1024*1024)
+	pre := make([]byte, 8)
+	if _, err := io.ReadFull(br, pre); err != nil {
+		return nil, fmt.Errorf("npy: %v", err)
+	}
+	if string(pre[:6]) != string(npyMagic) {
+		return nil, errors.New("npy: not a .npy file")
+	}
+	var headerLen int
+	switch pre[6] {
+	case 1:
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return nil, fmt.Errorf("npy: %v", err)
+		}
+		headerLen = int(binary.LittleEndian.Uint16(b))
+	case 2, 3:
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return nil, fmt.Errorf("npy: %v", err)
+		}
+		headerLen = int(binary.LittleEndian.Uint32(b))
+	default:
+		return nil, fmt.Errorf("npy: unsupported version %d", pre[6])
+	}
+	if headerLen > npyMaxHeaderLen {
+		return nil, fmt.Errorf("npy: header of %d bytes is too large, at most %d bytes are", headerLen, npyMaxHeaderLen)
+	}
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("npy: %v", err)
+	}
+
+	nr := &NpyReader{r: br}
+	m := npyDescrPattern.FindSubmatch(header)
+	if m == nil {
+		return nil, errors.New("npy: no descr in the header")
+	}
+	switch string(m[1]) {
+	case "<f4":
+		nr.valueSize = 4
+	case "<f8":
+		nr.valueSize = 8
+	default:
+		return nil, fmt.Errorf("npy: unsupported dtype %s, only <f4 and <f8 are", m[1])
+	}
+	if m := npyFortranPattern.FindSubmatch(header); m == nil || string(m[1]) != "False" {
+		return nil, errors.New("npy: the array must be in C order")
+	}
+	m = npyShapePattern.FindSubmatch(header)
+	if m == nil {
+		return nil, errors.New("npy: no shape in the header")
+	}
+	shape := []int{}
+	for _, s := range strings.Split(string(m[1]), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("npy: invalid shape %s", m[1])
+		}
+		shape = append(shape, n)
+	}
+	switch {
+	case len(shape) == 1 && shape[0] == Dim:
+		nr.count = 1
+	case len(shape) == 2 && shape[1] == Dim:
+		nr.count = shape[0]
+	default:
+		return nil, fmt.Errorf("npy: the shape must be (N, %d), not (%s)", Dim, m[1])
+	}
+	nr.buf = make([]byte, nr.valueSize*Dim)
+	return nr, nil
+}
+
+// Len returns the number of vectors in the file.
+func (nr *NpyReader) Len() int {
+	return nr.count
+}
+
+func (nr *NpyReader) Next() (Record, error) {
+	var rec Record
+	if nr.read >= nr.count {
+		return rec, io.EOF
+	}
+	if _, err := io.ReadFull(nr.r, nr.buf); err != nil {
+		return rec, fmt.Errorf("npy: vector %d: %v", nr.read, err)
+	}
+	decodeFloats(nr.buf, nr.valueSize, rec.Vals[:])
+	nr.read += 1
+	return rec, nil
+}
+
+// Skip discards the next n vectors without decoding them.
+func (nr *NpyReader) Skip(n int) error {
+	if n > nr.count-nr.read {
+		n = nr.count - nr.read
+	}
+	if _, err := io.CopyN(ioutil.Discard, nr.r, int64(n*len(nr.buf))); err != nil {
+		return fmt.Errorf("npy: %v", err)
+	}
+	nr.read += n
+	return nil
+}
+
+func decodeFloats(b []byte, valueSize int, vals []float64) {
+	for i := range vals {
+		if valueSize == 4 {
+			vals[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:])))
+		} else {
+			vals[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[i*8:]))
+		}
+	}
+}
+
+// NpyWriter writes vectors as a .npy file of float32 or float64 with the shape (N, 512).
+// The number of vectors has to be known up front since it is in the header,
+// unless the file can be seeked back to rewrite the header (see NewNpyFileWriter).
+type NpyWriter struct {
+	w          *bufio.Writer
+	ws         io.WriteSeeker
+	descr      string
+	headerSize int
+	valueSize  int
+	count      int
+	written    int
+	buf        []byte
+}
+
+// npyMaxCountDigits is the room kept in the header of NewNpyFileWriter for the number of vectors.
+const npyMaxCountDigits = 20
+
+// npyHeader returns the magic, the version, the header length and the header of the array.
+// The header ends with a newline and is padded with spaces so that the whole is size bytes long,
+// or a multiple of 64 bytes when size is 0.
+func npyHeader(descr string, count string, size int) []byte {
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s, %d), }", descr, count, Dim)
+	preamble := len(npyMagic) + 4
+	pad := size - (preamble + len(header) + 1)
+	if size == 0 {
+		pad = 64 - (preamble+len(header)+1)%64
+		if pad == 64 {
+			pad = 0
+		}
+	}
+	header += strings.Repeat(" ", pad) + "\n"
+	b := append([]byte{}, npyMagic...)
+	b = append(b, 1, 0)
+	b = append(b, byte(len(header)), byte(len(header)>>8))
+	return append(b, header...)
+}
+
+func newNpyWriter(w io.Writer, count int, useFloat32 bool) *NpyWriter {
+	nw := &NpyWriter{w: bufio.NewWriterSize(w, 1024*1024), descr: "<f8", valueSize: 8, count: count}
+	if useFloat32 {
+		nw.descr = "<f4"
+		nw.valueSize = 4
+	}
+	nw.buf = make([]byte, nw.valueSize*Dim)
+	return nw
+}
+
+func NewNpyWriter(w io.Writer, count int, useFloat32 bool) (*NpyWriter, error) {
+	nw := newNpyWriter(w, count, useFloat32)
+	if _, err := nw.w.Write(npyHeader(nw.descr, strconv.Itoa(count), 0)); err != nil {
+		return nil, err
+	}
+	return nw, nil
+}
+
+// NewNpyFileWriter writes any number of vectors to a file.
+// Room for the number is kept in the header, which is rewritten on Close.
+func NewNpyFileWriter(ws io.WriteSeeker, useFloat32 bool) (*NpyWriter, error) {
+	nw := newNpyWriter(ws, -1, useFloat32)
+	nw.ws = ws
+	header := npyHeader(nw.descr, strings.Repeat("0", npyMaxCountDigits), 0)
+	nw.headerSize = len(header)
+	if _, err := nw.w.Write(header); err != nil {
+		return nil, err
+	}
+	return nw, nil
+}
+
+func (nw *NpyWriter) Write(vals []float64) error {
+	if nw.count >= 0 && nw.written >= nw.count {
+		return errors.New("npy: more vectors than the header says")
+	}
+	if len(vals) != Dim {
+		return fmt.Errorf("npy: the vector has %d values, not %d", len(vals), Dim)
+	}
+	for i, v := range vals {
+		if nw.valueSize == 4 {
+			binary.LittleEndian.PutUint32(nw.buf[i*4:], math.Float32bits(float32(v)))
+		} else {
+			binary.LittleEndian.PutUint64(nw.buf[i*8:], math.Float64bits(v))
+		}
+	}
+	nw.written += 1
+	_, err := nw.w.Write(nw.buf)
+	return err
+}
+
+// Close flushes the buffer. It fails when fewer vectors than the header says were written.
+// A writer of NewNpyFileWriter writes the number of vectors into the header instead.
+func (nw *NpyWriter) Close() error {
+	if err := nw.w.Flush(); err != nil {
+		return err
+	}
+	if nw.ws != nil {
+		if _, err := nw.ws.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := nw.ws.Write(npyHeader(nw.descr, strconv.Itoa(nw.written), nw.headerSize))
+		return err
+	}
+	if nw.written != nw.count {
+		return fmt.Errorf("npy: %d vectors were written but the header says %d", nw.written, nw.count)
+	}
+	return nil
+}
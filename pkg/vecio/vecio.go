@@ -0,0 +1,119 @@
+// Package vecio reads and writes the vectors of data points in the file formats
+// which the featuredb command accepts.
+package vecio
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Dim is the dimension of every vector in feature-search-db.
+const Dim = 512
+
+// Record is a vector with an optional external ID and metadata.
+type Record struct {
+	ID   string            `json:"id,omitempty"`
+	Vals [Dim]float64      `json:"vals"`
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+// Reader reads records one by one. Next returns io.EOF after the last record.
+type Reader interface {
+	Next() (Record, error)
+}
+
+// TextReader reads one vector per line. A line is either a JSON array of numbers,
+// a JSON object like {"id": "...", "vals": [...], "meta": {...}},
+// or numbers separated by commas or white spaces.
+// Empty lines and lines starting with # are skipped.
+type TextReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewTextReader(r io.Reader) *TextReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &TextReader{scanner: scanner}
+}
+
+func (tr *TextReader) Next() (Record, error) {
+	for tr.scanner.Scan() {
+		tr.line += 1
+		line := strings.TrimSpace(tr.scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rec, err := parseLine(line)
+		if err != nil {
+			return Record{}, fmt.Errorf("line %d: %v", tr.line, err)
+		}
+		return rec, nil
+	}
+	if err := tr.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+func parseLine(line string) (Record, error) {
+	var rec Record
+	var vals []float64
+	switch line[0] {
+	case '[':
+		if err := json.Unmarshal([]byte(line), &vals); err != nil {
+			return rec, err
+		}
+	case '{':
+		var obj struct {
+			ID         string            `json:"id"`
+			ExternalID string            `json:"externalID"`
+			Vals       []float64         `json:"vals"`
+			Meta       map[string]string `json:"meta"`
+		}
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			return rec, err
+		}
+		rec.ID, rec.Meta, vals = obj.ID, obj.Meta, obj.Vals
+		// Exports of feature groups have "externalID" instead.
+		if rec.ID == "" {
+			rec.ID = obj.ExternalID
+		}
+	default:
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		vals = make([]float64, 0, len(fields))
+		for _, f := range fields {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return rec, err
+			}
+			vals = append(vals, v)
+		}
+	}
+	if len(vals) != Dim {
+		return rec, fmt.Errorf("the vector has %d values, not %d", len(vals), Dim)
+	}
+	copy(rec.Vals[:], vals)
+	return rec, nil
+}
+
+// ReadAll reads every record of r.
+func ReadAll(r Reader) ([]Record, error) {
+	recs := []Record{}
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return recs, err
+		}
+		recs = append(recs, rec)
+	}
+}
@@ -0,0 +1,239 @@
+package vecio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTextReader(t *testing.T) {
+	t.Run("it reads every line format successfully", testTextReader_formats)
+	t.Run("it reports the line of a bad vector", testTextReader_invalid)
+}
+
+func numbers(sep string, v string) string {
+	vals := make([]string, Dim)
+	for i := range vals {
+		vals[i] = v
+	}
+	return strings.Join(vals, sep)
+}
+
+func testTextReader_formats(t *testing.T) {
+	// prepare
+	input := strings.Join([]string{
+		"# comment",
+		"[" + numbers(",", "1") + "]",
+		"",
+		`{"id": "x", "vals": [` + numbers(",", "2") + `], "meta": {"k": "v"}}`,
+		numbers(" ", "3"),
+		numbers(", ", "4.5"),
+	}, "\n")
+
+	// exec
+	recs, err := ReadAll(NewTextReader(strings.NewReader(input)))
+
+	// assert
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if len(recs) != 4 {
+		t.Fatalf("fail. number of records not match. %d", len(recs))
+	}
+	for i, want := range []float64{1, 2, 3, 4.5} {
+		if recs[i].Vals[0] != want || recs[i].Vals[Dim-1] != want {
+			t.Fatalf("fail. values of record %d not match. %v", i, recs[i].Vals[0])
+		}
+	}
+	if recs[1].ID != "x" || recs[1].Meta["k"] != "v" {
+		t.Fatalf("fail. id or meta not match. %+v", recs[1].Meta)
+	}
+}
+
+func testTextReader_invalid(t *testing.T) {
+	// prepare
+	r := NewTextReader(strings.NewReader("[" + numbers(",", "1") + "]\n[1, 2]\n"))
+
+	// exec
+	_, err1 := r.Next()
+	_, err2 := r.Next()
+
+	// assert
+	if err1 != nil {
+		t.Fatalf("fail. %v", err1)
+	}
+	if err2 == nil || err2 == io.EOF || !strings.HasPrefix(err2.Error(), "line 2:") {
+		t.Fatalf("fail. error not match. %v", err2)
+	}
+}
+
+func TestBinaryReaders(t *testing.T) {
+	t.Run("it reads what NpyWriter wrote successfully", testNpy_roundTrip)
+	t.Run("it rewrites the count of NpyFileWriter successfully", testNpyFile_count)
+	t.Run("it reads fvecs and bvecs successfully", testVecs_read)
+	t.Run("it skips records successfully", testSkip)
+	t.Run("it rejects a huge npy header", testNpy_hugeHeader)
+}
+
+func testVectors(n int) [][Dim]float64 {
+	vecs := make([][Dim]float64, n)
+	for i := range vecs {
+		for j := range vecs[i] {
+			vecs[i][j] = float64(i) + float64(j%8)/4
+		}
+	}
+	return vecs
+}
+
+func testNpy_roundTrip(t *testing.T) {
+	vecs := testVectors(3)
+	for _, useFloat32 := range []bool{false, true} {
+		// prepare
+		buf := bytes.NewBuffer(nil)
+		nw, err := NewNpyWriter(buf, len(vecs), useFloat32)
+		if err != nil {
+			t.Fatalf("fail. %v", err)
+		}
+		for i := range vecs {
+			nw.Write(vecs[i][:])
+		}
+		if err := nw.Close(); err != nil {
+			t.Fatalf("fail. %v", err)
+		}
+		if (buf.Len()-len(vecs)*Dim*nw.valueSize)%64 != 0 {
+			t.Fatalf("fail. header is not aligned. %d", buf.Len())
+		}
+
+		// exec
+		r, err := NewReader(FormatNpy, buf)
+		if err != nil {
+			t.Fatalf("fail. %v", err)
+		}
+		recs, err := ReadAll(r)
+
+		// assert
+		if err != nil || len(recs) != len(vecs) {
+			t.Fatalf("fail. number of records not match. %d %v", len(recs), err)
+		}
+		for i := range recs {
+			if recs[i].Vals != vecs[i] {
+				t.Fatalf("fail. vector %d not match (float32=%v)", i, useFloat32)
+			}
+		}
+	}
+}
+
+func testNpyFile_count(t *testing.T) {
+	// prepare
+	vecs := testVectors(5)
+	f, err := ioutil.TempFile("", "vecio")
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	nw, err := NewNpyFileWriter(f, true)
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+
+	// exec
+	for i := range vecs {
+		if err := nw.Write(vecs[i][:]); err != nil {
+			t.Fatalf("fail. %v", err)
+		}
+	}
+	if err := nw.Close(); err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+
+	// assert
+	f.Seek(0, io.SeekStart)
+	r, err := NewNpyReader(f)
+	if err != nil {
+		t.Fatalf("fail. %v", err)
+	}
+	if r.Len() != len(vecs) {
+		t.Fatalf("fail. count not match. %d", r.Len())
+	}
+	recs, err := ReadAll(r)
+	if err != nil || len(recs) != len(vecs) || recs[4].Vals != vecs[4] {
+		t.Fatalf("fail. records not match. %d %v", len(recs), err)
+	}
+}
+
+func vecsFile(vecs [][Dim]float64, bvecs bool) []byte {
+	buf := bytes.NewBuffer(nil)
+	for _, vec := range vecs {
+		binary.Write(buf, binary.LittleEndian, int32(Dim))
+		for _, v := range vec {
+			if bvecs {
+				buf.WriteByte(byte(v))
+			} else {
+				binary.Write(buf, binary.LittleEndian, float32(v))
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+func testVecs_read(t *testing.T) {
+	// prepare
+	vecs := testVectors(2)
+	for i := range vecs[1] {
+		vecs[1][i] = float64(i % 256)
+	}
+
+	for _, format := range []string{FormatFvecs, FormatBvecs} {
+		// exec
+		r, _ := NewReader(format, bytes.NewReader(vecsFile(vecs, format == FormatBvecs)))
+		recs, err := ReadAll(r)
+
+		// assert
+		if err != nil || len(recs) != 2 {
+			t.Fatalf("fail. number of records not match. %d %v", len(recs), err)
+		}
+		if recs[1].Vals != vecs[1] {
+			t.Fatalf("fail. vector not match (%s)", format)
+		}
+	}
+}
+
+func testSkip(t *testing.T) {
+	// prepare
+	vecs := testVectors(4)
+	r, _ := NewReader(FormatFvecs, bytes.NewReader(vecsFile(vecs, false)))
+
+	// exec
+	err := Skip(r, 3)
+	rec, err2 := r.Next()
+	_, err3 := r.Next()
+
+	// assert
+	if err != nil || err2 != nil {
+		t.Fatalf("fail. %v %v", err, err2)
+	}
+	if rec.Vals != vecs[3] {
+		t.Fatalf("fail. vector not match. %v", rec.Vals[0])
+	}
+	if err3 != io.EOF {
+		t.Fatalf("fail. EOF is expected. %v", err3)
+	}
+}
+
+func testNpy_hugeHeader(t *testing.T) {
+	// prepare
+	header := append([]byte("\x93NUMPY\x02\x00"), 0xff, 0xff, 0xff, 0xff)
+
+	// exec
+	_, err := NewNpyReader(bytes.NewReader(header))
+
+	// assert
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("fail. huge header not rejected. %v", err)
+	}
+}